@@ -3,6 +3,7 @@ module github.com/terra-farm/terraform-provider-xenserver
 go 1.14
 
 require (
-	github.com/hashicorp/terraform-plugin-sdk v1.7.0
+	github.com/amfranz/go-xmlrpc-client v0.0.0-20190612172737-76858463955d
+	github.com/hashicorp/terraform-plugin-sdk/v2 v2.0.0
 	github.com/terra-farm/go-xen-api-client v0.0.0-20200621191037-f05e7ce3c3b8
 )
@@ -0,0 +1,383 @@
+package xenserver
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+// auditLog records the XenAPI calls which modify the pool, so that the
+// operations performed by a run can be reviewed afterwards. The generated
+// client offers no hook for this, so the calls are captured at the HTTP level
+// by an observedTransport.
+//
+// The log is written as a whole after every operation, the file is only
+// created once the first operation has been recorded. A plan therefore leaves
+// the log of the previous apply in place.
+type auditLog struct {
+	path string
+
+	mutex      sync.Mutex
+	operations []*auditOperation
+}
+
+type auditOperation struct {
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	ObjectRef  string    `json:"object_ref,omitempty"`
+	ObjectUUID string    `json:"object_uuid,omitempty"`
+	Task       string    `json:"task,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	Result     string    `json:"result"`
+	Error      string    `json:"error,omitempty"`
+}
+
+const (
+	auditResultSuccess = "success"
+	auditResultFailure = "failure"
+	auditResultPending = "pending"
+)
+
+func newAuditLog(path string) *auditLog {
+	if path == "" {
+		return nil
+	}
+
+	return &auditLog{
+		path:       path,
+		operations: make([]*auditOperation, 0),
+	}
+}
+
+func (a *auditLog) record(op *auditOperation) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.operations = append(a.operations, op)
+	a.write()
+}
+
+// finishTask completes the operation which started the asynchronous task, its
+// duration then covers the whole task instead of just the call starting it.
+func (a *auditLog) finishTask(task xenapi.TaskRef, err error) {
+	if a == nil {
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for _, op := range a.operations {
+		if op.Task != string(task) || op.Result != auditResultPending {
+			continue
+		}
+
+		op.DurationMS = time.Since(op.Time).Nanoseconds() / int64(time.Millisecond)
+		op.Result = auditResultSuccess
+		if err != nil {
+			op.Result = auditResultFailure
+			op.Error = err.Error()
+		}
+	}
+
+	a.write()
+}
+
+// write replaces the log file, a failure to do so does not fail the run.
+func (a *auditLog) write() {
+	data, err := json.MarshalIndent(map[string]interface{}{
+		"operations": a.operations,
+	}, "", "  ")
+	if err != nil {
+		log.Println("[ERROR] ", err)
+		return
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(a.path), filepath.Base(a.path)+".")
+	if err != nil {
+		log.Println("[ERROR] Failed to write audit log: ", err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		log.Println("[ERROR] Failed to write audit log: ", err)
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		log.Println("[ERROR] Failed to write audit log: ", err)
+		return
+	}
+
+	if err := os.Rename(tmp.Name(), a.path); err != nil {
+		log.Println("[ERROR] Failed to write audit log: ", err)
+	}
+}
+
+// observedTransport passes all requests on to next. Requests which modify the
+// pool invalidate the record cache and are recorded in the audit log. It is
+// registered as the handler of the http and https protocols of the transport
+// used by the XenAPI client.
+type observedTransport struct {
+	audit *auditLog
+	cache *recordCache
+	url   string
+	next  *http.Transport
+
+	once     sync.Once
+	resolver *xenapi.Client
+}
+
+// newObservedTransport returns a transport which passes all requests through an
+// observedTransport on to transport, if auditing or the record cache is
+// enabled. The XenAPI client requires an *http.Transport, so the
+// observedTransport is registered as the handler of the http and https
+// protocols.
+func newObservedTransport(transport *http.Transport, url string, audit *auditLog, cache *recordCache) *http.Transport {
+	if audit == nil && cache == nil {
+		return transport
+	}
+
+	ot := &observedTransport{
+		audit: audit,
+		cache: cache,
+		url:   url,
+		next:  transport,
+	}
+
+	observed := &http.Transport{
+		// Keeps HTTP/2 from claiming the https protocol
+		TLSNextProto: map[string]func(string, *tls.Conn) http.RoundTripper{},
+	}
+	observed.RegisterProtocol("http", ot)
+	observed.RegisterProtocol("https", ot)
+
+	return observed
+}
+
+// XML-RPC requests and responses, as far as they are relevant to the audit log
+type xmlrpcValue struct {
+	Raw    string        `xml:",chardata"`
+	String *string       `xml:"string"`
+	Array  []xmlrpcValue `xml:"array>data>value"`
+}
+
+func (v xmlrpcValue) text() string {
+	if v.String != nil {
+		return *v.String
+	}
+	return strings.TrimSpace(v.Raw)
+}
+
+type xmlrpcCall struct {
+	MethodName string        `xml:"methodName"`
+	Params     []xmlrpcValue `xml:"params>param>value"`
+}
+
+type xmlrpcResponse struct {
+	Members []struct {
+		Name  string      `xml:"name"`
+		Value xmlrpcValue `xml:"value"`
+	} `xml:"params>param>value>struct>member"`
+}
+
+func (t *observedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// HTTP handlers such as the VDI import carry the object in the query
+	if req.Method == http.MethodPut {
+		return t.roundTripHandler(req)
+	}
+	if req.Method != http.MethodPost || req.Body == nil {
+		return t.next.RoundTrip(req)
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	var call xmlrpcCall
+	if err := xml.Unmarshal(body, &call); err != nil || !isMutatingMethod(call.MethodName) {
+		return t.next.RoundTrip(req)
+	}
+
+	// Also after the call, records might have been fetched while it was running
+	t.cache.invalidate()
+	defer t.cache.invalidate()
+
+	if t.audit == nil {
+		return t.next.RoundTrip(req)
+	}
+
+	op := &auditOperation{
+		Time:   time.Now().UTC(),
+		Method: call.MethodName,
+	}
+
+	// The first parameter is the session, followed by the object operated on
+	var session string
+	if len(call.Params) > 0 {
+		session = call.Params[0].text()
+	}
+	if len(call.Params) > 1 {
+		if ref := call.Params[1].text(); strings.HasPrefix(ref, "OpaqueRef:") {
+			op.ObjectRef = ref
+			op.ObjectUUID = t.resolveUUID(session, call.MethodName, ref)
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	op.DurationMS = time.Since(op.Time).Nanoseconds() / int64(time.Millisecond)
+	if err != nil {
+		op.Result = auditResultFailure
+		op.Error = err.Error()
+		t.audit.record(op)
+		return nil, err
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	var result xmlrpcResponse
+	if err := xml.Unmarshal(respBody, &result); err != nil {
+		op.Result = auditResultFailure
+		op.Error = err.Error()
+		t.audit.record(op)
+		return resp, nil
+	}
+
+	op.Result = auditResultFailure
+	for _, member := range result.Members {
+		switch member.Name {
+		case "Status":
+			if member.Value.text() == "Success" {
+				op.Result = auditResultSuccess
+			}
+		case "Value":
+			value := member.Value.text()
+			if !strings.HasPrefix(value, "OpaqueRef:") {
+				break
+			}
+			if strings.HasPrefix(call.MethodName, "Async.") {
+				op.Task = value
+			} else if op.ObjectRef == "" {
+				// Objects which have been created
+				op.ObjectRef = value
+				op.ObjectUUID = t.resolveUUID(session, call.MethodName, value)
+			}
+		case "ErrorDescription":
+			details := make([]string, 0, len(member.Value.Array))
+			for _, detail := range member.Value.Array {
+				details = append(details, detail.text())
+			}
+			op.Error = strings.Join(details, ", ")
+		}
+	}
+
+	// Completed by finishTask
+	if op.Task != "" && op.Result == auditResultSuccess {
+		op.Result = auditResultPending
+	}
+
+	t.audit.record(op)
+	return resp, nil
+}
+
+func (t *observedTransport) roundTripHandler(req *http.Request) (*http.Response, error) {
+	t.cache.invalidate()
+	defer t.cache.invalidate()
+
+	if t.audit == nil {
+		return t.next.RoundTrip(req)
+	}
+
+	op := &auditOperation{
+		Time:      time.Now().UTC(),
+		Method:    req.Method + " " + req.URL.Path,
+		ObjectRef: req.URL.Query().Get("vdi"),
+	}
+	if op.ObjectRef != "" {
+		op.ObjectUUID = t.resolveUUID(req.URL.Query().Get("session_id"), "VDI.import", op.ObjectRef)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	op.DurationMS = time.Since(op.Time).Nanoseconds() / int64(time.Millisecond)
+
+	switch {
+	case err != nil:
+		op.Result = auditResultFailure
+		op.Error = err.Error()
+	case resp.StatusCode != http.StatusOK:
+		op.Result = auditResultFailure
+		op.Error = resp.Status
+	default:
+		op.Result = auditResultSuccess
+	}
+
+	t.audit.record(op)
+	return resp, err
+}
+
+// resolveUUID looks up the UUID of the object ref of the class method belongs
+// to. This bypasses the observedTransport, an object which can not be resolved is recorded
+// with its reference only.
+func (t *observedTransport) resolveUUID(session, method, ref string) string {
+	t.once.Do(func() {
+		var err error
+		if t.resolver, err = xenapi.NewClient(t.url, t.next); err != nil {
+			log.Println("[ERROR] ", err)
+		}
+	})
+	if t.resolver == nil {
+		return ""
+	}
+
+	class := strings.SplitN(strings.TrimPrefix(method, "Async."), ".", 2)[0]
+	result, err := t.resolver.APICall(class+".get_uuid", session, ref)
+	if err != nil {
+		log.Printf("[DEBUG] Failed to resolve UUID of %s %s: %s", class, ref, err)
+		return ""
+	}
+
+	uuid, _ := result.Value.(string)
+	return uuid
+}
+
+// isMutatingMethod reports whether the XenAPI method modifies the pool. Reads,
+// checks, session handling and task polling are left out.
+func isMutatingMethod(method string) bool {
+	parts := strings.SplitN(strings.TrimPrefix(method, "Async."), ".", 2)
+	if len(parts) != 2 {
+		return false
+	}
+
+	switch parts[0] {
+	case "session", "event", "task":
+		return false
+	}
+
+	for _, prefix := range []string{"get_", "assert_", "precheck"} {
+		if strings.HasPrefix(parts[1], prefix) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -1,6 +1,20 @@
 package xenserver
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
 	xenapi "github.com/terra-farm/go-xen-api-client"
 )
 
@@ -9,25 +23,493 @@ type Config struct {
 	URL      string
 	Username string
 	Password string
+
+	// TLS verification of the XenServer host certificate
+	Insecure      bool
+	CACertFile    string
+	CACertPEM     string
+	TLSServerName string
+
+	// Takes precedence over the TLS settings above when set
+	tlsConfig *tls.Config
+
+	// Degrades failures to refresh resources to warnings
+	TolerateReadErrors bool
+
+	// Path of the JSON file the XenAPI calls modifying the pool are recorded in
+	AuditLog string
+
+	// Serves lookups from the records of all objects of a class while refreshing
+	RecordCache bool
+
+	// UUIDs of the SR and network used by resources which do not name one
+	DefaultSR      string
+	DefaultNetwork string
+
+	// Storage operations run in parallel per SR, unlimited if not positive
+	SROperationParallelism int
+
+	// Fails lookups by name label which match several objects
+	FailOnDuplicateNames bool
+
+	// Time to establish a network connection, including the TLS handshake
+	ConnectionTimeout time.Duration
 }
 
 // Connection ...
 type Connection struct {
 	client  *xenapi.Client
 	session xenapi.SessionRef
+
+	// Used for the HTTP handlers of XenServer which are not part of the XenAPI,
+	// e.g. VDI import and export
+	url       string
+	transport *http.Transport
+
+	// Cancelling the context aborts all XenAPI calls in flight on this connection
+	ctx               context.Context
+	tlsConfig         *tls.Config
+	connectionTimeout time.Duration
+
+	tolerateReadErrors   bool
+	audit                *auditLog
+	records              *recordCache
+	defaultSR            string
+	defaultNetwork       string
+	srOperations         *srOperations
+	failOnDuplicateNames bool
+
+	// Captured by the preflight checks on login
+	apiVersionMajor int
+	apiVersionMinor int
+	softwareVersion map[string]string
+	poolName        string
+}
+
+// Time granted to clean up after an operation which has been aborted
+const cleanupTimeout = time.Minute
+
+// Time to establish a network connection unless configured otherwise
+const defaultConnectionTimeout = 30 * time.Second
+
+const (
+	// XenServer 6.2 and newer
+	minAPIVersionMajor = 2
+	minAPIVersionMinor = 1
+)
+
+// Permissions a session needs at the very least to manage VMs, as granted by
+// the vm-admin role
+var requiredPermissions = []string{
+	"vm.create",
+	"vm.destroy",
+	"vm.clone",
 }
 
 // NewConnection ...
-func (cfg *Config) NewConnection() (*Connection, error) {
-	client, err := xenapi.NewClient(cfg.URL, nil)
+func (cfg *Config) NewConnection(ctx context.Context) (*Connection, error) {
+	tlsConfig, err := cfg.loadTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	endpoint, err := parseURL(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	audit := newAuditLog(cfg.AuditLog)
+	records := newRecordCache(cfg.RecordCache)
+	transport := newObservedTransport(newCancelableTransport(ctx, tlsConfig, cfg.ConnectionTimeout), endpoint, audit, records)
+
+	client, err := xenapi.NewClient(endpoint, transport)
 	if err != nil {
 		return nil, err
 	}
 
 	session, err := client.Session.LoginWithPassword(cfg.Username, cfg.Password, "1.0", "terraform")
+
+	// Pool members refuse logins and tell the address of their master instead,
+	// e.g. once they joined a pool through xenserver_pool_join
+	if xenErr, ok := err.(*xenapi.Error); ok && xenErr.Code() == xenapi.ERR_HOST_IS_SLAVE && xenErr.Type() != "" {
+		member := endpoint
+		if endpoint, err = masterURL(endpoint, xenErr.Type()); err != nil {
+			return nil, err
+		}
+		log.Printf("[INFO] %s is a pool member, logging in to the pool master %s instead", member, endpoint)
+
+		// The server name override refers to the member, not to the master
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName = ""
+
+		transport = newObservedTransport(newCancelableTransport(ctx, tlsConfig, cfg.ConnectionTimeout), endpoint, audit, records)
+		if client, err = xenapi.NewClient(endpoint, transport); err != nil {
+			return nil, err
+		}
+
+		session, err = client.Session.LoginWithPassword(cfg.Username, cfg.Password, "1.0", "terraform")
+	}
 	if err != nil {
+		return nil, fmt.Errorf("login to %s as %q failed: %s", endpoint, cfg.Username, err)
+	}
+
+	c := &Connection{
+		client:            client,
+		session:           session,
+		url:               endpoint,
+		transport:         transport,
+		ctx:               ctx,
+		tlsConfig:         tlsConfig,
+		connectionTimeout: cfg.ConnectionTimeout,
+
+		tolerateReadErrors:   cfg.TolerateReadErrors,
+		audit:                audit,
+		records:              records,
+		defaultSR:            cfg.DefaultSR,
+		defaultNetwork:       cfg.DefaultNetwork,
+		srOperations:         newSROperations(cfg.SROperationParallelism),
+		failOnDuplicateNames: cfg.FailOnDuplicateNames,
+	}
+
+	if err := c.preflight(); err != nil {
+		if logoutErr := client.Session.Logout(session); logoutErr != nil {
+			log.Println("[ERROR] ", logoutErr)
+		}
 		return nil, err
 	}
 
-	return &Connection{client, session}, nil
+	return c, nil
+}
+
+// parseURL validates the URL of the XenAPI endpoint and normalizes it. The
+// scheme defaults to https, and IPv6 addresses are enclosed in brackets unless
+// they are already, so that "fd00::1" becomes "https://[fd00::1]". Zones of
+// link-local addresses may be given unescaped, e.g. "[fe80::1%eth0]".
+func parseURL(rawURL string) (string, error) {
+	if rawURL == "" {
+		return "", fmt.Errorf("no URL of the XenAPI endpoint configured")
+	}
+
+	scheme, rest := "https", rawURL
+	if i := strings.Index(rawURL, "://"); i >= 0 {
+		scheme, rest = strings.ToLower(rawURL[:i]), rawURL[i+3:]
+	}
+
+	if scheme != "http" && scheme != "https" {
+		return "", fmt.Errorf("unsupported scheme %q of URL %q, use http or https", scheme, rawURL)
+	}
+
+	host, path := rest, ""
+	if i := strings.Index(rest, "/"); i >= 0 {
+		host, path = rest[:i], rest[i:]
+	}
+
+	// The colons of a bare IPv6 address would be taken for a port
+	if ip := strings.SplitN(host, "%", 2)[0]; strings.Contains(ip, ":") && net.ParseIP(ip) != nil {
+		host = "[" + host + "]"
+	}
+
+	if strings.Contains(host, "%") && !strings.Contains(host, "%25") {
+		host = strings.Replace(host, "%", "%25", 1)
+	}
+
+	u, err := url.Parse(scheme + "://" + host + path)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL %q: %s", rawURL, err)
+	}
+
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("URL %q has no host", rawURL)
+	}
+
+	if port := u.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return "", fmt.Errorf("invalid port %q in URL %q", port, rawURL)
+		}
+	}
+
+	return u.String(), nil
+}
+
+// masterURL returns the URL of the XenAPI endpoint of the pool master at
+// address, reached the same way as the pool member at endpoint, i.e. with the
+// same scheme and port.
+func masterURL(endpoint, address string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	u.Host = urlHost(address, u.Port())
+	return u.String(), nil
+}
+
+// urlHost returns the host part of a URL to reach the host at address, an IP
+// address or a host name, on port, which may be empty for the default port.
+func urlHost(address, port string) string {
+	if port != "" {
+		return net.JoinHostPort(address, port)
+	}
+
+	if strings.Contains(address, ":") {
+		return "[" + address + "]"
+	}
+
+	return address
+}
+
+// loadTLSConfig builds the TLS configuration used to verify the certificate of
+// the XenServer host. Without a custom CA the system roots are used.
+func (cfg *Config) loadTLSConfig() (*tls.Config, error) {
+	if cfg.tlsConfig != nil {
+		return cfg.tlsConfig, nil
+	}
+
+	// Configuring how to verify the certificate implies verifying it
+	verify := !cfg.Insecure || cfg.CACertFile != "" || cfg.CACertPEM != "" || cfg.TLSServerName != ""
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: !verify,
+		ServerName:         cfg.TLSServerName,
+	}
+
+	caCertPEM := []byte(cfg.CACertPEM)
+	if cfg.CACertFile != "" {
+		var err error
+		if caCertPEM, err = ioutil.ReadFile(cfg.CACertFile); err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %s", err)
+		}
+	}
+
+	if len(caCertPEM) > 0 {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCertPEM) {
+			return nil, fmt.Errorf("no valid PEM encoded CA certificate found")
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// preflight verifies that the session is allowed to manage VMs and that the
+// XenAPI version is supported, so that misconfiguration is reported up front
+// instead of by the first resource operation.
+func (c *Connection) preflight() error {
+	username, err := c.client.Session.GetAuthUserName(c.session, c.session)
+	if err != nil {
+		return err
+	}
+
+	isSuperuser, err := c.client.Session.GetIsLocalSuperuser(c.session, c.session)
+	if err != nil {
+		return err
+	}
+
+	if !isSuperuser {
+		permissions, err := c.client.Session.GetRbacPermissions(c.session, c.session)
+		if err != nil {
+			return err
+		}
+
+		granted := make(map[string]bool, len(permissions))
+		for _, permission := range permissions {
+			granted[strings.ToLower(permission)] = true
+		}
+
+		for _, permission := range requiredPermissions {
+			if !granted[permission] {
+				return fmt.Errorf("user %q lacks permission %q, a role of at least vm-admin is required", username, permission)
+			}
+		}
+	}
+
+	host, err := c.client.Session.GetThisHost(c.session, c.session)
+	if err != nil {
+		return err
+	}
+
+	if c.apiVersionMajor, err = c.client.Host.GetAPIVersionMajor(c.session, host); err != nil {
+		return err
+	}
+
+	if c.apiVersionMinor, err = c.client.Host.GetAPIVersionMinor(c.session, host); err != nil {
+		return err
+	}
+
+	if c.softwareVersion, err = c.client.Host.GetSoftwareVersion(c.session, host); err != nil {
+		return err
+	}
+
+	pools, err := c.client.Pool.GetAll(c.session)
+	if err != nil {
+		return err
+	}
+
+	if len(pools) > 0 {
+		if c.poolName, err = c.client.Pool.GetNameLabel(c.session, pools[0]); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("[INFO] Connected to %s %s (xapi %s, API version %d.%d) as %q",
+		c.softwareVersion["product_brand"], c.softwareVersion["product_version"], c.softwareVersion["xapi"],
+		c.apiVersionMajor, c.apiVersionMinor, username)
+
+	if c.apiVersionMajor < minAPIVersionMajor ||
+		(c.apiVersionMajor == minAPIVersionMajor && c.apiVersionMinor < minAPIVersionMinor) {
+		return fmt.Errorf("XenAPI version %d.%d of %s is not supported, at least %d.%d is required",
+			c.apiVersionMajor, c.apiVersionMinor, c.url, minAPIVersionMajor, minAPIVersionMinor)
+	}
+
+	return nil
+}
+
+// Close logs out the session of the connection.
+func (c *Connection) Close() error {
+	return c.client.Session.Logout(c.session)
+}
+
+// WithContext returns a connection sharing the session of c whose XenAPI calls
+// are aborted once ctx is done.
+func (c *Connection) WithContext(ctx context.Context) (*Connection, error) {
+	transport := newObservedTransport(newCancelableTransport(ctx, c.tlsConfig, c.connectionTimeout), c.url, c.audit, c.records)
+
+	client, err := xenapi.NewClient(c.url, transport)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Connection{
+		client:               client,
+		session:              c.session,
+		url:                  c.url,
+		transport:            transport,
+		ctx:                  ctx,
+		tlsConfig:            c.tlsConfig,
+		connectionTimeout:    c.connectionTimeout,
+		tolerateReadErrors:   c.tolerateReadErrors,
+		audit:                c.audit,
+		records:              c.records,
+		defaultSR:            c.defaultSR,
+		defaultNetwork:       c.defaultNetwork,
+		srOperations:         c.srOperations,
+		failOnDuplicateNames: c.failOnDuplicateNames,
+		apiVersionMajor:      c.apiVersionMajor,
+		apiVersionMinor:      c.apiVersionMinor,
+		softwareVersion:      c.softwareVersion,
+		poolName:             c.poolName,
+	}, nil
+}
+
+// WithTimeout returns a connection sharing the session of c whose XenAPI calls
+// are aborted after timeout or once c is cancelled. The returned function must
+// be called to release the resources of the connection.
+func (c *Connection) WithTimeout(timeout time.Duration) (*Connection, context.CancelFunc, error) {
+	ctx, cancel := context.WithTimeout(c.ctx, timeout)
+
+	conn, err := c.WithContext(ctx)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	return conn, cancel, nil
+}
+
+// forCleanup returns a connection sharing the session of c which is still
+// usable when the context of c is done, so that aborted operations can be
+// cleaned up. The returned function must be called to release its resources.
+func (c *Connection) forCleanup() (*Connection, context.CancelFunc, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+
+	conn, err := c.WithContext(ctx)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	return conn, cancel, nil
+}
+
+// newCancelableTransport returns a transport which closes all of its network
+// connections once ctx is done. The XenAPI client does not support contexts, so
+// this is what aborts requests which are in flight. Establishing a connection
+// fails after timeout, or the default timeout if it is not positive.
+func newCancelableTransport(ctx context.Context, tlsConfig *tls.Config, timeout time.Duration) *http.Transport {
+	if timeout <= 0 {
+		timeout = defaultConnectionTimeout
+	}
+
+	dialer := &cancelableDialer{
+		ctx:     ctx,
+		timeout: timeout,
+		conns:   make(map[net.Conn]struct{}),
+	}
+
+	go dialer.closeOnDone()
+
+	return &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: timeout,
+	}
+}
+
+type cancelableDialer struct {
+	ctx     context.Context
+	timeout time.Duration
+	mutex   sync.Mutex
+	conns   map[net.Conn]struct{}
+}
+
+func (d *cancelableDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if err := d.ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	dialer := net.Dialer{
+		Timeout:   d.timeout,
+		KeepAlive: 30 * time.Second,
+	}
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	// The context might have been cancelled while dialing
+	if err := d.ctx.Err(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	tracked := &trackedConn{Conn: conn, dialer: d}
+	d.conns[tracked] = struct{}{}
+
+	return tracked, nil
+}
+
+func (d *cancelableDialer) closeOnDone() {
+	<-d.ctx.Done()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for conn := range d.conns {
+		conn.(*trackedConn).Conn.Close()
+	}
+	d.conns = make(map[net.Conn]struct{})
+}
+
+type trackedConn struct {
+	net.Conn
+	dialer *cancelableDialer
+}
+
+func (c *trackedConn) Close() error {
+	c.dialer.mutex.Lock()
+	delete(c.dialer.conns, c)
+	c.dialer.mutex.Unlock()
+
+	return c.Conn.Close()
 }
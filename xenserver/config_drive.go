@@ -0,0 +1,101 @@
+package xenserver
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+const (
+	configDriveSchemaVolumeLabel = "volume_label"
+	configDriveSchemaFiles       = "files"
+	configDriveSchemaSRUUID      = "sr_uuid"
+
+	configDrivePurpose = "config_drive"
+
+	// Label cloud-init looks for with its NoCloud data source
+	configDriveDefaultVolumeLabel = "cidata"
+
+	// Ignition has no platform for Xen, the config is provided the way its
+	// OpenStack platform reads it from a config drive
+	ignitionPurpose     = "ignition"
+	ignitionVolumeLabel = "config-2"
+	ignitionUserData    = "openstack/latest/user_data"
+	ignitionMetaData    = "openstack/latest/meta_data.json"
+)
+
+func resourceConfigDrive() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			configDriveSchemaVolumeLabel: &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      configDriveDefaultVolumeLabel,
+				ValidateFunc: validation.StringLenBetween(1, 16),
+			},
+			configDriveSchemaFiles: &schema.Schema{
+				Type:     schema.TypeMap,
+				Required: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			configDriveSchemaSRUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateUUID,
+			},
+		},
+	}
+}
+
+// applyConfigDrive builds an ISO image holding the files of the config drive
+// and attaches it to the VM as CD, replacing the previous image if any.
+func applyConfigDrive(c *Connection, vm *VMDescriptor, data map[string]interface{}) error {
+	files := make(map[string][]byte)
+	for path, content := range data[configDriveSchemaFiles].(map[string]interface{}) {
+		files[path] = []byte(content.(string))
+	}
+
+	image, err := buildISO9660(data[configDriveSchemaVolumeLabel].(string), files)
+	if err != nil {
+		return err
+	}
+
+	sr, err := generatedMediaSR(c, data[configDriveSchemaSRUUID].(string))
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[DEBUG] Attaching config drive with %d files to VM %s", len(files), vm.UUID)
+	return attachGeneratedISO(c, vm, sr, configDrivePurpose, image)
+}
+
+// applyIgnition attaches a config drive holding the Ignition config to the VM,
+// along with the metadata guest agents like Afterburn derive the hostname from.
+func applyIgnition(c *Connection, vm *VMDescriptor, config string, srUUID string) error {
+	metaData, err := json.Marshal(map[string]string{
+		"uuid":     vm.UUID,
+		"name":     vm.Name,
+		"hostname": vm.Name,
+	})
+	if err != nil {
+		return err
+	}
+
+	image, err := buildISO9660(ignitionVolumeLabel, map[string][]byte{
+		ignitionUserData: []byte(config),
+		ignitionMetaData: metaData,
+	})
+	if err != nil {
+		return err
+	}
+
+	sr, err := generatedMediaSR(c, srUUID)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[DEBUG] Attaching Ignition config to VM %s", vm.UUID)
+	return attachGeneratedISO(c, vm, sr, ignitionPurpose, image)
+}
@@ -0,0 +1,57 @@
+package xenserver
+
+// XenServer, its tool stack and other management tools store their own keys in
+// maps such as other_config and xenstore_data. Only the keys declared in the
+// configuration are managed by the provider, all other keys are left alone and
+// are not reported as differences.
+
+// filterDeclaredKeys returns the entries of current whose key is declared.
+func filterDeclaredKeys(current map[string]string, declared map[string]interface{}) map[string]string {
+	filtered := make(map[string]string, len(declared))
+	for k := range declared {
+		if v, ok := current[k]; ok {
+			filtered[k] = v
+		}
+	}
+	return filtered
+}
+
+// mergeDeclaredKeys applies the change of the declared keys from o to n on top
+// of current. Keys which have been removed from the configuration are removed,
+// keys which have never been declared are preserved.
+func mergeDeclaredKeys(current map[string]string, o, n map[string]interface{}) map[string]string {
+	merged := make(map[string]string, len(current))
+	for k, v := range current {
+		merged[k] = v
+	}
+
+	for k := range o {
+		if _, ok := n[k]; !ok {
+			delete(merged, k)
+		}
+	}
+
+	for k, v := range n {
+		merged[k] = v.(string)
+	}
+
+	return merged
+}
+
+// declaredKeysOf returns the map stored under mapKey of the entry of s whose
+// matchKey equals matchValue. Nested blocks such as network interfaces and disks
+// are matched this way against the entries read from XenServer.
+func declaredKeysOf(s []interface{}, matchKey string, matchValue interface{}, mapKey string) map[string]interface{} {
+	for _, schm := range s {
+		data := schm.(map[string]interface{})
+		if data[matchKey] != matchValue {
+			continue
+		}
+
+		if declared, ok := data[mapKey].(map[string]interface{}); ok {
+			return declared
+		}
+	}
+
+	return map[string]interface{}{}
+}
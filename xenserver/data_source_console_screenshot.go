@@ -0,0 +1,88 @@
+package xenserver
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+func dataSourceXenServerConsoleScreenshot() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: dataSourceXenServerConsoleScreenshotRead,
+
+		Schema: map[string]*schema.Schema{
+			"vm_uuid": &schema.Schema{
+				Type:         schema.TypeString,
+				Description:  "UUID of the running VM to take the screenshot of",
+				Required:     true,
+				ValidateFunc: validateUUID,
+			},
+			// Computed values
+			"image": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "Base64 encoded JPEG image of the console of the VM",
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func dataSourceXenServerConsoleScreenshotRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*Connection)
+
+	vm := &VMDescriptor{
+		UUID: d.Get("vm_uuid").(string),
+	}
+	if err := vm.Load(c); err != nil {
+		return diag.FromErr(referenceError(c, "VM", vm.UUID, err))
+	}
+
+	if vm.PowerState != xenapi.VMPowerStateRunning {
+		return diag.FromErr(fmt.Errorf("VM %s is %s, screenshots can only be taken of running VMs", vm.UUID, vm.PowerState))
+	}
+
+	image, err := consoleScreenshot(c, vm)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	d.SetId(vm.UUID)
+	return diag.FromErr(d.Set("image", base64.StdEncoding.EncodeToString(image)))
+}
+
+// consoleScreenshot fetches a JPEG image of the console of the VM through the
+// vncsnapshot HTTP handler of XenServer.
+func consoleScreenshot(c *Connection, vm *VMDescriptor) ([]byte, error) {
+	query := url.Values{}
+	query.Set("session_id", string(c.session))
+	query.Set("uuid", vm.UUID)
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(c.url, "/")+"/vncsnapshot?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{
+		Transport: c.transport,
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("screenshot of the console of VM %s failed: %s", vm.UUID, resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
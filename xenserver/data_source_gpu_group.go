@@ -0,0 +1,166 @@
+package xenserver
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+func dataSourceXenServerGPUGroup() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: dataSourceXenServerGPUGroupRead,
+
+		Schema: map[string]*schema.Schema{
+			"name_label": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "The name of the GPU group",
+				Optional:    true,
+				Computed:    true,
+			},
+			"vgpu_type_model_name": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "Only look for GPU groups supporting this vGPU type, e.g. GRID T4-2Q",
+				Optional:    true,
+			},
+			// Computed values
+			"vgpu_type_uuid": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "UUID of the vGPU type given by vgpu_type_model_name",
+				Computed:    true,
+			},
+			"gpu_types": &schema.Schema{
+				Type:        schema.TypeList,
+				Description: "Vendor and device IDs of the physical GPUs in the group",
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"vgpu_types": &schema.Schema{
+				Type:        schema.TypeList,
+				Description: "vGPU types supported by the physical GPUs in the group",
+				Computed:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"uuid": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"vendor_name": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"model_name": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"framebuffer_size": &schema.Schema{
+							Type:        schema.TypeInt,
+							Description: "Framebuffer size in bytes",
+							Computed:    true,
+						},
+						"max_heads": &schema.Schema{
+							Type:        schema.TypeInt,
+							Description: "Maximum number of displays",
+							Computed:    true,
+						},
+						"max_resolution_x": &schema.Schema{
+							Type:     schema.TypeInt,
+							Computed: true,
+						},
+						"max_resolution_y": &schema.Schema{
+							Type:     schema.TypeInt,
+							Computed: true,
+						},
+						"enabled": &schema.Schema{
+							Type:        schema.TypeBool,
+							Description: "Whether vGPUs of this type can be created in the group",
+							Computed:    true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceXenServerGPUGroupRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*Connection)
+
+	nameLabel, nameLabelOk := d.GetOk("name_label")
+	modelName, modelNameOk := d.GetOk("vgpu_type_model_name")
+
+	groups, err := c.client.GPUGroup.GetAllRecords(c.session)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	vgpuTypes, err := c.client.VGPUType.GetAllRecords(c.session)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	var match *xenapi.GPUGroupRecord
+	var matchType string
+	for _, group := range groups {
+		group := group
+
+		if nameLabelOk && group.NameLabel != nameLabel.(string) {
+			continue
+		}
+
+		vgpuTypeUUID := ""
+		if modelNameOk {
+			for _, ref := range group.SupportedVGPUTypes {
+				if vgpuTypes[ref].ModelName == modelName.(string) {
+					vgpuTypeUUID = vgpuTypes[ref].UUID
+					break
+				}
+			}
+			if vgpuTypeUUID == "" {
+				continue
+			}
+		}
+
+		if match != nil {
+			return diag.FromErr(fmt.Errorf("several GPU groups match, GPU groups %s and %s at least", match.UUID, group.UUID))
+		}
+		match, matchType = &group, vgpuTypeUUID
+	}
+
+	if match == nil {
+		return diag.FromErr(fmt.Errorf("Matching GPU group not found"))
+	}
+
+	enabled := make(map[xenapi.VGPUTypeRef]bool)
+	for _, ref := range match.EnabledVGPUTypes {
+		enabled[ref] = true
+	}
+
+	types := make([]map[string]interface{}, 0, len(match.SupportedVGPUTypes))
+	for _, ref := range match.SupportedVGPUTypes {
+		vgpuType := vgpuTypes[ref]
+		types = append(types, map[string]interface{}{
+			"uuid":             vgpuType.UUID,
+			"vendor_name":      vgpuType.VendorName,
+			"model_name":       vgpuType.ModelName,
+			"framebuffer_size": vgpuType.FramebufferSize,
+			"max_heads":        vgpuType.MaxHeads,
+			"max_resolution_x": vgpuType.MaxResolutionX,
+			"max_resolution_y": vgpuType.MaxResolutionY,
+			"enabled":          enabled[ref],
+		})
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i]["model_name"].(string) < types[j]["model_name"].(string)
+	})
+
+	d.SetId(match.UUID)
+	d.Set("name_label", match.NameLabel)
+	d.Set("vgpu_type_uuid", matchType)
+	d.Set("gpu_types", match.GPUTypes)
+
+	return diag.FromErr(d.Set("vgpu_types", types))
+}
@@ -0,0 +1,185 @@
+package xenserver
+
+import (
+	"context"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+func dataSourceXenServerISOs() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: dataSourceXenServerISOsRead,
+
+		Schema: map[string]*schema.Schema{
+			"name_pattern": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "Only list ISOs whose name matches this shell pattern (e.g. ubuntu-24.04*)",
+				Optional:    true,
+			},
+			"sr_uuid": &schema.Schema{
+				Type:         schema.TypeString,
+				Description:  "Only list ISOs in this SR",
+				Optional:     true,
+				ValidateFunc: validateUUID,
+			},
+			"min_size": &schema.Schema{
+				Type:        schema.TypeInt,
+				Description: "Only list ISOs of at least this size in bytes",
+				Optional:    true,
+			},
+			"max_size": &schema.Schema{
+				Type:        schema.TypeInt,
+				Description: "Only list ISOs of at most this size in bytes",
+				Optional:    true,
+			},
+			// Computed values
+			"uuid": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "UUID of the most recently uploaded matching ISO, i.e. the first entry of isos",
+				Computed:    true,
+			},
+			"name_label": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "Name of the most recently uploaded matching ISO",
+				Computed:    true,
+			},
+			"isos": &schema.Schema{
+				Type:        schema.TypeList,
+				Description: "All matching ISOs, the most recently uploaded first",
+				Computed:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"uuid": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"name_label": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"size": &schema.Schema{
+							Type:     schema.TypeInt,
+							Computed: true,
+						},
+						"sr_uuid": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceXenServerISOsRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*Connection)
+
+	namePattern, namePatternOk := d.GetOk("name_pattern")
+	srUUID, srUUIDOk := d.GetOk("sr_uuid")
+	minSize, minSizeOk := d.GetOk("min_size")
+	maxSize, maxSizeOk := d.GetOk("max_size")
+
+	srs, err := c.client.SR.GetAllRecords(c.session)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	vdis, err := c.client.VDI.GetAllRecords(c.session)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	isos := make([]map[string]interface{}, 0)
+	uploaded := make(map[string]time.Time)
+	for _, vdi := range vdis {
+		sr, ok := srs[vdi.SR]
+		if !ok || sr.ContentType != "iso" {
+			continue
+		}
+
+		if srUUIDOk && sr.UUID != srUUID.(string) {
+			continue
+		}
+
+		if namePatternOk {
+			matched, err := path.Match(namePattern.(string), vdi.NameLabel)
+			if err != nil {
+				return diag.FromErr(err)
+			}
+			if !matched {
+				continue
+			}
+		}
+
+		if minSizeOk && vdi.VirtualSize < minSize.(int) {
+			continue
+		}
+
+		if maxSizeOk && vdi.VirtualSize > maxSize.(int) {
+			continue
+		}
+
+		uploaded[vdi.UUID] = isoUploadTime(vdi)
+		isos = append(isos, map[string]interface{}{
+			"uuid":       vdi.UUID,
+			"name_label": vdi.NameLabel,
+			"size":       vdi.VirtualSize,
+			"sr_uuid":    sr.UUID,
+		})
+	}
+
+	// ISOs uploaded at the same time, or copied into the SR by other means and
+	// therefore lacking a timestamp, are ordered by name in reverse, which puts
+	// the newest release first for names carrying a version number
+	sort.Slice(isos, func(i, j int) bool {
+		a, b := uploaded[isos[i]["uuid"].(string)], uploaded[isos[j]["uuid"].(string)]
+		if !a.Equal(b) {
+			return a.After(b)
+		}
+		nameA, nameB := isos[i]["name_label"].(string), isos[j]["name_label"].(string)
+		if nameA != nameB {
+			return nameA > nameB
+		}
+		return isos[i]["uuid"].(string) < isos[j]["uuid"].(string)
+	})
+
+	uuid, nameLabel := "", ""
+	if len(isos) > 0 {
+		uuid = isos[0]["uuid"].(string)
+		nameLabel = isos[0]["name_label"].(string)
+	}
+
+	d.SetId(time.Now().UTC().String())
+
+	if err := d.Set("uuid", uuid); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set("name_label", nameLabel); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return diag.FromErr(d.Set("isos", isos))
+}
+
+// isoUploadTime returns when the ISO has been uploaded by xenserver_iso_upload,
+// or else its snapshot time, which XenServer sets when it copies a VDI. ISOs
+// placed in the SR by other means carry neither, the zero time is returned
+// for them.
+func isoUploadTime(vdi xenapi.VDIRecord) time.Time {
+	if uploaded, err := time.Parse(time.RFC3339, vdi.OtherConfig[isoUploadOtherConfigUploaded]); err == nil {
+		return uploaded
+	}
+
+	if vdi.SnapshotTime.Unix() > 0 {
+		return vdi.SnapshotTime
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,170 @@
+package xenserver
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+// Priorities of messages, XenCenter shows them as alerts of these severities
+const (
+	messagePriorityCritical      = 1
+	messagePriorityInformational = 5
+)
+
+func dataSourceXenServerMessages() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: dataSourceXenServerMessagesRead,
+
+		Schema: map[string]*schema.Schema{
+			"object_uuid": &schema.Schema{
+				Type:         schema.TypeString,
+				Description:  "Only list the messages about the object with this UUID, e.g. a VM",
+				Optional:     true,
+				ValidateFunc: validateUUID,
+			},
+			"class": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "Only list the messages about objects of this class",
+				Optional:    true,
+				ValidateFunc: validation.StringInSlice([]string{
+					string(xenapi.ClsVM),
+					string(xenapi.ClsHost),
+					string(xenapi.ClsSR),
+					string(xenapi.ClsPool),
+					string(xenapi.ClsVMPP),
+					string(xenapi.ClsVMSS),
+					string(xenapi.ClsPVSProxy),
+					string(xenapi.ClsVDI),
+				}, false),
+			},
+			"name": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "Only list the messages with this name, e.g. VM_CRASHED",
+				Optional:    true,
+			},
+			"priority": &schema.Schema{
+				Type:         schema.TypeInt,
+				Description:  "Only list the messages of this priority or a more important one, from 1 (critical) to 5 (informational)",
+				Optional:     true,
+				Default:      messagePriorityInformational,
+				ValidateFunc: validation.IntBetween(messagePriorityCritical, messagePriorityInformational),
+			},
+			"since": &schema.Schema{
+				Type:         schema.TypeString,
+				Description:  "Only list the messages created at or after this time, in RFC 3339 format",
+				Optional:     true,
+				ValidateFunc: validation.IsRFC3339Time,
+			},
+			// Computed values
+			"messages": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"uuid": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"name": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"priority": &schema.Schema{
+							Type:     schema.TypeInt,
+							Computed: true,
+						},
+						"class": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"object_uuid": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"timestamp": &schema.Schema{
+							Type:        schema.TypeString,
+							Description: "Time the message has been created at, in RFC 3339 format",
+							Computed:    true,
+						},
+						"body": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceXenServerMessagesRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*Connection)
+
+	objectUUID := d.Get("object_uuid").(string)
+	class := d.Get("class").(string)
+	name := d.Get("name").(string)
+	priority := d.Get("priority").(int)
+
+	var messages map[xenapi.MessageRef]xenapi.MessageRecord
+	var err error
+	if v, ok := d.GetOk("since"); ok {
+		since, parseErr := time.Parse(time.RFC3339, v.(string))
+		if parseErr != nil {
+			return diag.FromErr(fmt.Errorf("invalid since: %s", parseErr))
+		}
+		messages, err = c.client.Message.GetSince(c.session, since)
+	} else {
+		messages, err = c.client.Message.GetAllRecords(c.session)
+	}
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	list := make([]map[string]interface{}, 0)
+	for _, message := range messages {
+		if objectUUID != "" && !strings.EqualFold(message.ObjUUID, objectUUID) {
+			continue
+		}
+
+		if class != "" && string(message.Cls) != class {
+			continue
+		}
+
+		if name != "" && message.Name != name {
+			continue
+		}
+
+		if message.Priority > priority {
+			continue
+		}
+
+		list = append(list, map[string]interface{}{
+			"uuid":        message.UUID,
+			"name":        message.Name,
+			"priority":    message.Priority,
+			"class":       string(message.Cls),
+			"object_uuid": message.ObjUUID,
+			"timestamp":   message.Timestamp.UTC().Format(time.RFC3339),
+			"body":        message.Body,
+		})
+	}
+
+	// Oldest first, RFC 3339 timestamps in UTC sort chronologically
+	sort.Slice(list, func(i, j int) bool {
+		if list[i]["timestamp"].(string) != list[j]["timestamp"].(string) {
+			return list[i]["timestamp"].(string) < list[j]["timestamp"].(string)
+		}
+		return list[i]["uuid"].(string) < list[j]["uuid"].(string)
+	})
+
+	d.SetId(time.Now().UTC().String())
+	return diag.FromErr(d.Set("messages", list))
+}
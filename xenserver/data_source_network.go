@@ -0,0 +1,162 @@
+package xenserver
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+func dataSourceXenServerNetwork() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: dataSourceXenServerNetworkRead,
+
+		Schema: map[string]*schema.Schema{
+			"name_label": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "The human readable name of the network",
+				Optional:    true,
+				Computed:    true,
+			},
+			"bridge": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "Name of the bridge of the network on the hosts (e.g. xenbr0)",
+				Optional:    true,
+				Computed:    true,
+			},
+			"vlan": &schema.Schema{
+				Type:         schema.TypeInt,
+				Description:  "VLAN tag of a PIF attached to the network",
+				Optional:     true,
+				ValidateFunc: validateVLANTag,
+			},
+			"other_config": &schema.Schema{
+				Type:        schema.TypeMap,
+				Description: "Key-value pairs which all have to be present in the other_config of the network",
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			// Computed values
+			"description": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "Description of the network",
+				Computed:    true,
+			},
+			"mtu": &schema.Schema{
+				Type:        schema.TypeInt,
+				Description: "MTU of the network",
+				Computed:    true,
+			},
+			"pifs": &schema.Schema{
+				Type:        schema.TypeList,
+				Description: "UUIDs of the PIFs attached to the network",
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"ref": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "Reference handle of the network, saves lookups when passed on to other resources",
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func dataSourceXenServerNetworkRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*Connection)
+
+	nameLabel, nameLabelOk := d.GetOk("name_label")
+	bridge, bridgeOk := d.GetOk("bridge")
+	vlan, vlanOk := d.GetOk("vlan")
+	otherConfig := d.Get("other_config").(map[string]interface{})
+
+	if !nameLabelOk && !bridgeOk && !vlanOk && len(otherConfig) == 0 {
+		return diag.FromErr(fmt.Errorf("One of name_label, bridge, vlan or other_config must be assigned"))
+	}
+
+	networks, err := c.client.Network.GetAllRecords(c.session)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	pifs, err := c.client.PIF.GetAllRecords(c.session)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	var matchRef xenapi.NetworkRef
+	var match xenapi.NetworkRecord
+	matches := 0
+
+	for networkRef, network := range networks {
+		if nameLabelOk && network.NameLabel != nameLabel.(string) {
+			continue
+		}
+
+		if bridgeOk && network.Bridge != bridge.(string) {
+			continue
+		}
+
+		if vlanOk && !networkHasVLAN(network, pifs, vlan.(int)) {
+			continue
+		}
+
+		if !hasOtherConfig(network.OtherConfig, otherConfig) {
+			continue
+		}
+
+		matchRef = networkRef
+		match = network
+		matches++
+	}
+
+	if matches == 0 {
+		return diag.FromErr(fmt.Errorf("Matching network not found"))
+	}
+	if matches > 1 {
+		return diag.FromErr(fmt.Errorf("%d networks match, the filters have to match exactly one", matches))
+	}
+
+	pifUUIDs := make([]string, 0, len(match.PIFs))
+	for _, pifRef := range match.PIFs {
+		if pif, ok := pifs[pifRef]; ok {
+			pifUUIDs = append(pifUUIDs, pif.UUID)
+		}
+	}
+	sort.Strings(pifUUIDs)
+
+	d.SetId(match.UUID)
+	d.Set("name_label", match.NameLabel)
+	d.Set("bridge", match.Bridge)
+	d.Set("description", match.NameDescription)
+	d.Set("mtu", match.MTU)
+	d.Set("pifs", pifUUIDs)
+	d.Set("ref", string(matchRef))
+
+	return nil
+}
+
+// networkHasVLAN reports whether a PIF with the given VLAN tag is attached to
+// the network.
+func networkHasVLAN(network xenapi.NetworkRecord, pifs map[xenapi.PIFRef]xenapi.PIFRecord, vlan int) bool {
+	for _, pifRef := range network.PIFs {
+		if pif, ok := pifs[pifRef]; ok && pif.VLAN == vlan {
+			return true
+		}
+	}
+	return false
+}
+
+// hasOtherConfig reports whether all key-value pairs of wanted are present in
+// otherConfig.
+func hasOtherConfig(otherConfig map[string]string, wanted map[string]interface{}) bool {
+	for k, v := range wanted {
+		if otherConfig[k] != v.(string) {
+			return false
+		}
+	}
+	return true
+}
@@ -1,14 +1,16 @@
 package xenserver
 
 import (
+	"context"
 	"fmt"
 
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 )
 
 func dataSourceXenServerPif() *schema.Resource {
 	return &schema.Resource{
-		Read: dataSourceXenServerPifRead,
+		ReadContext: dataSourceXenServerPifRead,
 
 		Schema: map[string]*schema.Schema{
 			"device": &schema.Schema{
@@ -27,18 +29,23 @@ func dataSourceXenServerPif() *schema.Resource {
 				Description: "UUID of the virtual network to which this PIF is connected",
 				Computed:    true,
 			},
+			"network_ref": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "Reference handle of the virtual network to which this PIF is connected",
+				Computed:    true,
+			},
 		},
 	}
 }
 
-func dataSourceXenServerPifRead(d *schema.ResourceData, meta interface{}) error {
+func dataSourceXenServerPifRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	c := meta.(*Connection)
 
 	device, deviceOk := d.GetOk("device")
 	management, managementOk := d.GetOk("management")
 
 	if !deviceOk && !managementOk {
-		return fmt.Errorf("One of device or management must be assigned")
+		return diag.FromErr(fmt.Errorf("One of device or management must be assigned"))
 	}
 
 	if pifs, err := c.client.PIF.GetAllRecords(c.session); err == nil {
@@ -51,9 +58,10 @@ func dataSourceXenServerPifRead(d *schema.ResourceData, meta interface{}) error
 					NetworkRef: pif.Network,
 				}
 				if err = network.Query(c); err != nil {
-					return err
+					return diag.FromErr(err)
 				}
 				d.Set("network", network.UUID)
+				d.Set("network_ref", string(network.NetworkRef))
 
 				found = true
 				break
@@ -61,7 +69,7 @@ func dataSourceXenServerPifRead(d *schema.ResourceData, meta interface{}) error
 		}
 
 		if !found {
-			return fmt.Errorf("Matching PIF not found")
+			return diag.FromErr(fmt.Errorf("Matching PIF not found"))
 		}
 	}
 
@@ -1,14 +1,16 @@
 package xenserver
 
 import (
+	"context"
 	"time"
 
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 )
 
 func dataSourceXenServerPifs() *schema.Resource {
 	return &schema.Resource{
-		Read: dataSourceXenServerPifsRead,
+		ReadContext: dataSourceXenServerPifsRead,
 		Schema: map[string]*schema.Schema{
 			"uuids": &schema.Schema{
 				Type:     schema.TypeList,
@@ -19,7 +21,7 @@ func dataSourceXenServerPifs() *schema.Resource {
 	}
 }
 
-func dataSourceXenServerPifsRead(d *schema.ResourceData, meta interface{}) error {
+func dataSourceXenServerPifsRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	c := meta.(*Connection)
 
 	pifUUIDs := make([]string, 0)
@@ -0,0 +1,142 @@
+package xenserver
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+// The pool secret can be rotated since Citrix Hypervisor 8.2 CU1
+const poolRotateSecretMinVersion = "8.2.1"
+
+func dataSourceXenServerPoolJoinInfo() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: dataSourceXenServerPoolJoinInfoRead,
+
+		Schema: map[string]*schema.Schema{
+			// The secret itself is never read, only replaced
+			"rotate_secret": &schema.Schema{
+				Type:        schema.TypeBool,
+				Description: "Rotate the pool secret whenever the data source is read",
+				Optional:    true,
+				Default:     false,
+			},
+
+			// Computed values
+			"pool_uuid": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"master_uuid": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "UUID of the pool master",
+				Computed:    true,
+			},
+			"master_address": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "Management IP address of the pool master, which joining hosts have to contact",
+				Computed:    true,
+			},
+			"api_version": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "XenAPI version of the pool master, joining hosts must run the same version",
+				Computed:    true,
+			},
+			"product_version": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func dataSourceXenServerPoolJoinInfoRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*Connection)
+
+	pools, err := c.client.Pool.GetAllRecords(c.session)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	for poolRef, pool := range pools {
+		master := &HostDescriptor{
+			HostRef: pool.Master,
+		}
+		if err := master.Query(c); err != nil {
+			return diag.FromErr(err)
+		}
+
+		apiMajor, err := c.client.Host.GetAPIVersionMajor(c.session, master.HostRef)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		apiMinor, err := c.client.Host.GetAPIVersionMinor(c.session, master.HostRef)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		softwareVersion, err := c.client.Host.GetSoftwareVersion(c.session, master.HostRef)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		if d.Get("rotate_secret").(bool) {
+			if err := rotatePoolSecret(c, poolRef, softwareVersion["product_version"]); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+
+		d.SetId(string(poolRef))
+		d.Set("pool_uuid", pool.UUID)
+		d.Set("master_uuid", master.UUID)
+		d.Set("master_address", master.Address)
+		d.Set("api_version", fmt.Sprintf("%d.%d", apiMajor, apiMinor))
+		d.Set("product_version", softwareVersion["product_version"])
+
+		return nil
+	}
+
+	return diag.FromErr(fmt.Errorf("No pool found"))
+}
+
+// rotatePoolSecret replaces the secret the members of the pool authenticate
+// with against the master. The client predates the method, so it is called by
+// name, after checking the product version of the master reported by it.
+func rotatePoolSecret(c *Connection, poolRef xenapi.PoolRef, productVersion string) error {
+	if !versionAtLeast(productVersion, poolRotateSecretMinVersion) {
+		return fmt.Errorf("the secret of pool %s cannot be rotated, product version %s is older than %s (Citrix Hypervisor 8.2 CU1)",
+			c.poolDescription(), productVersion, poolRotateSecretMinVersion)
+	}
+
+	log.Printf("[DEBUG] Rotating the secret of pool %s", c.poolDescription())
+	if _, err := c.client.APICall("pool.rotate_secret", string(c.session), string(poolRef)); err != nil {
+		return fmt.Errorf("failed to rotate the secret of pool %s: %s", c.poolDescription(), err)
+	}
+
+	return nil
+}
+
+// versionAtLeast tells whether the dotted version is min or newer. Components
+// which are no numbers compare as 0.
+func versionAtLeast(version, min string) bool {
+	parts := strings.Split(version, ".")
+	for i, m := range strings.Split(min, ".") {
+		want, _ := strconv.Atoi(m)
+		var have int
+		if i < len(parts) {
+			have, _ = strconv.Atoi(parts[i])
+		}
+		if have != want {
+			return have > want
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,255 @@
+package xenserver
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+func dataSourceXenServerRRDUpdates() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: dataSourceXenServerRRDUpdatesRead,
+
+		Schema: map[string]*schema.Schema{
+			"vm_uuid": &schema.Schema{
+				Type:         schema.TypeString,
+				Description:  "UUID of the running VM to fetch the performance data of",
+				Optional:     true,
+				ExactlyOneOf: []string{"vm_uuid", "host_uuid"},
+				ValidateFunc: validateUUID,
+			},
+			"host_uuid": &schema.Schema{
+				Type:         schema.TypeString,
+				Description:  "UUID of the host to fetch the performance data of",
+				Optional:     true,
+				ValidateFunc: validateUUID,
+			},
+			"window": &schema.Schema{
+				Type:         schema.TypeInt,
+				Description:  "Seconds before now to fetch the performance data of",
+				Optional:     true,
+				Default:      300,
+				ValidateFunc: validation.IntAtLeast(5),
+			},
+			"interval": &schema.Schema{
+				Type:         schema.TypeInt,
+				Description:  "Seconds between the samples, XenServer picks the closest interval it keeps data for",
+				Optional:     true,
+				Default:      60,
+				ValidateFunc: validation.IntAtLeast(5),
+			},
+			"consolidation_function": &schema.Schema{
+				Type:         schema.TypeString,
+				Description:  "Function samples are consolidated with, AVERAGE, MIN or MAX",
+				Optional:     true,
+				Default:      "AVERAGE",
+				ValidateFunc: validation.StringInSlice([]string{"AVERAGE", "MIN", "MAX"}, false),
+			},
+			// Computed values
+			"averages": &schema.Schema{
+				Type:        schema.TypeMap,
+				Description: "Average over the window of each data source, e.g. cpu0 or vif_0_rx",
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeFloat},
+			},
+			"latest": &schema.Schema{
+				Type:        schema.TypeMap,
+				Description: "Latest sample of each data source",
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeFloat},
+			},
+			"start": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "Time of the first sample, in RFC 3339 format",
+				Computed:    true,
+			},
+			"end": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "Time of the last sample, in RFC 3339 format",
+				Computed:    true,
+			},
+			"step": &schema.Schema{
+				Type:        schema.TypeInt,
+				Description: "Seconds between the samples",
+				Computed:    true,
+			},
+		},
+	}
+}
+
+// rrdUpdates is the XML document the rrd_updates HTTP handler responds with.
+// The legend holds one entry per column of the rows, such as
+// AVERAGE:vm:<uuid>:cpu0.
+type rrdUpdates struct {
+	Start  int64    `xml:"meta>start"`
+	End    int64    `xml:"meta>end"`
+	Step   int      `xml:"meta>step"`
+	Legend []string `xml:"meta>legend>entry"`
+	Rows   []struct {
+		Time   int64    `xml:"t"`
+		Values []string `xml:"v"`
+	} `xml:"data>row"`
+}
+
+func dataSourceXenServerRRDUpdatesRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*Connection)
+
+	var class, uuid string
+	var hostRef xenapi.HostRef
+	if vmUUID, ok := d.GetOk("vm_uuid"); ok {
+		class, uuid = "vm", vmUUID.(string)
+
+		vm := &VMDescriptor{
+			UUID: uuid,
+		}
+		if err := vm.Load(c); err != nil {
+			return diag.FromErr(referenceError(c, "VM", uuid, err))
+		}
+
+		// Each host only keeps the data of the VMs resident on it
+		if vm.PowerState != xenapi.VMPowerStateRunning {
+			return diag.FromErr(fmt.Errorf("VM %s is %s, performance data is only recorded for running VMs", vm.UUID, vm.PowerState))
+		}
+
+		var err error
+		if hostRef, err = c.client.VM.GetResidentOn(c.session, vm.VMRef); err != nil {
+			return diag.FromErr(err)
+		}
+	} else {
+		class, uuid = "host", d.Get("host_uuid").(string)
+
+		host := &HostDescriptor{
+			UUID: uuid,
+		}
+		if err := host.Load(c); err != nil {
+			return diag.FromErr(referenceError(c, "host", uuid, err))
+		}
+		hostRef = host.HostRef
+	}
+
+	address, err := c.client.Host.GetAddress(c.session, hostRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	updates, err := fetchRRDUpdates(c, address, class, uuid, d.Get("window").(int), d.Get("interval").(int),
+		d.Get("consolidation_function").(string))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	averages, latest := summarizeRRDUpdates(updates, class, uuid)
+
+	d.SetId(uuid)
+	d.Set("averages", averages)
+	d.Set("latest", latest)
+	d.Set("start", time.Unix(updates.Start, 0).UTC().Format(time.RFC3339))
+	d.Set("end", time.Unix(updates.End, 0).UTC().Format(time.RFC3339))
+
+	return diag.FromErr(d.Set("step", updates.Step))
+}
+
+// fetchRRDUpdates fetches the performance data of the window before now from
+// the rrd_updates HTTP handler of the host at address.
+func fetchRRDUpdates(c *Connection, address, class, uuid string, window, interval int, cf string) (*rrdUpdates, error) {
+	base, err := url.Parse(c.url)
+	if err != nil {
+		return nil, err
+	}
+
+	// The host is reached the same way as the pool master
+	base.Host = urlHost(address, base.Port())
+	base.Path = "/rrd_updates"
+
+	query := url.Values{}
+	query.Set("session_id", string(c.session))
+	query.Set("start", strconv.FormatInt(time.Now().Unix()-int64(window), 10))
+	query.Set("interval", strconv.Itoa(interval))
+	query.Set("cf", cf)
+	if class == "host" {
+		query.Set("host", "true")
+	} else {
+		query.Set("vm_uuid", uuid)
+	}
+	base.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, base.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{
+		Transport: c.transport,
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching the performance data of %s %s failed: %s", class, uuid, resp.Status)
+	}
+
+	updates := &rrdUpdates{}
+	if err := xml.NewDecoder(resp.Body).Decode(updates); err != nil {
+		return nil, fmt.Errorf("failed to parse the performance data of %s %s: %s", class, uuid, err)
+	}
+
+	return updates, nil
+}
+
+// summarizeRRDUpdates returns the average and the latest sample of each data
+// source of the object, keyed by the name of the data source. Samples which
+// are not known, reported as NaN, are left out.
+func summarizeRRDUpdates(updates *rrdUpdates, class, uuid string) (map[string]float64, map[string]float64) {
+	averages := make(map[string]float64)
+	latest := make(map[string]float64)
+
+	for column, entry := range updates.Legend {
+		parts := strings.SplitN(entry, ":", 4)
+		if len(parts) != 4 || parts[1] != class || parts[2] != uuid {
+			continue
+		}
+		name := parts[3]
+
+		sum, count := 0.0, 0
+		newest := int64(math.MinInt64)
+		for _, row := range updates.Rows {
+			if column >= len(row.Values) {
+				continue
+			}
+
+			value, err := strconv.ParseFloat(row.Values[column], 64)
+			if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+				continue
+			}
+
+			sum += value
+			count++
+
+			if row.Time > newest {
+				newest = row.Time
+				latest[name] = value
+			}
+		}
+
+		if count > 0 {
+			averages[name] = sum / float64(count)
+		}
+	}
+
+	return averages, latest
+}
@@ -0,0 +1,128 @@
+package xenserver
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func dataSourceXenServerSMDrivers() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: dataSourceXenServerSMDriversRead,
+
+		Schema: map[string]*schema.Schema{
+			"type": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "Only list the storage manager for this SR type (e.g. nfs, lvmoiscsi)",
+				Optional:    true,
+			},
+			// Computed values
+			"drivers": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"uuid": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"type": &schema.Schema{
+							Type:        schema.TypeString,
+							Description: "The SR type handled by this storage manager",
+							Computed:    true,
+						},
+						"name_label": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"description": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"vendor": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"version": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"required_api_version": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"configuration": &schema.Schema{
+							Type:        schema.TypeMap,
+							Description: "Device config keys understood by the storage manager, mapped to their description",
+							Computed:    true,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+						},
+						"capabilities": &schema.Schema{
+							Type:     schema.TypeList,
+							Computed: true,
+							Elem:     &schema.Schema{Type: schema.TypeString},
+						},
+						"features": &schema.Schema{
+							Type:        schema.TypeMap,
+							Description: "Capabilities of the storage manager, mapped to their version",
+							Computed:    true,
+							Elem:        &schema.Schema{Type: schema.TypeInt},
+						},
+						"required_cluster_stack": &schema.Schema{
+							Type:     schema.TypeList,
+							Computed: true,
+							Elem:     &schema.Schema{Type: schema.TypeString},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceXenServerSMDriversRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*Connection)
+
+	srType, srTypeOk := d.GetOk("type")
+
+	sms, err := c.client.SM.GetAllRecords(c.session)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	drivers := make([]map[string]interface{}, 0, len(sms))
+	for _, sm := range sms {
+		if srTypeOk && sm.Type != srType.(string) {
+			continue
+		}
+
+		features := make(map[string]interface{}, len(sm.Features))
+		for k, v := range sm.Features {
+			features[k] = v
+		}
+
+		drivers = append(drivers, map[string]interface{}{
+			"uuid":                   sm.UUID,
+			"type":                   sm.Type,
+			"name_label":             sm.NameLabel,
+			"description":            sm.NameDescription,
+			"vendor":                 sm.Vendor,
+			"version":                sm.Version,
+			"required_api_version":   sm.RequiredAPIVersion,
+			"configuration":          sm.Configuration,
+			"capabilities":           sm.Capabilities,
+			"features":               features,
+			"required_cluster_stack": sm.RequiredClusterStack,
+		})
+	}
+
+	sort.Slice(drivers, func(i, j int) bool {
+		return drivers[i]["type"].(string) < drivers[j]["type"].(string)
+	})
+
+	d.SetId(time.Now().UTC().String())
+	return diag.FromErr(d.Set("drivers", drivers))
+}
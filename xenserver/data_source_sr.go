@@ -1,14 +1,17 @@
 package xenserver
 
 import (
+	"context"
 	"fmt"
+	"sort"
 
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 )
 
 func dataSourceXenServerSR() *schema.Resource {
 	return &schema.Resource{
-		Read: dataSourceXenServerSRRead,
+		ReadContext: dataSourceXenServerSRRead,
 
 		Schema: map[string]*schema.Schema{
 			"name_label": &schema.Schema{
@@ -16,20 +19,51 @@ func dataSourceXenServerSR() *schema.Resource {
 				Description: "The human readable name of the storage repository",
 				Required:    true,
 			},
+			// Computed values
+			"ref": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "Reference handle of the storage repository, saves lookups when passed on to other resources",
+				Computed:    true,
+			},
+			"folder": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "Path of the XenCenter folder of the storage repository",
+				Computed:    true,
+			},
+			"custom_fields": &schema.Schema{
+				Type:        schema.TypeMap,
+				Description: "XenCenter custom fields of the storage repository",
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"allowed_operations": &schema.Schema{
+				Type:        schema.TypeList,
+				Description: "Operations currently allowed on the storage repository, e.g. vdi_create",
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
 		},
 	}
 }
 
-func dataSourceXenServerSRRead(d *schema.ResourceData, meta interface{}) error {
+func dataSourceXenServerSRRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	c := meta.(*Connection)
 
 	nameLabel, nameLabelOk := d.GetOk("name_label")
 
 	if !nameLabelOk {
-		return fmt.Errorf("name_label must be provided")
+		return diag.FromErr(fmt.Errorf("name_label must be provided"))
 	}
 
 	if srs, err := c.client.SR.GetByNameLabel(c.session, nameLabel.(string)); err == nil {
+		if len(srs) > 1 {
+			if err := checkDuplicateNames(c, "SR", nameLabel.(string), len(srs), func(i int) (string, error) {
+				return c.client.SR.GetUUID(c.session, srs[i])
+			}); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+
 		found := false
 		for _, sr := range srs {
 			record, err := c.client.SR.GetRecord(c.session, sr)
@@ -38,13 +72,23 @@ func dataSourceXenServerSRRead(d *schema.ResourceData, meta interface{}) error {
 			}
 
 			d.SetId(record.UUID)
+			d.Set("ref", string(sr))
+			d.Set("folder", record.OtherConfig[otherConfigFolder])
+			d.Set("custom_fields", xenCenterCustomFields(record.OtherConfig))
+
+			allowedOperations := make([]string, 0, len(record.AllowedOperations))
+			for _, op := range record.AllowedOperations {
+				allowedOperations = append(allowedOperations, string(op))
+			}
+			sort.Strings(allowedOperations)
+			d.Set("allowed_operations", allowedOperations)
 
 			found = true
 			break
 		}
 
 		if !found {
-			return fmt.Errorf("Matching SR not found")
+			return diag.FromErr(fmt.Errorf("Matching SR not found"))
 		}
 	}
 
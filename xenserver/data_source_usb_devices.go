@@ -0,0 +1,162 @@
+package xenserver
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func dataSourceXenServerUSBDevices() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: dataSourceXenServerUSBDevicesRead,
+
+		Schema: map[string]*schema.Schema{
+			"host_uuid": &schema.Schema{
+				Type:         schema.TypeString,
+				Description:  "Only list the USB devices plugged into this host",
+				Optional:     true,
+				ValidateFunc: validateUUID,
+			},
+			"vendor_id": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "Only list the USB devices with this vendor ID (e.g. 0529)",
+				Optional:    true,
+			},
+			"product_id": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "Only list the USB devices with this product ID (e.g. 0001)",
+				Optional:    true,
+			},
+			"serial": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "Only list the USB devices with this serial number",
+				Optional:    true,
+			},
+			// Computed values
+			"devices": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"uuid": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"host_uuid": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"path": &schema.Schema{
+							Type:        schema.TypeString,
+							Description: "The port path of the USB device on the host",
+							Computed:    true,
+						},
+						"vendor_id": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"vendor_desc": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"product_id": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"product_desc": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"serial": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"version": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"description": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"passthrough_enabled": &schema.Schema{
+							Type:     schema.TypeBool,
+							Computed: true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceXenServerUSBDevicesRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*Connection)
+
+	pusbs, err := c.client.PUSB.GetAllRecords(c.session)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	filters := make(map[string]string)
+	for _, key := range []string{"host_uuid", "vendor_id", "product_id", "serial"} {
+		if v, ok := d.GetOk(key); ok {
+			filters[key] = v.(string)
+		}
+	}
+
+	hostUUIDs := make(map[string]string)
+	devices := make([]map[string]interface{}, 0, len(pusbs))
+	for _, pusb := range pusbs {
+		hostUUID, ok := hostUUIDs[string(pusb.Host)]
+		if !ok {
+			host := &HostDescriptor{
+				HostRef: pusb.Host,
+			}
+			if err := host.Query(c); err != nil {
+				return diag.FromErr(err)
+			}
+			hostUUID = host.UUID
+			hostUUIDs[string(pusb.Host)] = hostUUID
+		}
+
+		device := map[string]interface{}{
+			"uuid":                pusb.UUID,
+			"host_uuid":           hostUUID,
+			"path":                pusb.Path,
+			"vendor_id":           pusb.VendorID,
+			"vendor_desc":         pusb.VendorDesc,
+			"product_id":          pusb.ProductID,
+			"product_desc":        pusb.ProductDesc,
+			"serial":              pusb.Serial,
+			"version":             pusb.Version,
+			"description":         pusb.Description,
+			"passthrough_enabled": pusb.PassthroughEnabled,
+		}
+
+		matches := true
+		for key, value := range filters {
+			if device[key].(string) != value {
+				matches = false
+				break
+			}
+		}
+
+		if matches {
+			devices = append(devices, device)
+		}
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		if devices[i]["host_uuid"].(string) != devices[j]["host_uuid"].(string) {
+			return devices[i]["host_uuid"].(string) < devices[j]["host_uuid"].(string)
+		}
+		return devices[i]["path"].(string) < devices[j]["path"].(string)
+	})
+
+	d.SetId(time.Now().UTC().String())
+	return diag.FromErr(d.Set("devices", devices))
+}
@@ -0,0 +1,133 @@
+package xenserver
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+func dataSourceXenServerVDI() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: dataSourceXenServerVDIRead,
+
+		Schema: map[string]*schema.Schema{
+			"name_label": &schema.Schema{
+				Type:         schema.TypeString,
+				Description:  "The human readable name of the virtual disk",
+				Optional:     true,
+				Computed:     true,
+				AtLeastOneOf: []string{"name_label", "tag"},
+			},
+			"sr_uuid": &schema.Schema{
+				Type:         schema.TypeString,
+				Description:  "Only look for the virtual disk in this storage repository",
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validateUUID,
+			},
+			"tag": &schema.Schema{
+				Type:         schema.TypeString,
+				Description:  "A tag the virtual disk has",
+				Optional:     true,
+				AtLeastOneOf: []string{"name_label", "tag"},
+			},
+			// Computed values
+			"ref": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "Reference handle of the virtual disk",
+				Computed:    true,
+			},
+			"virtual_size": &schema.Schema{
+				Type:        schema.TypeInt,
+				Description: "Size of the virtual disk in bytes",
+				Computed:    true,
+			},
+			"tags": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+		},
+	}
+}
+
+func dataSourceXenServerVDIRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*Connection)
+
+	nameLabel, nameLabelOk := d.GetOk("name_label")
+	tag, tagOk := d.GetOk("tag")
+
+	var srRef xenapi.SRRef
+	if srUUID, ok := d.GetOk("sr_uuid"); ok {
+		sr := &SRDescriptor{
+			UUID: srUUID.(string),
+		}
+		if err := sr.Load(c); err != nil {
+			return diag.FromErr(referenceError(c, "SR", sr.UUID, err))
+		}
+		srRef = sr.SRRef
+	}
+
+	vdis, err := c.client.VDI.GetAllRecords(c.session)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	var matchRef xenapi.VDIRef
+	var match xenapi.VDIRecord
+	for ref, vdi := range vdis {
+		// Snapshots share the name of the disk they have been taken of
+		if vdi.IsASnapshot {
+			continue
+		}
+
+		if nameLabelOk && vdi.NameLabel != nameLabel.(string) {
+			continue
+		}
+
+		if srRef != "" && vdi.SR != srRef {
+			continue
+		}
+
+		if tagOk {
+			tagged := false
+			for _, t := range vdi.Tags {
+				if t == tag.(string) {
+					tagged = true
+					break
+				}
+			}
+			if !tagged {
+				continue
+			}
+		}
+
+		if matchRef != "" {
+			return diag.FromErr(fmt.Errorf("several VDIs match, VDIs %s and %s at least", match.UUID, vdi.UUID))
+		}
+		matchRef, match = ref, vdi
+	}
+
+	if matchRef == "" {
+		return diag.FromErr(fmt.Errorf("Matching VDI not found"))
+	}
+
+	sr := &SRDescriptor{
+		SRRef: match.SR,
+	}
+	if err := sr.Query(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	d.SetId(match.UUID)
+	d.Set("name_label", match.NameLabel)
+	d.Set("sr_uuid", sr.UUID)
+	d.Set("ref", string(matchRef))
+	d.Set("virtual_size", match.VirtualSize)
+	d.Set("tags", match.Tags)
+
+	return nil
+}
@@ -0,0 +1,206 @@
+package xenserver
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+// Keys of the IP addresses in the networks map of the guest metrics, e.g.
+// 0/ip, 0/ipv4/1 or 1/ipv6/0
+var guestNetworkIPKey = regexp.MustCompile(`^\d+/(ip|ipv4/\d+|ipv6/\d+)$`)
+
+func dataSourceXenServerVMList() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: dataSourceXenServerVMListRead,
+
+		Schema: map[string]*schema.Schema{
+			"tag": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "Only list the VMs with this tag",
+				Optional:    true,
+			},
+			"name_regex": &schema.Schema{
+				Type:         schema.TypeString,
+				Description:  "Only list the VMs whose name matches this regular expression",
+				Optional:     true,
+				ValidateFunc: validation.StringIsValidRegExp,
+			},
+			"power_state": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "Only list the VMs in this power state",
+				Optional:    true,
+				ValidateFunc: validation.StringInSlice([]string{
+					string(xenapi.VMPowerStateHalted),
+					string(xenapi.VMPowerStatePaused),
+					string(xenapi.VMPowerStateRunning),
+					string(xenapi.VMPowerStateSuspended),
+				}, true),
+			},
+			"other_config": &schema.Schema{
+				Type:        schema.TypeMap,
+				Description: "Only list the VMs which have all of these key-value pairs in their other_config",
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			// Computed values
+			"vms": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"uuid": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"name_label": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"power_state": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"tags": &schema.Schema{
+							Type:     schema.TypeList,
+							Computed: true,
+							Elem:     &schema.Schema{Type: schema.TypeString},
+						},
+						"ip_addresses": &schema.Schema{
+							Type:        schema.TypeList,
+							Description: "IP addresses the guest agent reports, empty without guest agent",
+							Computed:    true,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceXenServerVMListRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*Connection)
+
+	var nameRegex *regexp.Regexp
+	if v, ok := d.GetOk("name_regex"); ok {
+		var err error
+		if nameRegex, err = regexp.Compile(v.(string)); err != nil {
+			return diag.FromErr(fmt.Errorf("invalid name_regex: %s", err))
+		}
+	}
+
+	tag := d.Get("tag").(string)
+	powerState := d.Get("power_state").(string)
+	otherConfig := d.Get("other_config").(map[string]interface{})
+
+	vms, err := c.client.VM.GetAllRecords(c.session)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	list := make([]map[string]interface{}, 0)
+	for _, vm := range vms {
+		if vm.IsATemplate || vm.IsASnapshot || vm.IsControlDomain {
+			continue
+		}
+
+		if nameRegex != nil && !nameRegex.MatchString(vm.NameLabel) {
+			continue
+		}
+
+		if powerState != "" && !strings.EqualFold(string(vm.PowerState), powerState) {
+			continue
+		}
+
+		if tag != "" && !hasTag(vm.Tags, tag) {
+			continue
+		}
+
+		matches := true
+		for k, v := range otherConfig {
+			if value, ok := vm.OtherConfig[k]; !ok || value != v.(string) {
+				matches = false
+				break
+			}
+		}
+		if !matches {
+			continue
+		}
+
+		ips, err := guestIPAddresses(c, vm.GuestMetrics)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		list = append(list, map[string]interface{}{
+			"uuid":         vm.UUID,
+			"name_label":   vm.NameLabel,
+			"power_state":  string(vm.PowerState),
+			"tags":         vm.Tags,
+			"ip_addresses": ips,
+		})
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i]["name_label"].(string) != list[j]["name_label"].(string) {
+			return list[i]["name_label"].(string) < list[j]["name_label"].(string)
+		}
+		return list[i]["uuid"].(string) < list[j]["uuid"].(string)
+	})
+
+	d.SetId(time.Now().UTC().String())
+	return diag.FromErr(d.Set("vms", list))
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// guestIPAddresses returns the IP addresses the guest agent reports in the
+// guest metrics, ordered by interface.
+func guestIPAddresses(c *Connection, metrics xenapi.VMGuestMetricsRef) ([]string, error) {
+	ips := make([]string, 0)
+	if metrics == "" || metrics == "OpaqueRef:NULL" {
+		return ips, nil
+	}
+
+	networks, err := c.client.VMGuestMetrics.GetNetworks(c.session, metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(networks))
+	for k := range networks {
+		if guestNetworkIPKey.MatchString(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	// Older guest agents report the first IPv4 address under both 0/ip and
+	// 0/ipv4/0
+	seen := make(map[string]bool)
+	for _, k := range keys {
+		if ip := networks[k]; ip != "" && !seen[ip] {
+			seen[ip] = true
+			ips = append(ips, ip)
+		}
+	}
+
+	return ips, nil
+}
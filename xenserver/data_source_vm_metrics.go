@@ -0,0 +1,154 @@
+package xenserver
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func dataSourceXenServerVMMetrics() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: dataSourceXenServerVMMetricsRead,
+
+		Schema: map[string]*schema.Schema{
+			"vm_uuid": &schema.Schema{
+				Type:         schema.TypeString,
+				Description:  "UUID of the VM to read the metrics of",
+				Required:     true,
+				ValidateFunc: validateUUID,
+			},
+			// Computed values
+			"power_state": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"memory_actual": &schema.Schema{
+				Type:        schema.TypeInt,
+				Description: "Memory the guest actually has, in bytes",
+				Computed:    true,
+			},
+			"vcpus_number": &schema.Schema{
+				Type:        schema.TypeInt,
+				Description: "Current number of VCPUs",
+				Computed:    true,
+			},
+			"vcpus_utilisation": &schema.Schema{
+				Type:        schema.TypeList,
+				Description: "Utilisation of each VCPU between 0 and 1, empty on XenServer versions which only record it in the RRDs",
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeFloat},
+			},
+			"state": &schema.Schema{
+				Type:        schema.TypeList,
+				Description: "State of the guest, e.g. blocked or running",
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"start_time": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "Time the VM has last been booted at, in RFC 3339 format",
+				Computed:    true,
+			},
+			"install_time": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "Time the VM has been installed at, in RFC 3339 format",
+				Computed:    true,
+			},
+			"last_updated": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "Time the metrics have last been updated at, in RFC 3339 format",
+				Computed:    true,
+			},
+			"guest_live": &schema.Schema{
+				Type:        schema.TypeBool,
+				Description: "Whether the guest agent sends heartbeats",
+				Computed:    true,
+			},
+			"pv_drivers_detected": &schema.Schema{
+				Type:     schema.TypeBool,
+				Computed: true,
+			},
+			"os_version": &schema.Schema{
+				Type:        schema.TypeMap,
+				Description: "Version of the guest OS as reported by the guest agent",
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"guest_last_updated": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "Time the guest agent has last reported at, in RFC 3339 format, empty without guest agent",
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func dataSourceXenServerVMMetricsRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*Connection)
+
+	uuid := d.Get("vm_uuid").(string)
+	vmRef, err := c.client.VM.GetByUUID(c.session, uuid)
+	if err != nil {
+		return diag.FromErr(referenceError(c, "VM", uuid, err))
+	}
+
+	// The metrics change all the time, so bypass the record cache
+	vm, err := c.client.VM.GetRecord(c.session, vmRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	metrics, err := c.client.VMMetrics.GetRecord(c.session, vm.Metrics)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	utilisation := make([]float64, 0, metrics.VCPUsNumber)
+	if len(metrics.VCPUsUtilisation) > 0 {
+		for vcpu := 0; vcpu < metrics.VCPUsNumber; vcpu++ {
+			utilisation = append(utilisation, metrics.VCPUsUtilisation[vcpu])
+		}
+	}
+
+	guestLive := false
+	pvDriversDetected := false
+	osVersion := map[string]string{}
+	guestLastUpdated := ""
+	if vm.GuestMetrics != "" && vm.GuestMetrics != "OpaqueRef:NULL" {
+		guest, err := c.client.VMGuestMetrics.GetRecord(c.session, vm.GuestMetrics)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		guestLive = guest.Live
+		pvDriversDetected = guest.PVDriversDetected
+		osVersion = guest.OSVersion
+		guestLastUpdated = formatMetricsTime(guest.LastUpdated)
+	}
+
+	d.SetId(vm.UUID)
+	d.Set("power_state", string(vm.PowerState))
+	d.Set("memory_actual", metrics.MemoryActual)
+	d.Set("vcpus_number", metrics.VCPUsNumber)
+	d.Set("vcpus_utilisation", utilisation)
+	d.Set("state", metrics.State)
+	d.Set("start_time", formatMetricsTime(metrics.StartTime))
+	d.Set("install_time", formatMetricsTime(metrics.InstallTime))
+	d.Set("last_updated", formatMetricsTime(metrics.LastUpdated))
+	d.Set("guest_live", guestLive)
+	d.Set("pv_drivers_detected", pvDriversDetected)
+	d.Set("guest_last_updated", guestLastUpdated)
+
+	return diag.FromErr(d.Set("os_version", osVersion))
+}
+
+// formatMetricsTime formats a time of the metrics in RFC 3339 format. XenServer
+// reports times which have never been set as the epoch, they are left empty.
+func formatMetricsTime(t time.Time) string {
+	if t.IsZero() || t.Unix() <= 0 {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
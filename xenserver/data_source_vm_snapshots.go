@@ -0,0 +1,118 @@
+package xenserver
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+func dataSourceXenServerVMSnapshots() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: dataSourceXenServerVMSnapshotsRead,
+
+		Schema: map[string]*schema.Schema{
+			"vm_uuid": &schema.Schema{
+				Type:         schema.TypeString,
+				Description:  "UUID of the VM to list the snapshots of",
+				Required:     true,
+				ValidateFunc: validateUUID,
+			},
+			// Computed values
+			"latest_uuid": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "UUID of the newest snapshot, empty if the VM has none",
+				Computed:    true,
+			},
+			"snapshots": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"uuid": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"name_label": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"snapshot_time": &schema.Schema{
+							Type:        schema.TypeString,
+							Description: "Time the snapshot has been taken at, in RFC 3339 format",
+							Computed:    true,
+						},
+						"is_checkpoint": &schema.Schema{
+							Type:        schema.TypeBool,
+							Description: "Whether the snapshot includes the memory of the VM",
+							Computed:    true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceXenServerVMSnapshotsRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*Connection)
+
+	vm := &VMDescriptor{
+		UUID: d.Get("vm_uuid").(string),
+	}
+	if err := vm.Load(c); err != nil {
+		return diag.FromErr(referenceError(c, "VM", vm.UUID, err))
+	}
+
+	snapshots, err := queryVMSnapshots(c, vm)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	list := make([]map[string]interface{}, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		list = append(list, map[string]interface{}{
+			"uuid":          snapshot.UUID,
+			"name_label":    snapshot.NameLabel,
+			"snapshot_time": snapshot.SnapshotTime.UTC().Format(time.RFC3339),
+			"is_checkpoint": snapshot.PowerState == xenapi.VMPowerStateSuspended,
+		})
+	}
+
+	latest := ""
+	if len(snapshots) > 0 {
+		latest = snapshots[0].UUID
+	}
+
+	d.SetId(vm.UUID)
+	d.Set("latest_uuid", latest)
+
+	return diag.FromErr(d.Set("snapshots", list))
+}
+
+// queryVMSnapshots returns the records of the snapshots of the VM, the newest
+// first.
+func queryVMSnapshots(c *Connection, vm *VMDescriptor) ([]xenapi.VMRecord, error) {
+	refs, err := c.client.VM.GetSnapshots(c.session, vm.VMRef)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]xenapi.VMRecord, 0, len(refs))
+	for _, ref := range refs {
+		snapshot, err := c.getVMRecord(ref)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].SnapshotTime.After(snapshots[j].SnapshotTime)
+	})
+
+	return snapshots, nil
+}
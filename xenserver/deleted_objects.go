@@ -0,0 +1,51 @@
+package xenserver
+
+import (
+	"context"
+	"log"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+// existsFunc reports whether the object of a resource still exists.
+type existsFunc func(d *schema.ResourceData, m interface{}) (bool, error)
+
+// forgetfulRead wraps the Read function of a resource so that objects deleted
+// outside of Terraform, e.g. in XenCenter, are removed from the state, and get
+// recreated by the next apply, instead of failing the plan.
+//
+// Read also fails when an object the resource merely refers to is gone, e.g.
+// the network of a VIF, so the resource is only forgotten when exists tells
+// that its own object is gone. Otherwise the error is kept.
+func forgetfulRead(read schema.ReadContextFunc, exists existsFunc) schema.ReadContextFunc {
+	return func(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+		diags := read(ctx, d, m)
+		if !diags.HasError() {
+			return diags
+		}
+
+		ok, err := exists(d, m)
+		if err != nil && !isObjectGoneError(err) || err == nil && ok {
+			return diags
+		}
+
+		log.Printf("[WARN] %s no longer exists, removing it from the state", d.Id())
+		d.SetId("")
+		return nil
+	}
+}
+
+// isObjectGoneError reports whether XenServer rejected a call because the
+// object, or an object it belongs to, does not exist (anymore).
+func isObjectGoneError(err error) bool {
+	if xenErr, ok := err.(*xenapi.Error); ok {
+		switch xenErr.Code() {
+		case xenapi.ERR_UUID_INVALID, xenapi.ERR_HANDLE_INVALID:
+			return true
+		}
+	}
+
+	return false
+}
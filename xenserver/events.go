@@ -0,0 +1,129 @@
+package xenserver
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	xmlrpc "github.com/amfranz/go-xmlrpc-client"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+// Longest time a single event.from call blocks on the server. The call is
+// aborted along with the context of the connection, so this only bounds the
+// time between two checks of the watched objects.
+const eventWaitTimeout = 30 * time.Second
+
+// eventWatcher follows changes of XenAPI objects through event.from. Waiting
+// for a long running operation then blocks on the server until one of the
+// watched objects changed, instead of fetching their records in a loop, which
+// puts less load on the pool master and notices changes right away.
+//
+// Pools which do not support event.from, or watchers which failed to
+// subscribe, fall back to waiting for a fixed interval. Callers therefore
+// check the state of the watched objects after every wait, the events only
+// tell them when to do so.
+type eventWatcher struct {
+	c               *Connection
+	classes         []string
+	token           string
+	pollInterval    time.Duration
+	pollingFallback bool
+}
+
+// newEventWatcher subscribes to the changes of the classes, e.g. "vm" for all
+// VMs or "task/OpaqueRef:..." for a single object. Only changes made after the
+// watcher has been created are reported. Without events it waits for
+// pollInterval instead.
+func newEventWatcher(c *Connection, pollInterval time.Duration, classes ...string) *eventWatcher {
+	w := &eventWatcher{
+		c:            c,
+		classes:      classes,
+		pollInterval: pollInterval,
+	}
+
+	if err := w.subscribe(); err != nil {
+		log.Printf("[WARN] Failed to subscribe to events of %v, polling instead: %s", classes, err)
+		w.pollingFallback = true
+	}
+
+	return w
+}
+
+// subscribe fetches the token of the most recent event. Without classes,
+// event.from returns no events but the current token right away.
+func (w *eventWatcher) subscribe() error {
+	w.token = ""
+	_, err := w.from([]string{}, 0)
+	return err
+}
+
+// from calls event.from and remembers the token to continue from. The
+// generated client does not match the result of event.from, which is a struct
+// holding the events along with the token, so it is called by name.
+func (w *eventWatcher) from(classes []string, timeout time.Duration) ([]interface{}, error) {
+	params := make([]interface{}, len(classes))
+	for i, class := range classes {
+		params[i] = class
+	}
+
+	result, err := w.c.client.APICall("event.from", string(w.c.session), params, w.token, timeout.Seconds())
+	if err != nil {
+		return nil, err
+	}
+
+	batch, ok := result.Value.(xmlrpc.Struct)
+	if !ok {
+		return nil, fmt.Errorf("event.from did not return a struct")
+	}
+
+	token, ok := batch["token"].(string)
+	if !ok {
+		return nil, fmt.Errorf("event.from did not return a token")
+	}
+	w.token = token
+
+	events, _ := batch["events"].([]interface{})
+	return events, nil
+}
+
+// wait blocks until one of the watched objects changed, or timeout passed.
+func (w *eventWatcher) wait(timeout time.Duration) error {
+	if w.pollingFallback {
+		return w.sleep()
+	}
+
+	events, err := w.from(w.classes, timeout)
+	if err != nil {
+		if ctxErr := w.c.ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+
+		// Changes in between are of no concern, the caller checks the state
+		// of the objects after every wait anyway
+		if xenErr, ok := err.(*xenapi.Error); ok {
+			switch xenErr.Code() {
+			case xenapi.ERR_EVENTS_LOST, xenapi.ERR_EVENT_FROM_TOKEN_PARSE_FAILURE:
+				log.Printf("[DEBUG] Resubscribing to events of %v: %s", w.classes, err)
+				return w.subscribe()
+			}
+		}
+
+		return err
+	}
+
+	log.Printf("[TRACE] Received %d events of %v", len(events), w.classes)
+	return nil
+}
+
+func (w *eventWatcher) sleep() error {
+	timer := time.NewTimer(w.pollInterval)
+	defer timer.Stop()
+
+	select {
+	case <-w.c.ctx.Done():
+		return w.c.ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,214 @@
+package xenserver
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+// Marks the VBDs and VDIs of media generated for a VM, e.g. answer files for
+// its first boot. The value tells what the media has been generated for. These
+// VBDs are not part of the cdrom and hard_drive blocks of the VM, and their
+// VDIs are destroyed along with the VM.
+const vbdOtherConfigGenerated = "terraform_generated"
+
+// generatedMediaSR returns the SR identified by uuid. If uuid is empty the
+// default SR of the provider is used, or else the default SR of the pool.
+func generatedMediaSR(c *Connection, uuid string) (*SRDescriptor, error) {
+	if uuid == "" {
+		uuid = c.defaultSR
+	}
+
+	sr := &SRDescriptor{
+		UUID: uuid,
+	}
+
+	if uuid == "" {
+		pool, err := getPool(c)
+		if err != nil {
+			return nil, err
+		}
+
+		if sr.SRRef, err = c.client.Pool.GetDefaultSR(c.session, pool); err != nil {
+			return nil, err
+		}
+
+		if sr.SRRef == "OpaqueRef:NULL" {
+			return nil, fmt.Errorf("pool %s has no default SR, an SR has to be given", c.poolDescription())
+		}
+	}
+
+	if err := sr.Load(c); err != nil {
+		return nil, referenceError(c, "SR", uuid, err)
+	}
+
+	return sr, nil
+}
+
+// attachGeneratedISO uploads the ISO image to a new VDI on the SR and attaches
+// it to the VM as read-only CD. Media previously generated for the same purpose
+// is replaced, by changing the CD of running VMs.
+func attachGeneratedISO(c *Connection, vm *VMDescriptor, sr *SRDescriptor, purpose string, image []byte) error {
+	otherConfig := map[string]string{
+		vbdOtherConfigGenerated: purpose,
+	}
+
+	var vdiRef xenapi.VDIRef
+	err := withSROperation(c, sr.SRRef, func() error {
+		var err error
+		vdiRef, err = c.client.VDI.Create(c.session, xenapi.VDIRecord{
+			NameLabel:   fmt.Sprintf("%s %s", vm.Name, purpose),
+			VirtualSize: len(image),
+			SR:          sr.SRRef,
+			Type:        xenapi.VdiTypeUser,
+			OtherConfig: otherConfig,
+		})
+		if err != nil {
+			return err
+		}
+
+		log.Printf("[DEBUG] Uploading %s of VM %s to VDI %s", purpose, vm.UUID, vdiRef)
+		if err := importRawVDI(c, vdiRef, bytes.NewReader(image), int64(len(image)), vdiFormatRaw); err != nil {
+			if destroyErr := c.client.VDI.Destroy(c.session, vdiRef); destroyErr != nil {
+				log.Println("[ERROR] ", destroyErr)
+			}
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	vbdRef, vbd, err := findGeneratedVBD(c, vm, purpose)
+	if err != nil {
+		return err
+	}
+
+	if vbdRef != "" && vm.PowerState == xenapi.VMPowerStateRunning {
+		log.Printf("[DEBUG] Changing %s of VM %s", purpose, vm.UUID)
+		if !vbd.Empty {
+			if err := c.client.VBD.Eject(c.session, vbdRef); err != nil {
+				return err
+			}
+		}
+
+		if err := c.client.VBD.Insert(c.session, vbdRef, vdiRef); err != nil {
+			return err
+		}
+	} else {
+		if vbdRef != "" {
+			if err := c.client.VBD.Destroy(c.session, vbdRef); err != nil {
+				return err
+			}
+		}
+
+		vdi := &VDIDescriptor{
+			VDIRef: vdiRef,
+		}
+		if err := vdi.Query(c); err != nil {
+			return err
+		}
+
+		if _, err := createVBD(c, &VBDDescriptor{
+			VM:          vm,
+			VDI:         vdi,
+			Type:        xenapi.VbdTypeCD,
+			Mode:        xenapi.VbdModeRO,
+			OtherConfig: otherConfig,
+		}); err != nil {
+			return err
+		}
+	}
+
+	if vbdRef != "" && !vbd.Empty {
+		return destroyGeneratedVDIs(c, []xenapi.VDIRef{vbd.VDI})
+	}
+
+	return nil
+}
+
+// findGeneratedVBD returns the VBD of the media generated for the VM for the
+// purpose, or an empty reference if there is none.
+func findGeneratedVBD(c *Connection, vm *VMDescriptor, purpose string) (xenapi.VBDRef, xenapi.VBDRecord, error) {
+	vbdRefs, err := c.client.VM.GetVBDs(c.session, vm.VMRef)
+	if err != nil {
+		return "", xenapi.VBDRecord{}, err
+	}
+
+	for _, vbdRef := range vbdRefs {
+		vbd, err := c.client.VBD.GetRecord(c.session, vbdRef)
+		if err != nil {
+			return "", xenapi.VBDRecord{}, err
+		}
+
+		if vbd.OtherConfig[vbdOtherConfigGenerated] == purpose {
+			return vbdRef, vbd, nil
+		}
+	}
+
+	return "", xenapi.VBDRecord{}, nil
+}
+
+// detachGeneratedISO removes the media generated for the VM for the purpose.
+// The CD of a running VM is ejected instead, as it cannot be unplugged.
+func detachGeneratedISO(c *Connection, vm *VMDescriptor, purpose string) error {
+	vbdRef, vbd, err := findGeneratedVBD(c, vm, purpose)
+	if err != nil || vbdRef == "" {
+		return err
+	}
+
+	if vm.PowerState == xenapi.VMPowerStateRunning {
+		if !vbd.Empty {
+			if err := c.client.VBD.Eject(c.session, vbdRef); err != nil {
+				return err
+			}
+		}
+	} else {
+		if err := c.client.VBD.Destroy(c.session, vbdRef); err != nil {
+			return err
+		}
+	}
+
+	if vbd.Empty {
+		return nil
+	}
+
+	return destroyGeneratedVDIs(c, []xenapi.VDIRef{vbd.VDI})
+}
+
+// queryGeneratedVDIs returns the VDIs of the media generated for the VM.
+func queryGeneratedVDIs(c *Connection, vm *VMDescriptor) ([]xenapi.VDIRef, error) {
+	vbdRefs, err := c.client.VM.GetVBDs(c.session, vm.VMRef)
+	if err != nil {
+		return nil, err
+	}
+
+	vdis := make([]xenapi.VDIRef, 0)
+	for _, vbdRef := range vbdRefs {
+		vbd, err := c.client.VBD.GetRecord(c.session, vbdRef)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := vbd.OtherConfig[vbdOtherConfigGenerated]; ok && !vbd.Empty {
+			vdis = append(vdis, vbd.VDI)
+		}
+	}
+
+	return vdis, nil
+}
+
+func destroyGeneratedVDIs(c *Connection, vdis []xenapi.VDIRef) error {
+	for _, vdi := range vdis {
+		log.Println("[DEBUG] Destroying generated VDI ", vdi)
+		if err := c.client.VDI.Destroy(c.session, vdi); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
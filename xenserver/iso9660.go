@@ -0,0 +1,437 @@
+package xenserver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// The ISO 9660 images generated here carry small configuration files for the
+// guest, e.g. answer files, so that they can be attached as CD. Besides the
+// primary directory tree with its restricted file names, the images have a
+// Joliet tree with the file names as given, which Windows and Linux prefer.
+
+const (
+	isoSectorSize = 2048
+
+	// The first 16 sectors are reserved for the system area
+	isoFirstDescriptorSector = 16
+
+	isoMaxJolietNameLength = 64
+)
+
+type isoFile struct {
+	name string
+	data []byte
+
+	sector uint32
+}
+
+type isoDirectory struct {
+	name   string
+	parent *isoDirectory
+	dirs   []*isoDirectory
+	files  []*isoFile
+	number int
+	sector [2]uint32
+	size   [2]uint32
+}
+
+// isoTree distinguishes the primary directory tree from the Joliet tree.
+type isoTree int
+
+const (
+	isoTreePrimary isoTree = iota
+	isoTreeJoliet
+)
+
+// buildISO9660 returns an ISO 9660 image with the volume label volumeID
+// holding the files, keyed by their slash separated path.
+func buildISO9660(volumeID string, files map[string][]byte) ([]byte, error) {
+	root := &isoDirectory{}
+
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		clean := strings.Trim(path.Clean("/"+p), "/")
+		if clean == "" {
+			return nil, fmt.Errorf("invalid file path %q", p)
+		}
+
+		dir := root
+		parts := strings.Split(clean, "/")
+		for _, part := range parts[:len(parts)-1] {
+			if dir.hasEntry(part) && !dir.hasSubdirectory(part) {
+				return nil, fmt.Errorf("file path %q conflicts with another file", p)
+			}
+			dir = dir.subdirectory(part)
+		}
+
+		name := parts[len(parts)-1]
+		if dir.hasEntry(name) {
+			return nil, fmt.Errorf("duplicate file path %q", p)
+		}
+		dir.files = append(dir.files, &isoFile{name: name, data: files[p]})
+	}
+
+	dirs := root.levels()
+	for i, dir := range dirs {
+		dir.number = i + 1
+	}
+
+	// The names of the primary tree are restricted, so they may collide even
+	// though the names of the Joliet tree do not
+	for _, dir := range dirs {
+		seen := make(map[string]string)
+		for _, name := range dir.entryNames() {
+			if len(utf16.Encode([]rune(name))) > isoMaxJolietNameLength {
+				return nil, fmt.Errorf("file name %q is longer than %d characters", name, isoMaxJolietNameLength)
+			}
+
+			id := string(isoIdentifier(name, dir.hasSubdirectory(name), isoTreePrimary))
+			if other, ok := seen[id]; ok {
+				return nil, fmt.Errorf("file names %q and %q cannot be told apart on the image", other, name)
+			}
+			seen[id] = name
+		}
+	}
+
+	// The size of the directory extents does not depend on their location, so
+	// all sizes are computed before the sectors are assigned
+	for _, tree := range []isoTree{isoTreePrimary, isoTreeJoliet} {
+		for _, dir := range dirs {
+			dir.size[tree] = uint32(len(dir.directoryRecords(tree)))
+		}
+	}
+
+	pathTableSize := [2]uint32{}
+	for _, tree := range []isoTree{isoTreePrimary, isoTreeJoliet} {
+		pathTableSize[tree] = uint32(len(isoPathTable(dirs, tree, binary.LittleEndian)))
+	}
+
+	// Primary, Joliet and terminating volume descriptors
+	sector := uint32(isoFirstDescriptorSector + 3)
+
+	pathTableSectors := [2][2]uint32{}
+	for _, tree := range []isoTree{isoTreePrimary, isoTreeJoliet} {
+		for i := range pathTableSectors[tree] {
+			pathTableSectors[tree][i] = sector
+			sector += isoSectors(pathTableSize[tree])
+		}
+	}
+
+	for _, tree := range []isoTree{isoTreePrimary, isoTreeJoliet} {
+		for _, dir := range dirs {
+			dir.sector[tree] = sector
+			sector += isoSectors(dir.size[tree])
+		}
+	}
+
+	for _, dir := range dirs {
+		for _, file := range dir.files {
+			file.sector = sector
+			sector += isoSectors(uint32(len(file.data)))
+		}
+	}
+
+	image := make([]byte, int(sector)*isoSectorSize)
+
+	for _, tree := range []isoTree{isoTreePrimary, isoTreeJoliet} {
+		descriptor := isoVolumeDescriptor(tree, volumeID, sector, root, pathTableSize[tree], pathTableSectors[tree])
+		copy(image[(isoFirstDescriptorSector+int(tree))*isoSectorSize:], descriptor)
+
+		copy(image[pathTableSectors[tree][0]*isoSectorSize:], isoPathTable(dirs, tree, binary.LittleEndian))
+		copy(image[pathTableSectors[tree][1]*isoSectorSize:], isoPathTable(dirs, tree, binary.BigEndian))
+
+		// The records refer to the sectors, which are known by now
+		for _, dir := range dirs {
+			copy(image[dir.sector[tree]*isoSectorSize:], dir.directoryRecords(tree))
+		}
+	}
+
+	terminator := image[(isoFirstDescriptorSector+2)*isoSectorSize:]
+	terminator[0] = 255
+	copy(terminator[1:], "CD001")
+	terminator[6] = 1
+
+	for _, dir := range dirs {
+		for _, file := range dir.files {
+			copy(image[file.sector*isoSectorSize:], file.data)
+		}
+	}
+
+	return image, nil
+}
+
+func (dir *isoDirectory) subdirectory(name string) *isoDirectory {
+	for _, sub := range dir.dirs {
+		if sub.name == name {
+			return sub
+		}
+	}
+
+	sub := &isoDirectory{name: name, parent: dir}
+	dir.dirs = append(dir.dirs, sub)
+	return sub
+}
+
+func (dir *isoDirectory) hasSubdirectory(name string) bool {
+	for _, sub := range dir.dirs {
+		if sub.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (dir *isoDirectory) hasEntry(name string) bool {
+	for _, entry := range dir.entryNames() {
+		if entry == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (dir *isoDirectory) entryNames() []string {
+	names := make([]string, 0, len(dir.dirs)+len(dir.files))
+	for _, sub := range dir.dirs {
+		names = append(names, sub.name)
+	}
+	for _, file := range dir.files {
+		names = append(names, file.name)
+	}
+	return names
+}
+
+// levels returns the directories breadth first, the order of the path tables.
+func (dir *isoDirectory) levels() []*isoDirectory {
+	dirs := []*isoDirectory{dir}
+	for i := 0; i < len(dirs); i++ {
+		subs := append([]*isoDirectory(nil), dirs[i].dirs...)
+		sort.Slice(subs, func(a, b int) bool {
+			return bytes.Compare(isoIdentifier(subs[a].name, true, isoTreePrimary), isoIdentifier(subs[b].name, true, isoTreePrimary)) < 0
+		})
+		dirs = append(dirs, subs...)
+	}
+	return dirs
+}
+
+// directoryRecords returns the extent of the directory in the tree, padded to
+// full sectors. Records must not span sectors.
+func (dir *isoDirectory) directoryRecords(tree isoTree) []byte {
+	parent := dir.parent
+	if parent == nil {
+		parent = dir
+	}
+
+	type entry struct {
+		id     []byte
+		sector uint32
+		size   uint32
+		isDir  bool
+	}
+
+	entries := make([]entry, 0, len(dir.dirs)+len(dir.files))
+	for _, sub := range dir.dirs {
+		entries = append(entries, entry{isoIdentifier(sub.name, true, tree), sub.sector[tree], sub.size[tree], true})
+	}
+	for _, file := range dir.files {
+		entries = append(entries, entry{isoIdentifier(file.name, false, tree), file.sector, uint32(len(file.data)), false})
+	}
+	sort.Slice(entries, func(a, b int) bool {
+		return bytes.Compare(entries[a].id, entries[b].id) < 0
+	})
+
+	entries = append([]entry{
+		{[]byte{0}, dir.sector[tree], dir.size[tree], true},
+		{[]byte{1}, parent.sector[tree], parent.size[tree], true},
+	}, entries...)
+
+	var buf []byte
+	for _, e := range entries {
+		record := isoDirectoryRecord(e.id, e.sector, e.size, e.isDir)
+		if len(buf)%isoSectorSize+len(record) > isoSectorSize {
+			buf = append(buf, make([]byte, isoSectorSize-len(buf)%isoSectorSize)...)
+		}
+		buf = append(buf, record...)
+	}
+
+	if len(buf)%isoSectorSize != 0 {
+		buf = append(buf, make([]byte, isoSectorSize-len(buf)%isoSectorSize)...)
+	}
+
+	return buf
+}
+
+func isoDirectoryRecord(id []byte, sector, size uint32, isDir bool) []byte {
+	length := 33 + len(id)
+	if length%2 != 0 {
+		length++
+	}
+
+	record := make([]byte, length)
+	record[0] = byte(length)
+	putBothEndian32(record[2:], sector)
+	putBothEndian32(record[10:], size)
+	// The recording date is left unspecified, so the image only depends on the
+	// files
+	if isDir {
+		record[25] = 2
+	}
+	putBothEndian16(record[28:], 1)
+	record[32] = byte(len(id))
+	copy(record[33:], id)
+
+	return record
+}
+
+func isoPathTable(dirs []*isoDirectory, tree isoTree, order binary.ByteOrder) []byte {
+	var buf []byte
+	for _, dir := range dirs {
+		id := []byte{0}
+		parent := 1
+		if dir.parent != nil {
+			id = isoIdentifier(dir.name, true, tree)
+			parent = dir.parent.number
+		}
+
+		record := make([]byte, 8+len(id)+len(id)%2)
+		record[0] = byte(len(id))
+		order.PutUint32(record[2:], dir.sector[tree])
+		order.PutUint16(record[6:], uint16(parent))
+		copy(record[8:], id)
+
+		buf = append(buf, record...)
+	}
+	return buf
+}
+
+func isoVolumeDescriptor(tree isoTree, volumeID string, sectors uint32, root *isoDirectory, pathTableSize uint32, pathTableSectors [2]uint32) []byte {
+	descriptor := make([]byte, isoSectorSize)
+
+	descriptor[0] = 1
+	if tree == isoTreeJoliet {
+		descriptor[0] = 2
+	}
+	copy(descriptor[1:], "CD001")
+	descriptor[6] = 1
+
+	isoPadText(descriptor[8:40], "", tree)
+	isoPadText(descriptor[40:72], volumeID, tree)
+	putBothEndian32(descriptor[80:], sectors)
+	if tree == isoTreeJoliet {
+		// UCS-2 level 3
+		copy(descriptor[88:], "%/E")
+	}
+	putBothEndian16(descriptor[120:], 1)
+	putBothEndian16(descriptor[124:], 1)
+	putBothEndian16(descriptor[128:], isoSectorSize)
+	putBothEndian32(descriptor[132:], pathTableSize)
+	binary.LittleEndian.PutUint32(descriptor[140:], pathTableSectors[0])
+	binary.BigEndian.PutUint32(descriptor[148:], pathTableSectors[1])
+	copy(descriptor[156:190], isoDirectoryRecord([]byte{0}, root.sector[tree], root.size[tree], true))
+
+	for _, field := range [][2]int{{190, 318}, {318, 446}, {446, 574}, {574, 702}, {702, 739}, {739, 776}, {776, 813}} {
+		isoPadText(descriptor[field[0]:field[1]], "", tree)
+	}
+
+	// Creation, modification, expiration and effective dates are unspecified
+	for _, offset := range []int{813, 830, 847, 864} {
+		copy(descriptor[offset:], "0000000000000000")
+	}
+	descriptor[881] = 1
+
+	return descriptor
+}
+
+// isoIdentifier returns the name of a file or directory as recorded in the
+// tree. The primary tree only allows upper case letters, digits and
+// underscores, with a version appended to file names.
+func isoIdentifier(name string, isDir bool, tree isoTree) []byte {
+	if tree == isoTreeJoliet {
+		return isoUCS2(name)
+	}
+
+	base, ext := name, ""
+	if !isDir {
+		if i := strings.LastIndex(name, "."); i > 0 {
+			base, ext = name[:i], name[i+1:]
+		}
+	}
+
+	id := isoDChars(base, 30-len(ext))
+	if !isDir {
+		id += "." + isoDChars(ext, 30-len(id)) + ";1"
+	}
+	return []byte(id)
+}
+
+func isoDChars(s string, max int) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(s) {
+		if b.Len() >= max {
+			break
+		}
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+func isoUCS2(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	buf := make([]byte, 2*len(units))
+	for i, unit := range units {
+		binary.BigEndian.PutUint16(buf[2*i:], unit)
+	}
+	return buf
+}
+
+// isoPadText fills the field with text, padded with spaces.
+func isoPadText(field []byte, text string, tree isoTree) {
+	if tree == isoTreeJoliet {
+		encoded := isoUCS2(text)
+		for i := 0; i+1 < len(field); i += 2 {
+			if i+1 < len(encoded) {
+				field[i], field[i+1] = encoded[i], encoded[i+1]
+			} else {
+				field[i], field[i+1] = 0, ' '
+			}
+		}
+		return
+	}
+
+	for i := range field {
+		if i < len(text) {
+			field[i] = text[i]
+		} else {
+			field[i] = ' '
+		}
+	}
+}
+
+func isoSectors(size uint32) uint32 {
+	return (size + isoSectorSize - 1) / isoSectorSize
+}
+
+func putBothEndian16(b []byte, v uint16) {
+	binary.LittleEndian.PutUint16(b, v)
+	binary.BigEndian.PutUint16(b[2:], v)
+}
+
+func putBothEndian32(b []byte, v uint32) {
+	binary.LittleEndian.PutUint32(b, v)
+	binary.BigEndian.PutUint32(b[4:], v)
+}
@@ -0,0 +1,330 @@
+package xenserver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// isoRecord is a directory record parsed back from an image.
+type isoRecord struct {
+	id     []byte
+	sector uint32
+	size   uint32
+	isDir  bool
+}
+
+func TestBuildISO9660(t *testing.T) {
+	cases := []struct {
+		name  string
+		files map[string][]byte
+		// The path of each file in the primary tree, keyed by its path
+		primary map[string]string
+		err     string
+	}{
+		{
+			name: "root files",
+			files: map[string][]byte{
+				"user-data": []byte("#cloud-config\n"),
+				"meta-data": []byte("instance-id: vm\n"),
+			},
+			primary: map[string]string{
+				"user-data": "USER_DATA.;1",
+				"meta-data": "META_DATA.;1",
+			},
+		},
+		{
+			name: "nested paths",
+			files: map[string][]byte{
+				"openstack/latest/meta_data.json": []byte(`{"uuid": "vm"}`),
+				"openstack/latest/user_data":      []byte("#cloud-config\n"),
+				"/autounattend.xml":               []byte("<unattend/>"),
+			},
+			primary: map[string]string{
+				"openstack/latest/meta_data.json": "OPENSTACK/LATEST/META_DATA.JSON;1",
+				"openstack/latest/user_data":      "OPENSTACK/LATEST/USER_DATA.;1",
+				"/autounattend.xml":               "AUTOUNATTEND.XML;1",
+			},
+		},
+		{
+			name: "sector sized and empty files",
+			files: map[string][]byte{
+				"large.bin": bytes.Repeat([]byte{0xa5}, isoSectorSize+1),
+				"empty":     {},
+			},
+			primary: map[string]string{
+				"large.bin": "LARGE.BIN;1",
+				"empty":     "EMPTY.;1",
+			},
+		},
+		{
+			name: "names colliding in the primary tree",
+			files: map[string][]byte{
+				"a-b.txt": []byte("1"),
+				"a_b.txt": []byte("2"),
+			},
+			err: "cannot be told apart",
+		},
+		{
+			name: "nested names colliding in the primary tree",
+			files: map[string][]byte{
+				"config/Network.cfg": []byte("1"),
+				"config/network.cfg": []byte("2"),
+			},
+			err: "cannot be told apart",
+		},
+		{
+			name: "file and directory of the same name",
+			files: map[string][]byte{
+				"config":      []byte("1"),
+				"config/file": []byte("2"),
+			},
+			err: "conflicts with another file",
+		},
+		{
+			name: "duplicate paths",
+			files: map[string][]byte{
+				"user-data":  []byte("1"),
+				"/user-data": []byte("2"),
+			},
+			err: "duplicate file path",
+		},
+		{
+			name: "name too long",
+			files: map[string][]byte{
+				strings.Repeat("x", isoMaxJolietNameLength+1): []byte("1"),
+			},
+			err: "longer than",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			image, err := buildISO9660("CONFIG", tc.files)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error containing %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(image)%isoSectorSize != 0 {
+				t.Fatalf("image size %d is no multiple of the sector size", len(image))
+			}
+
+			primaryRoot := checkISODescriptor(t, image, isoTreePrimary, "CONFIG")
+			jolietRoot := checkISODescriptor(t, image, isoTreeJoliet, "CONFIG")
+
+			terminator := isoSector(t, image, isoFirstDescriptorSector+2)
+			if terminator[0] != 255 || string(terminator[1:6]) != "CD001" {
+				t.Errorf("no volume descriptor set terminator in sector %d", isoFirstDescriptorSector+2)
+			}
+
+			for p, data := range tc.files {
+				primary := lookupISOFile(t, image, primaryRoot, strings.Split(tc.primary[p], "/"), func(name string) []byte {
+					return []byte(name)
+				})
+				if !bytes.Equal(isoExtent(t, image, primary), data) {
+					t.Errorf("primary tree: content of %s differs", tc.primary[p])
+				}
+
+				joliet := lookupISOFile(t, image, jolietRoot, strings.Split(strings.Trim(p, "/"), "/"), isoUCS2)
+				if !bytes.Equal(isoExtent(t, image, joliet), data) {
+					t.Errorf("Joliet tree: content of %s differs", p)
+				}
+			}
+		})
+	}
+}
+
+// checkISODescriptor verifies the volume descriptor of the tree and returns the
+// record of its root directory.
+func checkISODescriptor(t *testing.T, image []byte, tree isoTree, volumeID string) isoRecord {
+	t.Helper()
+
+	sector := isoFirstDescriptorSector + int(tree)
+	descriptor := isoSector(t, image, sector)
+
+	typ := byte(1)
+	label := []byte(volumeID + strings.Repeat(" ", 32-len(volumeID)))
+	if tree == isoTreeJoliet {
+		typ = 2
+		label = isoUCS2(volumeID + strings.Repeat(" ", 16-len(volumeID)))
+		if string(descriptor[88:91]) != "%/E" {
+			t.Errorf("sector %d: Joliet escape sequence is %q", sector, descriptor[88:91])
+		}
+	}
+
+	if descriptor[0] != typ || string(descriptor[1:6]) != "CD001" || descriptor[6] != 1 {
+		t.Fatalf("sector %d: no volume descriptor of type %d", sector, typ)
+	}
+	if !bytes.Equal(descriptor[40:72], label) {
+		t.Errorf("sector %d: volume identifier is %q", sector, descriptor[40:72])
+	}
+	if size := readBothEndian32(t, descriptor[80:]); int(size)*isoSectorSize != len(image) {
+		t.Errorf("sector %d: volume space size is %d sectors, the image has %d", sector, size, len(image)/isoSectorSize)
+	}
+	if size := readBothEndian16(t, descriptor[128:]); size != isoSectorSize {
+		t.Errorf("sector %d: logical block size is %d", sector, size)
+	}
+
+	root, _ := parseISORecord(t, descriptor[156:190])
+	if !root.isDir || !bytes.Equal(root.id, []byte{0}) {
+		t.Fatalf("sector %d: root directory record is invalid", sector)
+	}
+
+	// The root is its own parent
+	records := readISODirectory(t, image, root)
+	if len(records) < 2 || records[0].sector != root.sector || records[1].sector != root.sector {
+		t.Errorf("sector %d: root directory lacks the records of itself and its parent", sector)
+	}
+
+	return root
+}
+
+// lookupISOFile resolves the path below the directory dir, with the names
+// encoded as recorded in the tree.
+func lookupISOFile(t *testing.T, image []byte, dir isoRecord, path []string, encode func(string) []byte) isoRecord {
+	t.Helper()
+
+	for i, name := range path {
+		found := false
+		for _, record := range readISODirectory(t, image, dir)[2:] {
+			if bytes.Equal(record.id, encode(name)) {
+				if record.isDir != (i < len(path)-1) {
+					t.Fatalf("%s is recorded with the wrong type", strings.Join(path[:i+1], "/"))
+				}
+				dir, found = record, true
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("%s not found", strings.Join(path[:i+1], "/"))
+		}
+	}
+
+	return dir
+}
+
+// readISODirectory returns the records of the directory extent, in the order
+// they are recorded.
+func readISODirectory(t *testing.T, image []byte, dir isoRecord) []isoRecord {
+	t.Helper()
+
+	extent := isoExtent(t, image, dir)
+	records := make([]isoRecord, 0)
+	for offset := 0; offset < len(extent); {
+		// Records do not span sectors, the rest of a sector is zero padded
+		if extent[offset] == 0 {
+			offset += isoSectorSize - offset%isoSectorSize
+			continue
+		}
+
+		record, length := parseISORecord(t, extent[offset:])
+		if offset%isoSectorSize+length > isoSectorSize {
+			t.Fatalf("directory record at offset %d spans sectors", offset)
+		}
+		records = append(records, record)
+		offset += length
+	}
+
+	// Following the records of the directory itself and its parent
+	for i := 3; i < len(records); i++ {
+		if bytes.Compare(records[i-1].id, records[i].id) >= 0 {
+			t.Errorf("directory records %q and %q are not sorted", records[i-1].id, records[i].id)
+		}
+	}
+
+	return records
+}
+
+func parseISORecord(t *testing.T, b []byte) (isoRecord, int) {
+	t.Helper()
+
+	length := int(b[0])
+	if length < 34 || length > len(b) || 33+int(b[32]) > length {
+		t.Fatalf("invalid directory record of length %d", length)
+	}
+
+	return isoRecord{
+		id:     b[33 : 33+int(b[32])],
+		sector: readBothEndian32(t, b[2:]),
+		size:   readBothEndian32(t, b[10:]),
+		isDir:  b[25]&2 != 0,
+	}, length
+}
+
+func isoExtent(t *testing.T, image []byte, record isoRecord) []byte {
+	t.Helper()
+
+	start := int(record.sector) * isoSectorSize
+	if start+int(record.size) > len(image) {
+		t.Fatalf("extent at sector %d of %d bytes exceeds the image", record.sector, record.size)
+	}
+	return image[start : start+int(record.size)]
+}
+
+func isoSector(t *testing.T, image []byte, sector int) []byte {
+	t.Helper()
+
+	if (sector+1)*isoSectorSize > len(image) {
+		t.Fatalf("sector %d exceeds the image", sector)
+	}
+	return image[sector*isoSectorSize : (sector+1)*isoSectorSize]
+}
+
+func readBothEndian16(t *testing.T, b []byte) uint16 {
+	t.Helper()
+
+	v := binary.LittleEndian.Uint16(b)
+	if binary.BigEndian.Uint16(b[2:]) != v {
+		t.Errorf("both-endian value %x differs between its halves", b[:4])
+	}
+	return v
+}
+
+func readBothEndian32(t *testing.T, b []byte) uint32 {
+	t.Helper()
+
+	v := binary.LittleEndian.Uint32(b)
+	if binary.BigEndian.Uint32(b[4:]) != v {
+		t.Errorf("both-endian value %x differs between its halves", b[:8])
+	}
+	return v
+}
+
+func TestISOIdentifier(t *testing.T) {
+	cases := []struct {
+		name    string
+		isDir   bool
+		primary string
+	}{
+		{"user-data", false, "USER_DATA.;1"},
+		{"meta_data.json", false, "META_DATA.JSON;1"},
+		{"archive.tar.gz", false, "ARCHIVE_TAR.GZ;1"},
+		{".hidden", false, "_HIDDEN.;1"},
+		{"openstack", true, "OPENSTACK"},
+		{"v1.0", true, "V1_0"},
+		{strings.Repeat("a", 40) + ".txt", false, strings.Repeat("A", 27) + ".TXT;1"},
+	}
+
+	for _, tc := range cases {
+		if id := string(isoIdentifier(tc.name, tc.isDir, isoTreePrimary)); id != tc.primary {
+			t.Errorf("primary identifier of %q is %q, expected %q", tc.name, id, tc.primary)
+		}
+
+		joliet := isoIdentifier(tc.name, tc.isDir, isoTreeJoliet)
+		units := make([]uint16, len(joliet)/2)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(joliet[2*i:])
+		}
+		if name := string(utf16.Decode(units)); name != tc.name {
+			t.Errorf("Joliet identifier of %q decodes to %q", tc.name, name)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package xenserver
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+const (
+	lifecycleHookSchemaEvent     = "event"
+	lifecycleHookSchemaPlugin    = "plugin"
+	lifecycleHookSchemaFunction  = "function"
+	lifecycleHookSchemaArguments = "arguments"
+	lifecycleHookSchemaMessage   = "message"
+
+	lifecycleHookEventPostCreate = "post_create"
+	lifecycleHookEventPreDestroy = "pre_destroy"
+
+	// Priority used for messages recorded by hooks, 5 is informational
+	lifecycleHookMessagePriority = 5
+)
+
+func resourceLifecycleHook() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			lifecycleHookSchemaEvent: &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+				ValidateFunc: validation.StringInSlice([]string{
+					lifecycleHookEventPostCreate,
+					lifecycleHookEventPreDestroy,
+				}, false),
+			},
+			lifecycleHookSchemaPlugin: &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			lifecycleHookSchemaFunction: &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			lifecycleHookSchemaArguments: &schema.Schema{
+				Type:     schema.TypeMap,
+				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			lifecycleHookSchemaMessage: &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+		},
+	}
+}
+
+func getPoolMaster(c *Connection) (xenapi.HostRef, error) {
+	pools, err := c.client.Pool.GetAll(c.session)
+	if err != nil {
+		return "", err
+	}
+
+	if len(pools) == 0 {
+		return "", fmt.Errorf("no pool found")
+	}
+
+	return c.client.Pool.GetMaster(c.session, pools[0])
+}
+
+// runLifecycleHooks executes all hooks registered for the given event against
+// the object identified by cls and uuid. A hook either calls a plugin on the pool
+// master, records a message for the object, or both.
+func runLifecycleHooks(c *Connection, hooks []interface{}, event string, cls xenapi.Cls, uuid string) error {
+	for _, _hook := range hooks {
+		hook := _hook.(map[string]interface{})
+
+		if hook[lifecycleHookSchemaEvent].(string) != event {
+			continue
+		}
+
+		if plugin := hook[lifecycleHookSchemaPlugin].(string); plugin != "" {
+			fn := hook[lifecycleHookSchemaFunction].(string)
+			if fn == "" {
+				return fmt.Errorf("%q hook calling plugin %q has no %q", event, plugin, lifecycleHookSchemaFunction)
+			}
+
+			args := map[string]string{
+				"event": event,
+				"class": string(cls),
+				"uuid":  uuid,
+			}
+			for k, v := range hook[lifecycleHookSchemaArguments].(map[string]interface{}) {
+				args[k] = v.(string)
+			}
+
+			host, err := getPoolMaster(c)
+			if err != nil {
+				return err
+			}
+
+			log.Printf("[DEBUG] Calling plugin %s/%s for %s %s", plugin, fn, cls, uuid)
+			result, err := c.client.Host.CallPlugin(c.session, host, plugin, fn, args)
+			if err != nil {
+				return err
+			}
+			log.Printf("[DEBUG] Plugin %s/%s returned %q", plugin, fn, result)
+		}
+
+		if message := hook[lifecycleHookSchemaMessage].(string); message != "" {
+			name := "TERRAFORM_" + strings.ToUpper(event)
+
+			log.Printf("[DEBUG] Recording message %s for %s %s", name, cls, uuid)
+			if _, err := c.client.Message.Create(c.session, name, lifecycleHookMessagePriority, cls, uuid, message); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -1,13 +1,18 @@
 package xenserver
 
 import (
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
-	"github.com/hashicorp/terraform-plugin-sdk/terraform"
+	"context"
+
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 )
 
 // Provider ...
-func Provider() terraform.ResourceProvider {
-	return &schema.Provider{
+func Provider() *schema.Provider {
+	p := &schema.Provider{
 		Schema: map[string]*schema.Schema{
 			"url": &schema.Schema{
 				Type:        schema.TypeString,
@@ -29,42 +34,227 @@ func Provider() terraform.ResourceProvider {
 				Default:     "",
 				Description: descriptions["password"],
 			},
+
+			"insecure": &schema.Schema{
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("XENSERVER_INSECURE", false),
+				Description: descriptions["insecure"],
+			},
+
+			"ca_cert_file": &schema.Schema{
+				Type:          schema.TypeString,
+				Optional:      true,
+				DefaultFunc:   schema.EnvDefaultFunc("XENSERVER_CA_CERT_FILE", ""),
+				Description:   descriptions["ca_cert_file"],
+				ConflictsWith: []string{"ca_cert_pem"},
+			},
+
+			"ca_cert_pem": &schema.Schema{
+				Type:          schema.TypeString,
+				Optional:      true,
+				Default:       "",
+				Description:   descriptions["ca_cert_pem"],
+				ConflictsWith: []string{"ca_cert_file"},
+			},
+
+			"tls_server_name": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				Default:     "",
+				Description: descriptions["tls_server_name"],
+			},
+
+			"tolerate_read_errors": &schema.Schema{
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("XENSERVER_TOLERATE_READ_ERRORS", false),
+				Description: descriptions["tolerate_read_errors"],
+			},
+
+			"audit_log": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("XENSERVER_AUDIT_LOG", ""),
+				Description: descriptions["audit_log"],
+			},
+
+			"record_cache": &schema.Schema{
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("XENSERVER_RECORD_CACHE", true),
+				Description: descriptions["record_cache"],
+			},
+
+			"default_sr": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("XENSERVER_DEFAULT_SR", ""),
+				Description: descriptions["default_sr"],
+			},
+
+			"default_network": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("XENSERVER_DEFAULT_NETWORK", ""),
+				Description: descriptions["default_network"],
+			},
+
+			"sr_operation_parallelism": &schema.Schema{
+				Type:        schema.TypeInt,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("XENSERVER_SR_OPERATION_PARALLELISM", 2),
+				Description: descriptions["sr_operation_parallelism"],
+			},
+
+			"fail_on_duplicate_names": &schema.Schema{
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("XENSERVER_FAIL_ON_DUPLICATE_NAMES", true),
+				Description: descriptions["fail_on_duplicate_names"],
+			},
+
+			"connection_timeout": &schema.Schema{
+				Type:         schema.TypeInt,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("XENSERVER_CONNECTION_TIMEOUT", 30),
+				Description:  descriptions["connection_timeout"],
+				ValidateFunc: validation.IntAtLeast(1),
+			},
 		},
 
 		DataSourcesMap: map[string]*schema.Resource{
-			"xenserver_pif":  dataSourceXenServerPif(),
-			"xenserver_pifs": dataSourceXenServerPifs(),
-			"xenserver_sr":   dataSourceXenServerSR(),
+			"xenserver_console_screenshot": dataSourceXenServerConsoleScreenshot(),
+			"xenserver_gpu_group":          dataSourceXenServerGPUGroup(),
+			"xenserver_isos":               dataSourceXenServerISOs(),
+			"xenserver_messages":           dataSourceXenServerMessages(),
+			"xenserver_network":            dataSourceXenServerNetwork(),
+			"xenserver_pif":                dataSourceXenServerPif(),
+			"xenserver_pifs":               dataSourceXenServerPifs(),
+			"xenserver_rrd_updates":        dataSourceXenServerRRDUpdates(),
+			"xenserver_sr":                 dataSourceXenServerSR(),
+			"xenserver_sm_drivers":         dataSourceXenServerSMDrivers(),
+			"xenserver_usb_devices":        dataSourceXenServerUSBDevices(),
+			"xenserver_vdi":                dataSourceXenServerVDI(),
+			"xenserver_vm_list":            dataSourceXenServerVMList(),
+			"xenserver_vm_metrics":         dataSourceXenServerVMMetrics(),
+			"xenserver_vm_snapshots":       dataSourceXenServerVMSnapshots(),
 		},
 
 		ResourcesMap: map[string]*schema.Resource{
-			"xenserver_vm":      resourceVM(),
-			"xenserver_vdi":     resourceVDI(),
-			"xenserver_network": resourceNetwork(),
+			"xenserver_cluster":             resourceCluster(),
+			"xenserver_vm":                  resourceVM(),
+			"xenserver_vm_group":            resourceVMGroup(),
+			"xenserver_vdi":                 resourceVDI(),
+			"xenserver_vdi_copy":            resourceVDICopy(),
+			"xenserver_vdi_export":          resourceVDIExport(),
+			"xenserver_vdi_import":          resourceVDIImport(),
+			"xenserver_network":             resourceNetwork(),
+			"xenserver_network_purpose":     resourceNetworkPurpose(),
+			"xenserver_nfs_iso_sr":          resourceNFSISOSR(),
+			"xenserver_iso_upload":          resourceISOUpload(),
+			"xenserver_host_cpu_tuning":     resourceHostCPUTuning(),
+			"xenserver_host_license":        resourceHostLicense(),
+			"xenserver_host_maintenance":    resourceHostMaintenance(),
+			"xenserver_host_network_config": resourceHostNetworkConfig(),
+			"xenserver_host_storage_config": resourceHostStorageConfig(),
+			"xenserver_tunnel":              resourceTunnel(),
+			"xenserver_vif":                 resourceStandaloneVIF(),
+			"xenserver_pbd":                 resourcePBD(),
+			"xenserver_pgpu":                resourcePGPU(),
+			"xenserver_pool_ha":             resourcePoolHA(),
+			"xenserver_pool_storage":        resourcePoolStorage(),
+			"xenserver_pool_join":           resourcePoolJoin(),
+			"xenserver_pool_update":         resourcePoolUpdate(),
+			"xenserver_secret":              resourceSecret(),
+			"xenserver_smb_sr":              resourceSMBSR(),
+			"xenserver_snapshot_revert":     resourceSnapshotRevert(),
+			"xenserver_vusb":                resourceVUSB(),
+			"xenserver_xenstore_policy":     resourceXenstorePolicy(),
+			"xenserver_bond":                resourceBond(),
+			"xenserver_vlan":                resourceVLAN(),
+			"xenserver_vm_power_sequence":   resourceVMPowerSequence(),
+			"xenserver_vmss":                resourceVMSS(),
 		},
-
-		ConfigureFunc: providerConfigure,
 	}
+
+	tolerateReadErrors(p.ResourcesMap)
+
+	p.ConfigureContextFunc = providerConfigure
+
+	return p
 }
 
 var descriptions map[string]string
 
 func init() {
 	descriptions = map[string]string{
-		"url": "The URL to the XenAPI endpoint, typically \"https://<XenServer Management IP>\"",
+		"url": "The URL to the XenAPI endpoint, typically \"https://<XenServer Management IP>\". IPv6 addresses may be given with or without brackets",
 
 		"username": "The username to use to authenticate to XenServer",
 
 		"password": "The password to use to authenticate to XenServer",
+
+		"insecure": "Skip the verification of the XenServer host certificate",
+
+		"ca_cert_file": "Path to a PEM encoded CA certificate to verify the XenServer host certificate with",
+
+		"ca_cert_pem": "PEM encoded CA certificate to verify the XenServer host certificate with",
+
+		"tls_server_name": "Host name to verify the XenServer host certificate against, instead of the one of the URL",
+
+		"tolerate_read_errors": "Report failures to refresh a resource as warnings and keep its last known state, instead of aborting",
+
+		"audit_log": "Path of a JSON file to record the XenAPI calls modifying the pool in",
+
+		"record_cache": "Fetch the records of all objects of a class at once while refreshing, instead of one by one",
+
+		"default_sr": "UUID of the SR to create virtual disks in when a resource does not specify one",
+
+		"default_network": "UUID of the network to connect network interfaces to when a resource does not specify one",
+
+		"sr_operation_parallelism": "Maximum number of virtual disks created or copied in parallel per SR, unlimited if 0",
+
+		"fail_on_duplicate_names": "Fail lookups of VMs, networks, SRs and VDIs by name label which match several objects, instead of picking the first",
+
+		"connection_timeout": "Seconds to wait for a connection to the XenAPI endpoint to be established",
 	}
 }
 
-func providerConfigure(d *schema.ResourceData) (interface{}, error) {
+func providerConfigure(ctx context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics) {
 	config := Config{
 		URL:      d.Get("url").(string),
 		Username: d.Get("username").(string),
 		Password: d.Get("password").(string),
+
+		Insecure:      d.Get("insecure").(bool),
+		CACertFile:    d.Get("ca_cert_file").(string),
+		CACertPEM:     d.Get("ca_cert_pem").(string),
+		TLSServerName: d.Get("tls_server_name").(string),
+
+		TolerateReadErrors: d.Get("tolerate_read_errors").(bool),
+		AuditLog:           d.Get("audit_log").(string),
+		RecordCache:        d.Get("record_cache").(bool),
+
+		DefaultSR:      d.Get("default_sr").(string),
+		DefaultNetwork: d.Get("default_network").(string),
+
+		SROperationParallelism: d.Get("sr_operation_parallelism").(int),
+		FailOnDuplicateNames:   d.Get("fail_on_duplicate_names").(bool),
+
+		ConnectionTimeout: time.Duration(d.Get("connection_timeout").(int)) * time.Second,
+	}
+
+	// The stop context is cancelled when Terraform is interrupted, ctx only
+	// lasts as long as the provider is configured
+	if stopCtx, ok := schema.StopContext(ctx); ok {
+		ctx = stopCtx
+	}
+
+	conn, err := config.NewConnection(ctx)
+	if err != nil {
+		return nil, diag.FromErr(err)
 	}
 
-	return config.NewConnection()
+	return conn, nil
 }
@@ -0,0 +1,344 @@
+package xenserver
+
+import (
+	"log"
+	"reflect"
+	"sync"
+
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+// recordCache holds the records of all objects of a class, fetched with a
+// single get_all_records call the first time an object of the class is looked
+// up. Refreshing many resources then costs one call per class instead of a few
+// per object. The cache lives as long as the provider, i.e. for one plan or
+// apply.
+//
+// The first call modifying the pool invalidates the cache for good. Refreshing
+// does not modify the pool, while applying changes would otherwise have to
+// fetch all records again after every single change.
+type recordCache struct {
+	mutex       sync.Mutex
+	classes     map[string]*cachedClass
+	invalidated bool
+}
+
+type cachedClass struct {
+	mutex   sync.Mutex
+	records interface{}
+}
+
+func newRecordCache(enabled bool) *recordCache {
+	if !enabled {
+		return nil
+	}
+
+	return &recordCache{
+		classes: make(map[string]*cachedClass),
+	}
+}
+
+func (rc *recordCache) invalidate() {
+	if rc == nil {
+		return
+	}
+
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	if !rc.invalidated {
+		log.Println("[DEBUG] The pool is being modified, no longer caching records")
+	}
+	rc.classes = make(map[string]*cachedClass)
+	rc.invalidated = true
+}
+
+// get returns the records of class, fetching them if they are not cached. It
+// returns false once the cache has been invalidated.
+func (rc *recordCache) get(class string, fetch func() (interface{}, error)) (interface{}, bool, error) {
+	rc.mutex.Lock()
+	if rc.invalidated {
+		rc.mutex.Unlock()
+		return nil, false, nil
+	}
+	entry, ok := rc.classes[class]
+	if !ok {
+		entry = &cachedClass{}
+		rc.classes[class] = entry
+	}
+	rc.mutex.Unlock()
+
+	// Concurrent lookups wait for a single fetch
+	entry.mutex.Lock()
+	defer entry.mutex.Unlock()
+
+	if entry.records == nil {
+		records, err := fetch()
+		if err != nil {
+			return nil, false, err
+		}
+		entry.records = records
+	}
+
+	return entry.records, true, nil
+}
+
+// cachedRecords returns the records of class if the cache is enabled. When the
+// records can not be fetched, the caller falls back to looking up the object
+// on its own.
+func (c *Connection) cachedRecords(class string, fetch func() (interface{}, error)) (interface{}, bool) {
+	if c.records == nil {
+		return nil, false
+	}
+
+	records, ok, err := c.records.get(class, fetch)
+	if err != nil {
+		log.Printf("[DEBUG] Failed to fetch all %s records: %s", class, err)
+		return nil, false
+	}
+
+	return records, ok
+}
+
+// cloneRecord copies the maps and slices of the record pointed to by record,
+// so that callers modifying them do not modify the cached record.
+func cloneRecord(record interface{}) {
+	v := reflect.ValueOf(record).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.Map:
+			if field.IsNil() {
+				continue
+			}
+			clone := reflect.MakeMapWithSize(field.Type(), field.Len())
+			for _, key := range field.MapKeys() {
+				clone.SetMapIndex(key, field.MapIndex(key))
+			}
+			field.Set(clone)
+		case reflect.Slice:
+			if field.IsNil() {
+				continue
+			}
+			clone := reflect.MakeSlice(field.Type(), field.Len(), field.Len())
+			reflect.Copy(clone, field)
+			field.Set(clone)
+		}
+	}
+}
+
+func (c *Connection) getVMRecord(ref xenapi.VMRef) (xenapi.VMRecord, error) {
+	if records, ok := c.cachedRecords("VM", func() (interface{}, error) {
+		return c.client.VM.GetAllRecords(c.session)
+	}); ok {
+		if record, ok := records.(map[xenapi.VMRef]xenapi.VMRecord)[ref]; ok {
+			cloneRecord(&record)
+			return record, nil
+		}
+	}
+
+	return c.client.VM.GetRecord(c.session, ref)
+}
+
+func (c *Connection) getVMByUUID(uuid string) (xenapi.VMRef, error) {
+	if records, ok := c.cachedRecords("VM", func() (interface{}, error) {
+		return c.client.VM.GetAllRecords(c.session)
+	}); ok {
+		for ref, record := range records.(map[xenapi.VMRef]xenapi.VMRecord) {
+			if record.UUID == uuid {
+				return ref, nil
+			}
+		}
+	}
+
+	return c.client.VM.GetByUUID(c.session, uuid)
+}
+
+func (c *Connection) getVBDRecord(ref xenapi.VBDRef) (xenapi.VBDRecord, error) {
+	if records, ok := c.cachedRecords("VBD", func() (interface{}, error) {
+		return c.client.VBD.GetAllRecords(c.session)
+	}); ok {
+		if record, ok := records.(map[xenapi.VBDRef]xenapi.VBDRecord)[ref]; ok {
+			cloneRecord(&record)
+			return record, nil
+		}
+	}
+
+	return c.client.VBD.GetRecord(c.session, ref)
+}
+
+func (c *Connection) getVBDByUUID(uuid string) (xenapi.VBDRef, error) {
+	if records, ok := c.cachedRecords("VBD", func() (interface{}, error) {
+		return c.client.VBD.GetAllRecords(c.session)
+	}); ok {
+		for ref, record := range records.(map[xenapi.VBDRef]xenapi.VBDRecord) {
+			if record.UUID == uuid {
+				return ref, nil
+			}
+		}
+	}
+
+	return c.client.VBD.GetByUUID(c.session, uuid)
+}
+
+func (c *Connection) getVDIRecord(ref xenapi.VDIRef) (xenapi.VDIRecord, error) {
+	if records, ok := c.cachedRecords("VDI", func() (interface{}, error) {
+		return c.client.VDI.GetAllRecords(c.session)
+	}); ok {
+		if record, ok := records.(map[xenapi.VDIRef]xenapi.VDIRecord)[ref]; ok {
+			cloneRecord(&record)
+			return record, nil
+		}
+	}
+
+	return c.client.VDI.GetRecord(c.session, ref)
+}
+
+func (c *Connection) getVDIByUUID(uuid string) (xenapi.VDIRef, error) {
+	if records, ok := c.cachedRecords("VDI", func() (interface{}, error) {
+		return c.client.VDI.GetAllRecords(c.session)
+	}); ok {
+		for ref, record := range records.(map[xenapi.VDIRef]xenapi.VDIRecord) {
+			if record.UUID == uuid {
+				return ref, nil
+			}
+		}
+	}
+
+	return c.client.VDI.GetByUUID(c.session, uuid)
+}
+
+func (c *Connection) getVIFRecord(ref xenapi.VIFRef) (xenapi.VIFRecord, error) {
+	if records, ok := c.cachedRecords("VIF", func() (interface{}, error) {
+		return c.client.VIF.GetAllRecords(c.session)
+	}); ok {
+		if record, ok := records.(map[xenapi.VIFRef]xenapi.VIFRecord)[ref]; ok {
+			cloneRecord(&record)
+			return record, nil
+		}
+	}
+
+	return c.client.VIF.GetRecord(c.session, ref)
+}
+
+func (c *Connection) getVIFByUUID(uuid string) (xenapi.VIFRef, error) {
+	if records, ok := c.cachedRecords("VIF", func() (interface{}, error) {
+		return c.client.VIF.GetAllRecords(c.session)
+	}); ok {
+		for ref, record := range records.(map[xenapi.VIFRef]xenapi.VIFRecord) {
+			if record.UUID == uuid {
+				return ref, nil
+			}
+		}
+	}
+
+	return c.client.VIF.GetByUUID(c.session, uuid)
+}
+
+func (c *Connection) getSRRecord(ref xenapi.SRRef) (xenapi.SRRecord, error) {
+	if records, ok := c.cachedRecords("SR", func() (interface{}, error) {
+		return c.client.SR.GetAllRecords(c.session)
+	}); ok {
+		if record, ok := records.(map[xenapi.SRRef]xenapi.SRRecord)[ref]; ok {
+			cloneRecord(&record)
+			return record, nil
+		}
+	}
+
+	return c.client.SR.GetRecord(c.session, ref)
+}
+
+func (c *Connection) getSRByUUID(uuid string) (xenapi.SRRef, error) {
+	if records, ok := c.cachedRecords("SR", func() (interface{}, error) {
+		return c.client.SR.GetAllRecords(c.session)
+	}); ok {
+		for ref, record := range records.(map[xenapi.SRRef]xenapi.SRRecord) {
+			if record.UUID == uuid {
+				return ref, nil
+			}
+		}
+	}
+
+	return c.client.SR.GetByUUID(c.session, uuid)
+}
+
+func (c *Connection) getNetworkRecord(ref xenapi.NetworkRef) (xenapi.NetworkRecord, error) {
+	if records, ok := c.cachedRecords("network", func() (interface{}, error) {
+		return c.client.Network.GetAllRecords(c.session)
+	}); ok {
+		if record, ok := records.(map[xenapi.NetworkRef]xenapi.NetworkRecord)[ref]; ok {
+			cloneRecord(&record)
+			return record, nil
+		}
+	}
+
+	return c.client.Network.GetRecord(c.session, ref)
+}
+
+func (c *Connection) getNetworkByUUID(uuid string) (xenapi.NetworkRef, error) {
+	if records, ok := c.cachedRecords("network", func() (interface{}, error) {
+		return c.client.Network.GetAllRecords(c.session)
+	}); ok {
+		for ref, record := range records.(map[xenapi.NetworkRef]xenapi.NetworkRecord) {
+			if record.UUID == uuid {
+				return ref, nil
+			}
+		}
+	}
+
+	return c.client.Network.GetByUUID(c.session, uuid)
+}
+
+func (c *Connection) getPIFRecord(ref xenapi.PIFRef) (xenapi.PIFRecord, error) {
+	if records, ok := c.cachedRecords("PIF", func() (interface{}, error) {
+		return c.client.PIF.GetAllRecords(c.session)
+	}); ok {
+		if record, ok := records.(map[xenapi.PIFRef]xenapi.PIFRecord)[ref]; ok {
+			cloneRecord(&record)
+			return record, nil
+		}
+	}
+
+	return c.client.PIF.GetRecord(c.session, ref)
+}
+
+func (c *Connection) getPIFByUUID(uuid string) (xenapi.PIFRef, error) {
+	if records, ok := c.cachedRecords("PIF", func() (interface{}, error) {
+		return c.client.PIF.GetAllRecords(c.session)
+	}); ok {
+		for ref, record := range records.(map[xenapi.PIFRef]xenapi.PIFRecord) {
+			if record.UUID == uuid {
+				return ref, nil
+			}
+		}
+	}
+
+	return c.client.PIF.GetByUUID(c.session, uuid)
+}
+
+func (c *Connection) getHostRecord(ref xenapi.HostRef) (xenapi.HostRecord, error) {
+	if records, ok := c.cachedRecords("host", func() (interface{}, error) {
+		return c.client.Host.GetAllRecords(c.session)
+	}); ok {
+		if record, ok := records.(map[xenapi.HostRef]xenapi.HostRecord)[ref]; ok {
+			cloneRecord(&record)
+			return record, nil
+		}
+	}
+
+	return c.client.Host.GetRecord(c.session, ref)
+}
+
+func (c *Connection) getHostByUUID(uuid string) (xenapi.HostRef, error) {
+	if records, ok := c.cachedRecords("host", func() (interface{}, error) {
+		return c.client.Host.GetAllRecords(c.session)
+	}); ok {
+		for ref, record := range records.(map[xenapi.HostRef]xenapi.HostRecord) {
+			if record.UUID == uuid {
+				return ref, nil
+			}
+		}
+	}
+
+	return c.client.Host.GetByUUID(c.session, uuid)
+}
@@ -0,0 +1,58 @@
+package xenserver
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+// referenceError explains the failure to look up an object another resource
+// refers to by UUID. Every provider configuration, including each alias,
+// manages exactly one pool, so an unknown UUID most likely belongs to an object
+// of another pool which has been passed between resources of different
+// provider configurations.
+func referenceError(c *Connection, class, uuid string, err error) error {
+	xenErr, ok := err.(*xenapi.Error)
+	if !ok || xenErr.Code() != xenapi.ERR_UUID_INVALID {
+		return err
+	}
+
+	return fmt.Errorf("%s %s does not exist in pool %s: objects of another pool cannot be referenced, "+
+		"make sure that the resources referring to each other use the same provider configuration",
+		class, uuid, c.poolDescription())
+}
+
+// poolDescription identifies the pool of the connection in error messages.
+func (c *Connection) poolDescription() string {
+	if c.poolName == "" {
+		return c.url
+	}
+
+	return fmt.Sprintf("%q (%s)", c.poolName, c.url)
+}
+
+// checkDuplicateNames fails the lookup of an object by its name label which
+// matched count objects, listing the UUIDs of all of them, unless the provider
+// has been configured to pick the first match.
+func checkDuplicateNames(c *Connection, class, name string, count int, uuidOf func(i int) (string, error)) error {
+	if !c.failOnDuplicateNames {
+		log.Printf("[WARN] %d %ss are named %q, using the first one", count, class, name)
+		return nil
+	}
+
+	uuids := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		uuid, err := uuidOf(i)
+		if err != nil {
+			return err
+		}
+		uuids = append(uuids, uuid)
+	}
+	sort.Strings(uuids)
+
+	return fmt.Errorf("%d %ss are named %q in pool %s: %s, refer to the intended one by UUID",
+		count, class, name, c.poolDescription(), strings.Join(uuids, ", "))
+}
@@ -0,0 +1,228 @@
+package xenserver
+
+import (
+	"context"
+	"log"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+const (
+	bondSchemaNetwork       = "network"
+	bondSchemaMembers       = "members"
+	bondSchemaMAC           = "mac"
+	bondSchemaMode          = "mode"
+	bondSchemaMasterPIF     = "master_pif"
+	bondSchemaNetworkBridge = "network_bridge"
+	bondSchemaNetworkRef    = "network_ref"
+)
+
+func resourceBond() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceBondCreate,
+		ReadContext:   forgetfulRead(resourceBondRead, resourceBondExists),
+		UpdateContext: resourceBondUpdate,
+		DeleteContext: resourceBondDelete,
+
+		Schema: map[string]*schema.Schema{
+			bondSchemaNetwork: &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+
+			bondSchemaMembers: &schema.Schema{
+				Type:     schema.TypeSet,
+				Required: true,
+				ForceNew: true,
+				MinItems: 2,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+				Set:      schema.HashString,
+			},
+
+			bondSchemaMAC: &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ForceNew:     true,
+				ValidateFunc: validateMACAddress,
+			},
+
+			bondSchemaMode: &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+				Default:  string(xenapi.BondModeBalanceSlb),
+				ValidateFunc: validation.StringInSlice([]string{
+					string(xenapi.BondModeBalanceSlb),
+					string(xenapi.BondModeActiveBackup),
+					string(xenapi.BondModeLacp),
+				}, false),
+			},
+
+			bondSchemaMasterPIF: &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			bondSchemaNetworkBridge: &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			bondSchemaNetworkRef: &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func resourceBondCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	network := &NetworkDescriptor{
+		UUID: d.Get(bondSchemaNetwork).(string),
+	}
+
+	if err := network.Load(c); err != nil {
+		return diag.FromErr(referenceError(c, "network", network.UUID, err))
+	}
+
+	members := make([]xenapi.PIFRef, 0)
+	for _, _member := range d.Get(bondSchemaMembers).(*schema.Set).List() {
+		pif := &PIFDescriptor{
+			UUID: _member.(string),
+		}
+
+		if err := pif.Load(c); err != nil {
+			return diag.FromErr(referenceError(c, "PIF", pif.UUID, err))
+		}
+
+		members = append(members, pif.PIFRef)
+	}
+
+	mode := xenapi.BondMode(d.Get(bondSchemaMode).(string))
+
+	log.Printf("[DEBUG] Creating %s bond of %d PIFs on network %s", mode, len(members), network.UUID)
+	bondRef, err := c.client.Bond.Create(c.session, network.NetworkRef, members, d.Get(bondSchemaMAC).(string), mode, map[string]string{})
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	bond := &BondDescriptor{
+		BondRef: bondRef,
+	}
+
+	if err := bond.Query(c); err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId(bond.UUID)
+
+	return resourceBondRead(ctx, d, m)
+}
+
+func resourceBondRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	bond := &BondDescriptor{
+		UUID: d.Id(),
+	}
+
+	if err := bond.Load(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	members := make([]string, 0, len(bond.Members))
+	for _, member := range bond.Members {
+		members = append(members, member.UUID)
+	}
+
+	if err := d.Set(bondSchemaMembers, members); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(bondSchemaMode, string(bond.Mode)); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(bondSchemaMAC, bond.Master.MAC); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(bondSchemaMasterPIF, bond.Master.UUID); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(bondSchemaNetwork, bond.Master.Network.UUID); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(bondSchemaNetworkBridge, bond.Master.Network.Bridge); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(bondSchemaNetworkRef, string(bond.Master.Network.NetworkRef)); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return nil
+}
+
+func resourceBondUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	bond := &BondDescriptor{
+		UUID: d.Id(),
+	}
+
+	if err := bond.Load(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if d.HasChange(bondSchemaMode) {
+		_, n := d.GetChange(bondSchemaMode)
+
+		if err := c.client.Bond.SetMode(c.session, bond.BondRef, xenapi.BondMode(n.(string))); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	return resourceBondRead(ctx, d, m)
+}
+
+func resourceBondDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	bond := &BondDescriptor{
+		UUID: d.Id(),
+	}
+
+	if err := bond.Load(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return diag.FromErr(c.client.Bond.Destroy(c.session, bond.BondRef))
+}
+
+func resourceBondExists(d *schema.ResourceData, m interface{}) (bool, error) {
+	c := m.(*Connection)
+
+	bond := &BondDescriptor{
+		UUID: d.Id(),
+	}
+
+	if err := bond.Load(c); err != nil {
+		if xenErr, ok := err.(*xenapi.Error); ok {
+			if xenErr.Code() == xenapi.ERR_UUID_INVALID {
+				return false, nil
+			}
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,535 @@
+package xenserver
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+const (
+	clusterSchemaNetworkUUID             = "network_uuid"
+	clusterSchemaHostUUIDs               = "host_uuids"
+	clusterSchemaClusterStack            = "cluster_stack"
+	clusterSchemaTokenTimeout            = "token_timeout"
+	clusterSchemaTokenTimeoutCoefficient = "token_timeout_coefficient"
+	clusterSchemaPoolAutoJoin            = "pool_auto_join"
+
+	// SR type which depends on the cluster to coordinate access to the LUN
+	srTypeGFS2 = "gfs2"
+)
+
+func resourceCluster() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceClusterCreate,
+		ReadContext:   forgetfulRead(resourceClusterRead, resourceClusterExists),
+		UpdateContext: resourceClusterUpdate,
+		DeleteContext: resourceClusterDelete,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Update: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(20 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			clusterSchemaNetworkUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateUUID,
+			},
+
+			// All hosts of the pool join the cluster if not declared, as well
+			// as the hosts joining the pool later on
+			clusterSchemaHostUUIDs: &schema.Schema{
+				Type:     schema.TypeSet,
+				Optional: true,
+				Computed: true,
+				MinItems: 1,
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validateUUID,
+				},
+				Set: schema.HashString,
+			},
+
+			clusterSchemaClusterStack: &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+				ForceNew: true,
+				Default:  "corosync",
+			},
+
+			clusterSchemaTokenTimeout: &schema.Schema{
+				Type:         schema.TypeFloat,
+				Optional:     true,
+				ForceNew:     true,
+				Default:      20.0,
+				ValidateFunc: validation.FloatAtLeast(1),
+			},
+
+			clusterSchemaTokenTimeoutCoefficient: &schema.Schema{
+				Type:         schema.TypeFloat,
+				Optional:     true,
+				ForceNew:     true,
+				Default:      1.0,
+				ValidateFunc: validation.FloatAtLeast(0.65),
+			},
+
+			clusterSchemaPoolAutoJoin: &schema.Schema{
+				Type:     schema.TypeBool,
+				Computed: true,
+			},
+		},
+	}
+}
+
+// callClusterAPI calls a method of the XenAPI related to clustering. The client
+// predates clustering, which has been introduced with XenServer 7.6 along with
+// GFS2 SRs, so these methods are called by name.
+func callClusterAPI(c *Connection, method string, args ...interface{}) (interface{}, error) {
+	params := append([]interface{}{string(c.session)}, args...)
+
+	result, err := c.client.APICall(method, params...)
+	if err != nil {
+		if xenErr, ok := err.(*xenapi.Error); ok {
+			if xenErr.Code() == xenapi.ERR_MESSAGE_METHOD_UNKNOWN {
+				return nil, fmt.Errorf("clustering is not supported by pool %s, XenServer 7.6 or newer is required", c.poolDescription())
+			}
+		}
+
+		return nil, err
+	}
+
+	return result.Value, nil
+}
+
+func callClusterAPIString(c *Connection, method string, args ...interface{}) (string, error) {
+	value, err := callClusterAPI(c, method, args...)
+	if err != nil {
+		return "", err
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%s did not return a string", method)
+	}
+
+	return s, nil
+}
+
+func callClusterAPIRefs(c *Connection, method string, args ...interface{}) ([]string, error) {
+	value, err := callClusterAPI(c, method, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	values, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s did not return a list", method)
+	}
+
+	refs := make([]string, 0, len(values))
+	for _, v := range values {
+		ref, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s did not return a list of references", method)
+		}
+		refs = append(refs, ref)
+	}
+
+	return refs, nil
+}
+
+// clusterPIF returns the PIF of the host on the network the cluster runs on.
+// The PIF must have an IP address, and it is prevented from being unplugged
+// while the host is a member of the cluster.
+func clusterPIF(c *Connection, network *NetworkDescriptor, host *HostDescriptor) (xenapi.PIFRef, error) {
+	pifRefs, err := c.client.Network.GetPIFs(c.session, network.NetworkRef)
+	if err != nil {
+		return "", err
+	}
+
+	for _, pifRef := range pifRefs {
+		pif, err := c.client.PIF.GetRecord(c.session, pifRef)
+		if err != nil {
+			return "", err
+		}
+
+		if pif.Host != host.HostRef {
+			continue
+		}
+
+		if pif.IP == "" {
+			return "", fmt.Errorf("PIF %s of host %s on network %s has no IP address, which the cluster requires", pif.UUID, host.UUID, network.UUID)
+		}
+
+		if !pif.DisallowUnplug {
+			if err := c.client.PIF.SetDisallowUnplug(c.session, pifRef, true); err != nil {
+				return "", err
+			}
+		}
+
+		return pifRef, nil
+	}
+
+	return "", fmt.Errorf("host %s has no PIF on network %s", host.UUID, network.UUID)
+}
+
+// clusterHostUUIDs returns the UUIDs of the hosts to join the cluster, either
+// the declared ones or all hosts of the pool.
+func clusterHostUUIDs(c *Connection, d *schema.ResourceData) ([]string, error) {
+	if hostUUIDs, ok := d.GetOk(clusterSchemaHostUUIDs); ok {
+		uuids := make([]string, 0)
+		for _, uuid := range hostUUIDs.(*schema.Set).List() {
+			uuids = append(uuids, uuid.(string))
+		}
+		sort.Strings(uuids)
+		return uuids, nil
+	}
+
+	hosts, err := c.client.Host.GetAllRecords(c.session)
+	if err != nil {
+		return nil, err
+	}
+
+	uuids := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		uuids = append(uuids, host.UUID)
+	}
+	sort.Strings(uuids)
+
+	return uuids, nil
+}
+
+// joinCluster adds the host to the cluster as a cluster host.
+func joinCluster(c *Connection, cluster string, network *NetworkDescriptor, hostUUID string) error {
+	host := &HostDescriptor{
+		UUID: hostUUID,
+	}
+	if err := host.Load(c); err != nil {
+		return referenceError(c, "host", host.UUID, err)
+	}
+
+	pif, err := clusterPIF(c, network, host)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[DEBUG] Adding host %s to cluster %s", host.UUID, cluster)
+	task, err := callAsync(c, "Cluster_host.create", cluster, string(host.HostRef), string(pif))
+	if err != nil {
+		return err
+	}
+
+	_, err = waitForTask(c, task)
+	return err
+}
+
+// clusterHosts returns the cluster hosts of the cluster, keyed by the UUID of
+// their host.
+func clusterHosts(c *Connection, cluster string) (map[string]string, error) {
+	clusterHostRefs, err := callClusterAPIRefs(c, "Cluster.get_cluster_hosts", cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	clusterHosts := make(map[string]string, len(clusterHostRefs))
+	for _, clusterHost := range clusterHostRefs {
+		hostRef, err := callClusterAPIString(c, "Cluster_host.get_host", clusterHost)
+		if err != nil {
+			return nil, err
+		}
+
+		hostUUID, err := c.client.Host.GetUUID(c.session, xenapi.HostRef(hostRef))
+		if err != nil {
+			return nil, err
+		}
+
+		clusterHosts[hostUUID] = clusterHost
+	}
+
+	return clusterHosts, nil
+}
+
+func resourceClusterCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c, cancel, err := m.(*Connection).WithTimeout(d.Timeout(schema.TimeoutCreate))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer cancel()
+
+	network := &NetworkDescriptor{
+		UUID: d.Get(clusterSchemaNetworkUUID).(string),
+	}
+	if err := network.Load(c); err != nil {
+		return diag.FromErr(referenceError(c, "network", network.UUID, err))
+	}
+
+	// Hosts joining the pool later on only join the cluster if no hosts are
+	// declared
+	_, declared := d.GetOk(clusterSchemaHostUUIDs)
+
+	hostUUIDs, err := clusterHostUUIDs(c, d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	// The cluster is formed by its first host, the others join it one by one
+	first := &HostDescriptor{
+		UUID: hostUUIDs[0],
+	}
+	if err := first.Load(c); err != nil {
+		return diag.FromErr(referenceError(c, "host", first.UUID, err))
+	}
+
+	pif, err := clusterPIF(c, network, first)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	log.Printf("[DEBUG] Creating cluster on network %s", network.UUID)
+	task, err := callAsync(c, "Cluster.create", string(pif),
+		d.Get(clusterSchemaClusterStack).(string),
+		!declared,
+		d.Get(clusterSchemaTokenTimeout).(float64),
+		d.Get(clusterSchemaTokenTimeoutCoefficient).(float64))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	cluster, err := waitForTask(c, task)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	clusterUUID, err := callClusterAPIString(c, "Cluster.get_uuid", cluster)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId(clusterUUID)
+
+	for _, hostUUID := range hostUUIDs[1:] {
+		if err := joinCluster(c, cluster, network, hostUUID); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	return resourceClusterRead(ctx, d, m)
+}
+
+func resourceClusterRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	cluster, err := callClusterAPIString(c, "Cluster.get_by_uuid", d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	clusterStack, err := callClusterAPIString(c, "Cluster.get_cluster_stack", cluster)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(clusterSchemaClusterStack, clusterStack); err != nil {
+		return diag.FromErr(err)
+	}
+
+	for key, method := range map[string]string{
+		clusterSchemaTokenTimeout:            "Cluster.get_token_timeout",
+		clusterSchemaTokenTimeoutCoefficient: "Cluster.get_token_timeout_coefficient",
+	} {
+		value, err := callClusterAPI(c, method, cluster)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		if timeout, ok := value.(float64); ok {
+			if err := d.Set(key, timeout); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+	}
+
+	value, err := callClusterAPI(c, "Cluster.get_pool_auto_join", cluster)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	autoJoin, _ := value.(bool)
+	if err := d.Set(clusterSchemaPoolAutoJoin, autoJoin); err != nil {
+		return diag.FromErr(err)
+	}
+
+	hosts, err := clusterHosts(c, cluster)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	hostUUIDs := make([]string, 0, len(hosts))
+	for hostUUID := range hosts {
+		hostUUIDs = append(hostUUIDs, hostUUID)
+	}
+	sort.Strings(hostUUIDs)
+
+	if err := d.Set(clusterSchemaHostUUIDs, hostUUIDs); err != nil {
+		return diag.FromErr(err)
+	}
+
+	// All cluster hosts communicate over the same network, the one of any of
+	// them will do
+	for _, clusterHost := range hosts {
+		pif, err := callClusterAPIString(c, "Cluster_host.get_PIF", clusterHost)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		networkRef, err := c.client.PIF.GetNetwork(c.session, xenapi.PIFRef(pif))
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		networkUUID, err := c.client.Network.GetUUID(c.session, networkRef)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		return diag.FromErr(d.Set(clusterSchemaNetworkUUID, networkUUID))
+	}
+
+	return nil
+}
+
+func resourceClusterUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c, cancel, err := m.(*Connection).WithTimeout(d.Timeout(schema.TimeoutUpdate))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer cancel()
+
+	if d.HasChange(clusterSchemaHostUUIDs) {
+		cluster, err := callClusterAPIString(c, "Cluster.get_by_uuid", d.Id())
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		network := &NetworkDescriptor{
+			UUID: d.Get(clusterSchemaNetworkUUID).(string),
+		}
+		if err := network.Load(c); err != nil {
+			return diag.FromErr(referenceError(c, "network", network.UUID, err))
+		}
+
+		o, n := d.GetChange(clusterSchemaHostUUIDs)
+		oldHosts, newHosts := o.(*schema.Set), n.(*schema.Set)
+
+		// Hosts join before others leave, so that the cluster keeps its quorum
+		for _, hostUUID := range newHosts.Difference(oldHosts).List() {
+			if err := joinCluster(c, cluster, network, hostUUID.(string)); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+
+		hosts, err := clusterHosts(c, cluster)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		for _, hostUUID := range oldHosts.Difference(newHosts).List() {
+			clusterHost, ok := hosts[hostUUID.(string)]
+			if !ok {
+				continue
+			}
+
+			log.Printf("[DEBUG] Removing host %s from cluster %s", hostUUID, d.Id())
+			task, err := callAsync(c, "Cluster_host.destroy", clusterHost)
+			if err != nil {
+				return diag.FromErr(err)
+			}
+
+			if _, err := waitForTask(c, task); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+	}
+
+	return resourceClusterRead(ctx, d, m)
+}
+
+// checkClusterUnused fails if a GFS2 SR is still attached to a host, as it
+// would lose access to its LUN once the cluster is gone.
+func checkClusterUnused(c *Connection) error {
+	srs, err := c.client.SR.GetAllRecords(c.session)
+	if err != nil {
+		return err
+	}
+
+	for _, sr := range srs {
+		if sr.Type != srTypeGFS2 {
+			continue
+		}
+
+		for _, pbdRef := range sr.PBDs {
+			attached, err := c.client.PBD.GetCurrentlyAttached(c.session, pbdRef)
+			if err != nil {
+				return err
+			}
+
+			if attached {
+				return fmt.Errorf("GFS2 SR %s (%s) is still attached, it has to be detached before the cluster is destroyed", sr.UUID, sr.NameLabel)
+			}
+		}
+	}
+
+	return nil
+}
+
+func resourceClusterDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c, cancel, err := m.(*Connection).WithTimeout(d.Timeout(schema.TimeoutDelete))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer cancel()
+
+	cluster, err := callClusterAPIString(c, "Cluster.get_by_uuid", d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := checkClusterUnused(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	// Leaves the cluster host by host before the cluster is destroyed
+	log.Printf("[DEBUG] Destroying cluster %s", d.Id())
+	task, err := callAsync(c, "Cluster.pool_destroy", cluster)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	_, err = waitForTask(c, task)
+	return diag.FromErr(err)
+}
+
+func resourceClusterExists(d *schema.ResourceData, m interface{}) (bool, error) {
+	c := m.(*Connection)
+
+	if _, err := callClusterAPI(c, "Cluster.get_by_uuid", d.Id()); err != nil {
+		if xenErr, ok := err.(*xenapi.Error); ok {
+			if xenErr.Code() == xenapi.ERR_UUID_INVALID {
+				return false, nil
+			}
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,170 @@
+package xenserver
+
+import (
+	"context"
+	"log"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+const (
+	hostCPUTuningSchemaHostUUID         = "host_uuid"
+	hostCPUTuningSchemaFeatures         = "features"
+	hostCPUTuningSchemaCPUInfo          = "cpu_info"
+	hostCPUTuningSchemaPhysicalFeatures = "physical_features"
+	hostCPUTuningSchemaMaskable         = "maskable"
+)
+
+func resourceHostCPUTuning() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceHostCPUTuningCreate,
+		ReadContext:   forgetfulRead(resourceHostCPUTuningRead, resourceHostCPUTuningExists),
+		UpdateContext: resourceHostCPUTuningUpdate,
+		DeleteContext: resourceHostCPUTuningDelete,
+
+		Schema: map[string]*schema.Schema{
+			hostCPUTuningSchemaHostUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateUUID,
+			},
+
+			// Only takes effect once the host has been rebooted, so it is not
+			// read back
+			hostCPUTuningSchemaFeatures: &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+			},
+
+			hostCPUTuningSchemaCPUInfo: &schema.Schema{
+				Type:     schema.TypeMap,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+
+			hostCPUTuningSchemaPhysicalFeatures: &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			hostCPUTuningSchemaMaskable: &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func resourceHostCPUTuningCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	host := &HostDescriptor{
+		UUID: d.Get(hostCPUTuningSchemaHostUUID).(string),
+	}
+
+	if err := host.Load(c); err != nil {
+		return diag.FromErr(referenceError(c, "host", host.UUID, err))
+	}
+
+	features := d.Get(hostCPUTuningSchemaFeatures).(string)
+
+	log.Printf("[DEBUG] Setting CPU features of host %s to %s", host.UUID, features)
+	if err := c.client.Host.SetCPUFeatures(c.session, host.HostRef, features); err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId(host.UUID)
+
+	return resourceHostCPUTuningRead(ctx, d, m)
+}
+
+func resourceHostCPUTuningRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	host := &HostDescriptor{
+		UUID: d.Id(),
+	}
+
+	if err := host.Load(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	cpuInfo, err := c.client.Host.GetCPUInfo(c.session, host.HostRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(hostCPUTuningSchemaHostUUID, host.UUID); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(hostCPUTuningSchemaCPUInfo, cpuInfo); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(hostCPUTuningSchemaPhysicalFeatures, cpuInfo["physical_features"]); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(hostCPUTuningSchemaMaskable, cpuInfo["maskable"]); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return nil
+}
+
+func resourceHostCPUTuningUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	host := &HostDescriptor{
+		UUID: d.Id(),
+	}
+
+	if err := host.Load(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if d.HasChange(hostCPUTuningSchemaFeatures) {
+		features := d.Get(hostCPUTuningSchemaFeatures).(string)
+
+		log.Printf("[DEBUG] Setting CPU features of host %s to %s", host.UUID, features)
+		if err := c.client.Host.SetCPUFeatures(c.session, host.HostRef, features); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	return resourceHostCPUTuningRead(ctx, d, m)
+}
+
+func resourceHostCPUTuningDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	host := &HostDescriptor{
+		UUID: d.Id(),
+	}
+
+	if err := host.Load(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	log.Printf("[DEBUG] Resetting CPU features of host %s", host.UUID)
+	return diag.FromErr(c.client.Host.ResetCPUFeatures(c.session, host.HostRef))
+}
+
+func resourceHostCPUTuningExists(d *schema.ResourceData, m interface{}) (bool, error) {
+	c := m.(*Connection)
+
+	if _, err := c.client.Host.GetByUUID(c.session, d.Id()); err != nil {
+		if xenErr, ok := err.(*xenapi.Error); ok {
+			if xenErr.Code() == xenapi.ERR_UUID_INVALID {
+				return false, nil
+			}
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,223 @@
+package xenserver
+
+import (
+	"context"
+	"log"
+	"strconv"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+const (
+	hostLicenseSchemaHostUUID             = "host_uuid"
+	hostLicenseSchemaEdition              = "edition"
+	hostLicenseSchemaLicenseServerAddress = "license_server_address"
+	hostLicenseSchemaLicenseServerPort    = "license_server_port"
+	hostLicenseSchemaLicenseFile          = "license_file"
+	hostLicenseSchemaExpiry               = "expiry"
+	hostLicenseSchemaLicenseParams        = "license_params"
+
+	// Port the Citrix license server listens on by default
+	defaultLicenseServerPort = 27000
+)
+
+func resourceHostLicense() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceHostLicenseCreate,
+		ReadContext:   forgetfulRead(resourceHostLicenseRead, resourceHostLicenseExists),
+		UpdateContext: resourceHostLicenseUpdate,
+		DeleteContext: resourceHostLicenseDelete,
+
+		Schema: map[string]*schema.Schema{
+			hostLicenseSchemaHostUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateUUID,
+			},
+
+			hostLicenseSchemaEdition: &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+			},
+
+			hostLicenseSchemaLicenseServerAddress: &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+
+			hostLicenseSchemaLicenseServerPort: &schema.Schema{
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      defaultLicenseServerPort,
+				ValidateFunc: validation.IsPortNumber,
+			},
+
+			// Base64 encoded license file of XenServer versions before 6.2,
+			// applied once, so it is not read back
+			hostLicenseSchemaLicenseFile: &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				Sensitive:    true,
+				ValidateFunc: validation.StringIsBase64,
+			},
+
+			hostLicenseSchemaExpiry: &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			hostLicenseSchemaLicenseParams: &schema.Schema{
+				Type:     schema.TypeMap,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+		},
+	}
+}
+
+// applyHostLicense points the host to the license server, if any, and checks
+// out a license of the edition from it.
+func applyHostLicense(c *Connection, host *HostDescriptor, d *schema.ResourceData) error {
+	licenseServer, err := c.client.Host.GetLicenseServer(c.session, host.HostRef)
+	if err != nil {
+		return err
+	}
+
+	if address := d.Get(hostLicenseSchemaLicenseServerAddress).(string); address != "" {
+		licenseServer["address"] = address
+		licenseServer["port"] = strconv.Itoa(d.Get(hostLicenseSchemaLicenseServerPort).(int))
+
+		log.Printf("[DEBUG] Setting license server of host %s to %s:%s", host.UUID, licenseServer["address"], licenseServer["port"])
+		if err := c.client.Host.SetLicenseServer(c.session, host.HostRef, licenseServer); err != nil {
+			return err
+		}
+	}
+
+	edition := d.Get(hostLicenseSchemaEdition).(string)
+	log.Printf("[DEBUG] Applying edition %s to host %s", edition, host.UUID)
+	return c.client.Host.ApplyEdition(c.session, host.HostRef, edition, false)
+}
+
+func resourceHostLicenseCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	host := &HostDescriptor{
+		UUID: d.Get(hostLicenseSchemaHostUUID).(string),
+	}
+
+	if err := host.Load(c); err != nil {
+		return diag.FromErr(referenceError(c, "host", host.UUID, err))
+	}
+
+	if licenseFile, ok := d.GetOk(hostLicenseSchemaLicenseFile); ok {
+		log.Printf("[DEBUG] Applying license file to host %s", host.UUID)
+		if err := c.client.Host.LicenseApply(c.session, host.HostRef, licenseFile.(string)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if err := applyHostLicense(c, host, d); err != nil {
+		return diag.FromErr(err)
+	}
+
+	d.SetId(host.UUID)
+
+	return resourceHostLicenseRead(ctx, d, m)
+}
+
+func resourceHostLicenseRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	host := &HostDescriptor{
+		UUID: d.Id(),
+	}
+
+	if err := host.Load(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	record, err := c.client.Host.GetRecord(c.session, host.HostRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(hostLicenseSchemaHostUUID, host.UUID); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(hostLicenseSchemaEdition, record.Edition); err != nil {
+		return diag.FromErr(err)
+	}
+
+	// The license server is only managed if declared
+	if d.Get(hostLicenseSchemaLicenseServerAddress).(string) != "" {
+		if err := d.Set(hostLicenseSchemaLicenseServerAddress, record.LicenseServer["address"]); err != nil {
+			return diag.FromErr(err)
+		}
+
+		if port, err := strconv.Atoi(record.LicenseServer["port"]); err == nil {
+			if err := d.Set(hostLicenseSchemaLicenseServerPort, port); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+	}
+
+	if err := d.Set(hostLicenseSchemaExpiry, record.LicenseParams["expiry"]); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(hostLicenseSchemaLicenseParams, record.LicenseParams); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return nil
+}
+
+func resourceHostLicenseUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	host := &HostDescriptor{
+		UUID: d.Id(),
+	}
+
+	if err := host.Load(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if d.HasChange(hostLicenseSchemaEdition) || d.HasChange(hostLicenseSchemaLicenseServerAddress) ||
+		d.HasChange(hostLicenseSchemaLicenseServerPort) {
+		if err := applyHostLicense(c, host, d); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	return resourceHostLicenseRead(ctx, d, m)
+}
+
+// resourceHostLicenseDelete leaves the license of the host in place, as falling
+// back to the free edition could disable features VMs depend on.
+func resourceHostLicenseDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	log.Printf("[DEBUG] Leaving edition %s applied to host %s", d.Get(hostLicenseSchemaEdition).(string), d.Id())
+	return nil
+}
+
+func resourceHostLicenseExists(d *schema.ResourceData, m interface{}) (bool, error) {
+	c := m.(*Connection)
+
+	if _, err := c.client.Host.GetByUUID(c.session, d.Id()); err != nil {
+		if xenErr, ok := err.(*xenapi.Error); ok {
+			if xenErr.Code() == xenapi.ERR_UUID_INVALID {
+				return false, nil
+			}
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,145 @@
+package xenserver
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+const (
+	hostMaintenanceSchemaHostUUID = "host_uuid"
+	hostMaintenanceSchemaEvacuate = "evacuate"
+)
+
+func resourceHostMaintenance() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceHostMaintenanceCreate,
+		ReadContext:   forgetfulRead(resourceHostMaintenanceRead, resourceHostMaintenanceExists),
+		DeleteContext: resourceHostMaintenanceDelete,
+
+		// Evacuating the host migrates all of its VMs
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(60 * time.Minute),
+			Delete: schema.DefaultTimeout(10 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			hostMaintenanceSchemaHostUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateUUID,
+			},
+
+			hostMaintenanceSchemaEvacuate: &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  true,
+				ForceNew: true,
+			},
+		},
+	}
+}
+
+func resourceHostMaintenanceCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c, cancel, err := m.(*Connection).WithTimeout(d.Timeout(schema.TimeoutCreate))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer cancel()
+
+	host := &HostDescriptor{
+		UUID: d.Get(hostMaintenanceSchemaHostUUID).(string),
+	}
+
+	if err := host.Load(c); err != nil {
+		return diag.FromErr(referenceError(c, "host", host.UUID, err))
+	}
+
+	log.Printf("[DEBUG] Disabling host %s", host.UUID)
+	if err := c.client.Host.Disable(c.session, host.HostRef); err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId(host.UUID)
+
+	if d.Get(hostMaintenanceSchemaEvacuate).(bool) {
+		log.Printf("[DEBUG] Evacuating host %s", host.UUID)
+		if err := c.client.Host.Evacuate(c.session, host.HostRef); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	return nil
+}
+
+func resourceHostMaintenanceRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	host := &HostDescriptor{
+		UUID: d.Id(),
+	}
+
+	if err := host.Load(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	// The host has been taken out of maintenance outside of Terraform
+	if host.Enabled {
+		log.Printf("[DEBUG] Host %s is enabled, maintenance has ended", host.UUID)
+		d.SetId("")
+		return nil
+	}
+
+	if err := d.Set(hostMaintenanceSchemaHostUUID, host.UUID); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return nil
+}
+
+func resourceHostMaintenanceDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c, cancel, err := m.(*Connection).WithTimeout(d.Timeout(schema.TimeoutDelete))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer cancel()
+
+	host := &HostDescriptor{
+		UUID: d.Id(),
+	}
+
+	if err := host.Load(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	log.Printf("[DEBUG] Enabling host %s", host.UUID)
+	if err := c.client.Host.Enable(c.session, host.HostRef); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return nil
+}
+
+func resourceHostMaintenanceExists(d *schema.ResourceData, m interface{}) (bool, error) {
+	c := m.(*Connection)
+
+	host := &HostDescriptor{
+		UUID: d.Id(),
+	}
+
+	if err := host.Load(c); err != nil {
+		if xenErr, ok := err.(*xenapi.Error); ok {
+			if xenErr.Code() == xenapi.ERR_UUID_INVALID {
+				return false, nil
+			}
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
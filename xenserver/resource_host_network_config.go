@@ -0,0 +1,270 @@
+package xenserver
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+const (
+	hostNetworkConfigSchemaHostUUID          = "host_uuid"
+	hostNetworkConfigSchemaNameLabel         = "name_label"
+	hostNetworkConfigSchemaDNSServers        = "dns_servers"
+	hostNetworkConfigSchemaSyslogDestination = "syslog_destination"
+
+	// Key in the logging map of the host which makes it forward its logs
+	hostLoggingSyslogDestination = "syslog_destination"
+)
+
+func resourceHostNetworkConfig() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceHostNetworkConfigCreate,
+		ReadContext:   forgetfulRead(resourceHostNetworkConfigRead, resourceHostNetworkConfigExists),
+		UpdateContext: resourceHostNetworkConfigUpdate,
+		DeleteContext: resourceHostNetworkConfigDelete,
+
+		Schema: map[string]*schema.Schema{
+			hostNetworkConfigSchemaHostUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateUUID,
+			},
+
+			hostNetworkConfigSchemaNameLabel: &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+
+			// Configured on the management interface, which needs a static IP
+			// configuration for it
+			hostNetworkConfigSchemaDNSServers: &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+
+			hostNetworkConfigSchemaSyslogDestination: &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+		},
+	}
+}
+
+// managementPIF returns the PIF the host is managed through.
+func managementPIF(c *Connection, host *HostDescriptor) (xenapi.PIFRef, xenapi.PIFRecord, error) {
+	pifs, err := c.client.PIF.GetAllRecords(c.session)
+	if err != nil {
+		return "", xenapi.PIFRecord{}, err
+	}
+
+	for ref, pif := range pifs {
+		if pif.Host == host.HostRef && pif.Management {
+			return ref, pif, nil
+		}
+	}
+
+	return "", xenapi.PIFRecord{}, fmt.Errorf("host %s has no management interface", host.UUID)
+}
+
+func setHostDNSServers(c *Connection, host *HostDescriptor, servers []interface{}) error {
+	dns := make([]string, 0, len(servers))
+	for _, server := range servers {
+		dns = append(dns, server.(string))
+	}
+
+	pifRef, pif, err := managementPIF(c, host)
+	if err != nil {
+		return err
+	}
+
+	if strings.Join(dns, ",") == pif.DNS {
+		return nil
+	}
+
+	// With DHCP the DNS servers are handed out by the DHCP server
+	if pif.IPConfigurationMode != xenapi.IPConfigurationModeStatic {
+		return fmt.Errorf("%q requires a static IP configuration of the management interface %s of host %s, it is configured with %s",
+			hostNetworkConfigSchemaDNSServers, pif.Device, host.UUID, pif.IPConfigurationMode)
+	}
+
+	log.Printf("[DEBUG] Setting DNS servers of host %s to %q", host.UUID, dns)
+	return c.client.PIF.ReconfigureIP(c.session, pifRef, pif.IPConfigurationMode, pif.IP, pif.Netmask, pif.Gateway, strings.Join(dns, ","))
+}
+
+func setHostSyslogDestination(c *Connection, host *HostDescriptor, destination string) error {
+	log.Printf("[DEBUG] Setting syslog destination of host %s to %q", host.UUID, destination)
+	if err := c.client.Host.RemoveFromLogging(c.session, host.HostRef, hostLoggingSyslogDestination); err != nil {
+		return err
+	}
+
+	if destination != "" {
+		if err := c.client.Host.AddToLogging(c.session, host.HostRef, hostLoggingSyslogDestination, destination); err != nil {
+			return err
+		}
+	}
+
+	// Rewrites the syslog configuration of the control domain
+	return c.client.Host.SyslogReconfigure(c.session, host.HostRef)
+}
+
+func resourceHostNetworkConfigCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	host := &HostDescriptor{
+		UUID: d.Get(hostNetworkConfigSchemaHostUUID).(string),
+	}
+
+	if err := host.Load(c); err != nil {
+		return diag.FromErr(referenceError(c, "host", host.UUID, err))
+	}
+
+	if nameLabel, ok := d.GetOk(hostNetworkConfigSchemaNameLabel); ok {
+		log.Printf("[DEBUG] Setting name of host %s to %q", host.UUID, nameLabel.(string))
+		if err := c.client.Host.SetNameLabel(c.session, host.HostRef, nameLabel.(string)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if servers, ok := d.GetOk(hostNetworkConfigSchemaDNSServers); ok {
+		if err := setHostDNSServers(c, host, servers.([]interface{})); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if destination, ok := d.GetOk(hostNetworkConfigSchemaSyslogDestination); ok {
+		if err := setHostSyslogDestination(c, host, destination.(string)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	d.SetId(host.UUID)
+
+	return resourceHostNetworkConfigRead(ctx, d, m)
+}
+
+func resourceHostNetworkConfigRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	host := &HostDescriptor{
+		UUID: d.Id(),
+	}
+
+	if err := host.Load(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	record, err := c.client.Host.GetRecord(c.session, host.HostRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	_, pif, err := managementPIF(c, host)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	dns := make([]string, 0)
+	for _, server := range strings.Split(pif.DNS, ",") {
+		if server = strings.TrimSpace(server); server != "" {
+			dns = append(dns, server)
+		}
+	}
+
+	if err := d.Set(hostNetworkConfigSchemaHostUUID, host.UUID); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(hostNetworkConfigSchemaNameLabel, record.NameLabel); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(hostNetworkConfigSchemaDNSServers, dns); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(hostNetworkConfigSchemaSyslogDestination, record.Logging[hostLoggingSyslogDestination]); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return nil
+}
+
+func resourceHostNetworkConfigUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	host := &HostDescriptor{
+		UUID: d.Id(),
+	}
+
+	if err := host.Load(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if d.HasChange(hostNetworkConfigSchemaNameLabel) {
+		nameLabel := d.Get(hostNetworkConfigSchemaNameLabel).(string)
+
+		log.Printf("[DEBUG] Setting name of host %s to %q", host.UUID, nameLabel)
+		if err := c.client.Host.SetNameLabel(c.session, host.HostRef, nameLabel); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange(hostNetworkConfigSchemaDNSServers) {
+		if err := setHostDNSServers(c, host, d.Get(hostNetworkConfigSchemaDNSServers).([]interface{})); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange(hostNetworkConfigSchemaSyslogDestination) {
+		if err := setHostSyslogDestination(c, host, d.Get(hostNetworkConfigSchemaSyslogDestination).(string)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	return resourceHostNetworkConfigRead(ctx, d, m)
+}
+
+func resourceHostNetworkConfigDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	host := &HostDescriptor{
+		UUID: d.Id(),
+	}
+
+	if err := host.Load(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	// The name and the DNS servers are left as they are, the host can not do
+	// without them
+	if d.Get(hostNetworkConfigSchemaSyslogDestination).(string) != "" {
+		return diag.FromErr(setHostSyslogDestination(c, host, ""))
+	}
+
+	return nil
+}
+
+func resourceHostNetworkConfigExists(d *schema.ResourceData, m interface{}) (bool, error) {
+	c := m.(*Connection)
+
+	if _, err := c.client.Host.GetByUUID(c.session, d.Id()); err != nil {
+		if xenErr, ok := err.(*xenapi.Error); ok {
+			if xenErr.Code() == xenapi.ERR_UUID_INVALID {
+				return false, nil
+			}
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,229 @@
+package xenserver
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"strconv"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+const (
+	hostStorageConfigSchemaHostUUID     = "host_uuid"
+	hostStorageConfigSchemaISCSIIQN     = "iscsi_iqn"
+	hostStorageConfigSchemaMultipathing = "multipathing"
+
+	// Keys in the other_config of the host the storage settings are kept in.
+	// Hosts predating the dedicated XenAPI methods only read them from there.
+	hostOtherConfigISCSIIQN        = "iscsi_iqn"
+	hostOtherConfigMultipathing    = "multipathing"
+	hostOtherConfigMultipathHandle = "multipathhandle"
+
+	// Multipath handler of the control domain, the only one still supported
+	multipathHandleDMP = "dmp"
+)
+
+// iSCSI qualified names, e.g. iqn.2020-01.com.example:host1, or EUI-64 and NAA
+// based names
+var validateISCSIName = validation.StringMatch(regexp.MustCompile(`^(iqn\.\d{4}-\d{2}\.[^\s:]+(:\S+)?|eui\.[0-9A-Fa-f]{16}|naa\.[0-9A-Fa-f]{16,32})$`),
+	"must be an iSCSI qualified name, e.g. iqn.2020-01.com.example:host1")
+
+func resourceHostStorageConfig() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceHostStorageConfigCreate,
+		ReadContext:   forgetfulRead(resourceHostStorageConfigRead, resourceHostStorageConfigExists),
+		UpdateContext: resourceHostStorageConfigUpdate,
+		DeleteContext: resourceHostStorageConfigDelete,
+
+		Schema: map[string]*schema.Schema{
+			hostStorageConfigSchemaHostUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateUUID,
+			},
+
+			hostStorageConfigSchemaISCSIIQN: &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validateISCSIName,
+			},
+
+			hostStorageConfigSchemaMultipathing: &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Computed: true,
+			},
+		},
+	}
+}
+
+// setHostStorageSetting sets a storage setting of the host through its
+// dedicated XenAPI method, which XenServer 7.5 introduced along with the field
+// of the host. The client predates them, so the method is called by name. On
+// older hosts, the setting is stored in the other_config of the host instead,
+// which the method keeps in sync as well.
+func setHostStorageSetting(c *Connection, host *HostDescriptor, method string, arg interface{}, otherConfig map[string]string) error {
+	_, err := c.client.APICall(method, string(c.session), string(host.HostRef), arg)
+	if err == nil {
+		return nil
+	}
+
+	if xenErr, ok := err.(*xenapi.Error); !ok || xenErr.Code() != xenapi.ERR_MESSAGE_METHOD_UNKNOWN {
+		return err
+	}
+
+	log.Printf("[DEBUG] Host %s does not support %s, setting its other_config instead", host.UUID, method)
+	for key, value := range otherConfig {
+		if err := c.client.Host.RemoveFromOtherConfig(c.session, host.HostRef, key); err != nil {
+			return err
+		}
+
+		if err := c.client.Host.AddToOtherConfig(c.session, host.HostRef, key, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setHostISCSIIQN sets the name the host identifies itself with to iSCSI
+// targets. It can only be changed while no iSCSI SR is attached to the host.
+func setHostISCSIIQN(c *Connection, host *HostDescriptor, iqn string) error {
+	log.Printf("[DEBUG] Setting iSCSI IQN of host %s to %q", host.UUID, iqn)
+	return setHostStorageSetting(c, host, "host.set_iscsi_iqn", iqn, map[string]string{
+		hostOtherConfigISCSIIQN: iqn,
+	})
+}
+
+// setHostMultipathing enables or disables multipathing of the storage of the
+// host. It can only be changed while no SR is attached to the host, i.e. while
+// the host is in maintenance mode.
+func setHostMultipathing(c *Connection, host *HostDescriptor, enabled bool) error {
+	log.Printf("[DEBUG] Setting multipathing of host %s to %t", host.UUID, enabled)
+	return setHostStorageSetting(c, host, "host.set_multipathing", enabled, map[string]string{
+		hostOtherConfigMultipathing:    strconv.FormatBool(enabled),
+		hostOtherConfigMultipathHandle: multipathHandleDMP,
+	})
+}
+
+func resourceHostStorageConfigCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	host := &HostDescriptor{
+		UUID: d.Get(hostStorageConfigSchemaHostUUID).(string),
+	}
+
+	if err := host.Load(c); err != nil {
+		return diag.FromErr(referenceError(c, "host", host.UUID, err))
+	}
+
+	otherConfig, err := c.client.Host.GetOtherConfig(c.session, host.HostRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	// Setting the IQN restarts the iSCSI initiator, so it is only set if it
+	// differs
+	if iqn, ok := d.GetOk(hostStorageConfigSchemaISCSIIQN); ok && iqn.(string) != otherConfig[hostOtherConfigISCSIIQN] {
+		if err := setHostISCSIIQN(c, host, iqn.(string)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if multipathing, ok := d.GetOkExists(hostStorageConfigSchemaMultipathing); ok {
+		if strconv.FormatBool(multipathing.(bool)) != otherConfig[hostOtherConfigMultipathing] {
+			if err := setHostMultipathing(c, host, multipathing.(bool)); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+	}
+
+	d.SetId(host.UUID)
+
+	return resourceHostStorageConfigRead(ctx, d, m)
+}
+
+func resourceHostStorageConfigRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	host := &HostDescriptor{
+		UUID: d.Id(),
+	}
+
+	if err := host.Load(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	otherConfig, err := c.client.Host.GetOtherConfig(c.session, host.HostRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(hostStorageConfigSchemaHostUUID, host.UUID); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(hostStorageConfigSchemaISCSIIQN, otherConfig[hostOtherConfigISCSIIQN]); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(hostStorageConfigSchemaMultipathing, otherConfig[hostOtherConfigMultipathing] == "true"); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return nil
+}
+
+func resourceHostStorageConfigUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	host := &HostDescriptor{
+		UUID: d.Id(),
+	}
+
+	if err := host.Load(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if d.HasChange(hostStorageConfigSchemaISCSIIQN) {
+		if err := setHostISCSIIQN(c, host, d.Get(hostStorageConfigSchemaISCSIIQN).(string)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange(hostStorageConfigSchemaMultipathing) {
+		if err := setHostMultipathing(c, host, d.Get(hostStorageConfigSchemaMultipathing).(bool)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	return resourceHostStorageConfigRead(ctx, d, m)
+}
+
+// resourceHostStorageConfigDelete leaves the settings as they are, as changing
+// them would disrupt the storage of the host.
+func resourceHostStorageConfigDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return nil
+}
+
+func resourceHostStorageConfigExists(d *schema.ResourceData, m interface{}) (bool, error) {
+	c := m.(*Connection)
+
+	if _, err := c.client.Host.GetByUUID(c.session, d.Id()); err != nil {
+		if xenErr, ok := err.(*xenapi.Error); ok {
+			if xenErr.Code() == xenapi.ERR_UUID_INVALID {
+				return false, nil
+			}
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
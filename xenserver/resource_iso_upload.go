@@ -0,0 +1,370 @@
+package xenserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+const (
+	isoUploadSchemaSRUUID   = "sr_uuid"
+	isoUploadSchemaName     = "name_label"
+	isoUploadSchemaSource   = "source"
+	isoUploadSchemaChecksum = "checksum"
+	isoUploadSchemaVDIUUID  = "vdi_uuid"
+
+	// Key in the other_config of the VDI the checksum of the uploaded file is stored in
+	isoUploadOtherConfigChecksum = "terraform_checksum"
+	// Key in the other_config of the VDI the time of the upload is stored in,
+	// which the xenserver_isos data source orders the ISOs by
+	isoUploadOtherConfigUploaded = "terraform_uploaded"
+)
+
+func resourceISOUpload() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceISOUploadCreate,
+		ReadContext:   forgetfulRead(resourceISOUploadRead, resourceISOUploadExists),
+		UpdateContext: resourceISOUploadUpdate,
+		DeleteContext: resourceISOUploadDelete,
+
+		CustomizeDiff: resourceISOUploadCustomizeDiff,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(60 * time.Minute),
+			Delete: schema.DefaultTimeout(20 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			isoUploadSchemaSRUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateUUID,
+			},
+
+			isoUploadSchemaName: &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+			},
+
+			isoUploadSchemaSource: &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+			},
+
+			isoUploadSchemaChecksum: &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			isoUploadSchemaVDIUUID: &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// importRawVDI streams the content of r, an image in the format raw or vhd,
+// into the VDI through the import_raw_vdi HTTP handler of XenServer.
+func importRawVDI(c *Connection, vdi xenapi.VDIRef, r io.Reader, size int64, format string) error {
+	query := url.Values{}
+	query.Set("session_id", string(c.session))
+	query.Set("vdi", string(vdi))
+	query.Set("format", format)
+
+	progress := &transferProgress{
+		r:         r,
+		operation: "Upload to",
+		vdi:       vdi,
+		size:      size,
+		percent:   -1,
+	}
+
+	req, err := http.NewRequest(http.MethodPut, strings.TrimRight(c.url, "/")+"/import_raw_vdi?"+query.Encode(), progress)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+
+	client := &http.Client{
+		Transport: c.transport,
+	}
+
+	resp, err := client.Do(req.WithContext(c.ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("VDI import failed: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// transferProgress reports the progress of an upload or a download to the log
+// while the content is read.
+type transferProgress struct {
+	r           io.Reader
+	operation   string
+	vdi         xenapi.VDIRef
+	size        int64
+	transferred int64
+	percent     int
+}
+
+func (p *transferProgress) Read(buf []byte) (int, error) {
+	n, err := p.r.Read(buf)
+	p.transferred += int64(n)
+
+	if p.size > 0 {
+		if percent := int(p.transferred * 100 / p.size); percent != p.percent {
+			p.percent = percent
+			log.Printf("[INFO] %s VDI %s is %d%% complete", p.operation, p.vdi, percent)
+		}
+	}
+
+	return n, err
+}
+
+// uploadVDI creates a VDI in the SR sized to fit the local image at source and
+// uploads the image into it. The VDI is destroyed again if the upload fails.
+func uploadVDI(c *Connection, sr *SRDescriptor, name, source, format string, otherConfig map[string]string) (xenapi.VDIRef, error) {
+	f, err := os.Open(source)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	virtualSize := info.Size()
+	if format == vdiFormatVHD {
+		if virtualSize, err = vhdVirtualSize(f, info.Size()); err != nil {
+			return "", fmt.Errorf("failed to read the size of the disk in %s: %s", source, err)
+		}
+	}
+
+	vdiRecord := xenapi.VDIRecord{
+		NameLabel:   name,
+		VirtualSize: int(virtualSize),
+		SR:          sr.SRRef,
+		Type:        xenapi.VdiTypeUser,
+		OtherConfig: otherConfig,
+	}
+
+	vdiRef, err := c.client.VDI.Create(c.session, vdiRecord)
+	if err != nil {
+		return "", err
+	}
+
+	log.Printf("[DEBUG] Uploading %s to VDI %s", source, vdiRef)
+	if err := importRawVDI(c, vdiRef, f, info.Size(), format); err != nil {
+		// Do not leave a partially uploaded file behind
+		if destroyErr := c.client.VDI.Destroy(c.session, vdiRef); destroyErr != nil {
+			log.Println("[ERROR] ", destroyErr)
+		}
+		return "", err
+	}
+
+	return vdiRef, nil
+}
+
+func resourceISOUploadCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	checksum, err := fileSHA256(d.Get(isoUploadSchemaSource).(string))
+	if err != nil {
+		return err
+	}
+
+	if checksum != d.Get(isoUploadSchemaChecksum).(string) {
+		if err := d.SetNew(isoUploadSchemaChecksum, checksum); err != nil {
+			return err
+		}
+
+		if d.Id() != "" {
+			return d.ForceNew(isoUploadSchemaChecksum)
+		}
+	}
+
+	return nil
+}
+
+func resourceISOUploadCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return uploadCreate(ctx, d, m, vdiFormatRaw)
+}
+
+// uploadCreate uploads the source file of the resource, which is in the given
+// format, into a new VDI. It creates the ISO uploads as well as the imported
+// disk images.
+func uploadCreate(ctx context.Context, d *schema.ResourceData, m interface{}, format string) diag.Diagnostics {
+	c, cancel, err := m.(*Connection).WithTimeout(d.Timeout(schema.TimeoutCreate))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer cancel()
+
+	sr := &SRDescriptor{
+		UUID: d.Get(isoUploadSchemaSRUUID).(string),
+	}
+
+	if err := sr.Load(c); err != nil {
+		return diag.FromErr(referenceError(c, "SR", sr.UUID, err))
+	}
+
+	source := d.Get(isoUploadSchemaSource).(string)
+
+	checksum, err := fileSHA256(source)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	vdiRef, err := uploadVDI(c, sr, d.Get(isoUploadSchemaName).(string), source, format, map[string]string{
+		isoUploadOtherConfigChecksum: checksum,
+		isoUploadOtherConfigUploaded: time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	vdi := &VDIDescriptor{
+		VDIRef: vdiRef,
+	}
+
+	if err := vdi.Query(c); err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId(vdi.UUID)
+
+	return resourceISOUploadRead(ctx, d, m)
+}
+
+func resourceISOUploadRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	vdi := &VDIDescriptor{
+		UUID: d.Id(),
+	}
+
+	if err := vdi.Load(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	otherConfig, err := c.client.VDI.GetOtherConfig(c.session, vdi.VDIRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(isoUploadSchemaName, vdi.Name); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(isoUploadSchemaSRUUID, vdi.SR.UUID); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(isoUploadSchemaChecksum, otherConfig[isoUploadOtherConfigChecksum]); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(isoUploadSchemaVDIUUID, vdi.UUID); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return nil
+}
+
+func resourceISOUploadUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	vdi := &VDIDescriptor{
+		UUID: d.Id(),
+	}
+
+	if err := vdi.Load(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if d.HasChange(isoUploadSchemaName) {
+		_, n := d.GetChange(isoUploadSchemaName)
+
+		if err := c.client.VDI.SetNameLabel(c.session, vdi.VDIRef, n.(string)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	return resourceISOUploadRead(ctx, d, m)
+}
+
+func resourceISOUploadDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c, cancel, err := m.(*Connection).WithTimeout(d.Timeout(schema.TimeoutDelete))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer cancel()
+
+	vdi := &VDIDescriptor{
+		UUID: d.Id(),
+	}
+
+	if err := vdi.Load(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := c.client.VDI.Destroy(c.session, vdi.VDIRef); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return nil
+}
+
+func resourceISOUploadExists(d *schema.ResourceData, m interface{}) (bool, error) {
+	c := m.(*Connection)
+
+	vdi := &VDIDescriptor{
+		UUID: d.Id(),
+	}
+
+	if err := vdi.Load(c); err != nil {
+		if xenErr, ok := err.(*xenapi.Error); ok {
+			if xenErr.Code() == xenapi.ERR_UUID_INVALID {
+				return false, nil
+			}
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
@@ -19,9 +19,14 @@
 package xenserver
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"sort"
 
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	xenapi "github.com/terra-farm/go-xen-api-client"
 )
 
@@ -31,15 +36,20 @@ const (
 	networkSchemaBridge      = "bridge"
 	networkSchemaMTU         = "mtu"
 	networkSchemaOtherConfig = "other_config"
+	networkSchemaRef         = "ref"
+	networkSchemaPIFs        = "pifs"
+
+	networkSchemaDefaultLockingMode = "default_locking_mode"
+
+	networkSchemaAllowDisruptiveUpdate = "allow_disruptive_update"
 )
 
 func resourceNetwork() *schema.Resource {
 	return &schema.Resource{
-		Create: resourceNetworkCreate,
-		Read:   resourceNetworkRead,
-		Update: resourceNetworkUpdate,
-		Delete: resourceNetworkDelete,
-		Exists: resourceNetworkExists,
+		CreateContext: resourceNetworkCreate,
+		ReadContext:   forgetfulRead(resourceNetworkRead, resourceNetworkExists),
+		UpdateContext: resourceNetworkUpdate,
+		DeleteContext: resourceNetworkDelete,
 
 		Schema: map[string]*schema.Schema{
 			networkSchemaName: &schema.Schema{
@@ -53,8 +63,9 @@ func resourceNetwork() *schema.Resource {
 			},
 
 			networkSchemaMTU: &schema.Schema{
-				Type:     schema.TypeInt,
-				Optional: true,
+				Type:         schema.TypeInt,
+				Optional:     true,
+				ValidateFunc: validateMTU,
 			},
 
 			networkSchemaBridge: &schema.Schema{
@@ -67,17 +78,52 @@ func resourceNetwork() *schema.Resource {
 				Type:     schema.TypeMap,
 				Optional: true,
 			},
+
+			xenCenterSchemaFolder:       xenCenterFolderSchema(),
+			xenCenterSchemaCustomFields: xenCenterCustomFieldsSchema(),
+
+			// Applies to the VIFs in the network_default locking mode, which
+			// drop all traffic while the network is disabled
+			networkSchemaDefaultLockingMode: &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+				Default:  string(xenapi.NetworkDefaultLockingModeUnlocked),
+				ValidateFunc: validation.StringInSlice([]string{
+					string(xenapi.NetworkDefaultLockingModeUnlocked),
+					string(xenapi.NetworkDefaultLockingModeDisabled),
+				}, false),
+			},
+
+			networkSchemaAllowDisruptiveUpdate: &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+
+			networkSchemaRef: &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			networkSchemaPIFs: &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
 		},
 	}
 }
 
-func resourceNetworkCreate(d *schema.ResourceData, m interface{}) error {
+func resourceNetworkCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	c := m.(*Connection)
 
 	var other_config = make(map[string]string)
 	for k, v := range d.Get(networkSchemaOtherConfig).(map[string]interface{}) {
 		other_config[k] = v.(string)
 	}
+	for k, v := range xenCenterOtherConfig(d.Get(xenCenterSchemaFolder), d.Get(xenCenterSchemaCustomFields)) {
+		other_config[k] = v.(string)
+	}
 
 	networkRecord := xenapi.NetworkRecord{
 		NameLabel:       d.Get(networkSchemaName).(string),
@@ -95,19 +141,27 @@ func resourceNetworkCreate(d *schema.ResourceData, m interface{}) error {
 		}
 
 		if err := network.Query(c); err != nil {
-			return err
+			return diag.FromErr(err)
 		}
 		log.Println("UUID is ", network.UUID)
 		d.SetId(network.UUID)
+
+		// Not taken into account by network.create
+		mode := xenapi.NetworkDefaultLockingMode(d.Get(networkSchemaDefaultLockingMode).(string))
+		if mode != network.DefaultLockingMode {
+			if err := c.client.Network.SetDefaultLockingMode(c.session, network.NetworkRef, mode); err != nil {
+				return diag.FromErr(err)
+			}
+		}
 	} else {
 		log.Println("Network not created!")
-		return err
+		return diag.FromErr(err)
 	}
 
 	return nil
 }
 
-func resourceNetworkRead(d *schema.ResourceData, m interface{}) error {
+func resourceNetworkRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	c := m.(*Connection)
 
 	network := &NetworkDescriptor{
@@ -115,29 +169,64 @@ func resourceNetworkRead(d *schema.ResourceData, m interface{}) error {
 	}
 
 	if err := network.Load(c); err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	d.SetId(network.UUID)
 	if err := d.Set(networkSchemaName, network.Name); err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	if err := d.Set(networkSchemaBridge, network.Bridge); err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	if err := d.Set(networkSchemaMTU, network.MTU); err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	if err := d.Set(networkSchemaDescription, network.Description); err != nil {
-		return err
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(networkSchemaRef, string(network.NetworkRef)); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(networkSchemaOtherConfig, filterDeclaredKeys(network.OtherConfig, d.Get(networkSchemaOtherConfig).(map[string]interface{}))); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := readXenCenterMetadata(d, network.OtherConfig); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(networkSchemaDefaultLockingMode, string(network.DefaultLockingMode)); err != nil {
+		return diag.FromErr(err)
+	}
+
+	pifRefs, err := c.client.Network.GetPIFs(c.session, network.NetworkRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	pifs := make([]string, 0, len(pifRefs))
+	for _, pifRef := range pifRefs {
+		pifUUID, err := c.client.PIF.GetUUID(c.session, pifRef)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		pifs = append(pifs, pifUUID)
+	}
+	sort.Strings(pifs)
+
+	if err := d.Set(networkSchemaPIFs, pifs); err != nil {
+		return diag.FromErr(err)
 	}
 
 	return nil
 }
-func resourceNetworkUpdate(d *schema.ResourceData, m interface{}) error {
+func resourceNetworkUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	c := m.(*Connection)
 
 	network := &NetworkDescriptor{
@@ -145,42 +234,131 @@ func resourceNetworkUpdate(d *schema.ResourceData, m interface{}) error {
 	}
 
 	if err := network.Load(c); err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	if d.HasChange(networkSchemaName) {
 		_, n := d.GetChange(networkSchemaName)
 
 		if err := c.client.Network.SetNameLabel(c.session, network.NetworkRef, n.(string)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange(networkSchemaMTU) {
+		if err := setNetworkMTU(c, network, d.Get(networkSchemaMTU).(int), d.Get(networkSchemaAllowDisruptiveUpdate).(bool)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange(networkSchemaDescription) {
+		_, n := d.GetChange(networkSchemaDescription)
+
+		if err := c.client.Network.SetNameDescription(c.session, network.NetworkRef, n.(string)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange(networkSchemaOtherConfig) || xenCenterMetadataChanged(d) {
+		o, n := d.GetChange(networkSchemaOtherConfig)
+		otherConfig := mergeDeclaredKeys(network.OtherConfig, o.(map[string]interface{}), n.(map[string]interface{}))
+		otherConfig = mergeXenCenterMetadata(otherConfig, d)
+
+		if err := c.client.Network.SetOtherConfig(c.session, network.NetworkRef, otherConfig); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange(networkSchemaDefaultLockingMode) {
+		mode := xenapi.NetworkDefaultLockingMode(d.Get(networkSchemaDefaultLockingMode).(string))
+
+		log.Printf("[DEBUG] Setting default locking mode of network %s to %s", network.UUID, mode)
+		if err := c.client.Network.SetDefaultLockingMode(c.session, network.NetworkRef, mode); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	return nil
+}
+
+// setNetworkMTU changes the MTU of the network. The PIFs of the network only
+// pick up the new MTU when they are plugged, so the attached ones are unplugged
+// and plugged again, which interrupts the traffic of the network. VIFs of running
+// VMs keep their MTU until they are plugged again, e.g. by rebooting the VM.
+func setNetworkMTU(c *Connection, network *NetworkDescriptor, mtu int, allowDisruptive bool) error {
+	pifRefs, err := c.client.Network.GetPIFs(c.session, network.NetworkRef)
+	if err != nil {
+		return err
+	}
+
+	attached := make([]xenapi.PIFRef, 0, len(pifRefs))
+	for _, pifRef := range pifRefs {
+		pif, err := c.client.PIF.GetRecord(c.session, pifRef)
+		if err != nil {
 			return err
 		}
 
-		d.SetPartial(networkSchemaName)
+		if !pif.CurrentlyAttached {
+			continue
+		}
+
+		if pif.Management {
+			return fmt.Errorf("can not change the MTU of network %s, it carries the management interface %s", network.UUID, pif.UUID)
+		}
+
+		attached = append(attached, pifRef)
 	}
 
-	if d.HasChange(networkSchemaMTU) {
-		_, n := d.GetChange(networkSchemaMTU)
+	if len(attached) > 0 && !allowDisruptive {
+		return fmt.Errorf("changing the MTU of network %s replugs its %d attached PIFs, which interrupts its traffic, set %q to allow it",
+			network.UUID, len(attached), networkSchemaAllowDisruptiveUpdate)
+	}
+
+	log.Printf("[DEBUG] Setting MTU of network %s to %d", network.UUID, mtu)
+	if err := c.client.Network.SetMTU(c.session, network.NetworkRef, mtu); err != nil {
+		return err
+	}
 
-		if err := c.client.Network.SetMTU(c.session, network.NetworkRef, n.(int)); err != nil {
+	for _, pifRef := range attached {
+		log.Printf("[DEBUG] Replugging PIF %s to apply the MTU of network %s", pifRef, network.UUID)
+		if err := c.client.PIF.Unplug(c.session, pifRef); err != nil {
 			return err
 		}
 
-		d.SetPartial(networkSchemaMTU)
+		if err := c.client.PIF.Plug(c.session, pifRef); err != nil {
+			return err
+		}
 	}
 
-	if d.HasChange(networkSchemaDescription) {
-		_, n := d.GetChange(networkSchemaDescription)
+	vifRefs, err := c.client.Network.GetVIFs(c.session, network.NetworkRef)
+	if err != nil {
+		return err
+	}
 
-		if err := c.client.Network.SetNameDescription(c.session, network.NetworkRef, n.(string)); err != nil {
+	for _, vifRef := range vifRefs {
+		vif, err := c.getVIFRecord(vifRef)
+		if err != nil {
+			return err
+		}
+
+		if !vif.CurrentlyAttached {
+			continue
+		}
+
+		vm := &VMDescriptor{
+			VMRef: vif.VM,
+		}
+		if err := vm.Query(c); err != nil {
 			return err
 		}
 
-		d.SetPartial(networkSchemaDescription)
+		log.Printf("[WARN] VM %s (%s) keeps the previous MTU of network %s until it is rebooted", vm.Name, vm.UUID, network.UUID)
 	}
 
 	return nil
 }
-func resourceNetworkDelete(d *schema.ResourceData, m interface{}) error {
+
+func resourceNetworkDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	c := m.(*Connection)
 
 	network := &NetworkDescriptor{
@@ -188,11 +366,11 @@ func resourceNetworkDelete(d *schema.ResourceData, m interface{}) error {
 	}
 
 	if err := network.Load(c); err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	if err := c.client.Network.Destroy(c.session, network.NetworkRef); err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	return nil
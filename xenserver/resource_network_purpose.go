@@ -0,0 +1,235 @@
+package xenserver
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+const (
+	networkPurposeSchemaNetworkUUID = "network_uuid"
+	networkPurposeSchemaPurposes    = "purposes"
+
+	// Key in the other_config of the network listing the purposes which have
+	// been added by Terraform, separated by commas. Only these are removed
+	// again, purposes the network had before are left alone.
+	networkOtherConfigAddedPurposes = "terraform_added_purposes"
+)
+
+func resourceNetworkPurpose() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceNetworkPurposeCreate,
+		ReadContext:   forgetfulRead(resourceNetworkPurposeRead, resourceNetworkPurposeExists),
+		UpdateContext: resourceNetworkPurposeUpdate,
+		DeleteContext: resourceNetworkPurposeDelete,
+
+		Schema: map[string]*schema.Schema{
+			networkPurposeSchemaNetworkUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateUUID,
+			},
+
+			// Only the declared purposes are managed, others which have been
+			// added to the network are left alone
+			networkPurposeSchemaPurposes: &schema.Schema{
+				Type:     schema.TypeSet,
+				Required: true,
+				MinItems: 1,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+					ValidateFunc: validation.StringInSlice([]string{
+						string(xenapi.NetworkPurposeNbd),
+						string(xenapi.NetworkPurposeInsecureNbd),
+					}, false),
+				},
+				Set: schema.HashString,
+			},
+		},
+	}
+}
+
+// setNetworkPurposes adds the purposes in add to the network and removes the
+// ones in remove from it. Purposes are only removed if they have been added by
+// Terraform, which is recorded in the other_config of the network.
+func setNetworkPurposes(c *Connection, network *NetworkDescriptor, add, remove []interface{}) error {
+	current, err := c.client.Network.GetPurpose(c.session, network.NetworkRef)
+	if err != nil {
+		return err
+	}
+
+	has := make(map[string]bool, len(current))
+	for _, purpose := range current {
+		has[string(purpose)] = true
+	}
+
+	otherConfig, err := c.client.Network.GetOtherConfig(c.session, network.NetworkRef)
+	if err != nil {
+		return err
+	}
+
+	added := make(map[string]bool)
+	for _, purpose := range strings.Split(otherConfig[networkOtherConfigAddedPurposes], ",") {
+		if purpose != "" {
+			added[purpose] = true
+		}
+	}
+
+	for _, purpose := range remove {
+		if !has[purpose.(string)] {
+			continue
+		}
+
+		if !added[purpose.(string)] {
+			log.Printf("[DEBUG] Keeping purpose %s of network %s, it has not been added by Terraform", purpose.(string), network.UUID)
+			continue
+		}
+
+		log.Printf("[DEBUG] Removing purpose %s from network %s", purpose.(string), network.UUID)
+		if err := c.client.Network.RemovePurpose(c.session, network.NetworkRef, xenapi.NetworkPurpose(purpose.(string))); err != nil {
+			return err
+		}
+		delete(added, purpose.(string))
+	}
+
+	for _, purpose := range add {
+		if !has[purpose.(string)] {
+			log.Printf("[DEBUG] Adding purpose %s to network %s", purpose.(string), network.UUID)
+			if err := c.client.Network.AddPurpose(c.session, network.NetworkRef, xenapi.NetworkPurpose(purpose.(string))); err != nil {
+				return err
+			}
+			added[purpose.(string)] = true
+		}
+	}
+
+	purposes := make([]string, 0, len(added))
+	for purpose := range added {
+		purposes = append(purposes, purpose)
+	}
+	sort.Strings(purposes)
+
+	if err := c.client.Network.RemoveFromOtherConfig(c.session, network.NetworkRef, networkOtherConfigAddedPurposes); err != nil {
+		return err
+	}
+
+	if len(purposes) == 0 {
+		return nil
+	}
+
+	return c.client.Network.AddToOtherConfig(c.session, network.NetworkRef, networkOtherConfigAddedPurposes, strings.Join(purposes, ","))
+}
+
+func resourceNetworkPurposeCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	network := &NetworkDescriptor{
+		UUID: d.Get(networkPurposeSchemaNetworkUUID).(string),
+	}
+
+	if err := network.Load(c); err != nil {
+		return diag.FromErr(referenceError(c, "network", network.UUID, err))
+	}
+
+	if err := setNetworkPurposes(c, network, d.Get(networkPurposeSchemaPurposes).(*schema.Set).List(), nil); err != nil {
+		return diag.FromErr(err)
+	}
+
+	d.SetId(network.UUID)
+
+	return resourceNetworkPurposeRead(ctx, d, m)
+}
+
+func resourceNetworkPurposeRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	network := &NetworkDescriptor{
+		UUID: d.Id(),
+	}
+
+	if err := network.Load(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	current, err := c.client.Network.GetPurpose(c.session, network.NetworkRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	declared := d.Get(networkPurposeSchemaPurposes).(*schema.Set)
+	purposes := make([]string, 0, len(current))
+	for _, purpose := range current {
+		if declared.Contains(string(purpose)) {
+			purposes = append(purposes, string(purpose))
+		}
+	}
+
+	if err := d.Set(networkPurposeSchemaNetworkUUID, network.UUID); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(networkPurposeSchemaPurposes, purposes); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return nil
+}
+
+func resourceNetworkPurposeUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	network := &NetworkDescriptor{
+		UUID: d.Id(),
+	}
+
+	if err := network.Load(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if d.HasChange(networkPurposeSchemaPurposes) {
+		o, n := d.GetChange(networkPurposeSchemaPurposes)
+		os, ns := o.(*schema.Set), n.(*schema.Set)
+
+		if err := setNetworkPurposes(c, network, ns.Difference(os).List(), os.Difference(ns).List()); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	return resourceNetworkPurposeRead(ctx, d, m)
+}
+
+func resourceNetworkPurposeDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	network := &NetworkDescriptor{
+		UUID: d.Id(),
+	}
+
+	if err := network.Load(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return diag.FromErr(setNetworkPurposes(c, network, nil, d.Get(networkPurposeSchemaPurposes).(*schema.Set).List()))
+}
+
+func resourceNetworkPurposeExists(d *schema.ResourceData, m interface{}) (bool, error) {
+	c := m.(*Connection)
+
+	if _, err := c.client.Network.GetByUUID(c.session, d.Id()); err != nil {
+		if xenErr, ok := err.(*xenapi.Error); ok {
+			if xenErr.Code() == xenapi.ERR_UUID_INVALID {
+				return false, nil
+			}
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,48 @@
+package xenserver
+
+import (
+	"regexp"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+// ISO library on an NFS export, as provided by the iso driver
+var nfsISOSR = &typedSR{
+	srType:      "iso",
+	contentType: "iso",
+	deviceConfig: func(c *Connection, d *schema.ResourceData) (map[string]string, error) {
+		return map[string]string{
+			"location":   urlHost(d.Get(srSchemaServer).(string), "") + ":" + d.Get(srSchemaPath).(string),
+			"type":       "nfs_iso",
+			"nfsversion": d.Get(srSchemaVersion).(string),
+		}, nil
+	},
+}
+
+func resourceNFSISOSR() *schema.Resource {
+	return nfsISOSR.resource(map[string]*schema.Schema{
+		srSchemaServer: &schema.Schema{
+			Type:         schema.TypeString,
+			Required:     true,
+			ForceNew:     true,
+			ValidateFunc: validateSRServer,
+		},
+
+		// Exported directory holding the ISOs, e.g. /export/isos
+		srSchemaPath: &schema.Schema{
+			Type:         schema.TypeString,
+			Required:     true,
+			ForceNew:     true,
+			ValidateFunc: validation.StringMatch(regexp.MustCompile(`^/\S*$`), "must be an absolute path"),
+		},
+
+		srSchemaVersion: &schema.Schema{
+			Type:         schema.TypeString,
+			Optional:     true,
+			ForceNew:     true,
+			Default:      "3",
+			ValidateFunc: validation.StringInSlice([]string{"3", "4", "4.1"}, false),
+		},
+	})
+}
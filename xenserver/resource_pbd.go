@@ -0,0 +1,265 @@
+package xenserver
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+const (
+	pbdSchemaSRUUID       = "sr_uuid"
+	pbdSchemaHostUUID     = "host_uuid"
+	pbdSchemaDeviceConfig = "device_config"
+	pbdSchemaPlugged      = "plugged"
+)
+
+func resourcePBD() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourcePBDCreate,
+		ReadContext:   forgetfulRead(resourcePBDRead, resourcePBDExists),
+		UpdateContext: resourcePBDUpdate,
+		DeleteContext: resourcePBDDelete,
+
+		// Plugging and unplugging PBDs waits for the storage, which may be
+		// unresponsive
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(10 * time.Minute),
+			Update: schema.DefaultTimeout(10 * time.Minute),
+			Delete: schema.DefaultTimeout(10 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			pbdSchemaSRUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateUUID,
+			},
+
+			pbdSchemaHostUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateUUID,
+			},
+
+			// May contain credentials of the storage, e.g. for CIFS or iSCSI
+			// CHAP authentication
+			pbdSchemaDeviceConfig: &schema.Schema{
+				Type:      schema.TypeMap,
+				Optional:  true,
+				ForceNew:  true,
+				Sensitive: true,
+				Elem:      &schema.Schema{Type: schema.TypeString},
+			},
+
+			pbdSchemaPlugged: &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  true,
+			},
+		},
+	}
+}
+
+func resourcePBDCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c, cancel, err := m.(*Connection).WithTimeout(d.Timeout(schema.TimeoutCreate))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer cancel()
+
+	sr := &SRDescriptor{
+		UUID: d.Get(pbdSchemaSRUUID).(string),
+	}
+
+	if err := sr.Load(c); err != nil {
+		return diag.FromErr(referenceError(c, "SR", sr.UUID, err))
+	}
+
+	host := &HostDescriptor{
+		UUID: d.Get(pbdSchemaHostUUID).(string),
+	}
+
+	if err := host.Load(c); err != nil {
+		return diag.FromErr(referenceError(c, "host", host.UUID, err))
+	}
+
+	deviceConfig := make(map[string]string)
+	for k, v := range d.Get(pbdSchemaDeviceConfig).(map[string]interface{}) {
+		deviceConfig[k] = v.(string)
+	}
+
+	log.Printf("[DEBUG] Creating PBD connecting SR %s to host %s", sr.UUID, host.UUID)
+	pbdRef, err := c.client.PBD.Create(c.session, xenapi.PBDRecord{
+		SR:           sr.SRRef,
+		Host:         host.HostRef,
+		DeviceConfig: deviceConfig,
+		OtherConfig:  map[string]string{},
+	})
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	pbdUUID, err := c.client.PBD.GetUUID(c.session, pbdRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId(pbdUUID)
+
+	if d.Get(pbdSchemaPlugged).(bool) {
+		log.Printf("[DEBUG] Plugging PBD %s", pbdUUID)
+		if err := c.client.PBD.Plug(c.session, pbdRef); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	return resourcePBDRead(ctx, d, m)
+}
+
+func resourcePBDRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	pbdRef, err := c.client.PBD.GetByUUID(c.session, d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	pbd, err := c.client.PBD.GetRecord(c.session, pbdRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	sr := &SRDescriptor{
+		SRRef: pbd.SR,
+	}
+	if err := sr.Query(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	host := &HostDescriptor{
+		HostRef: pbd.Host,
+	}
+	if err := host.Query(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(pbdSchemaSRUUID, sr.UUID); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(pbdSchemaHostUUID, host.UUID); err != nil {
+		return diag.FromErr(err)
+	}
+
+	// XenServer adds keys of its own to the device config, e.g. SRmaster
+	declared := d.Get(pbdSchemaDeviceConfig).(map[string]interface{})
+	if err := d.Set(pbdSchemaDeviceConfig, filterDeclaredKeys(pbdDeviceConfigWithSecrets(pbd.DeviceConfig, declared), declared)); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(pbdSchemaPlugged, pbd.CurrentlyAttached); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return nil
+}
+
+func resourcePBDUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c, cancel, err := m.(*Connection).WithTimeout(d.Timeout(schema.TimeoutUpdate))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer cancel()
+
+	pbdRef, err := c.client.PBD.GetByUUID(c.session, d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if d.HasChange(pbdSchemaPlugged) {
+		if d.Get(pbdSchemaPlugged).(bool) {
+			log.Printf("[DEBUG] Plugging PBD %s", d.Id())
+			err = c.client.PBD.Plug(c.session, pbdRef)
+		} else {
+			log.Printf("[DEBUG] Unplugging PBD %s", d.Id())
+			err = c.client.PBD.Unplug(c.session, pbdRef)
+		}
+
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	return resourcePBDRead(ctx, d, m)
+}
+
+func resourcePBDDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c, cancel, err := m.(*Connection).WithTimeout(d.Timeout(schema.TimeoutDelete))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer cancel()
+
+	pbdRef, err := c.client.PBD.GetByUUID(c.session, d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	attached, err := c.client.PBD.GetCurrentlyAttached(c.session, pbdRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if attached {
+		log.Printf("[DEBUG] Unplugging PBD %s", d.Id())
+		if err := c.client.PBD.Unplug(c.session, pbdRef); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	log.Printf("[DEBUG] Destroying PBD %s", d.Id())
+	return diag.FromErr(c.client.PBD.Destroy(c.session, pbdRef))
+}
+
+func resourcePBDExists(d *schema.ResourceData, m interface{}) (bool, error) {
+	c := m.(*Connection)
+
+	if _, err := c.client.PBD.GetByUUID(c.session, d.Id()); err != nil {
+		if xenErr, ok := err.(*xenapi.Error); ok {
+			if xenErr.Code() == xenapi.ERR_UUID_INVALID {
+				return false, nil
+			}
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+// pbdDeviceConfigWithSecrets returns deviceConfig with the declared values of
+// the keys XenServer moved into secrets. It stores credentials, e.g. password,
+// in a secret and replaces them with a reference to it, e.g. password_secret,
+// which would otherwise show up as a change forcing a new PBD.
+func pbdDeviceConfigWithSecrets(deviceConfig map[string]string, declared map[string]interface{}) map[string]string {
+	merged := make(map[string]string, len(deviceConfig))
+	for k, v := range deviceConfig {
+		merged[k] = v
+	}
+
+	for k, v := range declared {
+		if _, ok := deviceConfig[k]; ok {
+			continue
+		}
+		if _, ok := deviceConfig[k+"_secret"]; ok {
+			merged[k] = v.(string)
+		}
+	}
+
+	return merged
+}
@@ -0,0 +1,323 @@
+package xenserver
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+const (
+	pgpuSchemaPGPUUUID               = "pgpu_uuid"
+	pgpuSchemaDom0Access             = "dom0_access"
+	pgpuSchemaEnabledVGPUTypeUUIDs   = "enabled_vgpu_type_uuids"
+	pgpuSchemaGPUGroupUUID           = "gpu_group_uuid"
+	pgpuSchemaDom0AccessState        = "dom0_access_state"
+	pgpuSchemaHostUUID               = "host_uuid"
+	pgpuSchemaSupportedVGPUTypeUUIDs = "supported_vgpu_type_uuids"
+	pgpuSchemaIsSystemDisplayDevice  = "is_system_display_device"
+
+	// Dom0 access once the host has been rebooted
+	pgpuDom0AccessEnabled  = "enabled"
+	pgpuDom0AccessDisabled = "disabled"
+)
+
+func resourcePGPU() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourcePGPUCreate,
+		ReadContext:   forgetfulRead(resourcePGPURead, resourcePGPUExists),
+		UpdateContext: resourcePGPUUpdate,
+		DeleteContext: resourcePGPUDelete,
+
+		Schema: map[string]*schema.Schema{
+			pgpuSchemaPGPUUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateUUID,
+			},
+
+			// Changes take effect once the host has been rebooted, the pending
+			// state is reported in dom0_access_state
+			pgpuSchemaDom0Access: &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validation.StringInSlice([]string{pgpuDom0AccessEnabled, pgpuDom0AccessDisabled}, false),
+			},
+
+			// Passthrough is a vGPU type of its own
+			pgpuSchemaEnabledVGPUTypeUUIDs: &schema.Schema{
+				Type:     schema.TypeSet,
+				Optional: true,
+				Computed: true,
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validateUUID,
+				},
+				Set: schema.HashString,
+			},
+
+			pgpuSchemaGPUGroupUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validateUUID,
+			},
+
+			pgpuSchemaDom0AccessState: &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			pgpuSchemaHostUUID: &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			pgpuSchemaSupportedVGPUTypeUUIDs: &schema.Schema{
+				Type:     schema.TypeSet,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+				Set:      schema.HashString,
+			},
+
+			pgpuSchemaIsSystemDisplayDevice: &schema.Schema{
+				Type:     schema.TypeBool,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func setPGPUDom0Access(c *Connection, pgpuRef xenapi.PGPURef, access string) error {
+	current, err := c.client.PGPU.GetDom0Access(c.session, pgpuRef)
+	if err != nil {
+		return err
+	}
+
+	if pgpuDom0AccessOf(current) == access {
+		return nil
+	}
+
+	log.Printf("[DEBUG] Setting dom0 access of pGPU %s to %s", pgpuRef, access)
+	if access == pgpuDom0AccessEnabled {
+		_, err = c.client.PGPU.EnableDom0Access(c.session, pgpuRef)
+	} else {
+		_, err = c.client.PGPU.DisableDom0Access(c.session, pgpuRef)
+	}
+	return err
+}
+
+// pgpuDom0AccessOf returns the dom0 access the pGPU has once the host has been
+// rebooted.
+func pgpuDom0AccessOf(state xenapi.PgpuDom0Access) string {
+	switch state {
+	case xenapi.PgpuDom0AccessEnabled, xenapi.PgpuDom0AccessEnableOnReboot:
+		return pgpuDom0AccessEnabled
+	default:
+		return pgpuDom0AccessDisabled
+	}
+}
+
+func setPGPUEnabledVGPUTypes(c *Connection, pgpuRef xenapi.PGPURef, uuids []interface{}) error {
+	types := make([]xenapi.VGPUTypeRef, 0, len(uuids))
+	for _, uuid := range uuids {
+		ref, err := c.client.VGPUType.GetByUUID(c.session, uuid.(string))
+		if err != nil {
+			return referenceError(c, "vGPU type", uuid.(string), err)
+		}
+		types = append(types, ref)
+	}
+
+	log.Printf("[DEBUG] Enabling vGPU types %q on pGPU %s", uuids, pgpuRef)
+	return c.client.PGPU.SetEnabledVGPUTypes(c.session, pgpuRef, types)
+}
+
+func setPGPUGPUGroup(c *Connection, pgpuRef xenapi.PGPURef, uuid string) error {
+	group, err := c.client.GPUGroup.GetByUUID(c.session, uuid)
+	if err != nil {
+		return referenceError(c, "GPU group", uuid, err)
+	}
+
+	log.Printf("[DEBUG] Moving pGPU %s into GPU group %s", pgpuRef, uuid)
+	return c.client.PGPU.SetGPUGroup(c.session, pgpuRef, group)
+}
+
+func resourcePGPUCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	uuid := d.Get(pgpuSchemaPGPUUUID).(string)
+	pgpuRef, err := c.client.PGPU.GetByUUID(c.session, uuid)
+	if err != nil {
+		return diag.FromErr(referenceError(c, "pGPU", uuid, err))
+	}
+
+	if group, ok := d.GetOk(pgpuSchemaGPUGroupUUID); ok {
+		if err := setPGPUGPUGroup(c, pgpuRef, group.(string)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if access, ok := d.GetOk(pgpuSchemaDom0Access); ok {
+		if err := setPGPUDom0Access(c, pgpuRef, access.(string)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if types, ok := d.GetOk(pgpuSchemaEnabledVGPUTypeUUIDs); ok {
+		if err := setPGPUEnabledVGPUTypes(c, pgpuRef, types.(*schema.Set).List()); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	d.SetId(uuid)
+
+	return resourcePGPURead(ctx, d, m)
+}
+
+func resourcePGPURead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	pgpuRef, err := c.client.PGPU.GetByUUID(c.session, d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	pgpu, err := c.client.PGPU.GetRecord(c.session, pgpuRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	vgpuTypes, err := c.client.VGPUType.GetAllRecords(c.session)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	enabled := make([]string, 0, len(pgpu.EnabledVGPUTypes))
+	for _, ref := range pgpu.EnabledVGPUTypes {
+		enabled = append(enabled, vgpuTypes[ref].UUID)
+	}
+
+	supported := make([]string, 0, len(pgpu.SupportedVGPUTypes))
+	for _, ref := range pgpu.SupportedVGPUTypes {
+		supported = append(supported, vgpuTypes[ref].UUID)
+	}
+
+	group, err := c.client.GPUGroup.GetUUID(c.session, pgpu.GPUGroup)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	host, err := c.client.Host.GetUUID(c.session, pgpu.Host)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(pgpuSchemaPGPUUUID, pgpu.UUID); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(pgpuSchemaDom0Access, pgpuDom0AccessOf(pgpu.Dom0Access)); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(pgpuSchemaEnabledVGPUTypeUUIDs, enabled); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(pgpuSchemaGPUGroupUUID, group); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(pgpuSchemaDom0AccessState, string(pgpu.Dom0Access)); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(pgpuSchemaHostUUID, host); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(pgpuSchemaSupportedVGPUTypeUUIDs, supported); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(pgpuSchemaIsSystemDisplayDevice, pgpu.IsSystemDisplayDevice); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return nil
+}
+
+func resourcePGPUUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	pgpuRef, err := c.client.PGPU.GetByUUID(c.session, d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if d.HasChange(pgpuSchemaGPUGroupUUID) {
+		if err := setPGPUGPUGroup(c, pgpuRef, d.Get(pgpuSchemaGPUGroupUUID).(string)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange(pgpuSchemaDom0Access) {
+		if err := setPGPUDom0Access(c, pgpuRef, d.Get(pgpuSchemaDom0Access).(string)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange(pgpuSchemaEnabledVGPUTypeUUIDs) {
+		if err := setPGPUEnabledVGPUTypes(c, pgpuRef, d.Get(pgpuSchemaEnabledVGPUTypeUUIDs).(*schema.Set).List()); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	return resourcePGPURead(ctx, d, m)
+}
+
+// resourcePGPUDelete restores the defaults of XenServer, all supported vGPU
+// types enabled and the pGPU accessible from dom0. The GPU group is left as it
+// is, a pGPU is always member of one.
+func resourcePGPUDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	pgpuRef, err := c.client.PGPU.GetByUUID(c.session, d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	supported, err := c.client.PGPU.GetSupportedVGPUTypes(c.session, pgpuRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	log.Printf("[DEBUG] Enabling all supported vGPU types on pGPU %s", d.Id())
+	if err := c.client.PGPU.SetEnabledVGPUTypes(c.session, pgpuRef, supported); err != nil {
+		return diag.FromErr(fmt.Errorf("failed to enable the vGPU types of pGPU %s: %s", d.Id(), err))
+	}
+
+	return diag.FromErr(setPGPUDom0Access(c, pgpuRef, pgpuDom0AccessEnabled))
+}
+
+func resourcePGPUExists(d *schema.ResourceData, m interface{}) (bool, error) {
+	c := m.(*Connection)
+
+	if _, err := c.client.PGPU.GetByUUID(c.session, d.Id()); err != nil {
+		if xenErr, ok := err.(*xenapi.Error); ok {
+			if xenErr.Code() == xenapi.ERR_UUID_INVALID {
+				return false, nil
+			}
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,269 @@
+package xenserver
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+const (
+	poolHASchemaHeartbeatSRUUIDs          = "heartbeat_sr_uuids"
+	poolHASchemaConfiguration             = "configuration"
+	poolHASchemaHostFailuresToTolerate    = "host_failures_to_tolerate"
+	poolHASchemaAllowOvercommit           = "allow_overcommit"
+	poolHASchemaMaxHostFailuresToTolerate = "max_host_failures_to_tolerate"
+	poolHASchemaPlanExistsFor             = "plan_exists_for"
+	poolHASchemaOvercommitted             = "overcommitted"
+)
+
+func resourcePoolHA() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourcePoolHACreate,
+		ReadContext:   resourcePoolHARead,
+		UpdateContext: resourcePoolHAUpdate,
+		DeleteContext: resourcePoolHADelete,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(20 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			poolHASchemaHeartbeatSRUUIDs: &schema.Schema{
+				Type:     schema.TypeSet,
+				Required: true,
+				ForceNew: true,
+				MinItems: 1,
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validateUUID,
+				},
+				Set: schema.HashString,
+			},
+
+			poolHASchemaConfiguration: &schema.Schema{
+				Type:     schema.TypeMap,
+				Optional: true,
+				ForceNew: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+
+			poolHASchemaHostFailuresToTolerate: &schema.Schema{
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validation.IntAtLeast(0),
+			},
+
+			poolHASchemaAllowOvercommit: &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+
+			poolHASchemaMaxHostFailuresToTolerate: &schema.Schema{
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+
+			poolHASchemaPlanExistsFor: &schema.Schema{
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+
+			poolHASchemaOvercommitted: &schema.Schema{
+				Type:     schema.TypeBool,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func getPool(c *Connection) (xenapi.PoolRef, error) {
+	pools, err := c.client.Pool.GetAll(c.session)
+	if err != nil {
+		return "", err
+	}
+
+	if len(pools) == 0 {
+		return "", fmt.Errorf("no pool found")
+	}
+
+	return pools[0], nil
+}
+
+func resourcePoolHACreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c, cancel, err := m.(*Connection).WithTimeout(d.Timeout(schema.TimeoutCreate))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer cancel()
+
+	pool, err := getPool(c)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	heartbeatSRs := make([]xenapi.SRRef, 0)
+	for _, srUUID := range d.Get(poolHASchemaHeartbeatSRUUIDs).(*schema.Set).List() {
+		sr := &SRDescriptor{
+			UUID: srUUID.(string),
+		}
+		if err := sr.Load(c); err != nil {
+			return diag.FromErr(referenceError(c, "SR", sr.UUID, err))
+		}
+		heartbeatSRs = append(heartbeatSRs, sr.SRRef)
+	}
+
+	configuration := make(map[string]string)
+	for k, v := range d.Get(poolHASchemaConfiguration).(map[string]interface{}) {
+		configuration[k] = v.(string)
+	}
+
+	// Settings of the restart planner are applied first, so that they are in
+	// place once HA starts protecting the VMs
+	if err := c.client.Pool.SetHaAllowOvercommit(c.session, pool, d.Get(poolHASchemaAllowOvercommit).(bool)); err != nil {
+		return diag.FromErr(err)
+	}
+
+	log.Printf("[DEBUG] Enabling HA with %d heartbeat SRs", len(heartbeatSRs))
+	if err := c.client.Pool.EnableHa(c.session, heartbeatSRs, configuration); err != nil {
+		return diag.FromErr(err)
+	}
+
+	poolUUID, err := c.client.Pool.GetUUID(c.session, pool)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId(poolUUID)
+
+	if hostFailures, ok := d.GetOkExists(poolHASchemaHostFailuresToTolerate); ok {
+		log.Printf("[DEBUG] Setting host failures to tolerate to %d", hostFailures.(int))
+		if err := c.client.Pool.SetHaHostFailuresToTolerate(c.session, pool, hostFailures.(int)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	return resourcePoolHARead(ctx, d, m)
+}
+
+func resourcePoolHARead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	pool, err := c.client.Pool.GetByUUID(c.session, d.Id())
+	if err != nil {
+		if xenErr, ok := err.(*xenapi.Error); ok {
+			if xenErr.Code() == xenapi.ERR_UUID_INVALID {
+				d.SetId("")
+				return nil
+			}
+		}
+
+		return diag.FromErr(err)
+	}
+
+	poolRecord, err := c.client.Pool.GetRecord(c.session, pool)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	// HA has been disabled outside of Terraform
+	if !poolRecord.HaEnabled {
+		log.Printf("[DEBUG] HA is disabled on pool %s", d.Id())
+		d.SetId("")
+		return nil
+	}
+
+	// The state files are the VDIs HA created on the heartbeat SRs
+	srUUIDs := make([]string, 0, len(poolRecord.HaStatefiles))
+	for _, statefile := range poolRecord.HaStatefiles {
+		vdi := &VDIDescriptor{
+			VDIRef: xenapi.VDIRef(statefile),
+		}
+		if err := vdi.Query(c); err != nil {
+			return diag.FromErr(err)
+		}
+		srUUIDs = append(srUUIDs, vdi.SR.UUID)
+	}
+	sort.Strings(srUUIDs)
+
+	if err := d.Set(poolHASchemaHeartbeatSRUUIDs, srUUIDs); err != nil {
+		return diag.FromErr(err)
+	}
+
+	declared := d.Get(poolHASchemaConfiguration).(map[string]interface{})
+	if err := d.Set(poolHASchemaConfiguration, filterDeclaredKeys(poolRecord.HaConfiguration, declared)); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(poolHASchemaHostFailuresToTolerate, poolRecord.HaHostFailuresToTolerate); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(poolHASchemaAllowOvercommit, poolRecord.HaAllowOvercommit); err != nil {
+		return diag.FromErr(err)
+	}
+
+	maxHostFailures, err := c.client.Pool.HaComputeMaxHostFailuresToTolerate(c.session)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(poolHASchemaMaxHostFailuresToTolerate, maxHostFailures); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(poolHASchemaPlanExistsFor, poolRecord.HaPlanExistsFor); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(poolHASchemaOvercommitted, poolRecord.HaOvercommitted); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return nil
+}
+
+func resourcePoolHAUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	pool, err := c.client.Pool.GetByUUID(c.session, d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if d.HasChange(poolHASchemaAllowOvercommit) {
+		if err := c.client.Pool.SetHaAllowOvercommit(c.session, pool, d.Get(poolHASchemaAllowOvercommit).(bool)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange(poolHASchemaHostFailuresToTolerate) {
+		hostFailures := d.Get(poolHASchemaHostFailuresToTolerate).(int)
+
+		log.Printf("[DEBUG] Setting host failures to tolerate to %d", hostFailures)
+		if err := c.client.Pool.SetHaHostFailuresToTolerate(c.session, pool, hostFailures); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	return resourcePoolHARead(ctx, d, m)
+}
+
+func resourcePoolHADelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c, cancel, err := m.(*Connection).WithTimeout(d.Timeout(schema.TimeoutDelete))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer cancel()
+
+	log.Println("[DEBUG] Disabling HA")
+	return diag.FromErr(c.client.Pool.DisableHa(c.session))
+}
@@ -0,0 +1,189 @@
+package xenserver
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+const (
+	poolJoinSchemaMasterAddress  = "master_address"
+	poolJoinSchemaMasterUsername = "master_username"
+	poolJoinSchemaMasterPassword = "master_password"
+	poolJoinSchemaForce          = "force"
+	poolJoinSchemaHostUUID       = "host_uuid"
+)
+
+func resourcePoolJoin() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourcePoolJoinCreate,
+		ReadContext:   resourcePoolJoinRead,
+		DeleteContext: resourcePoolJoinDelete,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(10 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			poolJoinSchemaMasterAddress: &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+
+			poolJoinSchemaMasterUsername: &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+
+			poolJoinSchemaMasterPassword: &schema.Schema{
+				Type:      schema.TypeString,
+				Required:  true,
+				ForceNew:  true,
+				Sensitive: true,
+			},
+
+			poolJoinSchemaForce: &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+				ForceNew: true,
+			},
+
+			poolJoinSchemaHostUUID: &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+// connectPoolMaster logs in to the master of the pool the host joins. Once the
+// host has joined, it no longer serves the XenAPI itself. The certificate of the
+// master is verified the same way as the one of the host, except for the server
+// name override which does not apply to the master.
+func connectPoolMaster(c *Connection, d *schema.ResourceData) (*Connection, error) {
+	tlsConfig := c.tlsConfig.Clone()
+	tlsConfig.ServerName = ""
+
+	// The URL of a bare address defaults to https
+	config := Config{
+		URL:               d.Get(poolJoinSchemaMasterAddress).(string),
+		Username:          d.Get(poolJoinSchemaMasterUsername).(string),
+		Password:          d.Get(poolJoinSchemaMasterPassword).(string),
+		ConnectionTimeout: c.connectionTimeout,
+		tlsConfig:         tlsConfig,
+	}
+
+	return config.NewConnection(c.ctx)
+}
+
+func resourcePoolJoinCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	hostRef, err := c.client.Session.GetThisHost(c.session, c.session)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	host := &HostDescriptor{
+		HostRef: hostRef,
+	}
+	if err := host.Query(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	masterAddress := d.Get(poolJoinSchemaMasterAddress).(string)
+	masterUsername := d.Get(poolJoinSchemaMasterUsername).(string)
+	masterPassword := d.Get(poolJoinSchemaMasterPassword).(string)
+
+	log.Printf("[DEBUG] Joining host %s to the pool of %s", host.UUID, masterAddress)
+	if d.Get(poolJoinSchemaForce).(bool) {
+		err = c.client.Pool.JoinForce(c.session, masterAddress, masterUsername, masterPassword)
+	} else {
+		err = c.client.Pool.Join(c.session, masterAddress, masterUsername, masterPassword)
+	}
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	d.SetId(host.UUID)
+
+	if err := d.Set(poolJoinSchemaHostUUID, host.UUID); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return diag.FromErr(resource.Retry(d.Timeout(schema.TimeoutCreate), func() *resource.RetryError {
+		master, err := connectPoolMaster(c, d)
+		if err != nil {
+			return resource.RetryableError(err)
+		}
+		defer master.Close()
+
+		hostRef, err := master.client.Host.GetByUUID(master.session, host.UUID)
+		if err != nil {
+			return resource.RetryableError(err)
+		}
+
+		enabled, err := master.client.Host.GetEnabled(master.session, hostRef)
+		if err != nil {
+			return resource.RetryableError(err)
+		}
+
+		if !enabled {
+			return resource.RetryableError(fmt.Errorf("host %s has not been enabled in the pool yet", host.UUID))
+		}
+
+		log.Printf("[DEBUG] Host %s has joined the pool", host.UUID)
+		return nil
+	}))
+}
+
+func resourcePoolJoinRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	master, err := connectPoolMaster(c, d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer master.Close()
+
+	if _, err := master.client.Host.GetByUUID(master.session, d.Id()); err != nil {
+		if xenErr, ok := err.(*xenapi.Error); ok {
+			if xenErr.Code() == xenapi.ERR_UUID_INVALID {
+				log.Printf("[DEBUG] Host %s is no longer member of the pool", d.Id())
+				d.SetId("")
+				return nil
+			}
+		}
+
+		return diag.FromErr(err)
+	}
+
+	return diag.FromErr(d.Set(poolJoinSchemaHostUUID, d.Id()))
+}
+
+func resourcePoolJoinDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	master, err := connectPoolMaster(c, d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer master.Close()
+
+	hostRef, err := master.client.Host.GetByUUID(master.session, d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	log.Printf("[DEBUG] Ejecting host %s from the pool", d.Id())
+	return diag.FromErr(master.client.Pool.Eject(master.session, hostRef))
+}
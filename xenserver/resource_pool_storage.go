@@ -0,0 +1,203 @@
+package xenserver
+
+import (
+	"context"
+	"log"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+const (
+	poolStorageSchemaSuspendImageSRUUID = "suspend_image_sr_uuid"
+	poolStorageSchemaCrashDumpSRUUID    = "crash_dump_sr_uuid"
+)
+
+func resourcePoolStorage() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourcePoolStorageCreate,
+		ReadContext:   forgetfulRead(resourcePoolStorageRead, resourcePoolStorageExists),
+		UpdateContext: resourcePoolStorageUpdate,
+		DeleteContext: resourcePoolStorageDelete,
+
+		Schema: map[string]*schema.Schema{
+			poolStorageSchemaSuspendImageSRUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validateOptionalUUID,
+			},
+
+			poolStorageSchemaCrashDumpSRUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validateOptionalUUID,
+			},
+		},
+	}
+}
+
+// loadSRRef returns the reference of the SR with the UUID, or a null reference
+// if uuid is empty.
+func loadSRRef(c *Connection, uuid string) (xenapi.SRRef, error) {
+	if uuid == "" {
+		return "OpaqueRef:NULL", nil
+	}
+
+	sr := &SRDescriptor{
+		UUID: uuid,
+	}
+	if err := sr.Load(c); err != nil {
+		return "", referenceError(c, "SR", uuid, err)
+	}
+
+	return sr.SRRef, nil
+}
+
+// srUUIDOf returns the UUID of the SR, or an empty string for a null reference.
+func srUUIDOf(c *Connection, ref xenapi.SRRef) (string, error) {
+	if ref == "" || ref == "OpaqueRef:NULL" {
+		return "", nil
+	}
+
+	sr := &SRDescriptor{
+		SRRef: ref,
+	}
+	if err := sr.Query(c); err != nil {
+		return "", err
+	}
+
+	return sr.UUID, nil
+}
+
+func setPoolStorage(c *Connection, pool xenapi.PoolRef, d *schema.ResourceData, create bool) error {
+	if v, ok := d.GetOk(poolStorageSchemaSuspendImageSRUUID); ok || (!create && d.HasChange(poolStorageSchemaSuspendImageSRUUID)) {
+		sr, err := loadSRRef(c, v.(string))
+		if err != nil {
+			return err
+		}
+
+		log.Printf("[DEBUG] Setting suspend image SR of pool %s to %q", c.poolDescription(), v.(string))
+		if err := c.client.Pool.SetSuspendImageSR(c.session, pool, sr); err != nil {
+			return err
+		}
+	}
+
+	if v, ok := d.GetOk(poolStorageSchemaCrashDumpSRUUID); ok || (!create && d.HasChange(poolStorageSchemaCrashDumpSRUUID)) {
+		sr, err := loadSRRef(c, v.(string))
+		if err != nil {
+			return err
+		}
+
+		log.Printf("[DEBUG] Setting crash dump SR of pool %s to %q", c.poolDescription(), v.(string))
+		if err := c.client.Pool.SetCrashDumpSR(c.session, pool, sr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func resourcePoolStorageCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	pool, err := getPool(c)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := setPoolStorage(c, pool, d, true); err != nil {
+		return diag.FromErr(err)
+	}
+
+	poolUUID, err := c.client.Pool.GetUUID(c.session, pool)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId(poolUUID)
+
+	return resourcePoolStorageRead(ctx, d, m)
+}
+
+func resourcePoolStorageRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	pool, err := c.client.Pool.GetByUUID(c.session, d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	poolRecord, err := c.client.Pool.GetRecord(c.session, pool)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	suspendImageSR, err := srUUIDOf(c, poolRecord.SuspendImageSR)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(poolStorageSchemaSuspendImageSRUUID, suspendImageSR); err != nil {
+		return diag.FromErr(err)
+	}
+
+	crashDumpSR, err := srUUIDOf(c, poolRecord.CrashDumpSR)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(poolStorageSchemaCrashDumpSRUUID, crashDumpSR); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return nil
+}
+
+func resourcePoolStorageUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	pool, err := c.client.Pool.GetByUUID(c.session, d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := setPoolStorage(c, pool, d, false); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return resourcePoolStorageRead(ctx, d, m)
+}
+
+func resourcePoolStorageDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	pool, err := c.client.Pool.GetByUUID(c.session, d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	log.Printf("[DEBUG] Resetting suspend image and crash dump SRs of pool %s", c.poolDescription())
+	if err := c.client.Pool.SetSuspendImageSR(c.session, pool, "OpaqueRef:NULL"); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return diag.FromErr(c.client.Pool.SetCrashDumpSR(c.session, pool, "OpaqueRef:NULL"))
+}
+
+func resourcePoolStorageExists(d *schema.ResourceData, m interface{}) (bool, error) {
+	c := m.(*Connection)
+
+	if _, err := c.client.Pool.GetByUUID(c.session, d.Id()); err != nil {
+		if xenErr, ok := err.(*xenapi.Error); ok {
+			if xenErr.Code() == xenapi.ERR_UUID_INVALID {
+				return false, nil
+			}
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,317 @@
+package xenserver
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+const (
+	poolUpdateSchemaSRUUID             = "sr_uuid"
+	poolUpdateSchemaSource             = "source"
+	poolUpdateSchemaHostUUIDs          = "host_uuids"
+	poolUpdateSchemaName               = "name_label"
+	poolUpdateSchemaVersion            = "version"
+	poolUpdateSchemaAfterApplyGuidance = "after_apply_guidance"
+	poolUpdateSchemaAppliedHostUUIDs   = "applied_host_uuids"
+)
+
+func resourcePoolUpdate() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourcePoolUpdateCreate,
+		ReadContext:   resourcePoolUpdateRead,
+		UpdateContext: resourcePoolUpdateUpdate,
+		DeleteContext: resourcePoolUpdateDelete,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(60 * time.Minute),
+			Update: schema.DefaultTimeout(60 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			poolUpdateSchemaSRUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateUUID,
+			},
+
+			poolUpdateSchemaSource: &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+
+			poolUpdateSchemaHostUUIDs: &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validateUUID,
+				},
+			},
+
+			poolUpdateSchemaName: &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			poolUpdateSchemaVersion: &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			poolUpdateSchemaAfterApplyGuidance: &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+
+			poolUpdateSchemaAppliedHostUUIDs: &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+		},
+	}
+}
+
+// poolUpdateHosts returns the hosts to apply the update to, in order. Without
+// explicit hosts these are all hosts of the pool, starting with the master as
+// required by XenServer.
+func poolUpdateHosts(c *Connection, d *schema.ResourceData) ([]xenapi.HostRef, error) {
+	hosts := make([]xenapi.HostRef, 0)
+
+	if _hostUUIDs, ok := d.GetOk(poolUpdateSchemaHostUUIDs); ok {
+		for _, hostUUID := range _hostUUIDs.([]interface{}) {
+			host := &HostDescriptor{
+				UUID: hostUUID.(string),
+			}
+			if err := host.Load(c); err != nil {
+				return nil, referenceError(c, "host", host.UUID, err)
+			}
+			hosts = append(hosts, host.HostRef)
+		}
+		return hosts, nil
+	}
+
+	master, err := getPoolMaster(c)
+	if err != nil {
+		return nil, err
+	}
+	hosts = append(hosts, master)
+
+	allHosts, err := c.client.Host.GetAll(c.session)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, host := range allHosts {
+		if host != master {
+			hosts = append(hosts, host)
+		}
+	}
+
+	return hosts, nil
+}
+
+// applyPoolUpdate prechecks and applies the update on all hosts it has not been
+// applied to yet, one host after another.
+func applyPoolUpdate(c *Connection, d *schema.ResourceData, updateRef xenapi.PoolUpdateRef) error {
+	hosts, err := poolUpdateHosts(c, d)
+	if err != nil {
+		return err
+	}
+
+	appliedHosts, err := c.client.PoolUpdate.GetHosts(c.session, updateRef)
+	if err != nil {
+		return err
+	}
+
+	applied := make(map[xenapi.HostRef]bool, len(appliedHosts))
+	for _, host := range appliedHosts {
+		applied[host] = true
+	}
+
+	for _, hostRef := range hosts {
+		if applied[hostRef] {
+			continue
+		}
+
+		host := &HostDescriptor{
+			HostRef: hostRef,
+		}
+		if err := host.Query(c); err != nil {
+			return err
+		}
+
+		status, err := c.client.PoolUpdate.Precheck(c.session, updateRef, hostRef)
+		if err != nil {
+			return fmt.Errorf("precheck of update %s on host %s failed: %s", d.Id(), host.Name, err)
+		}
+		log.Printf("[DEBUG] Precheck of update %s on host %s: %s", d.Id(), host.UUID, status)
+
+		log.Printf("[DEBUG] Applying update %s to host %s", d.Id(), host.UUID)
+		task, err := callAsync(c, "pool_update.apply", string(updateRef), string(hostRef))
+		if err == nil {
+			_, err = waitForTask(c, task)
+		}
+		if err != nil {
+			return fmt.Errorf("applying update %s to host %s failed: %s", d.Id(), host.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func resourcePoolUpdateCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c, cancel, err := m.(*Connection).WithTimeout(d.Timeout(schema.TimeoutCreate))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer cancel()
+
+	sr := &SRDescriptor{
+		UUID: d.Get(poolUpdateSchemaSRUUID).(string),
+	}
+
+	if err := sr.Load(c); err != nil {
+		return diag.FromErr(referenceError(c, "SR", sr.UUID, err))
+	}
+
+	source := d.Get(poolUpdateSchemaSource).(string)
+
+	vdiRef, err := uploadVDI(c, sr, filepath.Base(source), source, vdiFormatRaw, map[string]string{})
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	updateRef, err := c.client.PoolUpdate.Introduce(c.session, vdiRef)
+	if err != nil {
+		if destroyErr := c.client.VDI.Destroy(c.session, vdiRef); destroyErr != nil {
+			log.Println("[ERROR] ", destroyErr)
+		}
+		return diag.FromErr(err)
+	}
+
+	updateUUID, err := c.client.PoolUpdate.GetUUID(c.session, updateRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId(updateUUID)
+
+	if err := applyPoolUpdate(c, d, updateRef); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return resourcePoolUpdateRead(ctx, d, m)
+}
+
+func resourcePoolUpdateRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	updateRef, err := c.client.PoolUpdate.GetByUUID(c.session, d.Id())
+	if err != nil {
+		if xenErr, ok := err.(*xenapi.Error); ok {
+			if xenErr.Code() == xenapi.ERR_UUID_INVALID {
+				log.Printf("[DEBUG] Update %s has been removed", d.Id())
+				d.SetId("")
+				return nil
+			}
+		}
+
+		return diag.FromErr(err)
+	}
+
+	update, err := c.client.PoolUpdate.GetRecord(c.session, updateRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(poolUpdateSchemaName, update.NameLabel); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(poolUpdateSchemaVersion, update.Version); err != nil {
+		return diag.FromErr(err)
+	}
+
+	guidance := make([]string, 0, len(update.AfterApplyGuidance))
+	for _, g := range update.AfterApplyGuidance {
+		guidance = append(guidance, string(g))
+	}
+
+	if err := d.Set(poolUpdateSchemaAfterApplyGuidance, guidance); err != nil {
+		return diag.FromErr(err)
+	}
+
+	appliedHosts := make([]string, 0, len(update.Hosts))
+	for _, hostRef := range update.Hosts {
+		hostUUID, err := c.client.Host.GetUUID(c.session, hostRef)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		appliedHosts = append(appliedHosts, hostUUID)
+	}
+
+	if err := d.Set(poolUpdateSchemaAppliedHostUUIDs, appliedHosts); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return nil
+}
+
+func resourcePoolUpdateUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c, cancel, err := m.(*Connection).WithTimeout(d.Timeout(schema.TimeoutUpdate))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer cancel()
+
+	updateRef, err := c.client.PoolUpdate.GetByUUID(c.session, d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if d.HasChange(poolUpdateSchemaHostUUIDs) {
+		if err := applyPoolUpdate(c, d, updateRef); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	return resourcePoolUpdateRead(ctx, d, m)
+}
+
+// resourcePoolUpdateDelete removes the update files from the pool. Updates can
+// not be rolled back, so an update which has been applied stays known to the
+// pool.
+func resourcePoolUpdateDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	updateRef, err := c.client.PoolUpdate.GetByUUID(c.session, d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := c.client.PoolUpdate.PoolClean(c.session, updateRef); err != nil {
+		return diag.FromErr(err)
+	}
+
+	hosts, err := c.client.PoolUpdate.GetHosts(c.session, updateRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if len(hosts) > 0 {
+		log.Printf("[DEBUG] Update %s has been applied to %d hosts and can not be removed", d.Id(), len(hosts))
+		return nil
+	}
+
+	return diag.FromErr(c.client.PoolUpdate.Destroy(c.session, updateRef))
+}
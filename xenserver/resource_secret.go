@@ -0,0 +1,159 @@
+package xenserver
+
+import (
+	"context"
+	"log"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+const (
+	secretSchemaValue       = "value"
+	secretSchemaOtherConfig = "other_config"
+	secretSchemaRef         = "ref"
+)
+
+func resourceSecret() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceSecretCreate,
+		ReadContext:   forgetfulRead(resourceSecretRead, resourceSecretExists),
+		UpdateContext: resourceSecretUpdate,
+		DeleteContext: resourceSecretDelete,
+
+		Schema: map[string]*schema.Schema{
+			secretSchemaValue: &schema.Schema{
+				Type:      schema.TypeString,
+				Required:  true,
+				Sensitive: true,
+			},
+
+			secretSchemaOtherConfig: &schema.Schema{
+				Type:     schema.TypeMap,
+				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+
+			secretSchemaRef: &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func resourceSecretCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	otherConfig := make(map[string]string)
+	for k, v := range d.Get(secretSchemaOtherConfig).(map[string]interface{}) {
+		otherConfig[k] = v.(string)
+	}
+
+	secretRef, err := c.client.Secret.Create(c.session, xenapi.SecretRecord{
+		Value:       d.Get(secretSchemaValue).(string),
+		OtherConfig: otherConfig,
+	})
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	secretUUID, err := c.client.Secret.GetUUID(c.session, secretRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	log.Printf("[DEBUG] Created secret %s", secretUUID)
+	d.SetId(secretUUID)
+
+	return resourceSecretRead(ctx, d, m)
+}
+
+func resourceSecretRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	secretRef, err := c.client.Secret.GetByUUID(c.session, d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	secret, err := c.client.Secret.GetRecord(c.session, secretRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(secretSchemaValue, secret.Value); err != nil {
+		return diag.FromErr(err)
+	}
+
+	declared := d.Get(secretSchemaOtherConfig).(map[string]interface{})
+	if err := d.Set(secretSchemaOtherConfig, filterDeclaredKeys(secret.OtherConfig, declared)); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(secretSchemaRef, string(secretRef)); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return nil
+}
+
+func resourceSecretUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	secretRef, err := c.client.Secret.GetByUUID(c.session, d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if d.HasChange(secretSchemaValue) {
+		log.Printf("[DEBUG] Changing value of secret %s", d.Id())
+		if err := c.client.Secret.SetValue(c.session, secretRef, d.Get(secretSchemaValue).(string)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange(secretSchemaOtherConfig) {
+		current, err := c.client.Secret.GetOtherConfig(c.session, secretRef)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		o, n := d.GetChange(secretSchemaOtherConfig)
+		otherConfig := mergeDeclaredKeys(current, o.(map[string]interface{}), n.(map[string]interface{}))
+
+		if err := c.client.Secret.SetOtherConfig(c.session, secretRef, otherConfig); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	return resourceSecretRead(ctx, d, m)
+}
+
+func resourceSecretDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	secretRef, err := c.client.Secret.GetByUUID(c.session, d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	log.Printf("[DEBUG] Destroying secret %s", d.Id())
+	return diag.FromErr(c.client.Secret.Destroy(c.session, secretRef))
+}
+
+func resourceSecretExists(d *schema.ResourceData, m interface{}) (bool, error) {
+	c := m.(*Connection)
+
+	if _, err := c.client.Secret.GetByUUID(c.session, d.Id()); err != nil {
+		if xenErr, ok := err.(*xenapi.Error); ok {
+			if xenErr.Code() == xenapi.ERR_UUID_INVALID {
+				return false, nil
+			}
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,86 @@
+package xenserver
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+const (
+	smbSRSchemaUsername           = "username"
+	smbSRSchemaPasswordSecretUUID = "password_secret_uuid"
+)
+
+// SMB storage for the disks of VMs, as provided by the smb driver
+var smbSR = &typedSR{
+	srType:      "smb",
+	contentType: "user",
+	deviceConfig: func(c *Connection, d *schema.ResourceData) (map[string]string, error) {
+		// The share is given in UNC notation, i.e. \\server\share\directory
+		path := strings.Replace(d.Get(srSchemaPath).(string), "/", `\`, -1)
+
+		deviceConfig := map[string]string{
+			"server": `\\` + d.Get(srSchemaServer).(string) + `\` + path,
+			"vers":   d.Get(srSchemaVersion).(string),
+		}
+
+		if username := d.Get(smbSRSchemaUsername).(string); username != "" {
+			deviceConfig["username"] = username
+		}
+
+		// The driver reads the password from the secret, so that it is not
+		// stored in the device config of the PBDs
+		secretUUID, err := srSecret(c, d, smbSRSchemaPasswordSecretUUID)
+		if err != nil {
+			return nil, err
+		}
+		if secretUUID != "" {
+			deviceConfig["password_secret"] = secretUUID
+		}
+
+		return deviceConfig, nil
+	},
+}
+
+func resourceSMBSR() *schema.Resource {
+	return smbSR.resource(map[string]*schema.Schema{
+		srSchemaServer: &schema.Schema{
+			Type:         schema.TypeString,
+			Required:     true,
+			ForceNew:     true,
+			ValidateFunc: validateSRServer,
+		},
+
+		// Share and directory within it, e.g. vms/pool-a
+		srSchemaPath: &schema.Schema{
+			Type:         schema.TypeString,
+			Required:     true,
+			ForceNew:     true,
+			ValidateFunc: validation.StringMatch(regexp.MustCompile(`^[^/\\\s]`), "must start with the name of the share"),
+		},
+
+		srSchemaVersion: &schema.Schema{
+			Type:         schema.TypeString,
+			Optional:     true,
+			ForceNew:     true,
+			Default:      "3.0",
+			ValidateFunc: validation.StringInSlice([]string{"1.0", "2.0", "3.0"}, false),
+		},
+
+		smbSRSchemaUsername: &schema.Schema{
+			Type:     schema.TypeString,
+			Optional: true,
+			ForceNew: true,
+		},
+
+		smbSRSchemaPasswordSecretUUID: &schema.Schema{
+			Type:         schema.TypeString,
+			Optional:     true,
+			ForceNew:     true,
+			ValidateFunc: validateUUID,
+			RequiredWith: []string{smbSRSchemaUsername},
+		},
+	})
+}
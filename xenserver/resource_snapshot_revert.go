@@ -0,0 +1,131 @@
+package xenserver
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+const (
+	snapshotRevertSchemaSnapshotUUID = "snapshot_uuid"
+	snapshotRevertSchemaRestart      = "restart"
+	snapshotRevertSchemaTriggers     = "triggers"
+	snapshotRevertSchemaVMUUID       = "vm_uuid"
+)
+
+func resourceSnapshotRevert() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceSnapshotRevertCreate,
+		ReadContext:   resourceSnapshotRevertRead,
+		DeleteContext: resourceSnapshotRevertDelete,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			snapshotRevertSchemaSnapshotUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateUUID,
+			},
+
+			snapshotRevertSchemaRestart: &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				ForceNew: true,
+				Default:  true,
+			},
+
+			snapshotRevertSchemaTriggers: &schema.Schema{
+				Type:     schema.TypeMap,
+				Optional: true,
+				ForceNew: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+
+			snapshotRevertSchemaVMUUID: &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func resourceSnapshotRevertCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c, cancel, err := m.(*Connection).WithTimeout(d.Timeout(schema.TimeoutCreate))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer cancel()
+
+	snapshot := &VMDescriptor{
+		UUID: d.Get(snapshotRevertSchemaSnapshotUUID).(string),
+	}
+	if err := snapshot.Load(c); err != nil {
+		return diag.FromErr(referenceError(c, "snapshot", snapshot.UUID, err))
+	}
+
+	vmRef, err := c.client.VM.GetSnapshotOf(c.session, snapshot.VMRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	vm := &VMDescriptor{
+		VMRef: vmRef,
+	}
+	if err := vm.Query(c); err != nil {
+		return diag.FromErr(err)
+	}
+	wasRunning := vm.PowerState == xenapi.VMPowerStateRunning
+
+	log.Printf("[DEBUG] Reverting VM %s to snapshot %s", vm.UUID, snapshot.UUID)
+	task, err := callAsync(c, "VM.revert", string(snapshot.VMRef))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	if _, err := waitForTask(c, task); err != nil {
+		return diag.FromErr(err)
+	}
+
+	d.SetId(time.Now().UTC().String())
+
+	if err := d.Set(snapshotRevertSchemaVMUUID, vm.UUID); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if !wasRunning || !d.Get(snapshotRevertSchemaRestart).(bool) {
+		return nil
+	}
+
+	// Reverting to a checkpoint leaves the VM suspended, to a snapshot halted
+	if err := vm.Query(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	switch vm.PowerState {
+	case xenapi.VMPowerStateSuspended:
+		log.Printf("[DEBUG] Resuming VM %s", vm.UUID)
+		err = runPowerTask(c, "VM.resume", string(vm.VMRef), false, false)
+	case xenapi.VMPowerStateHalted:
+		log.Printf("[DEBUG] Starting VM %s", vm.UUID)
+		err = runPowerTask(c, "VM.start", string(vm.VMRef), false, false)
+	}
+
+	return diag.FromErr(err)
+}
+
+// resourceSnapshotRevertRead keeps the state as it is, the revert is an action
+// which only runs on create.
+func resourceSnapshotRevertRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return nil
+}
+
+func resourceSnapshotRevertDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return nil
+}
@@ -18,7 +18,246 @@
  */
 package xenserver
 
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
 const (
-	srSchemaUUID = "uuid"
-	srSchemaName = "name_label"
+	srSchemaUUID                = "uuid"
+	srSchemaName                = "name_label"
+	srSchemaDescription         = "description"
+	srSchemaServer              = "server"
+	srSchemaPath                = "path"
+	srSchemaVersion             = "version"
+	srSchemaPhysicalSize        = "physical_size"
+	srSchemaPhysicalUtilisation = "physical_utilisation"
 )
+
+// Host names or addresses of storage servers, without share or export path
+var validateSRServer = validation.All(validation.StringIsNotWhiteSpace, validation.StringDoesNotContainAny("/\\ "))
+
+// typedSR is an SR flavor managed by a dedicated resource, which builds the
+// device config of the SR from validated fields instead of taking it as a
+// free-form map. The SRs are shared, i.e. attached to all hosts of the pool.
+type typedSR struct {
+	srType      string
+	contentType string
+
+	// Builds the device config from the fields of the resource
+	deviceConfig func(c *Connection, d *schema.ResourceData) (map[string]string, error)
+}
+
+// resource returns the resource managing SRs of the flavor, with the fields
+// describing the storage added to the ones all SRs have. The fields of the
+// storage force a new SR when changed.
+func (t *typedSR) resource(fields map[string]*schema.Schema) *schema.Resource {
+	s := map[string]*schema.Schema{
+		srSchemaName: &schema.Schema{
+			Type:     schema.TypeString,
+			Required: true,
+		},
+
+		srSchemaDescription: &schema.Schema{
+			Type:     schema.TypeString,
+			Optional: true,
+			Default:  "",
+		},
+
+		srSchemaPhysicalSize: &schema.Schema{
+			Type:     schema.TypeInt,
+			Computed: true,
+		},
+
+		srSchemaPhysicalUtilisation: &schema.Schema{
+			Type:     schema.TypeInt,
+			Computed: true,
+		},
+	}
+
+	for k, v := range fields {
+		s[k] = v
+	}
+
+	return &schema.Resource{
+		CreateContext: t.create,
+		ReadContext:   forgetfulRead(resourceTypedSRRead, resourceTypedSRExists),
+		UpdateContext: resourceTypedSRUpdate,
+		DeleteContext: resourceTypedSRDelete,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(10 * time.Minute),
+			Delete: schema.DefaultTimeout(10 * time.Minute),
+		},
+
+		Schema: s,
+	}
+}
+
+// srSecret returns the UUID of the secret holding a credential of the storage,
+// after making sure the secret exists.
+func srSecret(c *Connection, d *schema.ResourceData, key string) (string, error) {
+	secretUUID := d.Get(key).(string)
+	if secretUUID == "" {
+		return "", nil
+	}
+
+	if _, err := c.client.Secret.GetByUUID(c.session, secretUUID); err != nil {
+		return "", referenceError(c, "secret", secretUUID, err)
+	}
+
+	return secretUUID, nil
+}
+
+// create creates the SR on the pool master, which attaches it to all hosts of
+// the pool.
+func (t *typedSR) create(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c, cancel, err := m.(*Connection).WithTimeout(d.Timeout(schema.TimeoutCreate))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer cancel()
+
+	deviceConfig, err := t.deviceConfig(c, d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	master, err := getPoolMaster(c)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	name := d.Get(srSchemaName).(string)
+
+	log.Printf("[DEBUG] Creating %s SR %q", t.srType, name)
+	srRef, err := c.client.SR.Create(c.session, master, deviceConfig, 0, name, d.Get(srSchemaDescription).(string),
+		t.srType, t.contentType, true, map[string]string{})
+	if err != nil {
+		return diag.FromErr(fmt.Errorf("failed to create %s SR %q: %s", t.srType, name, err))
+	}
+
+	srUUID, err := c.client.SR.GetUUID(c.session, srRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId(srUUID)
+
+	return resourceTypedSRRead(ctx, d, m)
+}
+
+func resourceTypedSRRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	srRef, err := c.client.SR.GetByUUID(c.session, d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	sr, err := c.client.SR.GetRecord(c.session, srRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(srSchemaName, sr.NameLabel); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(srSchemaDescription, sr.NameDescription); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(srSchemaPhysicalSize, sr.PhysicalSize); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(srSchemaPhysicalUtilisation, sr.PhysicalUtilisation); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return nil
+}
+
+func resourceTypedSRUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	srRef, err := c.client.SR.GetByUUID(c.session, d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if d.HasChange(srSchemaName) {
+		if err := c.client.SR.SetNameLabel(c.session, srRef, d.Get(srSchemaName).(string)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange(srSchemaDescription) {
+		if err := c.client.SR.SetNameDescription(c.session, srRef, d.Get(srSchemaDescription).(string)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	return resourceTypedSRRead(ctx, d, m)
+}
+
+// resourceTypedSRDelete detaches the SR from all hosts and forgets it. The
+// content of the SR is kept on the storage, so that the SR can be introduced
+// again, e.g. after having been removed by mistake.
+func resourceTypedSRDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c, cancel, err := m.(*Connection).WithTimeout(d.Timeout(schema.TimeoutDelete))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer cancel()
+
+	srRef, err := c.client.SR.GetByUUID(c.session, d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	pbds, err := c.client.SR.GetPBDs(c.session, srRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	for _, pbdRef := range pbds {
+		attached, err := c.client.PBD.GetCurrentlyAttached(c.session, pbdRef)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		if attached {
+			log.Printf("[DEBUG] Unplugging PBD %s of SR %s", pbdRef, d.Id())
+			if err := c.client.PBD.Unplug(c.session, pbdRef); err != nil {
+				return diag.FromErr(fmt.Errorf("failed to detach SR %s, it might still be in use: %s", d.Id(), err))
+			}
+		}
+	}
+
+	log.Printf("[DEBUG] Forgetting SR %s", d.Id())
+	return diag.FromErr(c.client.SR.Forget(c.session, srRef))
+}
+
+func resourceTypedSRExists(d *schema.ResourceData, m interface{}) (bool, error) {
+	c := m.(*Connection)
+
+	if _, err := c.client.SR.GetByUUID(c.session, d.Id()); err != nil {
+		if xenErr, ok := err.(*xenapi.Error); ok {
+			if xenErr.Code() == xenapi.ERR_UUID_INVALID {
+				return false, nil
+			}
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
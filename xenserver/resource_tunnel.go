@@ -0,0 +1,226 @@
+package xenserver
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+const (
+	tunnelSchemaNetworkUUID      = "network_uuid"
+	tunnelSchemaTransportPIFUUID = "transport_pif_uuid"
+	tunnelSchemaProtocol         = "protocol"
+	tunnelSchemaAccessPIFUUID    = "access_pif_uuid"
+	tunnelSchemaHostUUID         = "host_uuid"
+	tunnelSchemaStatus           = "status"
+
+	tunnelProtocolGRE   = "gre"
+	tunnelProtocolVXLAN = "vxlan"
+)
+
+func resourceTunnel() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceTunnelCreate,
+		ReadContext:   forgetfulRead(resourceTunnelRead, resourceTunnelExists),
+		DeleteContext: resourceTunnelDelete,
+
+		Schema: map[string]*schema.Schema{
+			tunnelSchemaNetworkUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateUUID,
+			},
+
+			tunnelSchemaTransportPIFUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateUUID,
+			},
+
+			tunnelSchemaProtocol: &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				Default:      tunnelProtocolGRE,
+				ValidateFunc: validation.StringInSlice([]string{tunnelProtocolGRE, tunnelProtocolVXLAN}, false),
+			},
+
+			tunnelSchemaAccessPIFUUID: &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			tunnelSchemaHostUUID: &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			tunnelSchemaStatus: &schema.Schema{
+				Type:     schema.TypeMap,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+		},
+	}
+}
+
+// createTunnel creates the tunnel with the protocol. Only GRE tunnels are
+// supported by the generated client, VXLAN requires XenServer 7.3 or newer,
+// which added the protocol parameter.
+func createTunnel(c *Connection, pif xenapi.PIFRef, network xenapi.NetworkRef, protocol string) (xenapi.TunnelRef, error) {
+	if protocol == tunnelProtocolGRE {
+		return c.client.Tunnel.Create(c.session, pif, network)
+	}
+
+	result, err := c.client.APICall("tunnel.create", string(c.session), string(pif), string(network), protocol)
+	if err != nil {
+		if xenErr, ok := err.(*xenapi.Error); ok {
+			if xenErr.Code() == xenapi.ERR_MESSAGE_PARAMETER_COUNT_MISMATCH {
+				return "", fmt.Errorf("%s tunnels are not supported by pool %s, XenServer 7.3 or newer is required", protocol, c.poolDescription())
+			}
+		}
+
+		return "", err
+	}
+
+	tunnel, ok := result.Value.(string)
+	if !ok {
+		return "", fmt.Errorf("tunnel.create did not return a tunnel reference")
+	}
+
+	return xenapi.TunnelRef(tunnel), nil
+}
+
+func resourceTunnelCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	pif := &PIFDescriptor{
+		UUID: d.Get(tunnelSchemaTransportPIFUUID).(string),
+	}
+
+	if err := pif.Load(c); err != nil {
+		return diag.FromErr(referenceError(c, "PIF", pif.UUID, err))
+	}
+
+	network := &NetworkDescriptor{
+		UUID: d.Get(tunnelSchemaNetworkUUID).(string),
+	}
+
+	if err := network.Load(c); err != nil {
+		return diag.FromErr(referenceError(c, "network", network.UUID, err))
+	}
+
+	protocol := d.Get(tunnelSchemaProtocol).(string)
+
+	log.Printf("[DEBUG] Creating %s tunnel for network %s on PIF %s", protocol, network.UUID, pif.UUID)
+	tunnelRef, err := createTunnel(c, pif.PIFRef, network.NetworkRef, protocol)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	tunnelUUID, err := c.client.Tunnel.GetUUID(c.session, tunnelRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId(tunnelUUID)
+
+	return resourceTunnelRead(ctx, d, m)
+}
+
+func resourceTunnelRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	tunnelRef, err := c.client.Tunnel.GetByUUID(c.session, d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	tunnel, err := c.client.Tunnel.GetRecord(c.session, tunnelRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	transportPIF := &PIFDescriptor{
+		PIFRef: tunnel.TransportPIF,
+	}
+	if err := transportPIF.Query(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	// The access PIF connects the network of the tunnel to the host
+	accessPIF := &PIFDescriptor{
+		PIFRef: tunnel.AccessPIF,
+	}
+	if err := accessPIF.Query(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	hostRef, err := c.client.PIF.GetHost(c.session, tunnel.AccessPIF)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	host := &HostDescriptor{
+		HostRef: hostRef,
+	}
+	if err := host.Query(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(tunnelSchemaTransportPIFUUID, transportPIF.UUID); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(tunnelSchemaNetworkUUID, accessPIF.Network.UUID); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(tunnelSchemaAccessPIFUUID, accessPIF.UUID); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(tunnelSchemaHostUUID, host.UUID); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(tunnelSchemaStatus, tunnel.Status); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return nil
+}
+
+func resourceTunnelDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	tunnelRef, err := c.client.Tunnel.GetByUUID(c.session, d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	log.Printf("[DEBUG] Destroying tunnel %s", d.Id())
+	return diag.FromErr(c.client.Tunnel.Destroy(c.session, tunnelRef))
+}
+
+func resourceTunnelExists(d *schema.ResourceData, m interface{}) (bool, error) {
+	c := m.(*Connection)
+
+	if _, err := c.client.Tunnel.GetByUUID(c.session, d.Id()); err != nil {
+		if xenErr, ok := err.(*xenapi.Error); ok {
+			if xenErr.Code() == xenapi.ERR_UUID_INVALID {
+				return false, nil
+			}
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
@@ -20,12 +20,15 @@ package xenserver
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"log"
+	"reflect"
+	"strconv"
 	"strings"
 
-	"github.com/hashicorp/terraform-plugin-sdk/helper/hashcode"
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	xenapi "github.com/terra-farm/go-xen-api-client"
 )
 
@@ -35,6 +38,23 @@ const (
 	vbdSchemaMode           = "mode"
 	vbdSchemaUserDevice     = "user_device"
 	vbdSchemaTemplateDevice = "is_from_template"
+	vbdSchemaQosType        = "qos_algorithm_type"
+	vbdSchemaQosParams      = "qos_algorithm_params"
+	vbdSchemaDevice         = "device"
+	vbdSchemaDevicePath     = "device_path"
+	vbdSchemaOtherConfig    = "other_config"
+	vbdSchemaCBTEnabled     = "cbt_enabled"
+	vbdSchemaKeepOnDestroy  = "keep_on_destroy"
+	vbdSchemaNameLabel      = "name_label"
+	vbdSchemaSRUUID         = "sr_uuid"
+	vbdSchemaSize           = "size"
+	vbdSchemaSourceVDIUUID  = "source_vdi_uuid"
+	vbdSchemaProvisioning   = "provisioning_type"
+
+	// Key in the other_config of a VBD whose VDI has been created from the
+	// content of another VDI, holding the UUID of that VDI. Like the disks from
+	// the template, the VDI belongs to the VM.
+	vbdOtherConfigSourceVDI = "terraform_source_vdi"
 )
 
 func queryTemplateVBDs(c *Connection, vm *VMDescriptor) (vbds []*VBDDescriptor, err error) {
@@ -64,6 +84,33 @@ func queryTemplateVBDs(c *Connection, vm *VMDescriptor) (vbds []*VBDDescriptor,
 	return vbds, nil
 }
 
+// queryOwnedVBDs returns the VBDs of the VM whose VDIs belong to it and are
+// destroyed along with it, the disks from the template and the ones created
+// from a source_vdi_uuid.
+func queryOwnedVBDs(c *Connection, vm *VMDescriptor) ([]*VBDDescriptor, error) {
+	vmVBDRefs, err := c.client.VM.GetVBDs(c.session, vm.VMRef)
+	if err != nil {
+		return nil, err
+	}
+
+	vbds := make([]*VBDDescriptor, 0)
+	for _, vmVBDRef := range vmVBDRefs {
+		vbd := &VBDDescriptor{
+			VBDRef: vmVBDRef,
+		}
+
+		if err := vbd.Query(c); err != nil {
+			return nil, err
+		}
+
+		if _, ok := vbd.OtherConfig[vbdOtherConfigSourceVDI]; vbd.IsTemplateDevice || ok {
+			vbds = append(vbds, vbd)
+		}
+	}
+
+	return vbds, nil
+}
+
 func readTemplateVBDsToSchema(c *Connection, vm *VMDescriptor, s []interface{}, vbdType xenapi.VbdType) error {
 	var vmVBDRefs []xenapi.VBDRef
 	var err error
@@ -95,16 +142,26 @@ func readTemplateVBDsToSchema(c *Connection, vm *VMDescriptor, s []interface{},
 				found = true
 
 				vbd.IsTemplateDevice = isTemplateDevice
+				readVBDQosFromSchema(vbd, data)
+				vbd.OtherConfig = mergeDeclaredKeys(vbd.OtherConfig, nil, vbdOtherConfigFromSchema(data))
 
 				if err = vbd.Commit(c); err != nil {
 					return err
 				}
 
+				if data[vbdSchemaCBTEnabled].(bool) && vbd.VDI != nil {
+					if err = setVDICBT(c, vbd.VDI, true); err != nil {
+						return err
+					}
+				}
+
 				data[vbdSchemaUserDevice] = vbd.UserDevice
 				data[vbdSchemaVdiUUID] = vbd.VDI.UUID
 				data[vbdSchemaBootable] = vbd.Bootable
 				data[vbdSchemaMode] = vbd.Mode
 				data[vbdSchemaTemplateDevice] = isTemplateDevice
+				data[vbdSchemaQosType] = vbd.QosAlgorithmType
+				data[vbdSchemaQosParams] = vbd.QosAlgorithmParams
 
 				break
 			}
@@ -136,6 +193,90 @@ func destroyTemplateVDIs(c *Connection, vbds []*VBDDescriptor) (err error) {
 	return nil
 }
 
+// withoutKeptVBDs drops the VBDs whose disk is declared with keep_on_destroy in
+// s, their VDIs survive the destruction of the VM.
+func withoutKeptVBDs(vbds []*VBDDescriptor, s []interface{}) []*VBDDescriptor {
+	kept := make(map[string]bool)
+	for _, schm := range s {
+		data := schm.(map[string]interface{})
+		if keep, ok := data[vbdSchemaKeepOnDestroy].(bool); ok && keep {
+			kept[data[vbdSchemaUserDevice].(string)] = true
+		}
+	}
+
+	destroy := make([]*VBDDescriptor, 0, len(vbds))
+	for _, vbd := range vbds {
+		if kept[vbd.UserDevice] {
+			log.Printf("[DEBUG] Keeping VDI of VBD %s", vbd.UUID)
+			continue
+		}
+		destroy = append(destroy, vbd)
+	}
+
+	return destroy
+}
+
+// declaredVBDSize returns the size the disk attached as userDevice is declared
+// with in s, or 0 if it is not declared.
+func declaredVBDSize(s []interface{}, userDevice string) int {
+	for _, schm := range s {
+		data := schm.(map[string]interface{})
+		if data[vbdSchemaUserDevice] == userDevice {
+			size, _ := data[vbdSchemaSize].(int)
+			return size
+		}
+	}
+
+	return 0
+}
+
+// customizeVMDiskSizeDiff rejects disks declared smaller than they are, disks
+// can only be grown.
+func customizeVMDiskSizeDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	if d.Id() == "" || !d.HasChange(vmSchemaHardDrive) || !d.NewValueKnown(vmSchemaHardDrive) {
+		return nil
+	}
+
+	o, n := d.GetChange(vmSchemaHardDrive)
+	for _, schm := range n.(*schema.Set).List() {
+		data := schm.(map[string]interface{})
+		userDevice := data[vbdSchemaUserDevice].(string)
+		size := data[vbdSchemaSize].(int)
+		if current := declaredVBDSize(o.(*schema.Set).List(), userDevice); size > 0 && size < current {
+			return fmt.Errorf("%s %s cannot be shrunk from %d to %d bytes, only grown", vmSchemaHardDrive, userDevice, current, size)
+		}
+	}
+
+	return nil
+}
+
+// customizeVMDiskSourceDiff checks the hard_drive blocks declaring a
+// source_vdi_uuid. The disk created from the source is told apart from the
+// other disks by its user device, which has to be declared therefore.
+func customizeVMDiskSourceDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	if !d.NewValueKnown(vmSchemaHardDrive) {
+		return nil
+	}
+
+	for _, schm := range d.Get(vmSchemaHardDrive).(*schema.Set).List() {
+		data := schm.(map[string]interface{})
+		source := data[vbdSchemaSourceVDIUUID].(string)
+		if source == "" {
+			continue
+		}
+
+		if data[vbdSchemaTemplateDevice].(bool) {
+			return fmt.Errorf("%s with %s %s cannot be from the template", vmSchemaHardDrive, vbdSchemaSourceVDIUUID, source)
+		}
+
+		if data[vbdSchemaUserDevice].(string) == "" {
+			return fmt.Errorf("%s with %s %s requires %s", vmSchemaHardDrive, vbdSchemaSourceVDIUUID, source, vbdSchemaUserDevice)
+		}
+	}
+
+	return nil
+}
+
 func readVBDFromSchema(c *Connection, s map[string]interface{}) (*VBDDescriptor, error) {
 	// In API it is called user_device, but in terraform provider it is called template device
 	// to emphasise that it is used to map VBD from template
@@ -143,12 +284,13 @@ func readVBDFromSchema(c *Connection, s map[string]interface{}) (*VBDDescriptor,
 
 	var vdi *VDIDescriptor = nil
 
-	if id, ok := s[vbdSchemaVdiUUID]; ok {
+	// Empty CD drives have no VDI
+	if id, ok := s[vbdSchemaVdiUUID]; ok && id.(string) != "" {
 		log.Println("[DEBUG] Try load VDI ", id)
 		vdi = &VDIDescriptor{}
 		vdi.UUID = id.(string)
 		if err := vdi.Load(c); err != nil {
-			return nil, err
+			return nil, referenceError(c, "VDI", vdi.UUID, err)
 		}
 	}
 	bootable := s[vbdSchemaBootable].(bool)
@@ -165,15 +307,113 @@ func readVBDFromSchema(c *Connection, s map[string]interface{}) (*VBDDescriptor,
 	}
 
 	vbd := &VBDDescriptor{
-		VDI:        vdi,
-		Bootable:   bootable,
-		Mode:       mode,
-		UserDevice: userDevice,
+		VDI:         vdi,
+		Bootable:    bootable,
+		Mode:        mode,
+		UserDevice:  userDevice,
+		OtherConfig: mergeDeclaredKeys(nil, nil, vbdOtherConfigFromSchema(s)),
 	}
+	readVBDQosFromSchema(vbd, s)
 
 	return vbd, nil
 }
 
+// readVBDQosFromSchema sets the QoS settings of the VBD to the ones declared.
+// Settings which are not declared are cleared, so that removing them from the
+// configuration removes them from the VBD.
+func readVBDQosFromSchema(vbd *VBDDescriptor, s map[string]interface{}) {
+	vbd.QosAlgorithmType, _ = s[vbdSchemaQosType].(string)
+
+	vbd.QosAlgorithmParams = make(map[string]string)
+	if qosParams, ok := s[vbdSchemaQosParams].(map[string]interface{}); ok {
+		for k, v := range qosParams {
+			vbd.QosAlgorithmParams[k] = v.(string)
+		}
+	}
+}
+
+// vbdOtherConfigFromSchema returns the other_config keys declared for a VBD.
+func vbdOtherConfigFromSchema(s map[string]interface{}) map[string]interface{} {
+	if otherConfig, ok := s[vbdSchemaOtherConfig].(map[string]interface{}); ok {
+		return otherConfig
+	}
+	return map[string]interface{}{}
+}
+
+// updateVBDsInPlace applies the QoS settings and the other_config of the VBDs in
+// n to the matching VBDs of the VM in place. The VBDs in o are the previously
+// configured ones, they tell which other_config keys to remove.
+func updateVBDsInPlace(c *Connection, vm *VMDescriptor, o, n []interface{}) error {
+	vmVBDRefs, err := c.client.VM.GetVBDs(c.session, vm.VMRef)
+	if err != nil {
+		return err
+	}
+
+	for _, vmVBDRef := range vmVBDRefs {
+		vbd, err := c.client.VBD.GetRecord(c.session, vmVBDRef)
+		if err != nil {
+			return err
+		}
+
+		for _, schm := range n {
+			data := schm.(map[string]interface{})
+			if data[vbdSchemaUserDevice].(string) != vbd.Userdevice {
+				continue
+			}
+
+			desired := &VBDDescriptor{}
+			readVBDQosFromSchema(desired, data)
+
+			if desired.QosAlgorithmType != vbd.QosAlgorithmType {
+				log.Printf("[DEBUG] Setting QoS algorithm of VBD %s to %q", vbd.UUID, desired.QosAlgorithmType)
+				if err := c.client.VBD.SetQosAlgorithmType(c.session, vmVBDRef, desired.QosAlgorithmType); err != nil {
+					return err
+				}
+			}
+
+			if len(desired.QosAlgorithmParams)+len(vbd.QosAlgorithmParams) > 0 && !reflect.DeepEqual(desired.QosAlgorithmParams, vbd.QosAlgorithmParams) {
+				log.Printf("[DEBUG] Setting QoS parameters of VBD %s to %v", vbd.UUID, desired.QosAlgorithmParams)
+				if err := c.client.VBD.SetQosAlgorithmParams(c.session, vmVBDRef, desired.QosAlgorithmParams); err != nil {
+					return err
+				}
+			}
+
+			if vbd.Type == xenapi.VbdTypeDisk && !vbd.Empty {
+				vdi := &VDIDescriptor{
+					VDIRef: vbd.VDI,
+				}
+				if err := vdi.Query(c); err != nil {
+					return err
+				}
+				if cbtEnabled, ok := data[vbdSchemaCBTEnabled].(bool); ok {
+					if err := setVDICBT(c, vdi, cbtEnabled); err != nil {
+						return err
+					}
+				}
+				// The VDIs of other disks are managed elsewhere, e.g. by a
+				// xenserver_vdi, and are left alone
+				if data[vbdSchemaTemplateDevice].(bool) || data[vbdSchemaSourceVDIUUID].(string) != "" {
+					if err := reconcileVDI(c, vm, vdi, data); err != nil {
+						return err
+					}
+				}
+			}
+
+			otherConfig := mergeDeclaredKeys(vbd.OtherConfig,
+				declaredKeysOf(o, vbdSchemaUserDevice, vbd.Userdevice, vbdSchemaOtherConfig),
+				vbdOtherConfigFromSchema(data))
+			if !reflect.DeepEqual(otherConfig, vbd.OtherConfig) {
+				log.Printf("[DEBUG] Setting other_config of VBD %s to %v", vbd.UUID, otherConfig)
+				if err := c.client.VBD.SetOtherConfig(c.session, vmVBDRef, otherConfig); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
 func readVBDsFromSchema(c *Connection, s []interface{}) ([]*VBDDescriptor, error) {
 	vbds := make([]*VBDDescriptor, 0, len(s))
 
@@ -193,18 +433,68 @@ func readVBDsFromSchema(c *Connection, s []interface{}) ([]*VBDDescriptor, error
 
 func fillVBDSchema(vbd VBDDescriptor) map[string]interface{} {
 	uuid := ""
+	cbtEnabled := false
+	nameLabel := ""
+	srUUID := ""
+	size := 0
+	provisioningType := ""
 	if vbd.VDI != nil {
 		uuid = vbd.VDI.UUID
+		cbtEnabled = vbd.VDI.CBTEnabled
+		nameLabel = vbd.VDI.Name
+		size = vbd.VDI.Size
+		provisioningType = vdiProvisioningType(vbd.VDI)
+		if vbd.VDI.SR != nil {
+			srUUID = vbd.VDI.SR.UUID
+		}
+	}
+
+	// The device is only known while the VM is running, otherwise it is derived
+	// from the user device the same way the backend would name it
+	device := vbd.Device
+	if device == "" {
+		device = vbdDeviceName(vbd.UserDevice)
 	}
+
+	devicePath := ""
+	if device != "" {
+		devicePath = "/dev/" + device
+	}
+
 	return map[string]interface{}{
 		vbdSchemaVdiUUID:        uuid,
 		vbdSchemaBootable:       vbd.Bootable,
 		vbdSchemaMode:           vbd.Mode,
 		vbdSchemaUserDevice:     vbd.UserDevice,
 		vbdSchemaTemplateDevice: vbd.IsTemplateDevice,
+		vbdSchemaQosType:        vbd.QosAlgorithmType,
+		vbdSchemaQosParams:      vbd.QosAlgorithmParams,
+		vbdSchemaDevice:         device,
+		vbdSchemaDevicePath:     devicePath,
+		vbdSchemaOtherConfig:    vbd.OtherConfig,
+		vbdSchemaCBTEnabled:     cbtEnabled,
+		vbdSchemaNameLabel:      nameLabel,
+		vbdSchemaSRUUID:         srUUID,
+		vbdSchemaSize:           size,
+		vbdSchemaSourceVDIUUID:  vbd.OtherConfig[vbdOtherConfigSourceVDI],
+		vbdSchemaProvisioning:   provisioningType,
 	}
 }
 
+// declaredKeepOnDestroy returns whether the disk attached as userDevice is
+// declared with keep_on_destroy in s. The flag only lives in the state.
+func declaredKeepOnDestroy(s []interface{}, userDevice string) bool {
+	for _, schm := range s {
+		data := schm.(map[string]interface{})
+		if data[vbdSchemaUserDevice] == userDevice {
+			keep, _ := data[vbdSchemaKeepOnDestroy].(bool)
+			return keep
+		}
+	}
+
+	return false
+}
+
 func readVBDs(c *Connection, vm *VMDescriptor) ([]map[string]interface{}, []map[string]interface{}, error) {
 	vmVBDs, err := c.client.VM.GetVBDs(c.session, vm.VMRef)
 	if err != nil {
@@ -225,6 +515,16 @@ func readVBDs(c *Connection, vm *VMDescriptor) ([]map[string]interface{}, []map[
 		}
 
 		log.Println("[DEBUG] Found VBD", vbd.UUID)
+
+		// Media generated for the VM is not declared by the user, neither is
+		// the installation media
+		if _, ok := vbd.OtherConfig[vbdOtherConfigGenerated]; ok {
+			continue
+		}
+		if _, ok := vbd.OtherConfig[vbdOtherConfigInstallMedia]; ok {
+			continue
+		}
+
 		vbdData := fillVBDSchema(vbd)
 		log.Println("[DEBUG] VBD: ", vbdData)
 		log.Println("[DEBUG] VBD Type: ", vbd.Type)
@@ -253,11 +553,41 @@ func setSchemaVBDs(c *Connection, vm *VMDescriptor, d *schema.ResourceData) erro
 	}
 
 	log.Println("[DEBUG] Found ", len(cdrom), " CDs and ", len(hdd), " HDDs")
+
+	// Only the other_config keys which are declared are managed
+	for _, data := range hdd {
+		data[vbdSchemaOtherConfig] = filterDeclaredKeys(data[vbdSchemaOtherConfig].(map[string]string),
+			declaredKeysOf(d.Get(vmSchemaHardDrive).(*schema.Set).List(), vbdSchemaUserDevice, data[vbdSchemaUserDevice], vbdSchemaOtherConfig))
+		data[vbdSchemaKeepOnDestroy] = declaredKeepOnDestroy(d.Get(vmSchemaHardDrive).(*schema.Set).List(), data[vbdSchemaUserDevice].(string))
+
+		// SRs round the size of disks up, the declared size is kept as long
+		// as the disk is at least as large
+		if size := declaredVBDSize(d.Get(vmSchemaHardDrive).(*schema.Set).List(), data[vbdSchemaUserDevice].(string)); size > 0 && data[vbdSchemaSize].(int) >= size {
+			data[vbdSchemaSize] = size
+		}
+	}
+	for _, data := range cdrom {
+		data[vbdSchemaOtherConfig] = filterDeclaredKeys(data[vbdSchemaOtherConfig].(map[string]string),
+			declaredKeysOf(d.Get(vmSchemaCdRom).(*schema.Set).List(), vbdSchemaUserDevice, data[vbdSchemaUserDevice], vbdSchemaOtherConfig))
+	}
+
 	err = d.Set(vmSchemaHardDrive, hdd)
 	if err != nil {
 		log.Println("[ERROR] ", err)
 		return err
 	}
+
+	diskPaths := make(map[string]string, len(hdd))
+	for _, data := range hdd {
+		if vdiUUID := data[vbdSchemaVdiUUID].(string); vdiUUID != "" {
+			diskPaths[vdiUUID] = data[vbdSchemaDevicePath].(string)
+		}
+	}
+	err = d.Set(vmSchemaDiskPaths, diskPaths)
+	if err != nil {
+		log.Println("[ERROR] ", err)
+		return err
+	}
 	err = d.Set(vmSchemaCdRom, cdrom)
 	if err != nil {
 		log.Println("[ERROR] ", err)
@@ -267,24 +597,88 @@ func setSchemaVBDs(c *Connection, vm *VMDescriptor, d *schema.ResourceData) erro
 	return nil
 }
 
+// checkVDIAttachments makes sure that a disk which is attached to other VMs
+// already can be attached to the VM of vbd as well. Any number of VMs can
+// attach a disk read-only, while a disk attached read-write by any of them has
+// to be sharable, e.g. for a cluster filesystem.
+func checkVDIAttachments(c *Connection, vbd *VBDDescriptor) error {
+	if vbd.VDI == nil || vbd.Type == xenapi.VbdTypeCD {
+		return nil
+	}
+
+	vbdRefs, err := c.client.VDI.GetVBDs(c.session, vbd.VDI.VDIRef)
+	if err != nil {
+		return err
+	}
+
+	for _, vbdRef := range vbdRefs {
+		other, err := c.getVBDRecord(vbdRef)
+		if err != nil {
+			return err
+		}
+
+		if other.VM == vbd.VM.VMRef {
+			continue
+		}
+
+		if vbd.VDI.IsShared || (other.Mode == xenapi.VbdModeRO && vbd.Mode == xenapi.VbdModeRO) {
+			continue
+		}
+
+		vm := &VMDescriptor{
+			VMRef: other.VM,
+		}
+		if err := vm.Query(c); err != nil {
+			return err
+		}
+
+		return fmt.Errorf("VDI %s is attached to VM %s already, it can only be attached to several VMs read-only, unless it is shared",
+			vbd.VDI.UUID, vm.UUID)
+	}
+
+	return nil
+}
+
 func createVBD(c *Connection, vbd *VBDDescriptor) (*VBDDescriptor, error) {
 	log.Println(fmt.Sprintf("[DEBUG] Creating VBD for VM %q", vbd.VM.Name))
 
+	if err := checkVDIAttachments(c, vbd); err != nil {
+		return nil, err
+	}
+
 	vbdObject := xenapi.VBDRecord{
-		Type:       vbd.Type,
-		Mode:       vbd.Mode,
-		Bootable:   vbd.Bootable,
-		VM:         vbd.VM.VMRef,
-		Empty:      vbd.VDI == nil,
-		Userdevice: vbd.UserDevice,
+		Type:        vbd.Type,
+		Mode:        vbd.Mode,
+		Bootable:    vbd.Bootable,
+		VM:          vbd.VM.VMRef,
+		Empty:       vbd.VDI == nil,
+		Userdevice:  vbd.UserDevice,
+		OtherConfig: vbd.OtherConfig,
+
+		QosAlgorithmType:   vbd.QosAlgorithmType,
+		QosAlgorithmParams: vbd.QosAlgorithmParams,
 	}
 
 	if devices, err := c.client.VM.GetAllowedVBDDevices(c.session, vbd.VM.VMRef); err == nil {
 		if len(devices) == 0 {
 			return nil, fmt.Errorf("No available devices to attach to")
 		}
-		vbdObject.Userdevice = devices[0]
-		log.Println("[DEBUG] Selected device for VBD: ", vbdObject.Userdevice)
+		if vbd.UserDevice == "" {
+			vbdObject.Userdevice = devices[0]
+			log.Println("[DEBUG] Selected device for VBD: ", vbdObject.Userdevice)
+		} else {
+			// A declared device has to be free
+			available := false
+			for _, device := range devices {
+				if device == vbd.UserDevice {
+					available = true
+					break
+				}
+			}
+			if !available {
+				return nil, fmt.Errorf("device %s of VM %s is not available", vbd.UserDevice, vbd.VM.UUID)
+			}
+		}
 	} else {
 		return nil, err
 	}
@@ -331,6 +725,7 @@ func vbdHash(v interface{}) int {
 	mode := m[vbdSchemaMode].(string)
 	bootable := m[vbdSchemaBootable].(bool)
 	vdiUUID := m[vbdSchemaVdiUUID].(string)
+	sourceVDIUUID := m[vbdSchemaSourceVDIUUID].(string)
 
 	log.Println("[DEBUG] Calculating hash for ", v)
 
@@ -340,7 +735,12 @@ func vbdHash(v interface{}) int {
 	}
 
 	if !isTemplateDevice {
-		b, _ = buf.WriteString(fmt.Sprintf("-%s", vdiUUID))
+		// The VDI of a disk created from a source is only known once created
+		if sourceVDIUUID != "" {
+			b, _ = buf.WriteString(fmt.Sprintf("-source-%s", sourceVDIUUID))
+		} else {
+			b, _ = buf.WriteString(fmt.Sprintf("-%s", vdiUUID))
+		}
 		count += b
 
 		if mode != "" {
@@ -354,7 +754,7 @@ func vbdHash(v interface{}) int {
 	log.Println("Consumed total ", count, " bytes to generate hash")
 	log.Println("String for hash: ", buf.String())
 
-	return hashcode.String(buf.String())
+	return schema.HashString(buf.String())
 }
 
 func createVBDs(c *Connection, s []interface{}, vbdType xenapi.VbdType, vm *VMDescriptor) (err error) {
@@ -368,6 +768,13 @@ func createVBDs(c *Connection, s []interface{}, vbdType xenapi.VbdType, vm *VMDe
 	for _, schm := range s {
 		data := schm.(map[string]interface{})
 
+		if vbdType == xenapi.VbdTypeDisk && data[vbdSchemaSourceVDIUUID].(string) != "" {
+			if err := createVBDFromSource(c, vm, data); err != nil {
+				return err
+			}
+			continue
+		}
+
 		if data[vbdSchemaUserDevice] != "" {
 			continue
 		}
@@ -394,6 +801,12 @@ func createVBDs(c *Connection, s []interface{}, vbdType xenapi.VbdType, vm *VMDe
 			return err
 		}
 
+		if vbdType == xenapi.VbdTypeDisk && data[vbdSchemaCBTEnabled].(bool) {
+			if err = setVDICBT(c, vbd.VDI, true); err != nil {
+				return err
+			}
+		}
+
 		data[vbdSchemaUserDevice] = vbd.UserDevice
 		data[vbdSchemaVdiUUID] = vbd.VDI.UUID
 		data[vbdSchemaBootable] = vbd.Bootable
@@ -403,6 +816,85 @@ func createVBDs(c *Connection, s []interface{}, vbdType xenapi.VbdType, vm *VMDe
 	return nil
 }
 
+// createVBDFromSource creates the VDI of the hard_drive block s from the content
+// of its source_vdi_uuid and attaches it to the VM as the declared user device.
+// The VDI is created in the declared SR, or else in the SR of the source, the
+// same way xenserver_vdi creates it.
+func createVBDFromSource(c *Connection, vm *VMDescriptor, s map[string]interface{}) error {
+	source := &VDIDescriptor{
+		UUID: s[vbdSchemaSourceVDIUUID].(string),
+	}
+	if err := source.Load(c); err != nil {
+		return referenceError(c, "VDI", source.UUID, err)
+	}
+
+	sr := &SRDescriptor{
+		UUID: s[vbdSchemaSRUUID].(string),
+	}
+	if sr.UUID == "" {
+		sr.UUID = source.SR.UUID
+	}
+	if err := sr.Load(c); err != nil {
+		return referenceError(c, "SR", sr.UUID, err)
+	}
+
+	smConfig, err := vdiProvisioningSmConfig(c, sr, s[vbdSchemaProvisioning].(string))
+	if err != nil {
+		return err
+	}
+
+	nameLabel := s[vbdSchemaNameLabel].(string)
+	if nameLabel == "" {
+		nameLabel = source.Name
+	}
+
+	vdiRef, err := createVDI(c, source.UUID, xenapi.VDIRecord{
+		NameLabel:   nameLabel,
+		VirtualSize: s[vbdSchemaSize].(int),
+		SR:          sr.SRRef,
+		Type:        xenapi.VdiTypeUser,
+		SmConfig:    smConfig,
+	})
+	if err != nil {
+		return err
+	}
+
+	vdi := &VDIDescriptor{
+		VDIRef: vdiRef,
+	}
+	if err := vdi.Query(c); err != nil {
+		destroyVDICopy(c, vdiRef)
+		return err
+	}
+	s[vbdSchemaVdiUUID] = vdi.UUID
+
+	vbd, err := readVBDFromSchema(c, s)
+	if err != nil {
+		destroyVDICopy(c, vdiRef)
+		return err
+	}
+	vbd.Type = xenapi.VbdTypeDisk
+	vbd.VM = vm
+	vbd.OtherConfig[vbdOtherConfigSourceVDI] = source.UUID
+
+	if vbd, err = createVBD(c, vbd); err != nil {
+		destroyVDICopy(c, vdiRef)
+		return err
+	}
+
+	if s[vbdSchemaCBTEnabled].(bool) {
+		if err := setVDICBT(c, vbd.VDI, true); err != nil {
+			return err
+		}
+	}
+
+	s[vbdSchemaUserDevice] = vbd.UserDevice
+	s[vbdSchemaBootable] = vbd.Bootable
+	s[vbdSchemaMode] = vbd.Mode
+
+	return nil
+}
+
 func resourceVBD() *schema.Resource {
 	return &schema.Resource{
 
@@ -413,9 +905,10 @@ func resourceVBD() *schema.Resource {
 				Default:  false,
 			},
 			vbdSchemaVdiUUID: &schema.Schema{
-				Type:     schema.TypeString,
-				Optional: true,
-				Computed: true,
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validateOptionalUUID,
 			},
 			vbdSchemaUserDevice: &schema.Schema{
 				Type:     schema.TypeString,
@@ -432,6 +925,338 @@ func resourceVBD() *schema.Resource {
 				Optional: true,
 				Computed: true,
 			},
+			// Not part of the hash, changes are applied in place
+			vbdSchemaCBTEnabled: &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Computed: true,
+			},
+			vbdSchemaQosType: &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			vbdSchemaQosParams: &schema.Schema{
+				Type:     schema.TypeMap,
+				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			// Not part of the hash, the VDI is relabeled in place
+			vbdSchemaNameLabel: &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			// Not part of the hash, the VDI is moved to the SR in place
+			vbdSchemaSRUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validateOptionalUUID,
+			},
+			// Not part of the hash, the VDI is grown in place
+			vbdSchemaSize: &schema.Schema{
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validation.IntAtLeast(0),
+			},
+			// Part of the hash instead of the UUID of the VDI created from it
+			vbdSchemaSourceVDIUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateOptionalUUID,
+			},
+			// Not part of the hash, only taken into account when the VDI is
+			// created from a source
+			vbdSchemaProvisioning: &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validation.StringInSlice([]string{vdiProvisioningThin, vdiProvisioningThick}, false),
+			},
+			// Not part of the hash, only taken into account on destroy
+			vbdSchemaKeepOnDestroy: &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			// Not part of the hash, only the declared keys are managed in place
+			vbdSchemaOtherConfig: &schema.Schema{
+				Type:     schema.TypeMap,
+				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			vbdSchemaDevice: &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			vbdSchemaDevicePath: &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
 		},
 	}
 }
+
+// vbdUserDeviceFromName translates a guest device name such as "xvdb" into the
+// corresponding user device ("1"). Numeric user devices are returned as is.
+func vbdUserDeviceFromName(name string) string {
+	if _, err := strconv.Atoi(name); err == nil {
+		return name
+	}
+
+	for _, prefix := range []string{"xvd", "hd", "sd"} {
+		if strings.HasPrefix(name, prefix) && len(name) == len(prefix)+1 {
+			letter := name[len(prefix)]
+			if letter >= 'a' && letter <= 'z' {
+				return strconv.Itoa(int(letter - 'a'))
+			}
+		}
+	}
+
+	return name
+}
+
+// vbdDeviceName returns the name a disk attached as the given user device is
+// expected to show up as in the guest, e.g. "xvdb" for "1".
+func vbdDeviceName(userDevice string) string {
+	index, err := strconv.Atoi(userDevice)
+	if err != nil || index < 0 || index > 'z'-'a' {
+		return ""
+	}
+
+	return "xvd" + string(rune('a'+index))
+}
+
+// reconcileVDI grows and relabels the VDI of a disk and moves it to another SR,
+// as declared in the hard_drive block s. The VDI of a running VM is migrated
+// live, otherwise it is copied to the SR and replaced.
+func reconcileVDI(c *Connection, vm *VMDescriptor, vdi *VDIDescriptor, s map[string]interface{}) error {
+	if size, ok := s[vbdSchemaSize].(int); ok && size > vdi.Size {
+		if err := growVDI(c, vm, vdi, size); err != nil {
+			return err
+		}
+	}
+
+	if nameLabel, ok := s[vbdSchemaNameLabel].(string); ok && nameLabel != "" && nameLabel != vdi.Name {
+		log.Printf("[DEBUG] Setting name label of VDI %s to %q", vdi.UUID, nameLabel)
+		if err := c.client.VDI.SetNameLabel(c.session, vdi.VDIRef, nameLabel); err != nil {
+			return err
+		}
+		vdi.Name = nameLabel
+	}
+
+	srUUID, ok := s[vbdSchemaSRUUID].(string)
+	if !ok || srUUID == "" || vdi.SR == nil || srUUID == vdi.SR.UUID {
+		return nil
+	}
+
+	if vm.PowerState != xenapi.VMPowerStateRunning {
+		return relocateVBDs(c, vm, map[string]interface{}{
+			s[vbdSchemaUserDevice].(string): srUUID,
+		}, nil)
+	}
+
+	sr := &SRDescriptor{
+		UUID: srUUID,
+	}
+	if err := sr.Load(c); err != nil {
+		return referenceError(c, "SR", sr.UUID, err)
+	}
+
+	log.Printf("[DEBUG] Migrating VDI %s to SR %s", vdi.UUID, sr.UUID)
+	return withSROperation(c, sr.SRRef, func() error {
+		_, err := c.client.VDI.PoolMigrate(c.session, vdi.VDIRef, sr.SRRef, map[string]string{})
+		return err
+	})
+}
+
+// growVDI resizes the VDI of a disk of the VM to size bytes. Disks cannot be
+// shrunk, as the data at their end would be lost.
+func growVDI(c *Connection, vm *VMDescriptor, vdi *VDIDescriptor, size int) error {
+	if size < vdi.Size {
+		return fmt.Errorf("VDI %s cannot be shrunk from %d to %d bytes, only grown", vdi.UUID, vdi.Size, size)
+	}
+
+	log.Printf("[DEBUG] Growing VDI %s from %d to %d bytes", vdi.UUID, vdi.Size, size)
+	var err error
+	if vm.PowerState == xenapi.VMPowerStateRunning {
+		err = c.client.VDI.ResizeOnline(c.session, vdi.VDIRef, size)
+	} else {
+		err = c.client.VDI.Resize(c.session, vdi.VDIRef, size)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to grow VDI %s to %d bytes: %s", vdi.UUID, size, err)
+	}
+
+	vdi.Size = size
+	return nil
+}
+
+// reconcileTemplateDisks applies the hard_drive blocks in s which declare disks
+// of the template to the disks the VM got from it, instead of creating disks of
+// their own.
+func reconcileTemplateDisks(c *Connection, vm *VMDescriptor, s []interface{}) error {
+	for _, schm := range s {
+		data := schm.(map[string]interface{})
+		if !data[vbdSchemaTemplateDevice].(bool) || data[vbdSchemaUserDevice].(string) == "" {
+			continue
+		}
+
+		vbds, err := queryTemplateVBDs(c, vm)
+		if err != nil {
+			return err
+		}
+
+		for _, vbd := range vbds {
+			if vbd.UserDevice != data[vbdSchemaUserDevice].(string) || vbd.Type != xenapi.VbdTypeDisk || vbd.VDI == nil {
+				continue
+			}
+
+			if err := reconcileVDI(c, vm, vbd.VDI, data); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// customizeVMDiskSRMapDiff rejects disk_sr_map entries which name a disk
+// attached from a vdi_uuid or created from a source_vdi_uuid. The former are
+// managed elsewhere, which relocating them would destroy, the latter declare
+// their SR with sr_uuid. Disks without a hard_drive declaration are the ones
+// the template provisions.
+func customizeVMDiskSRMapDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	srMap := d.Get(vmSchemaDiskSRMap).(map[string]interface{})
+	if len(srMap) == 0 || !d.HasChange(vmSchemaDiskSRMap) || !d.NewValueKnown(vmSchemaHardDrive) {
+		return nil
+	}
+
+	targets := make(map[string]string)
+	for device := range srMap {
+		targets[vbdUserDeviceFromName(device)] = device
+	}
+
+	for _, schm := range d.Get(vmSchemaHardDrive).(*schema.Set).List() {
+		data := schm.(map[string]interface{})
+		device, ok := targets[data[vbdSchemaUserDevice].(string)]
+		if !ok || data[vbdSchemaTemplateDevice].(bool) {
+			continue
+		}
+
+		if source := data[vbdSchemaSourceVDIUUID].(string); source != "" {
+			return fmt.Errorf("%s: disk %q is created from %s %s, set %s on its %s instead",
+				vmSchemaDiskSRMap, device, vbdSchemaSourceVDIUUID, source, vbdSchemaSRUUID, vmSchemaHardDrive)
+		}
+		if vdiUUID := data[vbdSchemaVdiUUID].(string); vdiUUID != "" {
+			return fmt.Errorf("%s: disk %q is attached from %s %s, only disks from the template can be relocated",
+				vmSchemaDiskSRMap, device, vbdSchemaVdiUUID, vdiUUID)
+		}
+	}
+
+	return nil
+}
+
+// relocateVBDs moves the disks of a VM to the SRs given in srMap, which is keyed
+// by device name or user device. Each affected VDI is copied to the target SR and
+// reattached in place of the original, which is destroyed afterwards. The disks
+// attached from a vdi_uuid of the hard_drive blocks in s are never relocated.
+func relocateVBDs(c *Connection, vm *VMDescriptor, srMap map[string]interface{}, s []interface{}) error {
+	targets := make(map[string]string)
+	for device, srUUID := range srMap {
+		targets[vbdUserDeviceFromName(device)] = srUUID.(string)
+	}
+
+	attached := make(map[string]bool)
+	for _, schm := range s {
+		data := schm.(map[string]interface{})
+		if vdiUUID := data[vbdSchemaVdiUUID].(string); vdiUUID != "" && !data[vbdSchemaTemplateDevice].(bool) {
+			attached[vdiUUID] = true
+		}
+	}
+
+	vmVBDRefs, err := c.client.VM.GetVBDs(c.session, vm.VMRef)
+	if err != nil {
+		return err
+	}
+
+	relocated := make(map[string]bool)
+	for _, vmVBDRef := range vmVBDRefs {
+		vbd, err := c.client.VBD.GetRecord(c.session, vmVBDRef)
+		if err != nil {
+			return err
+		}
+
+		srUUID, ok := targets[vbd.Userdevice]
+		if !ok || vbd.Type != xenapi.VbdTypeDisk || vbd.Empty {
+			continue
+		}
+		relocated[vbd.Userdevice] = true
+
+		vdi := &VDIDescriptor{
+			VDIRef: vbd.VDI,
+		}
+		if err = vdi.Query(c); err != nil {
+			return err
+		}
+
+		// Disks attached from existing VDIs are managed elsewhere, the copy
+		// would replace them and destroy the original
+		if attached[vdi.UUID] {
+			return fmt.Errorf("disk with user device %q is attached from VDI %s, only disks from the template can be relocated", vbd.Userdevice, vdi.UUID)
+		}
+
+		if vdi.SR.UUID == srUUID {
+			log.Printf("[DEBUG] VDI %s already resides on SR %s", vdi.UUID, srUUID)
+			continue
+		}
+
+		sr := &SRDescriptor{
+			UUID: srUUID,
+		}
+		if err = sr.Load(c); err != nil {
+			return referenceError(c, "SR", sr.UUID, err)
+		}
+
+		log.Printf("[DEBUG] Copying VDI %s to SR %s", vdi.UUID, sr.UUID)
+		var vdiCopy xenapi.VDIRef
+		err = withSROperation(c, sr.SRRef, func() error {
+			var err error
+			vdiCopy, err = c.client.VDI.Copy(c.session, vdi.VDIRef, sr.SRRef, "", "")
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		if err = c.client.VBD.Destroy(c.session, vmVBDRef); err != nil {
+			return err
+		}
+
+		vbdObject := xenapi.VBDRecord{
+			Type:        vbd.Type,
+			Mode:        vbd.Mode,
+			Bootable:    vbd.Bootable,
+			VM:          vm.VMRef,
+			VDI:         vdiCopy,
+			Userdevice:  vbd.Userdevice,
+			OtherConfig: vbd.OtherConfig,
+		}
+		if _, err = c.client.VBD.Create(c.session, vbdObject); err != nil {
+			return err
+		}
+
+		if err = c.client.VDI.Destroy(c.session, vdi.VDIRef); err != nil {
+			return err
+		}
+	}
+
+	for device := range targets {
+		if !relocated[device] {
+			return fmt.Errorf("no disk with user device %q found to relocate", device)
+		}
+	}
+
+	return nil
+}
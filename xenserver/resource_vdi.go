@@ -19,33 +19,75 @@
 package xenserver
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"time"
 
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	xenapi "github.com/terra-farm/go-xen-api-client"
 )
 
 const (
 	vdiSchemaUUID   = "sr_uuid"
 	vdiSchemaName   = "name_label"
+	vdiSchemaDesc   = "description"
 	vdiSchemaShared = "shared"
 	vdiSchemaRO     = "read_only"
 	vdiSchemaSize   = "size"
+	vdiSchemaSRRef  = "sr_ref"
+	vdiSchemaRef    = "ref"
+
+	vdiSchemaAllowedOperations = "allowed_operations"
+
+	vdiSchemaLifecycleHooks   = "lifecycle_hook"
+	vdiSchemaProvisioningType = "provisioning_type"
+	vdiSchemaSourceVDIUUID    = "source_vdi_uuid"
+	vdiSchemaCBTEnabled       = "cbt_enabled"
+
+	vdiProvisioningThin  = "thin"
+	vdiProvisioningThick = "thick"
 )
 
+// Types of the SRs whose drivers can create raw VDIs, which occupy their full
+// size on the volume group right away
+var thickProvisioningSRTypes = map[string]bool{
+	"lvm":       true,
+	"lvmoiscsi": true,
+	"lvmohba":   true,
+	"lvmofcoe":  true,
+}
+
 func resourceVDI() *schema.Resource {
 	return &schema.Resource{
-		Create: resourceVDICreate,
-		Read:   resourceVDIRead,
-		Update: resourceVDIUpdate,
-		Delete: resourceVDIDelete,
-		Exists: resourceVDIExists,
+		CreateContext: resourceVDICreate,
+		ReadContext:   forgetfulRead(resourceVDIRead, resourceVDIExists),
+		UpdateContext: resourceVDIUpdate,
+		DeleteContext: resourceVDIDelete,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Update: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(20 * time.Minute),
+		},
 
 		Schema: map[string]*schema.Schema{
 			vdiSchemaUUID: &schema.Schema{
-				Type:     schema.TypeString,
-				Required: true,
-				ForceNew: true,
+				Type:          schema.TypeString,
+				Optional:      true,
+				Computed:      true,
+				ForceNew:      true,
+				ConflictsWith: []string{vdiSchemaSRRef},
+				ValidateFunc:  validateUUID,
+			},
+
+			vdiSchemaSRRef: &schema.Schema{
+				Type:          schema.TypeString,
+				Optional:      true,
+				ForceNew:      true,
+				ConflictsWith: []string{vdiSchemaUUID},
 			},
 
 			vdiSchemaName: &schema.Schema{
@@ -53,6 +95,11 @@ func resourceVDI() *schema.Resource {
 				Required: true,
 			},
 
+			vdiSchemaDesc: &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+
 			vdiSchemaShared: &schema.Schema{
 				Type:     schema.TypeBool,
 				Optional: true,
@@ -66,57 +113,149 @@ func resourceVDI() *schema.Resource {
 			},
 
 			vdiSchemaSize: &schema.Schema{
-				Type:     schema.TypeInt,
-				Required: true,
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Computed:     true,
+				AtLeastOneOf: []string{vdiSchemaSize, vdiSchemaSourceVDIUUID},
+			},
+
+			vdiSchemaSourceVDIUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				AtLeastOneOf: []string{vdiSchemaSize, vdiSchemaSourceVDIUUID},
+				ValidateFunc: validateUUID,
+			},
+
+			vdiSchemaProvisioningType: &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ForceNew:     true,
+				ValidateFunc: validation.StringInSlice([]string{vdiProvisioningThin, vdiProvisioningThick}, false),
+			},
+
+			vdiSchemaCBTEnabled: &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Computed: true,
+			},
+
+			// Only held in the state, the SM driver does not have to keep it in
+			// the sm_config of the VDI
+			vdiSchemaEncryptionKey: &schema.Schema{
+				Type:          schema.TypeString,
+				Optional:      true,
+				ForceNew:      true,
+				Sensitive:     true,
+				ConflictsWith: []string{vdiSchemaEncryptionKeySecretUUID},
+			},
+
+			vdiSchemaEncryptionKeySecretUUID: &schema.Schema{
+				Type:          schema.TypeString,
+				Optional:      true,
+				ForceNew:      true,
+				ConflictsWith: []string{vdiSchemaEncryptionKey},
+				ValidateFunc:  validateUUID,
+			},
+
+			vdiSchemaLifecycleHooks: &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem:     resourceLifecycleHook(),
+			},
+
+			vdiSchemaRef: &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			vdiSchemaAllowedOperations: &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
 			},
 		},
 	}
 }
 
-func resourceVDICreate(d *schema.ResourceData, m interface{}) error {
-	c := m.(*Connection)
+func resourceVDICreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c, cancel, err := m.(*Connection).WithTimeout(d.Timeout(schema.TimeoutCreate))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer cancel()
 
 	sr := &SRDescriptor{
-		UUID: d.Get(vdiSchemaUUID).(string),
+		UUID:  d.Get(vdiSchemaUUID).(string),
+		SRRef: xenapi.SRRef(d.Get(vdiSchemaSRRef).(string)),
+	}
+
+	if sr.UUID == "" && sr.SRRef == "" {
+		if c.defaultSR == "" {
+			return diag.FromErr(fmt.Errorf("either %q or %q has to be given, the provider has no default_sr", vdiSchemaUUID, vdiSchemaSRRef))
+		}
+		sr.UUID = c.defaultSR
 	}
 
 	log.Println("Going to create VDI in SR ", sr.UUID)
 
 	if err := sr.Load(c); err != nil {
 		log.Println("SR not found!")
-		return err
+		return diag.FromErr(referenceError(c, "SR", sr.UUID, err))
+	}
+
+	smConfig, err := vdiProvisioningSmConfig(c, sr, d.Get(vdiSchemaProvisioningType).(string))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := vdiEncryptionSmConfig(c, sr, d, smConfig); err != nil {
+		return diag.FromErr(err)
 	}
 
 	vdiRecord := xenapi.VDIRecord{
-		NameLabel:   d.Get(vdiSchemaName).(string),
-		VirtualSize: d.Get(vdiSchemaSize).(int),
-		Sharable:    d.Get(vdiSchemaShared).(bool),
-		ReadOnly:    d.Get(vdiSchemaRO).(bool),
-		SR:          sr.SRRef,
-		Type:        xenapi.VdiTypeUser,
+		NameLabel:       d.Get(vdiSchemaName).(string),
+		NameDescription: d.Get(vdiSchemaDesc).(string),
+		VirtualSize:     d.Get(vdiSchemaSize).(int),
+		Sharable:        d.Get(vdiSchemaShared).(bool),
+		ReadOnly:        d.Get(vdiSchemaRO).(bool),
+		SR:              sr.SRRef,
+		Type:            xenapi.VdiTypeUser,
+		SmConfig:        smConfig,
 	}
 
 	log.Println("Object to send: ", vdiRecord)
-	if vdiRef, err := c.client.VDI.Create(c.session, vdiRecord); err == nil {
+	if vdiRef, err := createVDI(c, d.Get(vdiSchemaSourceVDIUUID).(string), vdiRecord); err == nil {
 		log.Println("VDI Created")
 		vdi := &VDIDescriptor{
 			VDIRef: vdiRef,
 		}
 
 		if err := vdi.Query(c); err != nil {
-			return err
+			return diag.FromErr(err)
 		}
 		log.Println("UUID is ", vdi.UUID)
 		d.SetId(vdi.UUID)
+
+		if d.Get(vdiSchemaCBTEnabled).(bool) {
+			if err := setVDICBT(c, vdi, true); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+
+		if err := runLifecycleHooks(c, d.Get(vdiSchemaLifecycleHooks).([]interface{}), lifecycleHookEventPostCreate, xenapi.ClsVDI, vdi.UUID); err != nil {
+			return diag.FromErr(err)
+		}
 	} else {
 		log.Println("VDI not created!")
-		return err
+		return diag.FromErr(err)
 	}
 
 	return nil
 }
 
-func resourceVDIRead(d *schema.ResourceData, m interface{}) error {
+func resourceVDIRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	c := m.(*Connection)
 
 	vdi := &VDIDescriptor{
@@ -124,94 +263,321 @@ func resourceVDIRead(d *schema.ResourceData, m interface{}) error {
 	}
 
 	if err := vdi.Load(c); err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	d.SetId(vdi.UUID)
 	if err := d.Set(vdiSchemaName, vdi.Name); err != nil {
-		return err
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vdiSchemaDesc, vdi.Description); err != nil {
+		return diag.FromErr(err)
 	}
 
 	if err := d.Set(vdiSchemaRO, vdi.IsReadOnly); err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	if err := d.Set(vdiSchemaShared, vdi.IsShared); err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	if err := d.Set(vdiSchemaSize, vdi.Size); err != nil {
-		return err
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vdiSchemaUUID, vdi.SR.UUID); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vdiSchemaRef, string(vdi.VDIRef)); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vdiSchemaAllowedOperations, vdi.AllowedOperations); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vdiSchemaCBTEnabled, vdi.CBTEnabled); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if source, ok := vdi.OtherConfig[vdiCopyOtherConfigSource]; ok {
+		if err := d.Set(vdiSchemaSourceVDIUUID, source); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if secretUUID, ok := vdi.SmConfig[smConfigEncryptionKeySecret]; ok {
+		if err := d.Set(vdiSchemaEncryptionKeySecretUUID, secretUUID); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if provisioningType := vdiProvisioningType(vdi); provisioningType != "" {
+		if err := d.Set(vdiSchemaProvisioningType, provisioningType); err != nil {
+			return diag.FromErr(err)
+		}
 	}
 
 	return nil
 }
-func resourceVDIUpdate(d *schema.ResourceData, m interface{}) error {
-	c := m.(*Connection)
+
+// createVDI creates the VDI described by the record, either blank or with the
+// content of the source VDI. A source in the same SR is cloned, which is quick
+// and shares the blocks of the source on most SRs, otherwise it is copied. The
+// VDI is grown to the size of the record if that is larger than the source.
+func createVDI(c *Connection, sourceUUID string, record xenapi.VDIRecord) (vdiRef xenapi.VDIRef, err error) {
+	err = withSROperation(c, record.SR, func() (err error) {
+		vdiRef, err = createVDIOnce(c, sourceUUID, record)
+		return
+	})
+	return
+}
+
+func createVDIOnce(c *Connection, sourceUUID string, record xenapi.VDIRecord) (vdiRef xenapi.VDIRef, err error) {
+	if sourceUUID == "" {
+		return c.client.VDI.Create(c.session, record)
+	}
+
+	source := &VDIDescriptor{
+		UUID: sourceUUID,
+	}
+	if err := source.Load(c); err != nil {
+		return "", referenceError(c, "VDI", source.UUID, err)
+	}
+
+	size := record.VirtualSize
+	if size == 0 {
+		size = source.Size
+	} else if size < source.Size {
+		return "", fmt.Errorf("size %d is smaller than the %d bytes of source VDI %s", size, source.Size, source.UUID)
+	}
+
+	// Do not leave a VDI with partial content behind
+	defer func() {
+		if err != nil && vdiRef != "" {
+			destroyVDICopy(c, vdiRef)
+			vdiRef = ""
+		}
+	}()
+
+	// A clone keeps the format of the source, a given provisioning type takes
+	// a copy into a VDI created with it
+	if source.SR.SRRef == record.SR && len(record.SmConfig) == 0 {
+		log.Printf("[DEBUG] Cloning VDI %s", source.UUID)
+		if vdiRef, err = c.client.VDI.Clone(c.session, source.VDIRef, map[string]string{}); err != nil {
+			return
+		}
+
+		if err = c.client.VDI.SetNameLabel(c.session, vdiRef, record.NameLabel); err != nil {
+			return
+		}
+
+		if err = c.client.VDI.SetNameDescription(c.session, vdiRef, record.NameDescription); err != nil {
+			return
+		}
+
+		if err = c.client.VDI.SetSharable(c.session, vdiRef, record.Sharable); err != nil {
+			return
+		}
+
+		if err = c.client.VDI.AddToOtherConfig(c.session, vdiRef, vdiCopyOtherConfigSource, source.UUID); err != nil {
+			return
+		}
+	} else {
+		// The content is copied into a VDI created up front, like for
+		// xenserver_vdi_copy, which cannot be read-only yet
+		target := record
+		target.VirtualSize = source.Size
+		target.ReadOnly = false
+		target.OtherConfig = map[string]string{
+			vdiCopyOtherConfigSource: source.UUID,
+		}
+
+		if vdiRef, err = c.client.VDI.Create(c.session, target); err != nil {
+			return
+		}
+
+		log.Printf("[DEBUG] Copying VDI %s into VDI %s", source.UUID, vdiRef)
+		var task xenapi.TaskRef
+		if task, err = callAsync(c, "VDI.copy", string(source.VDIRef), string(record.SR), "OpaqueRef:NULL", string(vdiRef)); err != nil {
+			return
+		}
+		if _, err = waitForTask(c, task); err != nil {
+			return
+		}
+	}
+
+	if size > source.Size {
+		log.Printf("[DEBUG] Growing VDI %s to %d bytes", vdiRef, size)
+		if err = c.client.VDI.Resize(c.session, vdiRef, size); err != nil {
+			return
+		}
+	}
+
+	if record.ReadOnly {
+		if err = c.client.VDI.SetReadOnly(c.session, vdiRef, true); err != nil {
+			return
+		}
+	}
+
+	return vdiRef, nil
+}
+
+// vdiProvisioningSmConfig returns the sm_config selecting the format of a new
+// VDI on the SR, after making sure the SR can create it. Thin provisioned VDIs
+// use the VHD format, thick provisioned ones the raw format, which only LVM
+// based SRs support. Without a provisioning type the driver picks the format.
+func vdiProvisioningSmConfig(c *Connection, sr *SRDescriptor, provisioningType string) (map[string]string, error) {
+	smConfig := make(map[string]string)
+	if provisioningType == "" {
+		return smConfig, nil
+	}
+
+	allowedOperations, err := c.client.SR.GetAllowedOperations(c.session, sr.SRRef)
+	if err != nil {
+		return nil, err
+	}
+
+	canCreate := false
+	for _, operation := range allowedOperations {
+		if operation == xenapi.StorageOperationsVdiCreate {
+			canCreate = true
+			break
+		}
+	}
+	if !canCreate {
+		return nil, fmt.Errorf("SR %s does not allow creating VDIs", sr.UUID)
+	}
+
+	if !thickProvisioningSRTypes[sr.Type] {
+		if provisioningType == vdiProvisioningThick {
+			return nil, fmt.Errorf("SR %s of type %s does not support thick provisioning, only LVM based SRs do", sr.UUID, sr.Type)
+		}
+		return smConfig, nil
+	}
+
+	if provisioningType == vdiProvisioningThick {
+		smConfig["type"] = "raw"
+	} else {
+		smConfig["type"] = "vhd"
+	}
+
+	return smConfig, nil
+}
+
+// vdiProvisioningType returns the provisioning type of the VDI, as told by the
+// format the driver recorded it has chosen for it, or "" if it did not.
+func vdiProvisioningType(vdi *VDIDescriptor) string {
+	return map[string]string{
+		"raw": vdiProvisioningThick,
+		"vhd": vdiProvisioningThin,
+	}[vdi.SmConfig["vdi_type"]]
+}
+
+func resourceVDIUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c, cancel, err := m.(*Connection).WithTimeout(d.Timeout(schema.TimeoutUpdate))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer cancel()
 
 	vdi := &VDIDescriptor{
 		UUID: d.Id(),
 	}
 
 	if err := vdi.Load(c); err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	if d.HasChange(vdiSchemaName) {
 		_, n := d.GetChange(vdiSchemaName)
 
 		if err := c.client.VDI.SetNameLabel(c.session, vdi.VDIRef, n.(string)); err != nil {
-			return err
+			return diag.FromErr(err)
 		}
+	}
 
-		d.SetPartial(vdiSchemaName)
+	if d.HasChange(vdiSchemaDesc) {
+		_, n := d.GetChange(vdiSchemaDesc)
+
+		if err := c.client.VDI.SetNameDescription(c.session, vdi.VDIRef, n.(string)); err != nil {
+			return diag.FromErr(err)
+		}
 	}
 
 	if d.HasChange(vdiSchemaSize) {
 		_, n := d.GetChange(vdiSchemaSize)
 
 		if err := c.client.VDI.SetVirtualSize(c.session, vdi.VDIRef, n.(int)); err != nil {
-			return err
+			return diag.FromErr(err)
 		}
-
-		d.SetPartial(vdiSchemaSize)
 	}
 
 	if d.HasChange(vdiSchemaShared) {
 		_, n := d.GetChange(vdiSchemaShared)
 
 		if err := c.client.VDI.SetSharable(c.session, vdi.VDIRef, n.(bool)); err != nil {
-			return err
+			return diag.FromErr(err)
 		}
-
-		d.SetPartial(vdiSchemaShared)
 	}
 
 	if d.HasChange(vdiSchemaRO) {
 		_, n := d.GetChange(vdiSchemaRO)
 
 		if err := c.client.VDI.SetReadOnly(c.session, vdi.VDIRef, n.(bool)); err != nil {
-			return err
+			return diag.FromErr(err)
 		}
+	}
 
-		d.SetPartial(vdiSchemaRO)
+	if d.HasChange(vdiSchemaCBTEnabled) {
+		if err := setVDICBT(c, vdi, d.Get(vdiSchemaCBTEnabled).(bool)); err != nil {
+			return diag.FromErr(err)
+		}
 	}
 
 	return nil
 }
-func resourceVDIDelete(d *schema.ResourceData, m interface{}) error {
-	c := m.(*Connection)
+
+// setVDICBT enables or disables changed block tracking on the VDI, which backup
+// tools use to only export the blocks written since the last backup.
+func setVDICBT(c *Connection, vdi *VDIDescriptor, enabled bool) error {
+	if vdi.CBTEnabled == enabled {
+		return nil
+	}
+
+	if enabled {
+		log.Printf("[DEBUG] Enabling changed block tracking on VDI %s", vdi.UUID)
+		return c.client.VDI.EnableCbt(c.session, vdi.VDIRef)
+	}
+
+	log.Printf("[DEBUG] Disabling changed block tracking on VDI %s", vdi.UUID)
+	return c.client.VDI.DisableCbt(c.session, vdi.VDIRef)
+}
+
+func resourceVDIDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c, cancel, err := m.(*Connection).WithTimeout(d.Timeout(schema.TimeoutDelete))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer cancel()
 
 	vdi := &VDIDescriptor{
 		UUID: d.Id(),
 	}
 
 	if err := vdi.Load(c); err != nil {
-		return err
+		return diag.FromErr(err)
+	}
+
+	if err := runLifecycleHooks(c, d.Get(vdiSchemaLifecycleHooks).([]interface{}), lifecycleHookEventPreDestroy, xenapi.ClsVDI, vdi.UUID); err != nil {
+		return diag.FromErr(err)
 	}
 
 	if err := c.client.VDI.Destroy(c.session, vdi.VDIRef); err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	return nil
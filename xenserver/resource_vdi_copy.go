@@ -0,0 +1,255 @@
+package xenserver
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+const (
+	vdiCopySchemaSourceVDIUUID = "source_vdi_uuid"
+	vdiCopySchemaSRUUID        = "sr_uuid"
+	vdiCopySchemaName          = "name_label"
+	vdiCopySchemaSize          = "size"
+	vdiCopySchemaRef           = "ref"
+
+	// Key in the other_config of the VDI the UUID of the source VDI is stored in
+	vdiCopyOtherConfigSource = "terraform_copy_of"
+)
+
+func resourceVDICopy() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceVDICopyCreate,
+		ReadContext:   forgetfulRead(resourceVDICopyRead, resourceVDICopyExists),
+		UpdateContext: resourceVDICopyUpdate,
+		DeleteContext: resourceVDICopyDelete,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(60 * time.Minute),
+			Delete: schema.DefaultTimeout(20 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			vdiCopySchemaSourceVDIUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateUUID,
+			},
+
+			vdiCopySchemaSRUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateUUID,
+			},
+
+			vdiCopySchemaName: &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+
+			vdiCopySchemaSize: &schema.Schema{
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+
+			vdiCopySchemaRef: &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func resourceVDICopyCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c, cancel, err := m.(*Connection).WithTimeout(d.Timeout(schema.TimeoutCreate))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer cancel()
+
+	source := &VDIDescriptor{
+		UUID: d.Get(vdiCopySchemaSourceVDIUUID).(string),
+	}
+	if err := source.Load(c); err != nil {
+		return diag.FromErr(referenceError(c, "VDI", source.UUID, err))
+	}
+
+	sr := &SRDescriptor{
+		UUID: d.Get(vdiCopySchemaSRUUID).(string),
+	}
+	if err := sr.Load(c); err != nil {
+		return diag.FromErr(referenceError(c, "SR", sr.UUID, err))
+	}
+
+	name := d.Get(vdiCopySchemaName).(string)
+	if name == "" {
+		name = source.Name
+	}
+
+	// The copy goes into a VDI created up front, so that there is a known VDI to
+	// clean up in case the copy fails or is aborted
+	var vdiRef xenapi.VDIRef
+	err = withSROperation(c, sr.SRRef, func() error {
+		var err error
+		vdiRef, err = c.client.VDI.Create(c.session, xenapi.VDIRecord{
+			NameLabel:   name,
+			VirtualSize: source.Size,
+			SR:          sr.SRRef,
+			Type:        xenapi.VdiTypeUser,
+			OtherConfig: map[string]string{
+				vdiCopyOtherConfigSource: source.UUID,
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		log.Printf("[DEBUG] Copying VDI %s into SR %s", source.UUID, sr.UUID)
+		task, err := callAsync(c, "VDI.copy", string(source.VDIRef), string(sr.SRRef), "OpaqueRef:NULL", string(vdiRef))
+		if err == nil {
+			_, err = waitForTask(c, task)
+		}
+		if err != nil {
+			destroyVDICopy(c, vdiRef)
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	vdi := &VDIDescriptor{
+		VDIRef: vdiRef,
+	}
+	if err := vdi.Query(c); err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId(vdi.UUID)
+
+	return resourceVDICopyRead(ctx, d, m)
+}
+
+// destroyVDICopy removes the target VDI of a failed copy.
+func destroyVDICopy(c *Connection, vdiRef xenapi.VDIRef) {
+	cleanup, cancel, err := c.forCleanup()
+	if err != nil {
+		log.Println("[ERROR] ", err)
+		return
+	}
+	defer cancel()
+
+	log.Printf("[DEBUG] Destroying VDI %s of failed copy", vdiRef)
+	if err := cleanup.client.VDI.Destroy(cleanup.session, vdiRef); err != nil {
+		log.Println("[ERROR] ", err)
+	}
+}
+
+func resourceVDICopyRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	vdi := &VDIDescriptor{
+		UUID: d.Id(),
+	}
+
+	if err := vdi.Load(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	otherConfig, err := c.client.VDI.GetOtherConfig(c.session, vdi.VDIRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if source, ok := otherConfig[vdiCopyOtherConfigSource]; ok {
+		if err := d.Set(vdiCopySchemaSourceVDIUUID, source); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if err := d.Set(vdiCopySchemaSRUUID, vdi.SR.UUID); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vdiCopySchemaName, vdi.Name); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vdiCopySchemaSize, vdi.Size); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vdiCopySchemaRef, string(vdi.VDIRef)); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return nil
+}
+
+func resourceVDICopyUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	vdi := &VDIDescriptor{
+		UUID: d.Id(),
+	}
+
+	if err := vdi.Load(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if d.HasChange(vdiCopySchemaName) {
+		_, n := d.GetChange(vdiCopySchemaName)
+
+		if err := c.client.VDI.SetNameLabel(c.session, vdi.VDIRef, n.(string)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	return resourceVDICopyRead(ctx, d, m)
+}
+
+func resourceVDICopyDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c, cancel, err := m.(*Connection).WithTimeout(d.Timeout(schema.TimeoutDelete))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer cancel()
+
+	vdi := &VDIDescriptor{
+		UUID: d.Id(),
+	}
+
+	if err := vdi.Load(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return diag.FromErr(c.client.VDI.Destroy(c.session, vdi.VDIRef))
+}
+
+func resourceVDICopyExists(d *schema.ResourceData, m interface{}) (bool, error) {
+	c := m.(*Connection)
+
+	vdi := &VDIDescriptor{
+		UUID: d.Id(),
+	}
+
+	if err := vdi.Load(c); err != nil {
+		if xenErr, ok := err.(*xenapi.Error); ok {
+			if xenErr.Code() == xenapi.ERR_UUID_INVALID {
+				return false, nil
+			}
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
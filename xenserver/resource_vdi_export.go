@@ -0,0 +1,201 @@
+package xenserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+const (
+	vdiExportSchemaVDIUUID     = "vdi_uuid"
+	vdiExportSchemaDestination = "destination"
+	vdiExportSchemaFormat      = "format"
+	vdiExportSchemaSize        = "size"
+	vdiExportSchemaChecksum    = "checksum"
+)
+
+func resourceVDIExport() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceVDIExportCreate,
+		ReadContext:   resourceVDIExportRead,
+		DeleteContext: resourceVDIExportDelete,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(60 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			vdiExportSchemaVDIUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateUUID,
+			},
+
+			vdiExportSchemaDestination: &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+
+			vdiExportSchemaFormat: vdiFormatSchema(),
+
+			vdiExportSchemaSize: &schema.Schema{
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+
+			vdiExportSchemaChecksum: &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+// exportRawVDI streams the content of the VDI, as an image in the format raw or
+// vhd, through the export_raw_vdi HTTP handler of XenServer into w.
+func exportRawVDI(c *Connection, vdi *VDIDescriptor, w io.Writer, format string) error {
+	query := url.Values{}
+	query.Set("session_id", string(c.session))
+	query.Set("vdi", string(vdi.VDIRef))
+	query.Set("format", format)
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(c.url, "/")+"/export_raw_vdi?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{
+		Transport: c.transport,
+	}
+
+	resp, err := client.Do(req.WithContext(c.ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("VDI export failed: %s", resp.Status)
+	}
+
+	// A VHD only holds the allocated blocks, its size is not known up front
+	size := resp.ContentLength
+	if size < 0 && format == vdiFormatRaw {
+		size = int64(vdi.Size)
+	}
+
+	progress := &transferProgress{
+		r:         resp.Body,
+		operation: "Download of",
+		vdi:       vdi.VDIRef,
+		size:      size,
+		percent:   -1,
+	}
+
+	_, err = io.Copy(w, progress)
+	return err
+}
+
+// downloadVDI exports the VDI to the local file at destination. The image is
+// written to a temporary file next to it first, so that the destination is
+// not left behind half written if the export fails.
+func downloadVDI(c *Connection, vdi *VDIDescriptor, destination, format string) error {
+	f, err := ioutil.TempFile(filepath.Dir(destination), "."+filepath.Base(destination)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	log.Printf("[DEBUG] Downloading VDI %s to %s", vdi.UUID, destination)
+	if err := exportRawVDI(c, vdi, f, format); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), destination)
+}
+
+func resourceVDIExportCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c, cancel, err := m.(*Connection).WithTimeout(d.Timeout(schema.TimeoutCreate))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer cancel()
+
+	vdi := &VDIDescriptor{
+		UUID: d.Get(vdiExportSchemaVDIUUID).(string),
+	}
+
+	if err := vdi.Load(c); err != nil {
+		return diag.FromErr(referenceError(c, "VDI", vdi.UUID, err))
+	}
+
+	destination := d.Get(vdiExportSchemaDestination).(string)
+
+	if err := downloadVDI(c, vdi, destination, d.Get(vdiExportSchemaFormat).(string)); err != nil {
+		return diag.FromErr(err)
+	}
+
+	checksum, err := fileSHA256(destination)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vdiExportSchemaChecksum, checksum); err != nil {
+		return diag.FromErr(err)
+	}
+
+	d.SetId(vdi.UUID)
+
+	return resourceVDIExportRead(ctx, d, m)
+}
+
+// resourceVDIExportRead forgets the export once the file is gone or has been
+// replaced by a file of another size, so that the VDI is exported again. The
+// checksum is not verified, as reading the whole image on every refresh would
+// be too slow.
+func resourceVDIExportRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	destination := d.Get(vdiExportSchemaDestination).(string)
+
+	info, err := os.Stat(destination)
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.Printf("[WARN] Export of VDI %s to %s is gone", d.Id(), destination)
+			d.SetId("")
+			return nil
+		}
+
+		return diag.FromErr(err)
+	}
+
+	if size, ok := d.GetOk(vdiExportSchemaSize); ok && int64(size.(int)) != info.Size() {
+		log.Printf("[WARN] Export of VDI %s to %s has been modified", d.Id(), destination)
+		d.SetId("")
+		return nil
+	}
+
+	return diag.FromErr(d.Set(vdiExportSchemaSize, int(info.Size())))
+}
+
+// resourceVDIExportDelete keeps the exported file, which typically outlives the
+// VDI it has been exported from.
+func resourceVDIExportDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return nil
+}
@@ -0,0 +1,71 @@
+package xenserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+const (
+	vdiImportSchemaFormat = "format"
+
+	// Formats of disk images understood by the import_raw_vdi and
+	// export_raw_vdi HTTP handlers
+	vdiFormatRaw = "raw"
+	vdiFormatVHD = "vhd"
+
+	// A VHD ends with a footer of 512 bytes, which starts with this cookie and
+	// holds the virtual size of the disk at offset 48
+	vhdFooterSize       = 512
+	vhdFooterCookie     = "conectix"
+	vhdFooterSizeOffset = 48
+)
+
+func vdiFormatSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:         schema.TypeString,
+		Optional:     true,
+		ForceNew:     true,
+		Default:      vdiFormatRaw,
+		ValidateFunc: validation.StringInSlice([]string{vdiFormatRaw, vdiFormatVHD}, false),
+	}
+}
+
+// resourceVDIImport uploads a local disk image into a new VDI. It works like
+// the ISO upload, except that the image may also be a VHD.
+func resourceVDIImport() *schema.Resource {
+	r := resourceISOUpload()
+	r.CreateContext = resourceVDIImportCreate
+	r.Schema[vdiImportSchemaFormat] = vdiFormatSchema()
+
+	return r
+}
+
+// vhdVirtualSize returns the size of the disk stored in the VHD r of size bytes,
+// as recorded in its footer.
+func vhdVirtualSize(r io.ReaderAt, size int64) (int64, error) {
+	if size < vhdFooterSize {
+		return 0, fmt.Errorf("file is too small to be a VHD")
+	}
+
+	footer := make([]byte, vhdFooterSize)
+	if _, err := r.ReadAt(footer, size-vhdFooterSize); err != nil {
+		return 0, err
+	}
+
+	if !bytes.HasPrefix(footer, []byte(vhdFooterCookie)) {
+		return 0, fmt.Errorf("file has no VHD footer")
+	}
+
+	return int64(binary.BigEndian.Uint64(footer[vhdFooterSizeOffset:])), nil
+}
+
+func resourceVDIImportCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return uploadCreate(ctx, d, m, d.Get(vdiImportSchemaFormat).(string))
+}
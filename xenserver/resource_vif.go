@@ -21,23 +21,38 @@ package xenserver
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"log"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
 
-	"github.com/hashicorp/terraform-plugin-sdk/helper/hashcode"
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	xenapi "github.com/terra-farm/go-xen-api-client"
 )
 
 const (
 	vifSchemaNetworkUUID = "network_uuid"
+	vifSchemaNetworkRef  = "network_ref"
 	vifSchemaMac         = "mac"
+	vifSchemaMacAddress  = "mac_address"
 	vifSchemaMtu         = "mtu"
 	vifSchemaDevice      = "device"
 	vifSchemaOtherConfig = "other_config"
+	vifSchemaVMUUID      = "vm_uuid"
+	vifSchemaQosType     = "qos_algorithm_type"
+	vifSchemaQosKbps     = "qos_kbps"
+	vifSchemaLockingMode = "locking_mode"
+	vifSchemaIPv4Allowed = "ipv4_allowed"
+	vifSchemaIPv6Allowed = "ipv6_allowed"
+
+	// Marks VIFs managed by a xenserver_vif resource in their other_config so that
+	// they are not picked up as network interfaces of a xenserver_vm
+	vifOtherConfigStandalone = "terraform_standalone"
 )
 
 func readVIFsFromSchema(c *Connection, s []interface{}) ([]*VIFDescriptor, error) {
@@ -50,8 +65,11 @@ func readVIFsFromSchema(c *Connection, s []interface{}) ([]*VIFDescriptor, error
 		if id, ok := data[vifSchemaNetworkUUID]; ok {
 			network.UUID = id.(string)
 		}
+		if network.UUID == "" {
+			network.UUID = c.defaultNetwork
+		}
 		if err := network.Load(c); err != nil {
-			return nil, err
+			return nil, referenceError(c, "network", network.UUID, err)
 		}
 		mtu := data[vifSchemaMtu].(int)
 		device := data[vifSchemaDevice].(int)
@@ -74,6 +92,11 @@ func readVIFsFromSchema(c *Connection, s []interface{}) ([]*VIFDescriptor, error
 			DeviceOrder:        device,
 			MTU:                mtu,
 			OtherConfig:        other_config,
+			QosAlgorithmType:   data[vifSchemaQosType].(string),
+			QosAlgorithmParams: vifQosParams(data[vifSchemaQosKbps].(int)),
+			LockingMode:        xenapi.VifLockingMode(data[vifSchemaLockingMode].(string)),
+			IPv4Allowed:        vifAllowedAddresses(data[vifSchemaIPv4Allowed]),
+			IPv6Allowed:        vifAllowedAddresses(data[vifSchemaIPv6Allowed]),
 		}
 
 		vifs = append(vifs, vif)
@@ -88,13 +111,39 @@ func fillVIFSchema(vif VIFDescriptor) map[string]interface{} {
 	if !vif.IsAutogeneratedMAC {
 		mac = vif.MAC
 	}
+	kbps, _ := strconv.Atoi(vif.QosAlgorithmParams["kbps"])
 	return map[string]interface{}{
 		vifSchemaNetworkUUID: vif.Network.UUID,
 		vifSchemaMac:         mac,
+		vifSchemaMacAddress:  vif.MAC,
 		vifSchemaMtu:         vif.MTU,
 		vifSchemaDevice:      vif.DeviceOrder,
 		vifSchemaOtherConfig: vif.OtherConfig,
+		vifSchemaQosType:     vif.QosAlgorithmType,
+		vifSchemaQosKbps:     kbps,
+		vifSchemaLockingMode: string(vif.LockingMode),
+		vifSchemaIPv4Allowed: vif.IPv4Allowed,
+		vifSchemaIPv6Allowed: vif.IPv6Allowed,
+	}
+}
+
+// omitsDefaultNetwork reports whether the network interface in s with the
+// device of vif is declared without a network while vif is connected to the
+// default network of the provider. Its network_uuid is then kept empty so that
+// the interface keeps its place in the set.
+func omitsDefaultNetwork(c *Connection, s []interface{}, vif *VIFDescriptor) bool {
+	if c.defaultNetwork == "" || vif.Network.UUID != c.defaultNetwork {
+		return false
 	}
+
+	for _, schm := range s {
+		data := schm.(map[string]interface{})
+		if data[vifSchemaDevice] == vif.DeviceOrder {
+			return data[vifSchemaNetworkUUID] == ""
+		}
+	}
+
+	return false
 }
 
 func createVIF(c *Connection, vif *VIFDescriptor) (*VIFDescriptor, error) {
@@ -104,15 +153,23 @@ func createVIF(c *Connection, vif *VIFDescriptor) (*VIFDescriptor, error) {
 		vif.DeviceOrder = vif.VM.VIFCount
 	}
 
+	if vif.LockingMode == "" {
+		vif.LockingMode = xenapi.VifLockingModeNetworkDefault
+	}
+
 	vifObject := xenapi.VIFRecord{
-		VM:               vif.VM.VMRef,
-		Network:          vif.Network.NetworkRef,
-		MTU:              vif.MTU,
-		MACAutogenerated: vif.IsAutogeneratedMAC,
-		MAC:              vif.MAC,
-		Device:           strconv.Itoa(vif.DeviceOrder),
-		OtherConfig:      vif.OtherConfig,
-		LockingMode:      xenapi.VifLockingModeNetworkDefault,
+		VM:                 vif.VM.VMRef,
+		Network:            vif.Network.NetworkRef,
+		MTU:                vif.MTU,
+		MACAutogenerated:   vif.IsAutogeneratedMAC,
+		MAC:                vif.MAC,
+		Device:             strconv.Itoa(vif.DeviceOrder),
+		OtherConfig:        vif.OtherConfig,
+		LockingMode:        vif.LockingMode,
+		Ipv4Allowed:        vif.IPv4Allowed,
+		Ipv6Allowed:        vif.IPv6Allowed,
+		QosAlgorithmType:   vif.QosAlgorithmType,
+		QosAlgorithmParams: vif.QosAlgorithmParams,
 	}
 
 	vifRef, err := c.client.VIF.Create(c.session, vifObject)
@@ -142,6 +199,72 @@ func createVIF(c *Connection, vif *VIFDescriptor) (*VIFDescriptor, error) {
 	return vif, nil
 }
 
+// updateVIFsInPlace applies the QoS settings, the locking mode and the allowed
+// addresses of the network interfaces in s to the matching VIFs of the VM,
+// which works for plugged VIFs of running VMs as well.
+func updateVIFsInPlace(c *Connection, vm *VMDescriptor, s []interface{}) error {
+	vmVIFRefs, err := c.client.VM.GetVIFs(c.session, vm.VMRef)
+	if err != nil {
+		return err
+	}
+
+	for _, vmVIFRef := range vmVIFRefs {
+		vif, err := c.client.VIF.GetRecord(c.session, vmVIFRef)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := vif.OtherConfig[vifOtherConfigStandalone]; ok {
+			continue
+		}
+
+		for _, schm := range s {
+			data := schm.(map[string]interface{})
+			if strconv.Itoa(data[vifSchemaDevice].(int)) != vif.Device {
+				continue
+			}
+
+			if qosType := data[vifSchemaQosType].(string); qosType != vif.QosAlgorithmType {
+				log.Printf("[DEBUG] Setting QoS algorithm of VIF %s to %q", vif.UUID, qosType)
+				if err := c.client.VIF.SetQosAlgorithmType(c.session, vmVIFRef, qosType); err != nil {
+					return err
+				}
+			}
+
+			if qosParams := vifQosParams(data[vifSchemaQosKbps].(int)); qosParams["kbps"] != vif.QosAlgorithmParams["kbps"] {
+				log.Printf("[DEBUG] Setting QoS parameters of VIF %s to %v", vif.UUID, qosParams)
+				if err := c.client.VIF.SetQosAlgorithmParams(c.session, vmVIFRef, qosParams); err != nil {
+					return err
+				}
+			}
+
+			// The allowed addresses are in place before the VIF gets locked
+			if ipv4Allowed := vifAllowedAddresses(data[vifSchemaIPv4Allowed]); !reflect.DeepEqual(ipv4Allowed, vifAllowedAddresses(vif.Ipv4Allowed)) {
+				log.Printf("[DEBUG] Setting allowed IPv4 addresses of VIF %s to %v", vif.UUID, ipv4Allowed)
+				if err := c.client.VIF.SetIpv4Allowed(c.session, vmVIFRef, ipv4Allowed); err != nil {
+					return err
+				}
+			}
+
+			if ipv6Allowed := vifAllowedAddresses(data[vifSchemaIPv6Allowed]); !reflect.DeepEqual(ipv6Allowed, vifAllowedAddresses(vif.Ipv6Allowed)) {
+				log.Printf("[DEBUG] Setting allowed IPv6 addresses of VIF %s to %v", vif.UUID, ipv6Allowed)
+				if err := c.client.VIF.SetIpv6Allowed(c.session, vmVIFRef, ipv6Allowed); err != nil {
+					return err
+				}
+			}
+
+			if lockingMode := xenapi.VifLockingMode(data[vifSchemaLockingMode].(string)); lockingMode != vif.LockingMode {
+				log.Printf("[DEBUG] Setting locking mode of VIF %s to %s", vif.UUID, lockingMode)
+				if err := c.client.VIF.SetLockingMode(c.session, vmVIFRef, lockingMode); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
 func vifHash(v interface{}) int {
 	var buf bytes.Buffer
 	m := v.(map[string]interface{})
@@ -178,7 +301,7 @@ func vifHash(v interface{}) int {
 	count += b
 	log.Println("Consumed total ", count, " bytes to generate hash")
 
-	return hashcode.String(buf.String())
+	return schema.HashString(buf.String())
 }
 
 func resourceVIF() *schema.Resource {
@@ -186,26 +309,404 @@ func resourceVIF() *schema.Resource {
 
 		Schema: map[string]*schema.Schema{
 			vifSchemaNetworkUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateOptionalUUID,
+			},
+			vifSchemaMac: &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateOptionalMACAddress,
+			},
+			// Also set when the MAC address is autogenerated, unlike mac,
+			// so it is not part of the hash
+			vifSchemaMacAddress: &schema.Schema{
 				Type:     schema.TypeString,
+				Computed: true,
+			},
+			vifSchemaMtu: &schema.Schema{
+				Type:         schema.TypeInt,
+				Optional:     true,
+				ValidateFunc: validateMTU,
+			},
+			vifSchemaDevice: &schema.Schema{
+				Type:     schema.TypeInt,
 				Optional: true,
+				Computed: true,
 			},
-			vifSchemaMac: &schema.Schema{
+			vifSchemaOtherConfig: &schema.Schema{
+				Type:     schema.TypeMap,
+				Optional: true,
+			},
+			// Not part of the hash, changes are applied in place
+			vifSchemaQosType: &schema.Schema{
 				Type:     schema.TypeString,
 				Optional: true,
 			},
-			vifSchemaMtu: &schema.Schema{
+			// Not part of the hash, changes are applied in place
+			vifSchemaQosKbps: &schema.Schema{
 				Type:     schema.TypeInt,
 				Optional: true,
 			},
+			// Not part of the hash, changes are applied in place
+			vifSchemaLockingMode: &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      string(xenapi.VifLockingModeNetworkDefault),
+				ValidateFunc: validateVIFLockingMode,
+			},
+			// Not part of the hash, changes are applied in place
+			vifSchemaIPv4Allowed: &schema.Schema{
+				Type:     schema.TypeSet,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validation.IsIPv4Address,
+				},
+				Set: schema.HashString,
+			},
+			// Not part of the hash, changes are applied in place
+			vifSchemaIPv6Allowed: &schema.Schema{
+				Type:     schema.TypeSet,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validation.IsIPv6Address,
+				},
+				Set: schema.HashString,
+			},
+		},
+	}
+}
+
+func resourceStandaloneVIF() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceVIFCreate,
+		ReadContext:   forgetfulRead(resourceVIFRead, resourceVIFExists),
+		UpdateContext: resourceVIFUpdate,
+		DeleteContext: resourceVIFDelete,
+
+		Schema: map[string]*schema.Schema{
+			vifSchemaVMUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateUUID,
+			},
+			vifSchemaNetworkUUID: &schema.Schema{
+				Type:          schema.TypeString,
+				Optional:      true,
+				Computed:      true,
+				ForceNew:      true,
+				ConflictsWith: []string{vifSchemaNetworkRef},
+				ValidateFunc:  validateOptionalUUID,
+			},
+			// Saves the lookup of the network
+			vifSchemaNetworkRef: &schema.Schema{
+				Type:          schema.TypeString,
+				Optional:      true,
+				ForceNew:      true,
+				ConflictsWith: []string{vifSchemaNetworkUUID},
+			},
+			vifSchemaMac: &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ForceNew:     true,
+				ValidateFunc: validateOptionalMACAddress,
+			},
+			vifSchemaMtu: &schema.Schema{
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Computed:     true,
+				ForceNew:     true,
+				ValidateFunc: validateMTU,
+			},
 			vifSchemaDevice: &schema.Schema{
 				Type:     schema.TypeInt,
 				Optional: true,
 				Computed: true,
+				ForceNew: true,
 			},
 			vifSchemaOtherConfig: &schema.Schema{
 				Type:     schema.TypeMap,
 				Optional: true,
 			},
+			vifSchemaQosType: &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			vifSchemaQosKbps: &schema.Schema{
+				Type:     schema.TypeInt,
+				Optional: true,
+			},
+			vifSchemaLockingMode: &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      string(xenapi.VifLockingModeNetworkDefault),
+				ValidateFunc: validateVIFLockingMode,
+			},
+			vifSchemaIPv4Allowed: &schema.Schema{
+				Type:     schema.TypeSet,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validation.IsIPv4Address,
+				},
+				Set: schema.HashString,
+			},
+			vifSchemaIPv6Allowed: &schema.Schema{
+				Type:     schema.TypeSet,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validation.IsIPv6Address,
+				},
+				Set: schema.HashString,
+			},
 		},
 	}
 }
+
+// validateVIFLockingMode checks the locking mode, which restricts the traffic
+// of a VIF to the allowed IP addresses while it is locked.
+func validateVIFLockingMode(v interface{}, k string) ([]string, []error) {
+	return validation.StringInSlice([]string{
+		string(xenapi.VifLockingModeNetworkDefault),
+		string(xenapi.VifLockingModeLocked),
+		string(xenapi.VifLockingModeUnlocked),
+		string(xenapi.VifLockingModeDisabled),
+	}, false)(v, k)
+}
+
+// vifAllowedAddresses returns the sorted IP addresses of v, a set from the
+// schema or a list read from XenServer.
+func vifAllowedAddresses(v interface{}) []string {
+	addresses := make([]string, 0)
+
+	switch v := v.(type) {
+	case *schema.Set:
+		for _, address := range v.List() {
+			addresses = append(addresses, address.(string))
+		}
+	case []string:
+		addresses = append(addresses, v...)
+	}
+	sort.Strings(addresses)
+
+	return addresses
+}
+
+func vifQosParams(kbps int) map[string]string {
+	params := make(map[string]string)
+	if kbps > 0 {
+		params["kbps"] = strconv.Itoa(kbps)
+	}
+	return params
+}
+
+func resourceVIFCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	vm := &VMDescriptor{
+		UUID: d.Get(vifSchemaVMUUID).(string),
+	}
+	if err := vm.Load(c); err != nil {
+		return diag.FromErr(referenceError(c, "VM", vm.UUID, err))
+	}
+
+	network := &NetworkDescriptor{
+		UUID:       d.Get(vifSchemaNetworkUUID).(string),
+		NetworkRef: xenapi.NetworkRef(d.Get(vifSchemaNetworkRef).(string)),
+	}
+	if network.UUID == "" && network.NetworkRef == "" {
+		network.UUID = c.defaultNetwork
+	}
+	if err := network.Load(c); err != nil {
+		return diag.FromErr(referenceError(c, "network", network.UUID, err))
+	}
+
+	otherConfig := make(map[string]string)
+	for k, v := range d.Get(vifSchemaOtherConfig).(map[string]interface{}) {
+		otherConfig[k] = v.(string)
+	}
+	otherConfig[vifOtherConfigStandalone] = "true"
+
+	mac := d.Get(vifSchemaMac).(string)
+
+	vif := &VIFDescriptor{
+		VM:                 vm,
+		Network:            network,
+		MAC:                mac,
+		IsAutogeneratedMAC: mac == "",
+		DeviceOrder:        d.Get(vifSchemaDevice).(int),
+		MTU:                d.Get(vifSchemaMtu).(int),
+		OtherConfig:        otherConfig,
+		QosAlgorithmType:   d.Get(vifSchemaQosType).(string),
+		QosAlgorithmParams: vifQosParams(d.Get(vifSchemaQosKbps).(int)),
+		LockingMode:        xenapi.VifLockingMode(d.Get(vifSchemaLockingMode).(string)),
+		IPv4Allowed:        vifAllowedAddresses(d.Get(vifSchemaIPv4Allowed)),
+		IPv6Allowed:        vifAllowedAddresses(d.Get(vifSchemaIPv6Allowed)),
+	}
+
+	if _, err := createVIF(c, vif); err != nil {
+		return diag.FromErr(err)
+	}
+
+	d.SetId(vif.UUID)
+
+	return resourceVIFRead(ctx, d, m)
+}
+
+func resourceVIFRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	vif := &VIFDescriptor{
+		UUID: d.Id(),
+	}
+	if err := vif.Load(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vifSchemaVMUUID, vif.VM.UUID); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vifSchemaNetworkUUID, vif.Network.UUID); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vifSchemaMac, vif.MAC); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vifSchemaMtu, vif.MTU); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vifSchemaDevice, vif.DeviceOrder); err != nil {
+		return diag.FromErr(err)
+	}
+
+	otherConfig := filterDeclaredKeys(vif.OtherConfig, d.Get(vifSchemaOtherConfig).(map[string]interface{}))
+	delete(otherConfig, vifOtherConfigStandalone)
+	if err := d.Set(vifSchemaOtherConfig, otherConfig); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vifSchemaQosType, vif.QosAlgorithmType); err != nil {
+		return diag.FromErr(err)
+	}
+
+	kbps, _ := strconv.Atoi(vif.QosAlgorithmParams["kbps"])
+	if err := d.Set(vifSchemaQosKbps, kbps); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vifSchemaLockingMode, string(vif.LockingMode)); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vifSchemaIPv4Allowed, vif.IPv4Allowed); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vifSchemaIPv6Allowed, vif.IPv6Allowed); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return nil
+}
+
+func resourceVIFUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	vif := &VIFDescriptor{
+		UUID: d.Id(),
+	}
+	if err := vif.Load(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if d.HasChange(vifSchemaOtherConfig) {
+		o, n := d.GetChange(vifSchemaOtherConfig)
+		otherConfig := mergeDeclaredKeys(vif.OtherConfig, o.(map[string]interface{}), n.(map[string]interface{}))
+		otherConfig[vifOtherConfigStandalone] = "true"
+
+		if err := c.client.VIF.SetOtherConfig(c.session, vif.VIFRef, otherConfig); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange(vifSchemaQosType) {
+		if err := c.client.VIF.SetQosAlgorithmType(c.session, vif.VIFRef, d.Get(vifSchemaQosType).(string)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange(vifSchemaQosKbps) {
+		if err := c.client.VIF.SetQosAlgorithmParams(c.session, vif.VIFRef, vifQosParams(d.Get(vifSchemaQosKbps).(int))); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	// The allowed addresses are in place before the VIF gets locked
+	if d.HasChange(vifSchemaIPv4Allowed) {
+		if err := c.client.VIF.SetIpv4Allowed(c.session, vif.VIFRef, vifAllowedAddresses(d.Get(vifSchemaIPv4Allowed))); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange(vifSchemaIPv6Allowed) {
+		if err := c.client.VIF.SetIpv6Allowed(c.session, vif.VIFRef, vifAllowedAddresses(d.Get(vifSchemaIPv6Allowed))); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange(vifSchemaLockingMode) {
+		if err := c.client.VIF.SetLockingMode(c.session, vif.VIFRef, xenapi.VifLockingMode(d.Get(vifSchemaLockingMode).(string))); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	return resourceVIFRead(ctx, d, m)
+}
+
+func resourceVIFDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	vif := &VIFDescriptor{
+		UUID: d.Id(),
+	}
+	if err := vif.Load(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if vif.VM.PowerState == xenapi.VMPowerStateRunning {
+		if err := c.client.VIF.Unplug(c.session, vif.VIFRef); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if err := c.client.VIF.Destroy(c.session, vif.VIFRef); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return nil
+}
+
+func resourceVIFExists(d *schema.ResourceData, m interface{}) (bool, error) {
+	c := m.(*Connection)
+
+	if _, err := c.client.VIF.GetByUUID(c.session, d.Id()); err != nil {
+		if xenErr, ok := err.(*xenapi.Error); ok {
+			if xenErr.Code() == xenapi.ERR_UUID_INVALID {
+				return false, nil
+			}
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
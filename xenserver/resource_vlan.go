@@ -19,9 +19,11 @@
 package xenserver
 
 import (
+	"context"
 	"log"
 
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	xenapi "github.com/terra-farm/go-xen-api-client"
 )
 
@@ -32,44 +34,65 @@ const (
 	vlanSchemaPIF         = "pif"
 	vlanSchemaOtherConfig = "other_config"
 	vlanSchemaNetwork     = "network"
+
+	vlanSchemaUntaggedPIF   = "untagged_pif"
+	vlanSchemaNetworkBridge = "network_bridge"
+	vlanSchemaNetworkRef    = "network_ref"
 )
 
 func resourceVLAN() *schema.Resource {
 	return &schema.Resource{
-		Create: resourceVLANCreate,
-		Read:   resourceVLANRead,
-		Update: resourceVLANUpdate,
-		Delete: resourceVLANDelete,
-		Exists: resourceVLANExists,
+		CreateContext: resourceVLANCreate,
+		ReadContext:   forgetfulRead(resourceVLANRead, resourceVLANExists),
+		UpdateContext: resourceVLANUpdate,
+		DeleteContext: resourceVLANDelete,
 
 		Schema: map[string]*schema.Schema{
 			vlanSchemaTag: &schema.Schema{
-				Type:     schema.TypeInt,
-				Required: true,
-				ForceNew: true,
+				Type:         schema.TypeInt,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateVLANTag,
 			},
 
 			vlanSchemaPIF: &schema.Schema{
-				Type:     schema.TypeString,
-				Required: true,
-				ForceNew: true,
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateUUID,
 			},
 
 			vlanSchemaNetwork: &schema.Schema{
-				ForceNew: true,
-				Type:     schema.TypeString,
-				Required: true,
+				ForceNew:     true,
+				Type:         schema.TypeString,
+				Required:     true,
+				ValidateFunc: validateUUID,
 			},
 
 			vlanSchemaOtherConfig: &schema.Schema{
 				Type:     schema.TypeMap,
 				Optional: true,
 			},
+
+			vlanSchemaUntaggedPIF: &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			vlanSchemaNetworkBridge: &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			vlanSchemaNetworkRef: &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
 		},
 	}
 }
 
-func resourceVLANCreate(d *schema.ResourceData, m interface{}) error {
+func resourceVLANCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	c := m.(*Connection)
 
 	pif := PIFDescriptor{
@@ -77,7 +100,7 @@ func resourceVLANCreate(d *schema.ResourceData, m interface{}) error {
 	}
 
 	if err := pif.Load(c); err != nil {
-		return err
+		return diag.FromErr(referenceError(c, "PIF", pif.UUID, err))
 	}
 
 	network := NetworkDescriptor{
@@ -85,7 +108,7 @@ func resourceVLANCreate(d *schema.ResourceData, m interface{}) error {
 	}
 
 	if err := network.Load(c); err != nil {
-		return err
+		return diag.FromErr(referenceError(c, "network", network.UUID, err))
 	}
 
 	tag := d.Get(vlanSchemaTag).(int)
@@ -97,28 +120,28 @@ func resourceVLANCreate(d *schema.ResourceData, m interface{}) error {
 		}
 
 		if err := vlan.Query(c); err != nil {
-			return err
+			return diag.FromErr(err)
 		}
 		log.Println("UUID is ", vlan.UUID)
 		d.SetId(vlan.UUID)
 
 		if _otherConfig, ok := d.GetOk(vlanSchemaOtherConfig); ok {
-			otherConfig := _otherConfig.(map[string]string)
+			otherConfig := _otherConfig.(map[string]interface{})
 			for k, v := range otherConfig {
-				if err := c.client.VLAN.AddToOtherConfig(c.session, vlan.VLANRef, k, v); err != nil {
-					return err
+				if err := c.client.VLAN.AddToOtherConfig(c.session, vlan.VLANRef, k, v.(string)); err != nil {
+					return diag.FromErr(err)
 				}
 			}
 		}
 	} else {
 		log.Println("VLAN not created!")
-		return err
+		return diag.FromErr(err)
 	}
 
-	return nil
+	return resourceVLANRead(ctx, d, m)
 }
 
-func resourceVLANRead(d *schema.ResourceData, m interface{}) error {
+func resourceVLANRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	c := m.(*Connection)
 
 	vlan := &VLANDescriptor{
@@ -126,25 +149,41 @@ func resourceVLANRead(d *schema.ResourceData, m interface{}) error {
 	}
 
 	if err := vlan.Load(c); err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	d.SetId(vlan.UUID)
 	if err := d.Set(vlanSchemaTag, vlan.Tag); err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	if err := d.Set(vlanSchemaOtherConfig, vlan.OtherConfig); err != nil {
-		return err
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vlanSchemaPIF, vlan.TaggedPIF.UUID); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vlanSchemaUntaggedPIF, vlan.UntaggedPIF.UUID); err != nil {
+		return diag.FromErr(err)
 	}
 
-	if err := d.Set(vlanSchemaPIF, vlan.UntaggedPIF); err != nil {
-		return err
+	if err := d.Set(vlanSchemaNetwork, vlan.UntaggedPIF.Network.UUID); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vlanSchemaNetworkBridge, vlan.UntaggedPIF.Network.Bridge); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vlanSchemaNetworkRef, string(vlan.UntaggedPIF.Network.NetworkRef)); err != nil {
+		return diag.FromErr(err)
 	}
 
 	return nil
 }
-func resourceVLANUpdate(d *schema.ResourceData, m interface{}) error {
+func resourceVLANUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	c := m.(*Connection)
 
 	vlan := &VLANDescriptor{
@@ -152,7 +191,7 @@ func resourceVLANUpdate(d *schema.ResourceData, m interface{}) error {
 	}
 
 	if err := vlan.Load(c); err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	if d.HasChange(vlanSchemaOtherConfig) {
@@ -164,15 +203,13 @@ func resourceVLANUpdate(d *schema.ResourceData, m interface{}) error {
 		}
 
 		if err := c.client.VLAN.SetOtherConfig(c.session, vlan.VLANRef, otherConfig); err != nil {
-			return err
+			return diag.FromErr(err)
 		}
-
-		d.SetPartial(vlanSchemaOtherConfig)
 	}
 
 	return nil
 }
-func resourceVLANDelete(d *schema.ResourceData, m interface{}) error {
+func resourceVLANDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	c := m.(*Connection)
 
 	vlan := &VLANDescriptor{
@@ -180,11 +217,11 @@ func resourceVLANDelete(d *schema.ResourceData, m interface{}) error {
 	}
 
 	if err := vlan.Load(c); err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	if err := c.client.VLAN.Destroy(c.session, vlan.VLANRef); err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	return nil
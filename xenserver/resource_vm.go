@@ -20,16 +20,24 @@
 package xenserver
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	xenapi "github.com/terra-farm/go-xen-api-client"
 )
 
 const (
 	vmSchemaNameLabel                 = "name_label"
+	vmSchemaDescription               = "description"
 	vmSchemaBaseTemplateName          = "base_template_name"
 	vmSchemaStaticMemoryMin           = "static_mem_min"
 	vmSchemaStaticMemoryMax           = "static_mem_max"
@@ -46,15 +54,64 @@ const (
 	vmSchemaCoresPerSocket            = "cores_per_socket"
 	vmSchemaXenstoreData              = "xenstore_data"
 	vmSchemaOtherConfig               = "other_config"
+	vmSchemaDiskSRMap                 = "disk_sr_map"
+	vmSchemaLifecycleHooks            = "lifecycle_hook"
+	vmSchemaConsoleURL                = "console_url"
+	vmSchemaConsoleProtocol           = "console_protocol"
+	vmSchemaRef                       = "ref"
+	vmSchemaAllowedOperations         = "allowed_operations"
+	vmSchemaDiskPaths                 = "disk_paths"
+	vmSchemaSnapshots                 = "snapshots"
+	vmSchemaVcpusMax                  = "vcpus_max"
+	vmSchemaHotAdd                    = "hot_add"
+	vmSchemaPlatform                  = "platform"
+	vmSchemaSourceSnapshotUUID        = "source_snapshot_uuid"
+	vmSchemaFullCopy                  = "full_copy"
+	vmSchemaIsATemplate               = "is_a_template"
+	vmSchemaCPU                       = "cpu"
+	vmSchemaCPUSockets                = "sockets"
+	vmSchemaCPUCoresPerSocket         = "cores_per_socket"
+	vmSchemaVcpuParams                = "vcpu_params"
+	vmSchemaGroup                     = "group"
+	vmSchemaHARestartPriority         = "ha_restart_priority"
+	vmSchemaHAAlwaysRun               = "ha_always_run"
+	vmSchemaOrder                     = "order"
+	vmSchemaStartDelay                = "start_delay"
+	vmSchemaShutdownDelay             = "shutdown_delay"
+	vmSchemaShutdownTimeout           = "shutdown_timeout"
+	vmSchemaForceShutdown             = "force_shutdown"
+	vmSchemaKeepDisksOnDestroy        = "keep_disks_on_destroy"
+	vmSchemaWindowsCustomization      = "windows_customization"
+	vmSchemaConfigDrive               = "config_drive"
+	vmSchemaIgnition                  = "ignition"
+	vmSchemaIgnitionSRUUID            = "ignition_sr_uuid"
+	vmSchemaMACAddresses              = "mac_addresses"
+
+	vmHARestartPriorityRestart    = "restart"
+	vmHARestartPriorityBestEffort = "best-effort"
 )
 
 func resourceVM() *schema.Resource {
 	return &schema.Resource{
-		Create: resourceVMCreate,
-		Read:   resourceVMRead,
-		Update: resourceVMUpdate,
-		Delete: resourceVMDelete,
-		Exists: resourceVMExists,
+		CreateContext: resourceVMCreate,
+		ReadContext:   forgetfulRead(resourceVMRead, resourceVMExists),
+		UpdateContext: resourceVMUpdate,
+		DeleteContext: resourceVMDelete,
+
+		CustomizeDiff: customdiff.All(
+			resourceVMCustomizeDiff,
+			customizeVMDiskSRMapDiff,
+			customizeVMDiskSizeDiff,
+			customizeVMDiskSourceDiff,
+			customizeVMPreserveDataDisksDiff,
+			customizeVMPlatformFlagsDiff,
+		),
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Update: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(20 * time.Minute),
+		},
 
 		Schema: map[string]*schema.Schema{
 			vmSchemaNameLabel: &schema.Schema{
@@ -62,9 +119,36 @@ func resourceVM() *schema.Resource {
 				Required: true,
 			},
 
-			vmSchemaBaseTemplateName: &schema.Schema{
+			vmSchemaDescription: &schema.Schema{
 				Type:     schema.TypeString,
-				Required: true,
+				Optional: true,
+			},
+
+			vmSchemaBaseTemplateName: &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ExactlyOneOf: []string{vmSchemaBaseTemplateName, vmSchemaSourceSnapshotUUID},
+			},
+
+			vmSchemaSourceSnapshotUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				ExactlyOneOf: []string{vmSchemaBaseTemplateName, vmSchemaSourceSnapshotUUID},
+				ValidateFunc: validateUUID,
+			},
+
+			vmSchemaFullCopy: &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				ForceNew: true,
+				Default:  false,
+			},
+
+			vmSchemaIsATemplate: &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
 			},
 
 			vmSchemaXenstoreData: &schema.Schema{
@@ -75,23 +159,27 @@ func resourceVM() *schema.Resource {
 			},
 
 			vmSchemaStaticMemoryMin: &schema.Schema{
-				Type:     schema.TypeInt,
-				Required: true,
+				Type:         schema.TypeInt,
+				Required:     true,
+				ValidateFunc: validation.IntAtLeast(1),
 			},
 
 			vmSchemaStaticMemoryMax: &schema.Schema{
-				Type:     schema.TypeInt,
-				Required: true,
+				Type:         schema.TypeInt,
+				Required:     true,
+				ValidateFunc: validation.IntAtLeast(1),
 			},
 
 			vmSchemaDynamicMemoryMin: &schema.Schema{
-				Type:     schema.TypeInt,
-				Required: true,
+				Type:         schema.TypeInt,
+				Required:     true,
+				ValidateFunc: validation.IntAtLeast(1),
 			},
 
 			vmSchemaDynamicMemoryMax: &schema.Schema{
-				Type:     schema.TypeInt,
-				Required: true,
+				Type:         schema.TypeInt,
+				Required:     true,
+				ValidateFunc: validation.IntAtLeast(1),
 			},
 
 			vmSchemaBootOrder: &schema.Schema{
@@ -141,16 +229,361 @@ func resourceVM() *schema.Resource {
 				Required: true,
 			},
 
-			vmSchemaCoresPerSocket: &schema.Schema{
+			vmSchemaVcpusMax: &schema.Schema{
 				Type:     schema.TypeInt,
 				Optional: true,
 				Computed: true,
 			},
 
+			vmSchemaHotAdd: &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+
+			vmSchemaCoresPerSocket: &schema.Schema{
+				Type:          schema.TypeInt,
+				Optional:      true,
+				Computed:      true,
+				ConflictsWith: []string{vmSchemaCPU},
+			},
+
+			vmSchemaCPU: &schema.Schema{
+				Type:          schema.TypeList,
+				Optional:      true,
+				MaxItems:      1,
+				ConflictsWith: []string{vmSchemaCoresPerSocket},
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						vmSchemaCPUSockets: &schema.Schema{
+							Type:         schema.TypeInt,
+							Optional:     true,
+							ValidateFunc: validation.IntAtLeast(1),
+						},
+						vmSchemaCPUCoresPerSocket: &schema.Schema{
+							Type:         schema.TypeInt,
+							Optional:     true,
+							ValidateFunc: validation.IntAtLeast(1),
+						},
+					},
+				},
+			},
+
+			vmSchemaVcpuParams: &schema.Schema{
+				Type:         schema.TypeMap,
+				Optional:     true,
+				Elem:         &schema.Schema{Type: schema.TypeString},
+				ValidateFunc: validateVCPUParams,
+			},
+
 			vmSchemaOtherConfig: &schema.Schema{
 				Type:     schema.TypeMap,
 				Optional: true,
 			},
+
+			xenCenterSchemaFolder:       xenCenterFolderSchema(),
+			xenCenterSchemaCustomFields: xenCenterCustomFieldsSchema(),
+
+			vmSchemaAffinityHostUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validateOptionalUUID,
+			},
+
+			vmSchemaSuspendSRUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateOptionalUUID,
+			},
+
+			vmSchemaPlacementStrategy: &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validation.StringInSlice([]string{vmPlacementStrict, vmPlacementBestEffort}, false),
+			},
+
+			vmSchemaMemoryOvercommitRatio: &schema.Schema{
+				Type:         schema.TypeFloat,
+				Optional:     true,
+				Default:      1.0,
+				ValidateFunc: validation.FloatAtLeast(0.1),
+			},
+
+			vmSchemaPCIDevices: &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validatePCIAddress,
+				},
+			},
+
+			// Only read back when declared, as VM groups are not supported by
+			// older pools
+			vmSchemaGroup: &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+
+			vmSchemaHARestartPriority: &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+				Default:  "",
+				ValidateFunc: validation.StringInSlice([]string{
+					"",
+					vmHARestartPriorityRestart,
+					vmHARestartPriorityBestEffort,
+				}, false),
+			},
+
+			// Derived from the restart priority by newer XenServer versions
+			vmSchemaHAAlwaysRun: &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Computed: true,
+			},
+
+			vmSchemaOrder: &schema.Schema{
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      0,
+				ValidateFunc: validation.IntAtLeast(0),
+			},
+
+			vmSchemaStartDelay: &schema.Schema{
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      0,
+				ValidateFunc: validation.IntAtLeast(0),
+			},
+
+			vmSchemaShutdownDelay: &schema.Schema{
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      0,
+				ValidateFunc: validation.IntAtLeast(0),
+			},
+
+			// Only used when the provider shuts the VM down, so they are not
+			// read back
+			vmSchemaShutdownTimeout: &schema.Schema{
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      60,
+				ValidateFunc: validation.IntAtLeast(0),
+			},
+
+			vmSchemaForceShutdown: &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  true,
+			},
+
+			// Detach all disks on destroy instead of destroying the ones which
+			// come from the template, see keep_on_destroy for single disks
+			vmSchemaKeepDisksOnDestroy: &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+
+			// Start the VM where XenServer places it, even if Workload
+			// Balancing is enabled for the pool
+			vmSchemaIgnoreWLB: &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+
+			// Carry the data disks from the template over to the VM which
+			// replaces this one
+			vmSchemaPreserveDataDisks: &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+
+			// Identifies the preserved data disks among the VMs replacing
+			// each other
+			vmSchemaPreserveID: &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+
+			vmSchemaPlatform: &schema.Schema{
+				Type:     schema.TypeMap,
+				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+
+			vmSchemaViridian: &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Computed: true,
+			},
+
+			vmSchemaNX: &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Computed: true,
+			},
+
+			vmSchemaPAE: &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Computed: true,
+			},
+
+			vmSchemaACPI: &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Computed: true,
+			},
+
+			vmSchemaAPIC: &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Computed: true,
+			},
+
+			vmSchemaTimeOffset: &schema.Schema{
+				Type:     schema.TypeInt,
+				Optional: true,
+				Computed: true,
+			},
+
+			vmSchemaDeviceModel: &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validation.StringInSlice([]string{"qemu-trad", "qemu-upstream-compat", "qemu-upstream"}, false),
+			},
+
+			vmSchemaVGA: &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validation.StringInSlice([]string{"std", "cirrus"}, false),
+			},
+
+			// In MiB
+			vmSchemaVideoRAM: &schema.Schema{
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validation.IntBetween(1, 16),
+			},
+
+			vmSchemaDiskSRMap: &schema.Schema{
+				Type:     schema.TypeMap,
+				Optional: true,
+				ForceNew: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+
+			// Applied on the first boot only
+			vmSchemaWindowsCustomization: &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				ForceNew: true,
+				MaxItems: 1,
+				Elem:     resourceWindowsCustomization(),
+			},
+
+			// SMBIOS data, which can only be set before the first boot
+			vmSchemaBIOSStrings: &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				ForceNew: true,
+				MaxItems: 1,
+				Elem:     resourceVMBIOSStrings(),
+			},
+
+			vmSchemaInstall: &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				MaxItems: 1,
+				Elem:     resourceVMInstall(),
+			},
+
+			// Only taken into account when the VM is created
+			vmSchemaWaitFor: &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				MaxItems: 1,
+				Elem:     resourceVMWaitFor(),
+			},
+
+			vmSchemaConfigDrive: &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				MaxItems: 1,
+				Elem:     resourceConfigDrive(),
+			},
+
+			// Provided on a config drive of its own, which guests may confuse with
+			// the one of config_drive
+			vmSchemaIgnition: &schema.Schema{
+				Type:          schema.TypeString,
+				Optional:      true,
+				ValidateFunc:  validation.StringIsJSON,
+				ConflictsWith: []string{vmSchemaConfigDrive},
+			},
+
+			vmSchemaIgnitionSRUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateUUID,
+			},
+
+			vmSchemaLifecycleHooks: &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem:     resourceLifecycleHook(),
+			},
+
+			vmSchemaConsoleURL: &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			vmSchemaConsoleProtocol: &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			vmSchemaRef: &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			// Operations XenServer currently allows on the VM, e.g. to check
+			// that it can be migrated before doing so
+			vmSchemaAllowedOperations: &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+
+			vmSchemaMACAddresses: &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+
+			vmSchemaDiskPaths: &schema.Schema{
+				Type:     schema.TypeMap,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+
+			// UUIDs of the snapshots of the VM, the newest first
+			vmSchemaSnapshots: &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
 		},
 	}
 }
@@ -169,37 +602,95 @@ func filterVMTemplates(c *Connection, vms []xenapi.VMRef) ([]xenapi.VMRef, error
 	return templates, nil
 }
 
-func resourceVMCreate(d *schema.ResourceData, m interface{}) error {
-	c := m.(*Connection)
-	d.Partial(true)
-
-	dBaseTemplateName := d.Get(vmSchemaBaseTemplateName).(string)
-
-	xenBaseTemplates, err := c.client.VM.GetByNameLabel(c.session, dBaseTemplateName)
+func findBaseTemplate(c *Connection, name string) (xenapi.VMRef, error) {
+	xenBaseTemplates, err := c.client.VM.GetByNameLabel(c.session, name)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	xenBaseTemplates, err = filterVMTemplates(c, xenBaseTemplates)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	if len(xenBaseTemplates) == 0 {
-		return fmt.Errorf("no VM template with label %q has been found", dBaseTemplateName)
+		return "", fmt.Errorf("no VM template with label %q has been found", name)
 	}
 
 	if len(xenBaseTemplates) > 1 {
-		return fmt.Errorf("more than one VM template with label %q has been found", dBaseTemplateName)
+		return "", fmt.Errorf("more than one VM template with label %q has been found", name)
+	}
+
+	return xenBaseTemplates[0], nil
+}
+
+func findSourceSnapshot(c *Connection, uuid string) (xenapi.VMRef, error) {
+	snapshot, err := c.client.VM.GetByUUID(c.session, uuid)
+	if err != nil {
+		return "", referenceError(c, "snapshot", uuid, err)
 	}
 
-	xenBaseTemplate := xenBaseTemplates[0]
+	isASnapshot, err := c.client.VM.GetIsASnapshot(c.session, snapshot)
+	if err != nil {
+		return "", err
+	}
+
+	if !isASnapshot {
+		return "", fmt.Errorf("VM %s is not a snapshot", uuid)
+	}
+
+	return snapshot, nil
+}
+
+func resourceVMCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c, cancel, err := m.(*Connection).WithTimeout(d.Timeout(schema.TimeoutCreate))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer cancel()
+	d.Partial(true)
+
+	dBaseTemplateName := d.Get(vmSchemaBaseTemplateName).(string)
+	dSourceSnapshotUUID := d.Get(vmSchemaSourceSnapshotUUID).(string)
+
+	var xenSource xenapi.VMRef
+	if dSourceSnapshotUUID != "" {
+		if xenSource, err = findSourceSnapshot(c, dSourceSnapshotUUID); err != nil {
+			return diag.FromErr(err)
+		}
+	} else {
+		if xenSource, err = findBaseTemplate(c, dBaseTemplateName); err != nil {
+			return diag.FromErr(err)
+		}
+	}
 
 	dNameLabel := d.Get(vmSchemaNameLabel).(string)
 
-	xenVM, err := c.client.VM.Clone(c.session, xenBaseTemplate, dNameLabel)
+	var xenVM xenapi.VMRef
+	if d.Get(vmSchemaFullCopy).(bool) {
+		// A full copy does not share its disks with the source, the disks stay in
+		// the SRs of the source disks. Copying the disks takes a while, so the
+		// progress of the copy is reported.
+		log.Println("[DEBUG] Copying VM source")
+		var task xenapi.TaskRef
+		if task, err = callAsync(c, "VM.copy", string(xenSource), dNameLabel, "OpaqueRef:NULL"); err == nil {
+			var result string
+			result, err = waitForTask(c, task)
+			xenVM = xenapi.VMRef(result)
+		}
+	} else {
+		// Cloning is fast on SRs supporting copy on write, but falls back to
+		// copying the disks on others
+		log.Println("[DEBUG] Cloning VM source")
+		var task xenapi.TaskRef
+		if task, err = callAsync(c, "VM.clone", string(xenSource), dNameLabel); err == nil {
+			var result string
+			result, err = waitForTask(c, task)
+			xenVM = xenapi.VMRef(result)
+		}
+	}
 	if err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	vm := &VMDescriptor{
@@ -207,22 +698,44 @@ func resourceVMCreate(d *schema.ResourceData, m interface{}) error {
 	}
 
 	if err = vm.Query(c); err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
-	d.SetPartial(vmSchemaNameLabel)
 	d.SetId(vm.UUID)
 
+	// A clone of a checkpoint is suspended with the memory image of the source
+	// VM, which must not be resumed next to the still running source. Discard
+	// the memory image so the new VM boots from its disks.
+	if vm.PowerState == xenapi.VMPowerStateSuspended {
+		log.Printf("[DEBUG] Discarding memory image of VM %s cloned from a checkpoint", vm.UUID)
+		if err = runPowerTask(c, "VM.hard_shutdown", string(vm.VMRef)); err != nil {
+			return diag.FromErr(err)
+		}
+		vm.PowerState = xenapi.VMPowerStateHalted
+	}
+
+	// Clones and copies keep the description of their source
+	if err := c.client.VM.SetNameDescription(c.session, vm.VMRef, d.Get(vmSchemaDescription).(string)); err != nil {
+		return diag.FromErr(err)
+	}
+
 	otherConfig := vm.OtherConfig
 	for k, v := range d.Get(vmSchemaOtherConfig).(map[string]interface{}) {
 		otherConfig[k] = v.(string)
 	}
+	for k, v := range xenCenterOtherConfig(d.Get(xenCenterSchemaFolder), d.Get(xenCenterSchemaCustomFields)) {
+		otherConfig[k] = v.(string)
+	}
 
-	// Reset base template name
-	otherConfig["base_template_name"] = dBaseTemplateName
+	// Reset base template name, a snapshot carries the one of its VM
+	if dSourceSnapshotUUID != "" {
+		delete(otherConfig, "base_template_name")
+	} else {
+		otherConfig["base_template_name"] = dBaseTemplateName
+	}
 
 	if err = c.client.VM.SetOtherConfig(c.session, vm.VMRef, otherConfig); err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	// Memory configuration
@@ -253,43 +766,88 @@ func resourceVMCreate(d *schema.ResourceData, m interface{}) error {
 
 	if len(updatedFields) > 0 {
 		if err = vm.UpdateMemory(c); err != nil {
-			return err
-		}
-		for _, f := range updatedFields {
-			d.SetPartial(f)
+			return diag.FromErr(err)
 		}
-		updatedFields = make([]string, 0, 5)
 	}
 
 	// Set VCPUs number
 	vm.VCPUCount = d.Get(vmSchemaVcpus).(int)
+	vm.VCPUMax = d.Get(vmSchemaVcpusMax).(int)
 	if err = vm.UpdateVCPUs(c); err != nil {
-		return err
-	} else {
-		d.SetPartial(vmSchemaVcpus)
+		return diag.FromErr(err)
 	}
 
 	dXenstoreDataRaw, ok := d.GetOk(vmSchemaXenstoreData)
 	if ok && dXenstoreDataRaw != nil {
-		vm.XenstoreData = make(map[string]string)
-		for key, value := range dXenstoreDataRaw.(map[string]interface{}) {
-			vm.XenstoreData[key] = value.(string)
-		}
+		vm.XenstoreData = mergeDeclaredKeys(vm.XenstoreData, nil, dXenstoreDataRaw.(map[string]interface{}))
 
 		err = c.client.VM.SetXenstoreData(c.session, vm.VMRef, vm.XenstoreData)
 		if err != nil {
-			return err
-		} else {
-			d.SetPartial(vmSchemaXenstoreData)
+			return diag.FromErr(err)
 		}
 	}
 
 	if vm.XenstoreData, err = c.client.VM.GetXenstoreData(c.session, vm.VMRef); err != nil {
-		return err
+		return diag.FromErr(err)
 	}
-	err = d.Set(vmSchemaXenstoreData, vm.XenstoreData)
+	err = d.Set(vmSchemaXenstoreData, filterDeclaredKeys(vm.XenstoreData, d.Get(vmSchemaXenstoreData).(map[string]interface{})))
 	if err != nil {
-		return err
+		return diag.FromErr(err)
+	}
+
+	// All settings derived from the template are overridden before any device is
+	// created and before the first start, so that they are in effect on first boot
+	if _order, ok := d.GetOk(vmSchemaBootOrder); ok {
+		order := _order.(string)
+		vm.HVMBootParameters["order"] = order
+	}
+	installBootOrder := vm.HVMBootParameters["order"]
+	if vmInstallPending(d) {
+		vm.HVMBootParameters["order"] = vmInstallBootOrder
+	}
+
+	if err = c.client.VM.SetHVMBootParams(c.session, vm.VMRef, vm.HVMBootParameters); err != nil {
+		return diag.FromErr(err)
+	}
+
+	for k, v := range d.Get(vmSchemaPlatform).(map[string]interface{}) {
+		vm.Platform[k] = v.(string)
+	}
+
+	applyPlatformFlags(d, vm, false)
+
+	if coresPerSocket, err := vmCoresPerSocket(d); err != nil {
+		return diag.FromErr(err)
+	} else if coresPerSocket > 0 {
+		if vm.VCPUCount%coresPerSocket != 0 {
+			return diag.FromErr(fmt.Errorf("%d cores could not fit to %d cores-per-socket topology", vm.VCPUCount, coresPerSocket))
+		}
+
+		vm.Platform["cores-per-socket"] = strconv.Itoa(coresPerSocket)
+	} else {
+		_coresPerSocket := vm.Platform["cores-per-socket"]
+		// If empty - set one core per socket
+		if _coresPerSocket == "" {
+			_coresPerSocket = "1"
+		}
+
+		if coresPerSocket, err = strconv.Atoi(_coresPerSocket); err == nil {
+			if err = d.Set(vmSchemaCoresPerSocket, coresPerSocket); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+	}
+
+	if vcpuParams, ok := d.GetOk(vmSchemaVcpuParams); ok {
+		vm.VCPUParams = mergeDeclaredKeys(vm.VCPUParams, nil, vcpuParams.(map[string]interface{}))
+
+		if err = c.client.VM.SetVCPUsParams(c.session, vm.VMRef, vm.VCPUParams); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if err = c.client.VM.SetPlatform(c.session, vm.VMRef, vm.Platform); err != nil {
+		return diag.FromErr(err)
 	}
 
 	log.Println("[DEBUG] VM Power State: ", vm.PowerState)
@@ -297,111 +855,205 @@ func resourceVMCreate(d *schema.ResourceData, m interface{}) error {
 	var vifs []*VIFDescriptor
 
 	if vifs, err = readVIFsFromSchema(c, d.Get(vmSchemaNetworkInterfaces).(*schema.Set).List()); err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	for _, vif := range vifs {
 		vif.VM = vm
 		if vif, err = createVIF(c, vif); err != nil {
 			log.Println("[ERROR] ", err)
-			return err
+			return diag.FromErr(err)
 		}
 	}
-	d.SetPartial(vmSchemaNetworkInterfaces)
+
+	// The autogenerated MAC addresses are known from here on
+	if err = setSchemaVIFs(c, vm, d); err != nil {
+		return diag.FromErr(err)
+	}
 
 	log.Println("[DEBUG] Creating CDs")
 	if err = createVBDs(c, d.Get(vmSchemaCdRom).(*schema.Set).List(), xenapi.VbdTypeCD, vm); err != nil {
 		log.Println("[ERROR] ", err)
-		return err
-	} else {
-		updatedFields = append(updatedFields, vmSchemaCdRom)
+		return diag.FromErr(err)
+	}
+
+	if d.Get(vmSchemaPreserveDataDisks).(bool) {
+		if err = reattachDataDisks(c, vm, d.Get(vmSchemaPreserveID).(string)); err != nil {
+			return diag.FromErr(err)
+		}
 	}
 
+	// Kept as declared, the state is replaced by the disks read back below
+	hardDrives := d.Get(vmSchemaHardDrive).(*schema.Set).List()
+
 	log.Println("[DEBUG] Creating HDDs")
-	if err = createVBDs(c, d.Get(vmSchemaHardDrive).(*schema.Set).List(), xenapi.VbdTypeDisk, vm); err != nil {
+	if err = createVBDs(c, hardDrives, xenapi.VbdTypeDisk, vm); err != nil {
 		log.Println("[ERROR] ", err)
-		return err
-	} else {
-		updatedFields = append(updatedFields, vmSchemaHardDrive)
+		return diag.FromErr(err)
 	}
 
-	if setSchemaVBDs(c, vm, d) != nil {
-		log.Println("[ERROR] ", err)
-		return err
-	} else {
-		for _, f := range updatedFields {
-			d.SetPartial(f)
+	// The disks from the template are relabeled and moved as declared
+	if err = reconcileTemplateDisks(c, vm, hardDrives); err != nil {
+		return diag.FromErr(err)
+	}
+
+	// Attached after the disks, which take the first devices
+	if vmInstallPending(d) {
+		if err = attachInstallMedia(c, vm, d, installBootOrder); err != nil {
+			return diag.FromErr(err)
 		}
-		updatedFields = make([]string, 0, 5)
 	}
 
-	if _order, ok := d.GetOk(vmSchemaBootOrder); ok {
-		order := _order.(string)
-		vm.HVMBootParameters["order"] = order
+	if err := setSchemaVBDs(c, vm, d); err != nil {
+		log.Println("[ERROR] ", err)
+		return diag.FromErr(err)
 	}
 
-	if err = c.client.VM.SetHVMBootParams(c.session, vm.VMRef, vm.HVMBootParameters); err != nil {
-		return err
-	} else {
-		d.SetPartial(vmSchemaBootOrder)
+	log.Println("[DEBUG] Provisioning VM")
+	err = c.client.VM.Provision(c.session, xenVM)
+	if err != nil {
+		return diag.FromErr(err)
 	}
 
-	if _coresPerSocket, ok := d.GetOk(vmSchemaCoresPerSocket); ok {
-		coresPerSocket := _coresPerSocket.(int)
+	if diskSRMap, ok := d.GetOk(vmSchemaDiskSRMap); ok {
+		log.Println("[DEBUG] Relocating disks")
+		if err = relocateVBDs(c, vm, diskSRMap.(map[string]interface{}), hardDrives); err != nil {
+			return diag.FromErr(err)
+		}
+	}
 
-		if vm.VCPUCount%coresPerSocket != 0 {
-			return fmt.Errorf("%d cores could not fit to %d cores-per-socket topology", vm.VCPUCount, coresPerSocket)
+	// reset template flag
+	if vm.IsATemplate {
+		if err = c.client.VM.SetIsATemplate(c.session, vm.VMRef, false); err != nil {
+			return diag.FromErr(err)
 		}
+	}
 
-		vm.Platform["cores-per-socket"] = strconv.Itoa(coresPerSocket)
-	} else {
-		_coresPerSocket = vm.Platform["cores-per-socket"]
-		// If empty - set one core per socket
-		if _coresPerSocket == "" {
-			_coresPerSocket = "1"
+	if err = verifyVMOverrides(c, vm); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err = setVMHA(c, vm, d); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err = setVMPlacement(c, vm, d); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if biosStrings := d.Get(vmSchemaBIOSStrings).([]interface{}); len(biosStrings) > 0 && biosStrings[0] != nil {
+		if err = applyBIOSStrings(c, vm, biosStrings[0].(map[string]interface{})); err != nil {
+			return diag.FromErr(err)
 		}
+	}
 
-		var coresPerSocket int
-		if coresPerSocket, err = strconv.Atoi(_coresPerSocket.(string)); err != nil {
-			if err = d.Set(vmSchemaCoresPerSocket, coresPerSocket); err != nil {
-				return err
-			}
+	if customization := d.Get(vmSchemaWindowsCustomization).([]interface{}); len(customization) > 0 {
+		if err = applyWindowsCustomization(c, vm, customization[0].(map[string]interface{})); err != nil {
+			return diag.FromErr(err)
 		}
 	}
 
-	if err = c.client.VM.SetPlatform(c.session, vm.VMRef, vm.Platform); err != nil {
-		return err
-	} else {
-		d.SetPartial(vmSchemaCoresPerSocket)
+	if configDrive := d.Get(vmSchemaConfigDrive).([]interface{}); len(configDrive) > 0 {
+		if err = applyConfigDrive(c, vm, configDrive[0].(map[string]interface{})); err != nil {
+			return diag.FromErr(err)
+		}
 	}
 
-	log.Println("[DEBUG] Provisioning VM")
-	err = c.client.VM.Provision(c.session, xenVM)
-	if err != nil {
-		return err
+	if ignition := d.Get(vmSchemaIgnition).(string); ignition != "" {
+		if err = applyIgnition(c, vm, ignition, d.Get(vmSchemaIgnitionSRUUID).(string)); err != nil {
+			return diag.FromErr(err)
+		}
 	}
 
-	// reset template flag
-	if vm.IsATemplate {
-		if err = c.client.VM.SetIsATemplate(c.session, vm.VMRef, false); err != nil {
-			return err
+	// The placement of the group applies when the VM is started
+	if group := d.Get(vmSchemaGroup).(string); group != "" {
+		if err = setVMGroup(c, vm.VMRef, group); err != nil {
+			return diag.FromErr(err)
 		}
 	}
 
 	d.Partial(false)
 
-	// TODO: Seems like this is more about the state of the resource than the creation of the resource?
-	log.Println("[DEBUG] Starting VM")
-	err = c.client.VM.Start(c.session, xenVM, false, false)
+	// A template is never started, it is converted right away
+	if d.Get(vmSchemaIsATemplate).(bool) {
+		log.Println("[DEBUG] Converting VM to template")
+		err = c.client.VM.SetIsATemplate(c.session, vm.VMRef, true)
+	} else {
+		// The memory of the pool might have been claimed since the plan
+		err = checkVMMemoryPlacement(c, d.Get(vmSchemaPlacementStrategy).(string), d.Get(vmSchemaMemoryOvercommitRatio).(float64),
+			d.Get(vmSchemaAffinityHostUUID).(string), vm.DynamicMemory.Min, vm.DynamicMemory.Max)
+		if err == nil {
+			// TODO: Seems like this is more about the state of the resource than the creation of the resource?
+			err = startVM(c, vm, d.Get(vmSchemaIgnoreWLB).(bool), d.Get(vmSchemaAffinityHostUUID).(string) != "")
+		}
+		if err == nil {
+			err = waitForVM(c, vm, d)
+		}
+	}
 	if err != nil {
-		return err
+		return diag.FromErr(err)
+	}
+
+	if err = runLifecycleHooks(c, d.Get(vmSchemaLifecycleHooks).([]interface{}), lifecycleHookEventPostCreate, xenapi.ClsVM, vm.UUID); err != nil {
+		return diag.FromErr(err)
 	}
 	log.Println("[DEBUG] Done")
 
 	return nil
 }
 
-func resourceVMRead(d *schema.ResourceData, m interface{}) error {
+// verifyVMOverrides checks that the settings applied to a VM cloned from a
+// template are still in place after provisioning, before the VM is started for
+// the first time.
+func verifyVMOverrides(c *Connection, vm *VMDescriptor) error {
+	actual := &VMDescriptor{
+		VMRef: vm.VMRef,
+	}
+
+	if err := actual.Query(c); err != nil {
+		return err
+	}
+
+	if actual.StaticMemory != vm.StaticMemory || actual.DynamicMemory != vm.DynamicMemory {
+		return fmt.Errorf("memory settings of VM %s have been reset by provisioning", vm.UUID)
+	}
+
+	if actual.VCPUCount != vm.VCPUCount {
+		return fmt.Errorf("VCPU count of VM %s has been reset by provisioning", vm.UUID)
+	}
+
+	for k, v := range vm.Platform {
+		if actual.Platform[k] != v {
+			return fmt.Errorf("platform setting %q of VM %s has been reset by provisioning", k, vm.UUID)
+		}
+	}
+
+	for k, v := range vm.VCPUParams {
+		if actual.VCPUParams[k] != v {
+			return fmt.Errorf("VCPU parameter %q of VM %s has been reset by provisioning", k, vm.UUID)
+		}
+	}
+
+	for k, v := range vm.HVMBootParameters {
+		if actual.HVMBootParameters[k] != v {
+			return fmt.Errorf("HVM boot parameter %q of VM %s has been reset by provisioning", k, vm.UUID)
+		}
+	}
+
+	for k, v := range vm.OtherConfig {
+		// Provisioning consumes the disks key of templates
+		if k == "disks" {
+			continue
+		}
+		if actual.OtherConfig[k] != v {
+			return fmt.Errorf("other_config key %q of VM %s has been reset by provisioning", k, vm.UUID)
+		}
+	}
+
+	return nil
+}
+
+func resourceVMRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	c := m.(*Connection)
 
 	vm := &VMDescriptor{
@@ -415,52 +1067,249 @@ func resourceVMRead(d *schema.ResourceData, m interface{}) error {
 			}
 		}
 
-		return err
+		return diag.FromErr(err)
+	}
+
+	err := d.Set(vmSchemaNameLabel, vm.Name)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	err = d.Set(vmSchemaDescription, vm.Description)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	err = d.Set(vmSchemaRef, string(vm.VMRef))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vmSchemaAllowedOperations, vm.AllowedOperations); err != nil {
+		return diag.FromErr(err)
+	}
+
+	err = d.Set(vmSchemaIsATemplate, vm.IsATemplate)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vmSchemaHARestartPriority, vm.HARestartPriority); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vmSchemaHAAlwaysRun, vm.HAAlwaysRun); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vmSchemaOrder, vm.Order); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vmSchemaStartDelay, vm.StartDelay); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vmSchemaShutdownDelay, vm.ShutdownDelay); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if d.Get(vmSchemaGroup).(string) != "" {
+		group, err := getVMGroup(c, vm.VMRef)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		if err := d.Set(vmSchemaGroup, group); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	vmBaseTemplateName, ok := vm.OtherConfig["base_template_name"]
+	if ok {
+		err = d.Set(vmSchemaBaseTemplateName, vmBaseTemplateName)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	err = d.Set(vmSchemaXenstoreData, filterDeclaredKeys(vm.XenstoreData, d.Get(vmSchemaXenstoreData).(map[string]interface{})))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	err = d.Set(vmSchemaOtherConfig, filterDeclaredKeys(vm.OtherConfig, d.Get(vmSchemaOtherConfig).(map[string]interface{})))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := readXenCenterMetadata(d, vm.OtherConfig); err != nil {
+		return diag.FromErr(err)
+	}
+
+	affinity, err := readVMAffinity(c, vm)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	err = d.Set(vmSchemaAffinityHostUUID, affinity)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	suspendSR, err := srUUIDOf(c, vm.SuspendSR)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	err = d.Set(vmSchemaSuspendSRUUID, suspendSR)
+	if err != nil {
+		return diag.FromErr(err)
 	}
 
-	err := d.Set(vmSchemaNameLabel, vm.Name)
+	err = d.Set(vmSchemaPCIDevices, readVMPCIDevices(vm))
 	if err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
-	vmBaseTemplateName, ok := vm.OtherConfig["base_template_name"]
-	if ok {
-		err = d.Set(vmSchemaBaseTemplateName, vmBaseTemplateName)
-		if err != nil {
-			return err
-		}
+	snapshots, err := queryVMSnapshots(c, vm)
+	if err != nil {
+		return diag.FromErr(err)
 	}
 
-	err = d.Set(vmSchemaXenstoreData, vm.XenstoreData)
+	snapshotUUIDs := make([]string, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		snapshotUUIDs = append(snapshotUUIDs, snapshot.UUID)
+	}
+
+	err = d.Set(vmSchemaSnapshots, snapshotUUIDs)
 	if err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	err = d.Set(vmSchemaVcpus, vm.VCPUCount)
 	if err != nil {
-		return err
+		return diag.FromErr(err)
+	}
+
+	err = d.Set(vmSchemaVcpusMax, vm.VCPUMax)
+	if err != nil {
+		return diag.FromErr(err)
 	}
 
 	err = d.Set(vmSchemaStaticMemoryMax, vm.StaticMemory.Max)
 	if err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	err = d.Set(vmSchemaStaticMemoryMin, vm.StaticMemory.Min)
 	if err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	err = d.Set(vmSchemaDynamicMemoryMax, vm.DynamicMemory.Max)
 	if err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	err = d.Set(vmSchemaDynamicMemoryMin, vm.DynamicMemory.Min)
 	if err != nil {
-		return err
+		return diag.FromErr(err)
+	}
+
+	if err := setSchemaVIFs(c, vm, d); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := setSchemaVBDs(c, vm, d); err != nil {
+		log.Println("[ERROR] ", err)
+		return diag.FromErr(err)
+	}
+
+	log.Println("[DEBUG] Query boot order")
+	// The VM boots from the installation media until the install is finished
+	if order, ok := vm.HVMBootParameters["order"]; ok && !vmInstallPending(d) {
+		if err := d.Set(vmSchemaBootOrder, order); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	// The CD drive of the installation media of a running VM is left behind
+	// once the install is finished, the install shows up as not provisioned
+	// until the drive has been removed by an apply after the VM halted
+	if !vmInstallPending(d) && len(d.Get(vmSchemaInstall).([]interface{})) > 0 && vm.PowerState == xenapi.VMPowerStateHalted {
+		attached, err := installMediaAttached(c, vm)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		if attached {
+			install := d.Get(vmSchemaInstall).([]interface{})[0].(map[string]interface{})
+			install[installSchemaProvisioned] = false
+			if err := d.Set(vmSchemaInstall, []interface{}{install}); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+	}
+
+	// Only the keys which are declared are managed, the template sets many more
+	platform := make(map[string]string)
+	for k := range d.Get(vmSchemaPlatform).(map[string]interface{}) {
+		if v, ok := vm.Platform[k]; ok {
+			platform[k] = v
+		}
+	}
+	if err := d.Set(vmSchemaPlatform, platform); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := readPlatformFlags(d, vm); err != nil {
+		return diag.FromErr(err)
+	}
+
+	// Reported as 0 once the key has been removed, e.g. in XenCenter, so that a
+	// declared topology is restored
+	coresPerSocket, _ := strconv.Atoi(vm.Platform["cores-per-socket"])
+	if err := d.Set(vmSchemaCoresPerSocket, coresPerSocket); err != nil {
+		return diag.FromErr(err)
 	}
 
+	if err := d.Set(vmSchemaVcpuParams, filterDeclaredKeys(vm.VCPUParams, d.Get(vmSchemaVcpuParams).(map[string]interface{}))); err != nil {
+		return diag.FromErr(err)
+	}
+
+	// Only the values which are declared are reported
+	if _cpu, ok := d.GetOk(vmSchemaCPU); ok && len(_cpu.([]interface{})) > 0 && _cpu.([]interface{})[0] != nil {
+		declared := _cpu.([]interface{})[0].(map[string]interface{})
+
+		coresPerSocket := d.Get(vmSchemaCoresPerSocket).(int)
+		if coresPerSocket < 1 {
+			coresPerSocket = 1
+		}
+
+		cpu := map[string]interface{}{}
+		if declared[vmSchemaCPUSockets].(int) > 0 {
+			cpu[vmSchemaCPUSockets] = vm.VCPUCount / coresPerSocket
+		}
+		if declared[vmSchemaCPUCoresPerSocket].(int) > 0 {
+			cpu[vmSchemaCPUCoresPerSocket] = coresPerSocket
+		}
+
+		if err := d.Set(vmSchemaCPU, []interface{}{cpu}); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if err := setSchemaConsole(c, vm, d); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return nil
+}
+
+// setSchemaVIFs sets the network interfaces of the VM, along with the MAC
+// addresses of all its interfaces ordered by device.
+func setSchemaVIFs(c *Connection, vm *VMDescriptor, d *schema.ResourceData) error {
 	vmVifs, err := c.client.VM.GetVIFs(c.session, vm.VMRef)
 	if err != nil {
 		return err
@@ -469,6 +1318,7 @@ func resourceVMRead(d *schema.ResourceData, m interface{}) error {
 	vifs := make([]map[string]interface{}, 0, len(vmVifs))
 	log.Println(fmt.Sprintf("[DEBUG] Got %d VIFs", len(vmVifs)))
 
+	macs := make(map[int]string, len(vmVifs))
 	for _, _vif := range vmVifs {
 		vif := VIFDescriptor{
 			VIFRef: _vif,
@@ -478,8 +1328,21 @@ func resourceVMRead(d *schema.ResourceData, m interface{}) error {
 			return err
 		}
 
+		macs[vif.DeviceOrder] = vif.MAC
+
+		// Managed by a xenserver_vif resource
+		if _, ok := vif.OtherConfig[vifOtherConfigStandalone]; ok {
+			continue
+		}
+
 		log.Println("[DEBUG] Found VIF", vif.UUID)
+		declared := d.Get(vmSchemaNetworkInterfaces).(*schema.Set).List()
 		vifData := fillVIFSchema(vif)
+		vifData[vifSchemaOtherConfig] = filterDeclaredKeys(vif.OtherConfig,
+			declaredKeysOf(declared, vifSchemaDevice, vif.DeviceOrder, vifSchemaOtherConfig))
+		if omitsDefaultNetwork(c, declared, &vif) {
+			vifData[vifSchemaNetworkUUID] = ""
+		}
 		log.Println("[DEBUG] VIF: ", vifData)
 
 		vifs = append(vifs, vifData)
@@ -490,30 +1353,59 @@ func resourceVMRead(d *schema.ResourceData, m interface{}) error {
 		return err
 	}
 
-	if setSchemaVBDs(c, vm, d) != nil {
-		log.Println("[ERROR] ", err)
+	devices := make([]int, 0, len(macs))
+	for device := range macs {
+		devices = append(devices, device)
+	}
+	sort.Ints(devices)
+
+	macAddresses := make([]string, 0, len(devices))
+	for _, device := range devices {
+		macAddresses = append(macAddresses, macs[device])
+	}
+
+	return d.Set(vmSchemaMACAddresses, macAddresses)
+}
+
+// setSchemaConsole exports the location of the VM console. Graphical (RFB)
+// consoles are preferred over text consoles.
+func setSchemaConsole(c *Connection, vm *VMDescriptor, d *schema.ResourceData) error {
+	consoles, err := c.client.VM.GetConsoles(c.session, vm.VMRef)
+	if err != nil {
 		return err
 	}
 
-	log.Println("[DEBUG] Query boot order")
-	if order, ok := vm.HVMBootParameters["order"]; ok {
-		if err := d.Set(vmSchemaBootOrder, order); err != nil {
+	var location string
+	var protocol xenapi.ConsoleProtocol
+	for _, consoleRef := range consoles {
+		console, err := c.client.Console.GetRecord(c.session, consoleRef)
+		if err != nil {
 			return err
 		}
-	}
 
-	if cps, ok := vm.Platform["cores-per-socket"]; ok {
-		coresPerSocket, _ := strconv.Atoi(cps)
-		if err := d.Set(vmSchemaCoresPerSocket, coresPerSocket); err != nil {
-			return err
+		if location == "" || console.Protocol == xenapi.ConsoleProtocolRfb {
+			location = console.Location
+			protocol = console.Protocol
 		}
 	}
 
+	if err := d.Set(vmSchemaConsoleURL, location); err != nil {
+		return err
+	}
+
+	if err := d.Set(vmSchemaConsoleProtocol, string(protocol)); err != nil {
+		return err
+	}
+
 	return nil
 }
 
-func resourceVMUpdate(d *schema.ResourceData, m interface{}) error {
-	c := m.(*Connection)
+func resourceVMUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c, cancel, err := m.(*Connection).WithTimeout(d.Timeout(schema.TimeoutUpdate))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer cancel()
 
 	vm := &VMDescriptor{
 		UUID: d.Id(),
@@ -526,7 +1418,7 @@ func resourceVMUpdate(d *schema.ResourceData, m interface{}) error {
 			}
 		}
 
-		return err
+		return diag.FromErr(err)
 	}
 
 	d.Partial(true)
@@ -535,60 +1427,73 @@ func resourceVMUpdate(d *schema.ResourceData, m interface{}) error {
 		_, _dNameLabel := d.GetChange(vmSchemaNameLabel)
 		dNameLabel := _dNameLabel.(string)
 		if err := c.client.VM.SetNameLabel(c.session, vm.VMRef, dNameLabel); err != nil {
-			return err
+			return diag.FromErr(err)
 		}
+	}
 
-		d.SetPartial(vmSchemaNameLabel)
+	if d.HasChange(vmSchemaDescription) {
+		if err := c.client.VM.SetNameDescription(c.session, vm.VMRef, d.Get(vmSchemaDescription).(string)); err != nil {
+			return diag.FromErr(err)
+		}
 	}
 
-	updatedFields := make([]string, 0, 5)
 	updateMemory := false
+	updateStaticMemory := false
+	hotAdd := d.Get(vmSchemaHotAdd).(bool) && vm.PowerState == xenapi.VMPowerStateRunning
 
 	if d.HasChange(vmSchemaStaticMemoryMax) {
 		mem := d.Get(vmSchemaStaticMemoryMax).(int)
 		vm.StaticMemory.Max = mem
 		updateMemory = true
-		updatedFields = append(updatedFields, vmSchemaStaticMemoryMax)
+		updateStaticMemory = true
 	}
 
 	if d.HasChange(vmSchemaStaticMemoryMin) {
 		mem := d.Get(vmSchemaStaticMemoryMin).(int)
 		vm.StaticMemory.Min = mem
 		updateMemory = true
-		updatedFields = append(updatedFields, vmSchemaStaticMemoryMin)
+		updateStaticMemory = true
 	}
 
 	if d.HasChange(vmSchemaDynamicMemoryMax) {
 		mem := d.Get(vmSchemaDynamicMemoryMax).(int)
 		vm.DynamicMemory.Max = mem
 		updateMemory = true
-		updatedFields = append(updatedFields, vmSchemaDynamicMemoryMax)
 	}
 
 	if d.HasChange(vmSchemaDynamicMemoryMin) {
 		mem := d.Get(vmSchemaDynamicMemoryMin).(int)
 		vm.DynamicMemory.Min = mem
 		updateMemory = true
-		updatedFields = append(updatedFields, vmSchemaDynamicMemoryMin)
 	}
 
 	if updateMemory {
-		if err := vm.UpdateMemory(c); err != nil {
-			return err
-		}
-
-		for _, f := range updatedFields {
-			d.SetPartial(f)
+		// The static limits can only be changed while the VM is halted
+		if hotAdd && !updateStaticMemory {
+			if err := vm.UpdateMemoryLive(c); err != nil {
+				return diag.FromErr(err)
+			}
+		} else {
+			if err := vm.UpdateMemory(c); err != nil {
+				return diag.FromErr(err)
+			}
 		}
 	}
 
-	if d.HasChange(vmSchemaVcpus) {
-		_, vcpus := d.GetChange(vmSchemaVcpus)
-		vm.VCPUCount = vcpus.(int)
-		if err := vm.UpdateVCPUs(c); err != nil {
-			return err
+	if d.HasChange(vmSchemaVcpus) || d.HasChange(vmSchemaVcpusMax) {
+		vm.VCPUCount = d.Get(vmSchemaVcpus).(int)
+		vm.VCPUMax = d.Get(vmSchemaVcpusMax).(int)
+
+		// VCPUs_max can only be changed while the VM is halted
+		if hotAdd && !d.HasChange(vmSchemaVcpusMax) {
+			if err := vm.UpdateVCPUsLive(c); err != nil {
+				return diag.FromErr(err)
+			}
+		} else {
+			if err := vm.UpdateVCPUs(c); err != nil {
+				return diag.FromErr(err)
+			}
 		}
-		d.SetPartial(vmSchemaVcpus)
 	}
 
 	if d.HasChange(vmSchemaNetworkInterfaces) {
@@ -597,10 +1502,14 @@ func resourceVMUpdate(d *schema.ResourceData, m interface{}) error {
 		os := o.(*schema.Set)
 		ns := n.(*schema.Set)
 
+		if err := updateVIFsInPlace(c, vm, ns.List()); err != nil {
+			return diag.FromErr(err)
+		}
+
 		var err error
 		var remove []*VIFDescriptor
-		if remove, err = readVIFsFromSchema(c, os.Difference(ns).List()); err == nil {
-			return err
+		if remove, err = readVIFsFromSchema(c, os.Difference(ns).List()); err != nil {
+			return diag.FromErr(err)
 		}
 
 		if len(remove) > 0 {
@@ -615,12 +1524,12 @@ func resourceVMUpdate(d *schema.ResourceData, m interface{}) error {
 					}
 
 					if err := vif.Query(c); err != nil {
-						return err
+						return diag.FromErr(err)
 					}
 					vmVifs = append(vmVifs, vif)
 				}
 			} else {
-				return err
+				return diag.FromErr(err)
 			}
 
 			for _, vif := range remove {
@@ -633,16 +1542,21 @@ func resourceVMUpdate(d *schema.ResourceData, m interface{}) error {
 				}
 				if vifToRemove != nil {
 					log.Println(fmt.Sprintf("[DEBUG] Removing VIF %q", vif.UUID))
+					if vm.PowerState == xenapi.VMPowerStateRunning {
+						if err := c.client.VIF.Unplug(c.session, vifToRemove.VIFRef); err != nil {
+							return diag.FromErr(err)
+						}
+					}
 					if err := c.client.VIF.Destroy(c.session, vifToRemove.VIFRef); err != nil {
-						return err
+						return diag.FromErr(err)
 					}
 				}
 			}
 		}
 
 		var create []*VIFDescriptor
-		if create, err = readVIFsFromSchema(c, ns.Difference(os).List()); err == nil {
-			return err
+		if create, err = readVIFsFromSchema(c, ns.Difference(os).List()); err != nil {
+			return diag.FromErr(err)
 		}
 
 		if len(create) > 0 {
@@ -650,11 +1564,10 @@ func resourceVMUpdate(d *schema.ResourceData, m interface{}) error {
 			for _, vif := range create {
 				vif.VM = vm
 				if _, err := createVIF(c, vif); err != nil {
-					return nil
+					return diag.FromErr(err)
 				}
 			}
 		}
-		d.SetPartial(vmSchemaNetworkInterfaces)
 	}
 
 	if d.HasChange(vmSchemaCdRom) {
@@ -663,10 +1576,14 @@ func resourceVMUpdate(d *schema.ResourceData, m interface{}) error {
 		os := o.(*schema.Set)
 		ns := n.(*schema.Set)
 
+		if err := updateVBDsInPlace(c, vm, os.List(), ns.List()); err != nil {
+			return diag.FromErr(err)
+		}
+
 		var err error
 		var remove []*VBDDescriptor
-		if remove, err = readVBDsFromSchema(c, os.Difference(ns).List()); err == nil {
-			return err
+		if remove, err = readVBDsFromSchema(c, os.Difference(ns).List()); err != nil {
+			return diag.FromErr(err)
 		}
 
 		if len(remove) > 0 {
@@ -681,12 +1598,12 @@ func resourceVMUpdate(d *schema.ResourceData, m interface{}) error {
 					}
 
 					if err := vbd.Query(c); err != nil {
-						return err
+						return diag.FromErr(err)
 					}
 					vmVBDs = append(vmVBDs, vbd)
 				}
 			} else {
-				return err
+				return diag.FromErr(err)
 			}
 
 			for _, vbd := range remove {
@@ -700,27 +1617,28 @@ func resourceVMUpdate(d *schema.ResourceData, m interface{}) error {
 				if vbdToRemove != nil {
 					log.Println(fmt.Sprintf("[DEBUG] Removing cdrom %q", vbd.UUID))
 					if err := c.client.VBD.Destroy(c.session, vbdToRemove.VBDRef); err != nil {
-						return err
+						return diag.FromErr(err)
 					}
 				}
 			}
 		}
 
 		var create []*VBDDescriptor
-		if create, err = readVBDsFromSchema(c, ns.Difference(os).List()); err == nil {
-			return err
+		if create, err = readVBDsFromSchema(c, ns.Difference(os).List()); err != nil {
+			return diag.FromErr(err)
 		}
 
 		if len(create) > 0 {
 			log.Println(fmt.Sprintf("[DEBUG] Will create %d cdroms", len(create)))
 			for _, cdrom := range create {
 				cdrom.VM = vm
+				cdrom.Type = xenapi.VbdTypeCD
+				cdrom.Mode = xenapi.VbdModeRO
 				if _, err := createVBD(c, cdrom); err != nil {
-					return err
+					return diag.FromErr(err)
 				}
 			}
 		}
-		d.SetPartial(vmSchemaCdRom)
 	}
 
 	if d.HasChange(vmSchemaHardDrive) {
@@ -729,10 +1647,14 @@ func resourceVMUpdate(d *schema.ResourceData, m interface{}) error {
 		os := o.(*schema.Set)
 		ns := n.(*schema.Set)
 
+		if err := updateVBDsInPlace(c, vm, os.List(), ns.List()); err != nil {
+			return diag.FromErr(err)
+		}
+
 		var err error
 		var remove []*VBDDescriptor
-		if remove, err = readVBDsFromSchema(c, os.Difference(ns).List()); err == nil {
-			return err
+		if remove, err = readVBDsFromSchema(c, os.Difference(ns).List()); err != nil {
+			return diag.FromErr(err)
 		}
 
 		if len(remove) > 0 {
@@ -747,12 +1669,12 @@ func resourceVMUpdate(d *schema.ResourceData, m interface{}) error {
 					}
 
 					if err := vbd.Query(c); err != nil {
-						return err
+						return diag.FromErr(err)
 					}
 					vmVBDs = append(vmVBDs, vbd)
 				}
 			} else {
-				return err
+				return diag.FromErr(err)
 			}
 
 			for _, vbd := range remove {
@@ -766,78 +1688,332 @@ func resourceVMUpdate(d *schema.ResourceData, m interface{}) error {
 				if vbdToRemove != nil {
 					log.Println(fmt.Sprintf("[DEBUG] Removing HDD %q", vbd.UUID))
 					if err := c.client.VBD.Destroy(c.session, vbdToRemove.VBDRef); err != nil {
-						return err
+						return diag.FromErr(err)
+					}
+
+					// The VDI of a disk created from a source belongs to the VM
+					if _, ok := vbdToRemove.OtherConfig[vbdOtherConfigSourceVDI]; ok && !declaredKeepOnDestroy(os.List(), vbd.UserDevice) {
+						log.Printf("[DEBUG] Destroying VDI %s", vbdToRemove.VDI.UUID)
+						if err := c.client.VDI.Destroy(c.session, vbdToRemove.VDI.VDIRef); err != nil {
+							return diag.FromErr(err)
+						}
 					}
 				}
 			}
 		}
 
+		added := make([]interface{}, 0)
+		for _, schm := range ns.Difference(os).List() {
+			data := schm.(map[string]interface{})
+			if data[vbdSchemaSourceVDIUUID].(string) == "" {
+				added = append(added, data)
+				continue
+			}
+
+			if err := createVBDFromSource(c, vm, data); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+
 		var create []*VBDDescriptor
-		if create, err = readVBDsFromSchema(c, ns.Difference(os).List()); err == nil {
-			return err
+		if create, err = readVBDsFromSchema(c, added); err != nil {
+			return diag.FromErr(err)
 		}
 
 		if len(create) > 0 {
 			log.Println(fmt.Sprintf("[DEBUG] Will create %d HDDs", len(create)))
 			for _, hdd := range create {
 				hdd.VM = vm
+				hdd.Type = xenapi.VbdTypeDisk
 				if _, err := createVBD(c, hdd); err != nil {
-					return err
+					return diag.FromErr(err)
 				}
 			}
 		}
 	}
 
-	dXenstoreDataRaw, ok := d.GetOk(vmSchemaXenstoreData)
-	if ok {
-		dXenstoreData := make(map[string]string)
-		for key, value := range dXenstoreDataRaw.(map[string]interface{}) {
-			dXenstoreData[key] = value.(string)
+	if d.HasChange(vmSchemaXenstoreData) {
+		o, n := d.GetChange(vmSchemaXenstoreData)
+		xenstoreData := mergeDeclaredKeys(vm.XenstoreData, o.(map[string]interface{}), n.(map[string]interface{}))
+
+		if err := c.client.VM.SetXenstoreData(c.session, vm.VMRef, xenstoreData); err != nil {
+			return diag.FromErr(err)
 		}
+	}
 
-		if err := c.client.VM.SetXenstoreData(c.session, vm.VMRef, dXenstoreData); err != nil {
-			return err
+	if d.HasChange(vmSchemaOtherConfig) || xenCenterMetadataChanged(d) {
+		o, n := d.GetChange(vmSchemaOtherConfig)
+		otherConfig := mergeDeclaredKeys(vm.OtherConfig, o.(map[string]interface{}), n.(map[string]interface{}))
+		otherConfig = mergeXenCenterMetadata(otherConfig, d)
+
+		if err := c.client.VM.SetOtherConfig(c.session, vm.VMRef, otherConfig); err != nil {
+			return diag.FromErr(err)
 		}
+	}
 
-		d.SetPartial(vmSchemaXenstoreData)
+	if d.HasChange(vmSchemaAffinityHostUUID) || d.HasChange(vmSchemaSuspendSRUUID) || d.HasChange(vmSchemaPCIDevices) {
+		if err := setVMPlacement(c, vm, d); err != nil {
+			return diag.FromErr(err)
+		}
 	}
 
-	if d.HasChange(vmSchemaBootOrder) {
+	if d.HasChange(vmSchemaInstall) && !vmInstallPending(d) {
+		if err := finishInstall(c, vm, d.Get(vmSchemaBootOrder).(string)); err != nil {
+			return diag.FromErr(err)
+		}
+	} else if d.HasChange(vmSchemaBootOrder) && !vmInstallPending(d) {
 		_, n := d.GetChange(vmSchemaBootOrder)
 		order := n.(string)
 		vm.HVMBootParameters["order"] = order
 
 		if err := c.client.VM.SetHVMBootParams(c.session, vm.VMRef, vm.HVMBootParameters); err != nil {
-			return err
+			return diag.FromErr(err)
 		}
-
-		d.SetPartial(vmSchemaBootOrder)
 	}
 
-	if d.HasChange(vmSchemaCoresPerSocket) {
-		_, n := d.GetChange(vmSchemaCoresPerSocket)
-		coresPerSocket := n.(int)
+	// Sockets in the cpu block translate to different cores per socket once the
+	// number of VCPUs changes
+	cpuTopologyChanged := d.HasChange(vmSchemaCPU) || (d.HasChange(vmSchemaVcpus) && len(d.Get(vmSchemaCPU).([]interface{})) > 0)
 
-		if vm.VCPUCount%coresPerSocket != 0 {
-			return fmt.Errorf("%d cores could not fit to %d cores-per-socket topology", vm.VCPUCount, coresPerSocket)
+	if d.HasChange(vmSchemaCoresPerSocket) || cpuTopologyChanged || d.HasChange(vmSchemaPlatform) || platformFlagsChanged(d) {
+		o, n := d.GetChange(vmSchemaPlatform)
+		for k := range o.(map[string]interface{}) {
+			delete(vm.Platform, k)
+		}
+		for k, v := range n.(map[string]interface{}) {
+			vm.Platform[k] = v.(string)
 		}
 
-		vm.Platform["cores-per-socket"] = strconv.Itoa(coresPerSocket)
+		applyPlatformFlags(d, vm, true)
 
+		coresPerSocket, err := vmCoresPerSocket(d)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		if coresPerSocket > 0 {
+			if vm.VCPUCount%coresPerSocket != 0 {
+				return diag.FromErr(fmt.Errorf("%d cores could not fit to %d cores-per-socket topology", vm.VCPUCount, coresPerSocket))
+			}
+
+			vm.Platform["cores-per-socket"] = strconv.Itoa(coresPerSocket)
+		}
+
+		// Platform settings take effect on the next boot of the VM
 		if err := c.client.VM.SetPlatform(c.session, vm.VMRef, vm.Platform); err != nil {
-			return err
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange(vmSchemaVcpuParams) {
+		o, n := d.GetChange(vmSchemaVcpuParams)
+		vcpuParams := mergeDeclaredKeys(vm.VCPUParams, o.(map[string]interface{}), n.(map[string]interface{}))
+
+		if err := c.client.VM.SetVCPUsParams(c.session, vm.VMRef, vcpuParams); err != nil {
+			return diag.FromErr(err)
+		}
+
+		// The scheduler parameters can be applied to running VMs, the mask
+		// only takes effect on the next boot
+		if vm.PowerState == xenapi.VMPowerStateRunning {
+			for _, key := range []string{"weight", "cap"} {
+				if value, ok := vcpuParams[key]; ok && value != vm.VCPUParams[key] {
+					if err := c.client.VM.AddToVCPUsParamsLive(c.session, vm.VMRef, key, value); err != nil {
+						return diag.FromErr(err)
+					}
+				}
+			}
 		}
+	}
+
+	if d.HasChange(vmSchemaHARestartPriority) || d.HasChange(vmSchemaHAAlwaysRun) ||
+		d.HasChange(vmSchemaOrder) || d.HasChange(vmSchemaStartDelay) || d.HasChange(vmSchemaShutdownDelay) {
+		if err := setVMHA(c, vm, d); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange(vmSchemaConfigDrive) {
+		if configDrive := d.Get(vmSchemaConfigDrive).([]interface{}); len(configDrive) > 0 {
+			if err := applyConfigDrive(c, vm, configDrive[0].(map[string]interface{})); err != nil {
+				return diag.FromErr(err)
+			}
+		} else {
+			if err := detachGeneratedISO(c, vm, configDrivePurpose); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+	}
+
+	if d.HasChange(vmSchemaIgnition) || d.HasChange(vmSchemaIgnitionSRUUID) {
+		if ignition := d.Get(vmSchemaIgnition).(string); ignition != "" {
+			if err := applyIgnition(c, vm, ignition, d.Get(vmSchemaIgnitionSRUUID).(string)); err != nil {
+				return diag.FromErr(err)
+			}
+		} else {
+			if err := detachGeneratedISO(c, vm, ignitionPurpose); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+	}
 
-		d.SetPartial(vmSchemaCoresPerSocket)
+	// Takes effect on the next start of the VM, e.g. a restart by HA
+	if d.HasChange(vmSchemaGroup) {
+		if err := setVMGroup(c, vm.VMRef, d.Get(vmSchemaGroup).(string)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	// Converting to a template comes last, so that it captures all changes above
+	if d.HasChange(vmSchemaIsATemplate) {
+		if err := setVMIsATemplate(c, vm, d); err != nil {
+			return diag.FromErr(err)
+		}
 	}
 
 	d.Partial(false)
 
-	return resourceVMRead(d, m)
+	return resourceVMRead(ctx, d, m)
 }
 
-func resourceVMDelete(d *schema.ResourceData, m interface{}) error {
-	c := m.(*Connection)
+// validateVCPUParams checks the VCPU parameters understood by the credit
+// scheduler of Xen: mask is a comma separated list of physical CPUs the VCPUs
+// may run on, weight the relative share of CPU time (1 to 65535) and cap the
+// maximum CPU time in percent of one physical CPU (0 for no limit).
+func validateVCPUParams(v interface{}, k string) (ws []string, errors []error) {
+	for key, value := range v.(map[string]interface{}) {
+		value := value.(string)
+
+		switch key {
+		case "mask":
+			for _, cpu := range strings.Split(value, ",") {
+				if n, err := strconv.Atoi(strings.TrimSpace(cpu)); err != nil || n < 0 {
+					errors = append(errors, fmt.Errorf("%s.mask: %q is not a list of physical CPU numbers", k, value))
+					break
+				}
+			}
+		case "weight":
+			if n, err := strconv.Atoi(value); err != nil || n < 1 || n > 65535 {
+				errors = append(errors, fmt.Errorf("%s.weight: %q is not a number between 1 and 65535", k, value))
+			}
+		case "cap":
+			if n, err := strconv.Atoi(value); err != nil || n < 0 {
+				errors = append(errors, fmt.Errorf("%s.cap: %q is not a positive number", k, value))
+			}
+		default:
+			errors = append(errors, fmt.Errorf("%s: unsupported parameter %q, supported are mask, weight and cap", k, key))
+		}
+	}
+
+	return
+}
+
+// vmCoresPerSocket returns the configured number of cores per socket, taken
+// from the cpu block or cores_per_socket, or 0 if it is not configured. Xen
+// derives the number of sockets from the VCPUs, so sockets are only checked
+// against the VCPUs or used to compute the cores per socket.
+func vmCoresPerSocket(d *schema.ResourceData) (int, error) {
+	vcpus := d.Get(vmSchemaVcpus).(int)
+
+	if _cpu, ok := d.GetOk(vmSchemaCPU); ok && len(_cpu.([]interface{})) > 0 && _cpu.([]interface{})[0] != nil {
+		cpu := _cpu.([]interface{})[0].(map[string]interface{})
+		sockets := cpu[vmSchemaCPUSockets].(int)
+		coresPerSocket := cpu[vmSchemaCPUCoresPerSocket].(int)
+
+		switch {
+		case sockets > 0 && coresPerSocket > 0:
+			if sockets*coresPerSocket != vcpus {
+				return 0, fmt.Errorf("%d sockets with %d cores each do not match %d VCPUs", sockets, coresPerSocket, vcpus)
+			}
+		case sockets > 0:
+			if vcpus%sockets != 0 {
+				return 0, fmt.Errorf("%d VCPUs could not be split evenly across %d sockets", vcpus, sockets)
+			}
+			coresPerSocket = vcpus / sockets
+		}
+
+		return coresPerSocket, nil
+	}
+
+	if coresPerSocket, ok := d.GetOk(vmSchemaCoresPerSocket); ok {
+		return coresPerSocket.(int), nil
+	}
+
+	return 0, nil
+}
+
+// setVMHA applies the HA protection of the VM and its position in the startup
+// and shutdown sequences, which HA follows when restarting VMs. Only values differing from
+// the VM are set, as changing the restart priority is checked against the
+// failover plan of the pool.
+func setVMHA(c *Connection, vm *VMDescriptor, d *schema.ResourceData) error {
+	if order := d.Get(vmSchemaOrder).(int); order != vm.Order {
+		if err := c.client.VM.SetOrder(c.session, vm.VMRef, order); err != nil {
+			return err
+		}
+	}
+
+	if startDelay := d.Get(vmSchemaStartDelay).(int); startDelay != vm.StartDelay {
+		if err := c.client.VM.SetStartDelay(c.session, vm.VMRef, startDelay); err != nil {
+			return err
+		}
+	}
+
+	if shutdownDelay := d.Get(vmSchemaShutdownDelay).(int); shutdownDelay != vm.ShutdownDelay {
+		if err := c.client.VM.SetShutdownDelay(c.session, vm.VMRef, shutdownDelay); err != nil {
+			return err
+		}
+	}
+
+	if priority := d.Get(vmSchemaHARestartPriority).(string); priority != vm.HARestartPriority {
+		log.Printf("[DEBUG] Setting HA restart priority of VM %s to %q", vm.UUID, priority)
+		if err := c.client.VM.SetHaRestartPriority(c.session, vm.VMRef, priority); err != nil {
+			return err
+		}
+	}
+
+	if alwaysRun, ok := d.GetOkExists(vmSchemaHAAlwaysRun); ok && alwaysRun.(bool) != vm.HAAlwaysRun {
+		if err := c.client.VM.SetHaAlwaysRun(c.session, vm.VMRef, alwaysRun.(bool)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// shutdownVM shuts the running VM down, giving the guest the shutdown timeout
+// of the VM to power off cleanly. A guest which does not power off in time is
+// forced off, unless force_shutdown is disabled.
+func shutdownVM(c *Connection, vm *VMDescriptor, d *schema.ResourceData) error {
+	timeout := time.Duration(d.Get(vmSchemaShutdownTimeout).(int)) * time.Second
+	return shutdownRunningVM(c, vm, timeout, d.Get(vmSchemaForceShutdown).(bool))
+}
+
+// setVMIsATemplate converts the VM into a template, shutting it down first, or
+// a template back into a halted VM.
+func setVMIsATemplate(c *Connection, vm *VMDescriptor, d *schema.ResourceData) error {
+	isATemplate := d.Get(vmSchemaIsATemplate).(bool)
+
+	if isATemplate && vm.PowerState != xenapi.VMPowerStateHalted {
+		if vm.PowerState != xenapi.VMPowerStateRunning {
+			return fmt.Errorf("can not convert VM %s in power state %s to a template", vm.UUID, vm.PowerState)
+		}
+
+		log.Printf("[DEBUG] Shutting down VM %s to convert it to a template", vm.UUID)
+		if err := shutdownVM(c, vm, d); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("[DEBUG] Setting template flag of VM %s to %t", vm.UUID, isATemplate)
+	return c.client.VM.SetIsATemplate(c.session, vm.VMRef, isATemplate)
+}
+
+func resourceVMDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c, cancel, err := m.(*Connection).WithTimeout(d.Timeout(schema.TimeoutDelete))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer cancel()
 
 	vm := VMDescriptor{
 		UUID: d.Id(),
@@ -850,38 +2026,64 @@ func resourceVMDelete(d *schema.ResourceData, m interface{}) error {
 			}
 		}
 
-		return err
+		return diag.FromErr(err)
+	}
+
+	if err := runLifecycleHooks(c, d.Get(vmSchemaLifecycleHooks).([]interface{}), lifecycleHookEventPreDestroy, xenapi.ClsVM, vm.UUID); err != nil {
+		return diag.FromErr(err)
 	}
 
 	if vm.PowerState == xenapi.VMPowerStateRunning {
-		if err := c.client.VM.HardShutdown(c.session, vm.VMRef); err != nil {
-			return err
+		if err := shutdownVM(c, &vm, d); err != nil {
+			return diag.FromErr(err)
 		}
 	}
 
 	vifs, err := c.client.VM.GetVIFs(c.session, vm.VMRef)
 	if err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	for _, vif := range vifs {
 		if err := c.client.VIF.Destroy(c.session, vif); err != nil {
-			return err
+			return diag.FromErr(err)
 		}
 	}
 
 	var vbds []*VBDDescriptor
-	if vbds, err = queryTemplateVBDs(c, &vm); err != nil {
-		return err
+	if vbds, err = queryOwnedVBDs(c, &vm); err != nil {
+		return diag.FromErr(err)
+	}
+	log.Printf("[DEBUG] Found %d vbds owned by the VM", len(vbds))
+
+	if d.Get(vmSchemaKeepDisksOnDestroy).(bool) {
+		log.Printf("[DEBUG] Keeping all disks of VM %s", vm.UUID)
+		vbds = nil
+	} else {
+		vbds = withoutKeptVBDs(vbds, d.Get(vmSchemaHardDrive).(*schema.Set).List())
+	}
+
+	if d.Get(vmSchemaPreserveDataDisks).(bool) {
+		if vbds, err = preserveDataDisks(c, &vm, d.Get(vmSchemaPreserveID).(string), vbds); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	generatedVDIs, err := queryGeneratedVDIs(c, &vm)
+	if err != nil {
+		return diag.FromErr(err)
 	}
-	log.Printf("[DEBUG] Found %d template vbds", len(vbds))
 
 	if err := c.client.VM.Destroy(c.session, vm.VMRef); err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	if err = destroyTemplateVDIs(c, vbds); err != nil {
-		return err
+		return diag.FromErr(err)
+	}
+
+	if err = destroyGeneratedVDIs(c, generatedVDIs); err != nil {
+		return diag.FromErr(err)
 	}
 
 	d.SetId("")
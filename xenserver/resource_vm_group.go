@@ -0,0 +1,294 @@
+package xenserver
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+const (
+	vmGroupSchemaName        = "name_label"
+	vmGroupSchemaDescription = "description"
+	vmGroupSchemaPlacement   = "placement"
+	vmGroupSchemaVMUUIDs     = "vm_uuids"
+
+	vmGroupPlacementNormal       = "normal"
+	vmGroupPlacementAntiAffinity = "anti_affinity"
+)
+
+func resourceVMGroup() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceVMGroupCreate,
+		ReadContext:   forgetfulRead(resourceVMGroupRead, resourceVMGroupExists),
+		UpdateContext: resourceVMGroupUpdate,
+		DeleteContext: resourceVMGroupDelete,
+
+		Schema: map[string]*schema.Schema{
+			vmGroupSchemaName: &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+			},
+
+			vmGroupSchemaDescription: &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+
+			vmGroupSchemaPlacement: &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+				ForceNew: true,
+				Default:  vmGroupPlacementAntiAffinity,
+				ValidateFunc: validation.StringInSlice([]string{
+					vmGroupPlacementNormal,
+					vmGroupPlacementAntiAffinity,
+				}, false),
+			},
+
+			// Membership is declared by the group argument of the VMs
+			vmGroupSchemaVMUUIDs: &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+		},
+	}
+}
+
+// callVMGroupAPI calls a method of the XenAPI related to VM groups. The client
+// predates VM groups, which have been introduced with XenServer 8 and XCP-ng
+// 8.3, so these methods are called by name.
+func callVMGroupAPI(c *Connection, method string, args ...interface{}) (interface{}, error) {
+	params := append([]interface{}{string(c.session)}, args...)
+
+	result, err := c.client.APICall(method, params...)
+	if err != nil {
+		if xenErr, ok := err.(*xenapi.Error); ok {
+			if xenErr.Code() == xenapi.ERR_MESSAGE_METHOD_UNKNOWN {
+				return nil, fmt.Errorf("VM groups are not supported by pool %s, XenServer 8 or XCP-ng 8.3 is required", c.poolDescription())
+			}
+		}
+
+		return nil, err
+	}
+
+	return result.Value, nil
+}
+
+func callVMGroupAPIString(c *Connection, method string, args ...interface{}) (string, error) {
+	value, err := callVMGroupAPI(c, method, args...)
+	if err != nil {
+		return "", err
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%s did not return a string", method)
+	}
+
+	return s, nil
+}
+
+func callVMGroupAPIRefs(c *Connection, method string, args ...interface{}) ([]string, error) {
+	value, err := callVMGroupAPI(c, method, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	values, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s did not return a list", method)
+	}
+
+	refs := make([]string, 0, len(values))
+	for _, v := range values {
+		ref, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s did not return a list of references", method)
+		}
+		refs = append(refs, ref)
+	}
+
+	return refs, nil
+}
+
+// getVMGroup returns the UUID of the group of the VM, or an empty string if it
+// is not a member of any group.
+func getVMGroup(c *Connection, vm xenapi.VMRef) (string, error) {
+	groups, err := callVMGroupAPIRefs(c, "VM.get_groups", string(vm))
+	if err != nil {
+		return "", err
+	}
+
+	// A VM is a member of one group at most
+	if len(groups) == 0 {
+		return "", nil
+	}
+
+	return callVMGroupAPIString(c, "VM_group.get_uuid", groups[0])
+}
+
+// setVMGroup makes the VM a member of the group identified by uuid, or removes
+// it from its group if uuid is empty.
+func setVMGroup(c *Connection, vm xenapi.VMRef, uuid string) error {
+	groups := make([]interface{}, 0, 1)
+
+	if uuid != "" {
+		group, err := callVMGroupAPIString(c, "VM_group.get_by_uuid", uuid)
+		if err != nil {
+			return referenceError(c, "VM group", uuid, err)
+		}
+		groups = append(groups, group)
+	}
+
+	log.Printf("[DEBUG] Setting group of VM %s to %q", vm, uuid)
+	_, err := callVMGroupAPI(c, "VM.set_groups", string(vm), groups)
+	return err
+}
+
+func resourceVMGroupCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	group, err := callVMGroupAPIString(c, "VM_group.create",
+		d.Get(vmGroupSchemaName).(string),
+		d.Get(vmGroupSchemaDescription).(string),
+		d.Get(vmGroupSchemaPlacement).(string))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	groupUUID, err := callVMGroupAPIString(c, "VM_group.get_uuid", group)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId(groupUUID)
+
+	return resourceVMGroupRead(ctx, d, m)
+}
+
+func resourceVMGroupRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	group, err := callVMGroupAPIString(c, "VM_group.get_by_uuid", d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	name, err := callVMGroupAPIString(c, "VM_group.get_name_label", group)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vmGroupSchemaName, name); err != nil {
+		return diag.FromErr(err)
+	}
+
+	description, err := callVMGroupAPIString(c, "VM_group.get_name_description", group)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vmGroupSchemaDescription, description); err != nil {
+		return diag.FromErr(err)
+	}
+
+	placement, err := callVMGroupAPIString(c, "VM_group.get_placement", group)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vmGroupSchemaPlacement, placement); err != nil {
+		return diag.FromErr(err)
+	}
+
+	vmRefs, err := callVMGroupAPIRefs(c, "VM_group.get_VMs", group)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	vmUUIDs := make([]string, 0, len(vmRefs))
+	for _, vmRef := range vmRefs {
+		vmUUID, err := c.client.VM.GetUUID(c.session, xenapi.VMRef(vmRef))
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		vmUUIDs = append(vmUUIDs, vmUUID)
+	}
+	sort.Strings(vmUUIDs)
+
+	if err := d.Set(vmGroupSchemaVMUUIDs, vmUUIDs); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return nil
+}
+
+func resourceVMGroupUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	group, err := callVMGroupAPIString(c, "VM_group.get_by_uuid", d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if d.HasChange(vmGroupSchemaName) {
+		if _, err := callVMGroupAPI(c, "VM_group.set_name_label", group, d.Get(vmGroupSchemaName).(string)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange(vmGroupSchemaDescription) {
+		if _, err := callVMGroupAPI(c, "VM_group.set_name_description", group, d.Get(vmGroupSchemaDescription).(string)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	return resourceVMGroupRead(ctx, d, m)
+}
+
+func resourceVMGroupDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	group, err := callVMGroupAPIString(c, "VM_group.get_by_uuid", d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	// Members left behind, e.g. VMs not managed by Terraform, are detached so
+	// that they do not refer to a group which is gone
+	vmRefs, err := callVMGroupAPIRefs(c, "VM_group.get_VMs", group)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	for _, vmRef := range vmRefs {
+		if err := setVMGroup(c, xenapi.VMRef(vmRef), ""); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	_, err = callVMGroupAPI(c, "VM_group.destroy", group)
+	return diag.FromErr(err)
+}
+
+func resourceVMGroupExists(d *schema.ResourceData, m interface{}) (bool, error) {
+	c := m.(*Connection)
+
+	if _, err := callVMGroupAPI(c, "VM_group.get_by_uuid", d.Id()); err != nil {
+		if xenErr, ok := err.(*xenapi.Error); ok {
+			if xenErr.Code() == xenapi.ERR_UUID_INVALID {
+				return false, nil
+			}
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
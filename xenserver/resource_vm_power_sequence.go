@@ -0,0 +1,299 @@
+package xenserver
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+const (
+	vmPowerSequenceSchemaAction         = "action"
+	vmPowerSequenceSchemaVMUUIDs        = "vm_uuids"
+	vmPowerSequenceSchemaVMTimeout      = "vm_timeout"
+	vmPowerSequenceSchemaForce          = "force"
+	vmPowerSequenceSchemaIgnoreFailures = "ignore_failures"
+	vmPowerSequenceSchemaTriggers       = "triggers"
+	vmPowerSequenceSchemaFailures       = "failures"
+
+	vmPowerSequenceActionStart    = "start"
+	vmPowerSequenceActionShutdown = "shutdown"
+)
+
+func resourceVMPowerSequence() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceVMPowerSequenceCreate,
+		ReadContext:   resourceVMPowerSequenceRead,
+		DeleteContext: resourceVMPowerSequenceDelete,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(60 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			vmPowerSequenceSchemaAction: &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+				ValidateFunc: validation.StringInSlice([]string{
+					vmPowerSequenceActionStart,
+					vmPowerSequenceActionShutdown,
+				}, false),
+			},
+
+			vmPowerSequenceSchemaVMUUIDs: &schema.Schema{
+				Type:     schema.TypeList,
+				Required: true,
+				ForceNew: true,
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validateUUID,
+				},
+			},
+
+			vmPowerSequenceSchemaVMTimeout: &schema.Schema{
+				Type:         schema.TypeInt,
+				Optional:     true,
+				ForceNew:     true,
+				Default:      300,
+				ValidateFunc: validation.IntAtLeast(1),
+			},
+
+			vmPowerSequenceSchemaForce: &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				ForceNew: true,
+				Default:  false,
+			},
+
+			vmPowerSequenceSchemaIgnoreFailures: &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				ForceNew: true,
+				Default:  false,
+			},
+
+			vmPowerSequenceSchemaTriggers: &schema.Schema{
+				Type:     schema.TypeMap,
+				Optional: true,
+				ForceNew: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+
+			vmPowerSequenceSchemaFailures: &schema.Schema{
+				Type:     schema.TypeMap,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+		},
+	}
+}
+
+// sortVMsByOrder sorts the VMs by their position in the startup sequence of the
+// pool, VMs of the same order keep their configured order. Shutdown runs the
+// sequence in reverse.
+func sortVMsByOrder(vms []*VMDescriptor, orders map[xenapi.VMRef]int, reverse bool) {
+	sort.SliceStable(vms, func(i, j int) bool {
+		if reverse {
+			return orders[vms[i].VMRef] > orders[vms[j].VMRef]
+		}
+		return orders[vms[i].VMRef] < orders[vms[j].VMRef]
+	})
+}
+
+// powerSequenceStep starts or shuts down a single VM within timeout. Unless the
+// VM is in the target state already, it returns the delay to wait for before
+// proceeding with the next VM.
+func powerSequenceStep(c *Connection, vm *VMDescriptor, action string, timeout time.Duration, force bool) (time.Duration, error) {
+	conn, cancel, err := c.WithTimeout(timeout)
+	if err != nil {
+		return 0, err
+	}
+	defer cancel()
+
+	record, err := conn.client.VM.GetRecord(conn.session, vm.VMRef)
+	if err != nil {
+		return 0, err
+	}
+
+	switch action {
+	case vmPowerSequenceActionStart:
+		switch record.PowerState {
+		case xenapi.VMPowerStateRunning:
+			return 0, nil
+		case xenapi.VMPowerStateHalted:
+			log.Printf("[DEBUG] Starting VM %s", vm.UUID)
+			if err := runPowerTask(conn, "VM.start", string(vm.VMRef), false, false); err != nil {
+				return 0, err
+			}
+		default:
+			return 0, fmt.Errorf("can not start VM in power state %s", record.PowerState)
+		}
+
+		return time.Duration(record.StartDelay) * time.Second, nil
+
+	case vmPowerSequenceActionShutdown:
+		switch record.PowerState {
+		case xenapi.VMPowerStateHalted:
+			return 0, nil
+		case xenapi.VMPowerStateRunning:
+			err = shutdownRunningVM(c, vm, timeout, force)
+		default:
+			err = fmt.Errorf("can not cleanly shut down VM in power state %s", record.PowerState)
+			if force {
+				err = hardShutdownVM(c, vm, err)
+			}
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		return time.Duration(record.ShutdownDelay) * time.Second, nil
+	}
+
+	return 0, fmt.Errorf("unknown action %q", action)
+}
+
+// shutdownRunningVM shuts the running VM down, giving the guest timeout to
+// power off cleanly. With force, a guest which does not power off in time is
+// forced off, right away if timeout is 0.
+func shutdownRunningVM(c *Connection, vm *VMDescriptor, timeout time.Duration, force bool) error {
+	err := fmt.Errorf("no time to shut down cleanly")
+	if timeout > 0 {
+		conn, cancel, connErr := c.WithTimeout(timeout)
+		if connErr != nil {
+			return connErr
+		}
+
+		log.Printf("[DEBUG] Shutting down VM %s", vm.UUID)
+		err = runPowerTask(conn, "VM.clean_shutdown", string(vm.VMRef))
+		cancel()
+		if err == nil {
+			return nil
+		}
+	}
+
+	if !force {
+		return fmt.Errorf("clean shutdown of VM %s failed: %s", vm.UUID, err)
+	}
+
+	return hardShutdownVM(c, vm, err)
+}
+
+// hardShutdownVM forces the VM off because of reason. The clean shutdown may
+// have used up the time of c, so the VM is forced off through a connection for
+// cleanups.
+func hardShutdownVM(c *Connection, vm *VMDescriptor, reason error) error {
+	log.Printf("[WARN] Forcing shutdown of VM %s: %s", vm.UUID, reason)
+
+	cleanup, cancel, err := c.forCleanup()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	return cleanup.client.VM.HardShutdown(cleanup.session, vm.VMRef)
+}
+
+func runPowerTask(c *Connection, method string, args ...interface{}) error {
+	task, err := callAsync(c, method, args...)
+	if err != nil {
+		return err
+	}
+
+	_, err = waitForTask(c, task)
+	return err
+}
+
+func resourceVMPowerSequenceCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c, cancel, err := m.(*Connection).WithTimeout(d.Timeout(schema.TimeoutCreate))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer cancel()
+
+	action := d.Get(vmPowerSequenceSchemaAction).(string)
+	timeout := time.Duration(d.Get(vmPowerSequenceSchemaVMTimeout).(int)) * time.Second
+	force := d.Get(vmPowerSequenceSchemaForce).(bool)
+
+	vms := make([]*VMDescriptor, 0)
+	orders := make(map[xenapi.VMRef]int)
+	for _, vmUUID := range d.Get(vmPowerSequenceSchemaVMUUIDs).([]interface{}) {
+		vm := &VMDescriptor{
+			UUID: vmUUID.(string),
+		}
+		if err := vm.Load(c); err != nil {
+			return diag.FromErr(referenceError(c, "VM", vm.UUID, err))
+		}
+
+		order, err := c.client.VM.GetOrder(c.session, vm.VMRef)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		vms = append(vms, vm)
+		orders[vm.VMRef] = order
+	}
+
+	sortVMsByOrder(vms, orders, action == vmPowerSequenceActionShutdown)
+
+	failures := make(map[string]string)
+	for i, vm := range vms {
+		delay, err := powerSequenceStep(c, vm, action, timeout, force)
+		if err != nil {
+			if ctxErr := c.ctx.Err(); ctxErr != nil {
+				return diag.FromErr(ctxErr)
+			}
+
+			log.Printf("[ERROR] Failed to %s VM %s: %s", action, vm.UUID, err)
+			failures[vm.UUID] = err.Error()
+			continue
+		}
+
+		// The delay only separates VMs of different orders
+		if delay > 0 && i+1 < len(vms) && orders[vms[i+1].VMRef] != orders[vm.VMRef] {
+			log.Printf("[DEBUG] Waiting %s before proceeding with the next VM", delay)
+			select {
+			case <-c.ctx.Done():
+				return diag.FromErr(c.ctx.Err())
+			case <-time.After(delay):
+			}
+		}
+	}
+
+	d.SetId(time.Now().UTC().String())
+
+	if err := d.Set(vmPowerSequenceSchemaFailures, failures); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if len(failures) > 0 && !d.Get(vmPowerSequenceSchemaIgnoreFailures).(bool) {
+		messages := make([]string, 0, len(failures))
+		for vmUUID, failure := range failures {
+			messages = append(messages, fmt.Sprintf("%s: %s", vmUUID, failure))
+		}
+		sort.Strings(messages)
+
+		return diag.FromErr(fmt.Errorf("failed to %s %d of %d VMs:\n%s", action, len(failures), len(vms), strings.Join(messages, "\n")))
+	}
+
+	return nil
+}
+
+// resourceVMPowerSequenceRead keeps the state as it is, the sequence is an
+// action which only runs on create.
+func resourceVMPowerSequenceRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return nil
+}
+
+func resourceVMPowerSequenceDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return nil
+}
@@ -0,0 +1,328 @@
+package xenserver
+
+import (
+	"context"
+	"log"
+	"sort"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+const (
+	vmssSchemaName              = "name_label"
+	vmssSchemaDescription       = "description"
+	vmssSchemaEnabled           = "enabled"
+	vmssSchemaType              = "type"
+	vmssSchemaFrequency         = "frequency"
+	vmssSchemaSchedule          = "schedule"
+	vmssSchemaRetainedSnapshots = "retained_snapshots"
+	vmssSchemaVMUUIDs           = "vm_uuids"
+
+	// Detaches a VM from its snapshot schedule
+	vmssNullRef = xenapi.VMSSRef("OpaqueRef:NULL")
+)
+
+func resourceVMSS() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceVMSSCreate,
+		ReadContext:   forgetfulRead(resourceVMSSRead, resourceVMSSExists),
+		UpdateContext: resourceVMSSUpdate,
+		DeleteContext: resourceVMSSDelete,
+
+		Schema: map[string]*schema.Schema{
+			vmssSchemaName: &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+			},
+
+			vmssSchemaDescription: &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+
+			vmssSchemaEnabled: &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  true,
+			},
+
+			vmssSchemaType: &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+				Default:  string(xenapi.VmssTypeSnapshot),
+				ValidateFunc: validation.StringInSlice([]string{
+					string(xenapi.VmssTypeSnapshot),
+					string(xenapi.VmssTypeCheckpoint),
+					string(xenapi.VmssTypeSnapshotWithQuiesce),
+				}, false),
+			},
+
+			vmssSchemaFrequency: &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+				ValidateFunc: validation.StringInSlice([]string{
+					string(xenapi.VmssFrequencyHourly),
+					string(xenapi.VmssFrequencyDaily),
+					string(xenapi.VmssFrequencyWeekly),
+				}, false),
+			},
+
+			vmssSchemaSchedule: &schema.Schema{
+				Type:     schema.TypeMap,
+				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+
+			vmssSchemaRetainedSnapshots: &schema.Schema{
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      7,
+				ValidateFunc: validation.IntBetween(1, 10),
+			},
+
+			vmssSchemaVMUUIDs: &schema.Schema{
+				Type:     schema.TypeSet,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validateUUID,
+				},
+				Set: schema.HashString,
+			},
+		},
+	}
+}
+
+func vmssSchedule(raw interface{}) map[string]string {
+	schedule := make(map[string]string)
+	for k, v := range raw.(map[string]interface{}) {
+		schedule[k] = v.(string)
+	}
+	return schedule
+}
+
+// setVMSSMembers attaches the VMs to the snapshot schedule, or detaches them by
+// passing vmssNullRef.
+func setVMSSMembers(c *Connection, vmss xenapi.VMSSRef, vmUUIDs []interface{}) error {
+	for _, vmUUID := range vmUUIDs {
+		vm := &VMDescriptor{
+			UUID: vmUUID.(string),
+		}
+
+		if err := vm.Load(c); err != nil {
+			if xenErr, ok := err.(*xenapi.Error); ok {
+				// Nothing to detach from a VM which is gone
+				if xenErr.Code() == xenapi.ERR_UUID_INVALID && vmss == vmssNullRef {
+					continue
+				}
+			}
+			return referenceError(c, "VM", vm.UUID, err)
+		}
+
+		log.Printf("[DEBUG] Setting snapshot schedule of VM %s to %s", vm.UUID, vmss)
+		if err := c.client.VM.SetSnapshotSchedule(c.session, vm.VMRef, vmss); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func resourceVMSSCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	vmssRecord := xenapi.VMSSRecord{
+		NameLabel:         d.Get(vmssSchemaName).(string),
+		NameDescription:   d.Get(vmssSchemaDescription).(string),
+		Enabled:           d.Get(vmssSchemaEnabled).(bool),
+		Type:              xenapi.VmssType(d.Get(vmssSchemaType).(string)),
+		Frequency:         xenapi.VmssFrequency(d.Get(vmssSchemaFrequency).(string)),
+		Schedule:          vmssSchedule(d.Get(vmssSchemaSchedule)),
+		RetainedSnapshots: d.Get(vmssSchemaRetainedSnapshots).(int),
+	}
+
+	vmssRef, err := c.client.VMSS.Create(c.session, vmssRecord)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	vmssUUID, err := c.client.VMSS.GetUUID(c.session, vmssRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId(vmssUUID)
+
+	if err := setVMSSMembers(c, vmssRef, d.Get(vmssSchemaVMUUIDs).(*schema.Set).List()); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return resourceVMSSRead(ctx, d, m)
+}
+
+func resourceVMSSRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	vmssRef, err := c.client.VMSS.GetByUUID(c.session, d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	vmss, err := c.client.VMSS.GetRecord(c.session, vmssRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vmssSchemaName, vmss.NameLabel); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vmssSchemaDescription, vmss.NameDescription); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vmssSchemaEnabled, vmss.Enabled); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vmssSchemaType, string(vmss.Type)); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vmssSchemaFrequency, string(vmss.Frequency)); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vmssSchemaSchedule, vmss.Schedule); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vmssSchemaRetainedSnapshots, vmss.RetainedSnapshots); err != nil {
+		return diag.FromErr(err)
+	}
+
+	vmUUIDs := make([]string, 0, len(vmss.VMs))
+	for _, vmRef := range vmss.VMs {
+		vmUUID, err := c.client.VM.GetUUID(c.session, vmRef)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		vmUUIDs = append(vmUUIDs, vmUUID)
+	}
+	sort.Strings(vmUUIDs)
+
+	if err := d.Set(vmssSchemaVMUUIDs, vmUUIDs); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return nil
+}
+
+func resourceVMSSUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	vmssRef, err := c.client.VMSS.GetByUUID(c.session, d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if d.HasChange(vmssSchemaName) {
+		if err := c.client.VMSS.SetNameLabel(c.session, vmssRef, d.Get(vmssSchemaName).(string)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange(vmssSchemaDescription) {
+		if err := c.client.VMSS.SetNameDescription(c.session, vmssRef, d.Get(vmssSchemaDescription).(string)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange(vmssSchemaEnabled) {
+		if err := c.client.VMSS.SetEnabled(c.session, vmssRef, d.Get(vmssSchemaEnabled).(bool)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange(vmssSchemaType) {
+		if err := c.client.VMSS.SetType(c.session, vmssRef, xenapi.VmssType(d.Get(vmssSchemaType).(string))); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	// The schedule keys depend on the frequency, so both are updated together
+	if d.HasChange(vmssSchemaFrequency) {
+		if err := c.client.VMSS.SetFrequency(c.session, vmssRef, xenapi.VmssFrequency(d.Get(vmssSchemaFrequency).(string))); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange(vmssSchemaSchedule) || d.HasChange(vmssSchemaFrequency) {
+		if err := c.client.VMSS.SetSchedule(c.session, vmssRef, vmssSchedule(d.Get(vmssSchemaSchedule))); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange(vmssSchemaRetainedSnapshots) {
+		if err := c.client.VMSS.SetRetainedSnapshots(c.session, vmssRef, d.Get(vmssSchemaRetainedSnapshots).(int)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange(vmssSchemaVMUUIDs) {
+		o, n := d.GetChange(vmssSchemaVMUUIDs)
+		oldVMs := o.(*schema.Set)
+		newVMs := n.(*schema.Set)
+
+		if err := setVMSSMembers(c, vmssNullRef, oldVMs.Difference(newVMs).List()); err != nil {
+			return diag.FromErr(err)
+		}
+
+		if err := setVMSSMembers(c, vmssRef, newVMs.Difference(oldVMs).List()); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	return resourceVMSSRead(ctx, d, m)
+}
+
+func resourceVMSSDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	vmssRef, err := c.client.VMSS.GetByUUID(c.session, d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	// A snapshot schedule can only be destroyed once no VM is attached anymore
+	vmRefs, err := c.client.VMSS.GetVMs(c.session, vmssRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	for _, vmRef := range vmRefs {
+		if err := c.client.VM.SetSnapshotSchedule(c.session, vmRef, vmssNullRef); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	return diag.FromErr(c.client.VMSS.Destroy(c.session, vmssRef))
+}
+
+func resourceVMSSExists(d *schema.ResourceData, m interface{}) (bool, error) {
+	c := m.(*Connection)
+
+	if _, err := c.client.VMSS.GetByUUID(c.session, d.Id()); err != nil {
+		if xenErr, ok := err.(*xenapi.Error); ok {
+			if xenErr.Code() == xenapi.ERR_UUID_INVALID {
+				return false, nil
+			}
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
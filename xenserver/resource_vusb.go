@@ -0,0 +1,218 @@
+package xenserver
+
+import (
+	"context"
+	"log"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+const (
+	vusbSchemaVMUUID            = "vm_uuid"
+	vusbSchemaUSBDeviceUUID     = "usb_device_uuid"
+	vusbSchemaHostUUID          = "host_uuid"
+	vusbSchemaUSBGroupUUID      = "usb_group_uuid"
+	vusbSchemaCurrentlyAttached = "currently_attached"
+)
+
+func resourceVUSB() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceVUSBCreate,
+		ReadContext:   forgetfulRead(resourceVUSBRead, resourceVUSBExists),
+		DeleteContext: resourceVUSBDelete,
+
+		Schema: map[string]*schema.Schema{
+			vusbSchemaVMUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateUUID,
+			},
+
+			vusbSchemaUSBDeviceUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateUUID,
+			},
+
+			vusbSchemaHostUUID: &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			vusbSchemaUSBGroupUUID: &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			vusbSchemaCurrentlyAttached: &schema.Schema{
+				Type:     schema.TypeBool,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func resourceVUSBCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	vm := &VMDescriptor{
+		UUID: d.Get(vusbSchemaVMUUID).(string),
+	}
+
+	if err := vm.Load(c); err != nil {
+		return diag.FromErr(referenceError(c, "VM", vm.UUID, err))
+	}
+
+	pusbUUID := d.Get(vusbSchemaUSBDeviceUUID).(string)
+
+	pusbRef, err := c.client.PUSB.GetByUUID(c.session, pusbUUID)
+	if err != nil {
+		return diag.FromErr(referenceError(c, "USB device", pusbUUID, err))
+	}
+
+	pusb, err := c.client.PUSB.GetRecord(c.session, pusbRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	// XenServer puts each USB device enabled for passthrough into a group of its
+	// own, VMs are given a device of a group
+	if !pusb.PassthroughEnabled {
+		log.Printf("[DEBUG] Enabling passthrough of USB device %s", pusbUUID)
+		if err := c.client.PUSB.SetPassthroughEnabled(c.session, pusbRef, true); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	usbGroupRef, err := c.client.PUSB.GetUSBGroup(c.session, pusbRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	log.Printf("[DEBUG] Passing USB device %s through to VM %s", pusbUUID, vm.UUID)
+	vusbRef, err := c.client.VUSB.Create(c.session, vm.VMRef, usbGroupRef, map[string]string{})
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	vusbUUID, err := c.client.VUSB.GetUUID(c.session, vusbRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId(vusbUUID)
+
+	return resourceVUSBRead(ctx, d, m)
+}
+
+func resourceVUSBRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	vusbRef, err := c.client.VUSB.GetByUUID(c.session, d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	vusb, err := c.client.VUSB.GetRecord(c.session, vusbRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	vm := &VMDescriptor{
+		VMRef: vusb.VM,
+	}
+	if err := vm.Query(c); err != nil {
+		return diag.FromErr(err)
+	}
+
+	usbGroupUUID, err := c.client.USBGroup.GetUUID(c.session, vusb.USBGroup)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	pusbRefs, err := c.client.USBGroup.GetPUSBs(c.session, vusb.USBGroup)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vusbSchemaVMUUID, vm.UUID); err != nil {
+		return diag.FromErr(err)
+	}
+
+	// The group is left empty while the device is unplugged from the host, the
+	// VUSB then gets the device back once it is plugged in again
+	if len(pusbRefs) > 0 {
+		pusb, err := c.client.PUSB.GetRecord(c.session, pusbRefs[0])
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		host := &HostDescriptor{
+			HostRef: pusb.Host,
+		}
+		if err := host.Query(c); err != nil {
+			return diag.FromErr(err)
+		}
+
+		if err := d.Set(vusbSchemaUSBDeviceUUID, pusb.UUID); err != nil {
+			return diag.FromErr(err)
+		}
+
+		if err := d.Set(vusbSchemaHostUUID, host.UUID); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if err := d.Set(vusbSchemaUSBGroupUUID, usbGroupUUID); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set(vusbSchemaCurrentlyAttached, vusb.CurrentlyAttached); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return nil
+}
+
+func resourceVUSBDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	vusbRef, err := c.client.VUSB.GetByUUID(c.session, d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	attached, err := c.client.VUSB.GetCurrentlyAttached(c.session, vusbRef)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if attached {
+		log.Printf("[DEBUG] Unplugging VUSB %s", d.Id())
+		if err := c.client.VUSB.Unplug(c.session, vusbRef); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	log.Printf("[DEBUG] Destroying VUSB %s", d.Id())
+	return diag.FromErr(c.client.VUSB.Destroy(c.session, vusbRef))
+}
+
+func resourceVUSBExists(d *schema.ResourceData, m interface{}) (bool, error) {
+	c := m.(*Connection)
+
+	if _, err := c.client.VUSB.GetByUUID(c.session, d.Id()); err != nil {
+		if xenErr, ok := err.(*xenapi.Error); ok {
+			if xenErr.Code() == xenapi.ERR_UUID_INVALID {
+				return false, nil
+			}
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,289 @@
+package xenserver
+
+import (
+	"context"
+	"log"
+	"sort"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+const (
+	xenstorePolicySchemaName         = "name"
+	xenstorePolicySchemaTag          = "tag"
+	xenstorePolicySchemaXenstoreData = "xenstore_data"
+	xenstorePolicySchemaVMUUIDs      = "vm_uuids"
+)
+
+func resourceXenstorePolicy() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceXenstorePolicyCreate,
+		ReadContext:   resourceXenstorePolicyRead,
+		UpdateContext: resourceXenstorePolicyUpdate,
+		DeleteContext: resourceXenstorePolicyDelete,
+
+		CustomizeDiff: resourceXenstorePolicyCustomizeDiff,
+
+		Schema: map[string]*schema.Schema{
+			xenstorePolicySchemaName: &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+
+			xenstorePolicySchemaTag: &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+			},
+
+			xenstorePolicySchemaXenstoreData: &schema.Schema{
+				Type:     schema.TypeMap,
+				Required: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+
+			xenstorePolicySchemaVMUUIDs: &schema.Schema{
+				Type:     schema.TypeSet,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+				Set:      schema.HashString,
+			},
+		},
+	}
+}
+
+// queryVMsByTag returns all VMs, excluding templates, snapshots and control
+// domains, carrying the given tag.
+func queryVMsByTag(c *Connection, tag string) (map[xenapi.VMRef]xenapi.VMRecord, error) {
+	vms, err := c.client.VM.GetAllRecords(c.session)
+	if err != nil {
+		return nil, err
+	}
+
+	tagged := make(map[xenapi.VMRef]xenapi.VMRecord)
+	for vmRef, vm := range vms {
+		if vm.IsATemplate || vm.IsASnapshot || vm.IsControlDomain {
+			continue
+		}
+
+		for _, vmTag := range vm.Tags {
+			if vmTag == tag {
+				tagged[vmRef] = vm
+				break
+			}
+		}
+	}
+
+	return tagged, nil
+}
+
+func xenstorePolicyData(raw interface{}) map[string]string {
+	data := make(map[string]string)
+	for k, v := range raw.(map[string]interface{}) {
+		data[k] = v.(string)
+	}
+	return data
+}
+
+// xenstorePolicyDrift returns the keys of the policy as they are found on the
+// VMs. Keys some VM lacks are left out and keys some VM has a different value
+// for take that value, so that the next plan shows the drift per key.
+func xenstorePolicyDrift(vms map[xenapi.VMRef]xenapi.VMRecord, data map[string]string) map[string]string {
+	vmUUIDs := make([]string, 0, len(vms))
+	byUUID := make(map[string]xenapi.VMRecord, len(vms))
+	for _, vm := range vms {
+		vmUUIDs = append(vmUUIDs, vm.UUID)
+		byUUID[vm.UUID] = vm
+	}
+	sort.Strings(vmUUIDs)
+
+	found := make(map[string]string, len(data))
+	for k, v := range data {
+		found[k] = v
+
+		for _, vmUUID := range vmUUIDs {
+			vmValue, ok := byUUID[vmUUID].XenstoreData[k]
+			if !ok {
+				log.Printf("[DEBUG] VM %s lacks xenstore key %s", vmUUID, k)
+				delete(found, k)
+				break
+			}
+			if vmValue != v {
+				log.Printf("[DEBUG] VM %s has xenstore key %s set to %q instead of %q", vmUUID, k, vmValue, v)
+				found[k] = vmValue
+				break
+			}
+		}
+	}
+
+	return found
+}
+
+func resourceXenstorePolicyCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	c := m.(*Connection)
+
+	vms, err := queryVMsByTag(c, d.Get(xenstorePolicySchemaTag).(string))
+	if err != nil {
+		return err
+	}
+
+	desired := make([]interface{}, 0, len(vms))
+	for _, vm := range vms {
+		desired = append(desired, vm.UUID)
+	}
+
+	current := d.Get(xenstorePolicySchemaVMUUIDs).(*schema.Set)
+	if !current.Equal(schema.NewSet(schema.HashString, desired)) {
+		return d.SetNew(xenstorePolicySchemaVMUUIDs, desired)
+	}
+
+	return nil
+}
+
+// applyXenstorePolicy pushes the keys of the policy to all tagged VMs and
+// removes keys no longer part of the policy, as well as all keys of the policy
+// from VMs which are not tagged anymore.
+func applyXenstorePolicy(c *Connection, d *schema.ResourceData) error {
+	o, n := d.GetChange(xenstorePolicySchemaXenstoreData)
+	oldData := xenstorePolicyData(o)
+	newData := xenstorePolicyData(n)
+
+	vms, err := queryVMsByTag(c, d.Get(xenstorePolicySchemaTag).(string))
+	if err != nil {
+		return err
+	}
+
+	applied := make(map[string]bool)
+	for vmRef, vm := range vms {
+		for k := range oldData {
+			if _, ok := newData[k]; !ok {
+				if err := c.client.VM.RemoveFromXenstoreData(c.session, vmRef, k); err != nil {
+					return err
+				}
+			}
+		}
+
+		for k, v := range newData {
+			if vmValue, ok := vm.XenstoreData[k]; ok && vmValue == v {
+				continue
+			}
+
+			// The key has to be removed first, adding fails for existing keys
+			if _, ok := vm.XenstoreData[k]; ok {
+				if err := c.client.VM.RemoveFromXenstoreData(c.session, vmRef, k); err != nil {
+					return err
+				}
+			}
+
+			if err := c.client.VM.AddToXenstoreData(c.session, vmRef, k, v); err != nil {
+				return err
+			}
+		}
+
+		log.Printf("[DEBUG] Applied xenstore policy %s to VM %s", d.Id(), vm.UUID)
+		applied[vm.UUID] = true
+	}
+
+	oldVMUUIDs, _ := d.GetChange(xenstorePolicySchemaVMUUIDs)
+	for _, _vmUUID := range oldVMUUIDs.(*schema.Set).List() {
+		vmUUID := _vmUUID.(string)
+		if applied[vmUUID] {
+			continue
+		}
+
+		if err := removeXenstorePolicy(c, vmUUID, oldData); err != nil {
+			return err
+		}
+	}
+
+	vmUUIDs := make([]string, 0, len(applied))
+	for vmUUID := range applied {
+		vmUUIDs = append(vmUUIDs, vmUUID)
+	}
+	sort.Strings(vmUUIDs)
+
+	return d.Set(xenstorePolicySchemaVMUUIDs, vmUUIDs)
+}
+
+func removeXenstorePolicy(c *Connection, vmUUID string, data map[string]string) error {
+	vmRef, err := c.client.VM.GetByUUID(c.session, vmUUID)
+	if err != nil {
+		if xenErr, ok := err.(*xenapi.Error); ok {
+			if xenErr.Code() == xenapi.ERR_UUID_INVALID {
+				return nil
+			}
+		}
+		return err
+	}
+
+	for k := range data {
+		if err := c.client.VM.RemoveFromXenstoreData(c.session, vmRef, k); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("[DEBUG] Removed xenstore policy from VM %s", vmUUID)
+	return nil
+}
+
+func resourceXenstorePolicyCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	d.SetId(d.Get(xenstorePolicySchemaName).(string))
+
+	if err := applyXenstorePolicy(c, d); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return resourceXenstorePolicyRead(ctx, d, m)
+}
+
+func resourceXenstorePolicyRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	vms, err := queryVMsByTag(c, d.Get(xenstorePolicySchemaTag).(string))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	vmUUIDs := make([]string, 0, len(vms))
+	for _, vm := range vms {
+		vmUUIDs = append(vmUUIDs, vm.UUID)
+	}
+	sort.Strings(vmUUIDs)
+
+	if err := d.Set(xenstorePolicySchemaVMUUIDs, vmUUIDs); err != nil {
+		return diag.FromErr(err)
+	}
+
+	// Changes made to the xenstore data of the VMs show up as changes of the
+	// keys, and are reverted on the next apply
+	data := xenstorePolicyData(d.Get(xenstorePolicySchemaXenstoreData))
+	return diag.FromErr(d.Set(xenstorePolicySchemaXenstoreData, xenstorePolicyDrift(vms, data)))
+}
+
+func resourceXenstorePolicyUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	if err := applyXenstorePolicy(c, d); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return resourceXenstorePolicyRead(ctx, d, m)
+}
+
+func resourceXenstorePolicyDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	c := m.(*Connection)
+
+	data := xenstorePolicyData(d.Get(xenstorePolicySchemaXenstoreData))
+
+	for _, vmUUID := range d.Get(xenstorePolicySchemaVMUUIDs).(*schema.Set).List() {
+		if err := removeXenstorePolicy(c, vmUUID.(string), data); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package xenserver
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+// Errors of storage operations caused by other operations on the same SR, which
+// are likely to succeed once those are done. Task failures only carry the error
+// codes in their message.
+var srContentionErrors = []string{
+	// Reported by file based SRs, e.g. NFS, while space is being reclaimed
+	"SR_BACKEND_FAILURE_44",
+	// The VDI is locked by another operation
+	"SR_BACKEND_FAILURE_46",
+	xenapi.ERR_SR_VDI_LOCKING_FAILED,
+	xenapi.ERR_VDI_IN_USE,
+	xenapi.ERR_OTHER_OPERATION_IN_PROGRESS,
+}
+
+const (
+	// Attempts of a storage operation failing due to contention
+	srOperationAttempts = 5
+
+	// Delay before the first retry, doubled for every further one
+	srOperationRetryDelay = 5 * time.Second
+)
+
+// srOperations limits the number of storage operations run in parallel per SR.
+// Terraform creates independent resources in parallel, which makes some SR
+// drivers report spurious failures when many disks are created at once. It is
+// shared by all connections of the provider.
+type srOperations struct {
+	parallelism int
+	mutex       sync.Mutex
+	slots       map[xenapi.SRRef]chan struct{}
+}
+
+func newSROperations(parallelism int) *srOperations {
+	return &srOperations{
+		parallelism: parallelism,
+		slots:       make(map[xenapi.SRRef]chan struct{}),
+	}
+}
+
+func (so *srOperations) slotsOf(sr xenapi.SRRef) chan struct{} {
+	so.mutex.Lock()
+	defer so.mutex.Unlock()
+
+	slots, ok := so.slots[sr]
+	if !ok {
+		slots = make(chan struct{}, so.parallelism)
+		so.slots[sr] = slots
+	}
+
+	return slots
+}
+
+// withSROperation runs a storage operation on the SR once one of the slots of
+// the SR is free. The operation is retried with an increasing delay while it
+// fails due to contention, it must clean up after itself when failing.
+func withSROperation(c *Connection, sr xenapi.SRRef, operation func() error) error {
+	if c.srOperations == nil || c.srOperations.parallelism <= 0 {
+		return retrySROperation(c, sr, operation)
+	}
+
+	slots := c.srOperations.slotsOf(sr)
+	select {
+	case slots <- struct{}{}:
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	}
+	defer func() { <-slots }()
+
+	return retrySROperation(c, sr, operation)
+}
+
+func retrySROperation(c *Connection, sr xenapi.SRRef, operation func() error) error {
+	delay := srOperationRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := operation()
+		if err == nil || attempt == srOperationAttempts || !isSRContentionError(err) {
+			return err
+		}
+
+		log.Printf("[WARN] Storage operation on SR %s failed, retrying in %s: %s", sr, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-c.ctx.Done():
+			return fmt.Errorf("%s, retry aborted: %s", err, c.ctx.Err())
+		}
+		delay *= 2
+	}
+}
+
+func isSRContentionError(err error) bool {
+	message := err.Error()
+	for _, code := range srContentionErrors {
+		if strings.Contains(message, code) {
+			return true
+		}
+	}
+
+	return false
+}
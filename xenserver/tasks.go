@@ -0,0 +1,172 @@
+package xenserver
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+// Interval in which the status of asynchronous tasks is polled if the pool
+// does not report the changes of the task as events
+const taskPollInterval = 2 * time.Second
+
+// Task results are XML-RPC encoded, e.g. <value>OpaqueRef:...</value>
+var taskResultTags = regexp.MustCompile(`</?value>`)
+
+// callAsync invokes the asynchronous variant of a XenAPI method, e.g.
+// "VDI.copy", and returns the task tracking it. The generated client only
+// provides the synchronous calls, so the arguments have to be passed in their
+// wire format, i.e. references as strings.
+func callAsync(c *Connection, method string, args ...interface{}) (xenapi.TaskRef, error) {
+	params := append([]interface{}{string(c.session)}, args...)
+
+	result, err := c.client.APICall("Async."+method, params...)
+	if err != nil {
+		return "", err
+	}
+
+	task, ok := result.Value.(string)
+	if !ok {
+		return "", fmt.Errorf("%s did not return a task reference", method)
+	}
+
+	return xenapi.TaskRef(task), nil
+}
+
+// waitForTask waits for the task to complete and returns its result. The
+// status of the task is checked whenever an event reports a change of it. A
+// task which is given up on before it completed, e.g. because the context of
+// the connection is done, gets cancelled. The task is destroyed in any case.
+func waitForTask(c *Connection, task xenapi.TaskRef) (string, error) {
+	result, err := pollTask(c, task)
+	c.audit.finishTask(task, err)
+	return result, err
+}
+
+func pollTask(c *Connection, task xenapi.TaskRef) (result string, err error) {
+	defer func() {
+		cleanup, cancel, err := c.forCleanup()
+		if err != nil {
+			log.Println("[ERROR] ", err)
+			return
+		}
+		defer cancel()
+
+		if err := cleanup.client.Task.Destroy(cleanup.session, task); err != nil {
+			log.Println("[ERROR] ", err)
+		}
+	}()
+
+	// Do not leave a task running behind which is no longer waited for
+	completed := false
+	defer func() {
+		if err != nil && !completed {
+			cancelTask(c, task)
+		}
+	}()
+
+	// Subscribe before the first check, so that no change gets lost in between
+	watcher := newEventWatcher(c, taskPollInterval, "task/"+string(task))
+
+	progress := newTaskProgress(c, task)
+
+	for {
+		status, err := c.client.Task.GetStatus(c.session, task)
+		if err != nil {
+			if ctxErr := c.ctx.Err(); ctxErr != nil {
+				return "", ctxErr
+			}
+			return "", err
+		}
+		completed = status != xenapi.TaskStatusTypePending
+
+		switch status {
+		case xenapi.TaskStatusTypeSuccess:
+			result, err := c.client.Task.GetResult(c.session, task)
+			if err != nil {
+				return "", err
+			}
+			return strings.TrimSpace(taskResultTags.ReplaceAllString(result, "")), nil
+
+		case xenapi.TaskStatusTypeFailure:
+			errorInfo, err := c.client.Task.GetErrorInfo(c.session, task)
+			if err != nil {
+				return "", err
+			}
+			return "", fmt.Errorf("task failed: %s", strings.Join(errorInfo, ", "))
+
+		case xenapi.TaskStatusTypeCancelled:
+			return "", fmt.Errorf("task has been cancelled")
+		}
+
+		progress.update(c)
+
+		if err := watcher.wait(eventWaitTimeout); err != nil {
+			if ctxErr := c.ctx.Err(); ctxErr != nil {
+				return "", ctxErr
+			}
+			return "", err
+		}
+	}
+}
+
+// taskProgress reports the progress of a task to the log, so that long running
+// operations can be told apart from hanging ones.
+type taskProgress struct {
+	task        xenapi.TaskRef
+	description string
+	percent     int
+}
+
+func newTaskProgress(c *Connection, task xenapi.TaskRef) *taskProgress {
+	p := &taskProgress{
+		task:        task,
+		description: string(task),
+		percent:     -1,
+	}
+
+	// The UUID and name of the task are only used for the log, the task can
+	// still be polled if they are unavailable
+	if uuid, err := c.client.Task.GetUUID(c.session, task); err == nil {
+		p.description = uuid
+		if name, err := c.client.Task.GetNameLabel(c.session, task); err == nil && name != "" {
+			p.description = fmt.Sprintf("%s (%s)", uuid, name)
+		}
+	}
+
+	return p
+}
+
+// update logs the progress of the task whenever its percentage changed since
+// the last update.
+func (p *taskProgress) update(c *Connection) {
+	progress, err := c.client.Task.GetProgress(c.session, p.task)
+	if err != nil {
+		return
+	}
+
+	if percent := int(progress * 100); percent != p.percent {
+		p.percent = percent
+		log.Printf("[INFO] Task %s is %d%% complete", p.description, percent)
+	}
+}
+
+// cancelTask asks XenServer to cancel the task on behalf of a connection whose
+// context is done already.
+func cancelTask(c *Connection, task xenapi.TaskRef) {
+	cleanup, cancel, err := c.forCleanup()
+	if err != nil {
+		log.Println("[ERROR] ", err)
+		return
+	}
+	defer cancel()
+
+	log.Printf("[DEBUG] Cancelling task %s", task)
+	if err := cleanup.client.Task.Cancel(cleanup.session, task); err != nil {
+		log.Println("[ERROR] ", err)
+	}
+}
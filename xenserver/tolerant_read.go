@@ -0,0 +1,65 @@
+package xenserver
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// tolerateReadErrors wraps the Read functions of all resources so that, with
+// tolerate_read_errors enabled, a failure to refresh a single object is reported
+// as a warning instead of aborting the whole plan. The resource keeps its last
+// known state in that case.
+func tolerateReadErrors(resources map[string]*schema.Resource) {
+	for name, resource := range resources {
+		if resource.ReadContext != nil {
+			resource.ReadContext = tolerantRead(name, resource.Schema, resource.ReadContext)
+		}
+	}
+}
+
+// tolerantRead wraps read, which has to be wrapped by forgetfulRead already if
+// the resource can tell whether its object is gone: resources whose object is
+// gone must still be removed from the state. Read may have set some attributes
+// before it failed, so all of them are restored to their prior values.
+func tolerantRead(name string, fields map[string]*schema.Schema, read schema.ReadContextFunc) schema.ReadContextFunc {
+	return func(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+		id := d.Id()
+		prior := make(map[string]interface{}, len(fields))
+		for field := range fields {
+			prior[field] = d.Get(field)
+		}
+
+		diags := read(ctx, d, m)
+		if !diags.HasError() || !isTolerableReadError(m.(*Connection)) {
+			return diags
+		}
+
+		d.SetId(id)
+		for field, value := range prior {
+			if err := d.Set(field, value); err != nil {
+				return append(diags, diag.FromErr(err)...)
+			}
+		}
+
+		warnings := make(diag.Diagnostics, 0, len(diags))
+		for _, diagnostic := range diags {
+			log.Printf("[WARN] Failed to read %s %s, keeping its last known state: %s", name, id, diagnostic.Summary)
+			warnings = append(warnings, diag.Diagnostic{
+				Severity: diag.Warning,
+				Summary:  fmt.Sprintf("Failed to read %s %s, keeping its last known state", name, id),
+				Detail:   diagnostic.Summary,
+			})
+		}
+		return warnings
+	}
+}
+
+// isTolerableReadError reports whether a failed read may be degraded to a
+// warning. An interrupted run must still be aborted.
+func isTolerableReadError(c *Connection) bool {
+	return c.tolerateReadErrors && c.ctx.Err() == nil
+}
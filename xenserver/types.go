@@ -21,6 +21,7 @@ package xenserver
 import (
 	"fmt"
 	"log"
+	"sort"
 	"strconv"
 
 	xenapi "github.com/terra-farm/go-xen-api-client"
@@ -37,6 +38,9 @@ type NetworkDescriptor struct {
 	Description string
 	Bridge      string
 	MTU         int
+	OtherConfig map[string]string
+
+	DefaultLockingMode xenapi.NetworkDefaultLockingMode
 
 	NetworkRef xenapi.NetworkRef
 }
@@ -50,6 +54,7 @@ type VMDescriptor struct {
 	StaticMemory      Range
 	DynamicMemory     Range
 	VCPUCount         int
+	VCPUMax           int
 	VIFCount          int
 	VBDCount          int
 	PCICount          int
@@ -57,7 +62,16 @@ type VMDescriptor struct {
 	XenstoreData      map[string]string
 	HVMBootParameters map[string]string
 	Platform          map[string]string
+	VCPUParams        map[string]string
 	IsATemplate       bool
+	HARestartPriority string
+	HAAlwaysRun       bool
+	Order             int
+	StartDelay        int
+	ShutdownDelay     int
+	Affinity          xenapi.HostRef
+	SuspendSR         xenapi.SRRef
+	AllowedOperations []string
 
 	VMRef xenapi.VMRef
 }
@@ -71,29 +85,40 @@ type VIFDescriptor struct {
 	IsAutogeneratedMAC bool
 	DeviceOrder        int
 	OtherConfig        map[string]string
+	QosAlgorithmType   string
+	QosAlgorithmParams map[string]string
+	LockingMode        xenapi.VifLockingMode
+	IPv4Allowed        []string
+	IPv6Allowed        []string
 
 	VIFRef xenapi.VIFRef
 }
 
 type SRDescriptor struct {
-	Name        string
-	UUID        string
-	Description string
-	Host        string
-	Type        string
-	ContentType string
-	Shared      bool
+	Name              string
+	UUID              string
+	Description       string
+	Host              string
+	Type              string
+	ContentType       string
+	Shared            bool
+	AllowedOperations []string
 
 	SRRef xenapi.SRRef
 }
 
 type VDIDescriptor struct {
-	Name       string
-	UUID       string
-	SR         *SRDescriptor
-	IsShared   bool
-	IsReadOnly bool
-	Size       int
+	Name              string
+	Description       string
+	UUID              string
+	SR                *SRDescriptor
+	IsShared          bool
+	IsReadOnly        bool
+	Size              int
+	CBTEnabled        bool
+	SmConfig          map[string]string
+	OtherConfig       map[string]string
+	AllowedOperations []string
 
 	VDIRef xenapi.VDIRef
 }
@@ -110,15 +135,41 @@ type VBDDescriptor struct {
 	OtherConfig      map[string]string
 	IsTemplateDevice bool
 
+	QosAlgorithmType   string
+	QosAlgorithmParams map[string]string
+
 	VBDRef xenapi.VBDRef
 }
 
 type PIFDescriptor struct {
-	UUID string
+	UUID    string
+	Device  string
+	MAC     string
+	VLAN    int
+	Network NetworkDescriptor
 
 	PIFRef xenapi.PIFRef
 }
 
+type BondDescriptor struct {
+	UUID    string
+	Mode    xenapi.BondMode
+	Master  PIFDescriptor
+	Members []PIFDescriptor
+
+	BondRef xenapi.BondRef
+}
+
+type HostDescriptor struct {
+	UUID        string
+	Name        string
+	Description string
+	Address     string
+	Enabled     bool
+
+	HostRef xenapi.HostRef
+}
+
 type VLANDescriptor struct {
 	UUID        string
 	Tag         int
@@ -130,6 +181,11 @@ type VLANDescriptor struct {
 }
 
 func (this *NetworkDescriptor) Load(c *Connection) error {
+	// A known reference handle saves the lookup by name or UUID
+	if this.NetworkRef != "" {
+		return this.Query(c)
+	}
+
 	var network xenapi.NetworkRef
 
 	hasNetName := false
@@ -147,11 +203,19 @@ func (this *NetworkDescriptor) Load(c *Connection) error {
 
 		hasNetName = true
 		network = networks[0]
+
+		if len(networks) > 1 {
+			if err := checkDuplicateNames(c, "network", this.Name, len(networks), func(i int) (string, error) {
+				return c.client.Network.GetUUID(c.session, networks[i])
+			}); err != nil {
+				return err
+			}
+		}
 	}
 
 	if !hasNetName {
 		if this.UUID != "" {
-			_network, err := c.client.Network.GetByUUID(c.session, this.UUID)
+			_network, err := c.getNetworkByUUID(this.UUID)
 			if err != nil {
 				return err
 			}
@@ -170,7 +234,11 @@ func (this *NetworkDescriptor) Load(c *Connection) error {
 }
 
 func (this *NetworkDescriptor) Query(c *Connection) error {
-	network, err := c.client.Network.GetRecord(c.session, this.NetworkRef)
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+
+	network, err := c.getNetworkRecord(this.NetworkRef)
 	if err != nil {
 		return err
 	}
@@ -180,11 +248,18 @@ func (this *NetworkDescriptor) Query(c *Connection) error {
 	this.Description = network.NameDescription
 	this.MTU = network.MTU
 	this.Bridge = network.Bridge
+	this.OtherConfig = network.OtherConfig
+	this.DefaultLockingMode = network.DefaultLockingMode
 
 	return nil
 }
 
 func (this *VMDescriptor) Load(c *Connection) error {
+	// A known reference handle saves the lookup by name or UUID
+	if this.VMRef != "" {
+		return this.Query(c)
+	}
+
 	var vm xenapi.VMRef
 
 	hasVMName := false
@@ -202,11 +277,19 @@ func (this *VMDescriptor) Load(c *Connection) error {
 
 		hasVMName = true
 		vm = vms[0]
+
+		if len(vms) > 1 {
+			if err := checkDuplicateNames(c, "VM", this.Name, len(vms), func(i int) (string, error) {
+				return c.client.VM.GetUUID(c.session, vms[i])
+			}); err != nil {
+				return err
+			}
+		}
 	}
 
 	if !hasVMName {
 		if this.UUID != "" {
-			_vm, err := c.client.VM.GetByUUID(c.session, this.UUID)
+			_vm, err := c.getVMByUUID(this.UUID)
 			if err != nil {
 				return err
 			}
@@ -225,7 +308,11 @@ func (this *VMDescriptor) Load(c *Connection) error {
 }
 
 func (this *VMDescriptor) Query(c *Connection) error {
-	vm, err := c.client.VM.GetRecord(c.session, this.VMRef)
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+
+	vm, err := c.getVMRecord(this.VMRef)
 	if err != nil {
 		return err
 	}
@@ -235,7 +322,8 @@ func (this *VMDescriptor) Query(c *Connection) error {
 	this.Description = vm.NameDescription
 	this.PowerState = vm.PowerState
 	this.IsPV = vm.PVBootloader != ""
-	this.VCPUCount = vm.VCPUsMax
+	this.VCPUCount = vm.VCPUsAtStartup
+	this.VCPUMax = vm.VCPUsMax
 	this.StaticMemory = Range{
 		Min: vm.MemoryStaticMin,
 		Max: vm.MemoryStaticMax,
@@ -250,7 +338,21 @@ func (this *VMDescriptor) Query(c *Connection) error {
 	this.OtherConfig = vm.OtherConfig
 	this.XenstoreData = vm.XenstoreData
 	this.HVMBootParameters = vm.HVMBootParams
+	this.VCPUParams = vm.VCPUsParams
 	this.IsATemplate = vm.IsATemplate
+	this.HARestartPriority = vm.HaRestartPriority
+	this.HAAlwaysRun = vm.HaAlwaysRun
+	this.Order = vm.Order
+	this.StartDelay = vm.StartDelay
+	this.ShutdownDelay = vm.ShutdownDelay
+	this.Affinity = vm.Affinity
+	this.SuspendSR = vm.SuspendSR
+
+	this.AllowedOperations = make([]string, 0, len(vm.AllowedOperations))
+	for _, op := range vm.AllowedOperations {
+		this.AllowedOperations = append(this.AllowedOperations, string(op))
+	}
+	sort.Strings(this.AllowedOperations)
 
 	if this.Platform, err = c.client.VM.GetPlatform(c.session, this.VMRef); err != nil {
 		return err
@@ -268,8 +370,50 @@ func (this *VMDescriptor) UpdateMemory(c *Connection) error {
 		this.DynamicMemory.Max)
 }
 
+// UpdateMemoryLive changes the dynamic memory range of a running VM.
+func (this *VMDescriptor) UpdateMemoryLive(c *Connection) error {
+	return c.client.VM.SetMemoryDynamicRange(c.session,
+		this.VMRef,
+		this.DynamicMemory.Min,
+		this.DynamicMemory.Max)
+}
+
 func (this *VMDescriptor) UpdateVCPUs(c *Connection) error {
-	if err := c.client.VM.SetVCPUsMax(c.session, this.VMRef, this.VCPUCount); err != nil {
+	if this.VCPUMax < this.VCPUCount {
+		this.VCPUMax = this.VCPUCount
+	}
+
+	currentMax, err := c.client.VM.GetVCPUsMax(c.session, this.VMRef)
+	if err != nil {
+		return err
+	}
+
+	// VCPUs_at_startup must never exceed VCPUs_max, so the order of the calls
+	// depends on whether the maximum grows or shrinks
+	if this.VCPUMax >= currentMax {
+		if this.VCPUMax != currentMax {
+			if err := c.client.VM.SetVCPUsMax(c.session, this.VMRef, this.VCPUMax); err != nil {
+				return err
+			}
+		}
+		if err := c.client.VM.SetVCPUsAtStartup(c.session, this.VMRef, this.VCPUCount); err != nil {
+			return err
+		}
+	} else {
+		if err := c.client.VM.SetVCPUsAtStartup(c.session, this.VMRef, this.VCPUCount); err != nil {
+			return err
+		}
+		if err := c.client.VM.SetVCPUsMax(c.session, this.VMRef, this.VCPUMax); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UpdateVCPUsLive hot plugs or unplugs VCPUs of a running VM, up to VCPUs_max.
+func (this *VMDescriptor) UpdateVCPUsLive(c *Connection) error {
+	if err := c.client.VM.SetVCPUsNumberLive(c.session, this.VMRef, this.VCPUCount); err != nil {
 		return err
 	}
 	if err := c.client.VM.SetVCPUsAtStartup(c.session, this.VMRef, this.VCPUCount); err != nil {
@@ -282,7 +426,7 @@ func (this *VMDescriptor) UpdateVCPUs(c *Connection) error {
 func (this *VIFDescriptor) Load(c *Connection) error {
 	var VIFRef xenapi.VIFRef
 	var err error
-	if VIFRef, err = c.client.VIF.GetByUUID(c.session, this.UUID); err != nil {
+	if VIFRef, err = c.getVIFByUUID(this.UUID); err != nil {
 		return err
 	}
 	this.VIFRef = VIFRef
@@ -291,9 +435,13 @@ func (this *VIFDescriptor) Load(c *Connection) error {
 }
 
 func (this *VIFDescriptor) Query(c *Connection) error {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+
 	var vif xenapi.VIFRecord
 	var err error
-	if vif, err = c.client.VIF.GetRecord(c.session, this.VIFRef); err != nil {
+	if vif, err = c.getVIFRecord(this.VIFRef); err != nil {
 		return err
 	}
 
@@ -303,6 +451,11 @@ func (this *VIFDescriptor) Query(c *Connection) error {
 	this.IsAutogeneratedMAC = vif.MACAutogenerated
 	this.MAC = vif.MAC
 	this.OtherConfig = vif.OtherConfig
+	this.QosAlgorithmType = vif.QosAlgorithmType
+	this.QosAlgorithmParams = vif.QosAlgorithmParams
+	this.LockingMode = vif.LockingMode
+	this.IPv4Allowed = vif.Ipv4Allowed
+	this.IPv6Allowed = vif.Ipv6Allowed
 
 	if this.Network == nil {
 		this.Network = &NetworkDescriptor{
@@ -326,6 +479,11 @@ func (this *VIFDescriptor) Query(c *Connection) error {
 }
 
 func (this *SRDescriptor) Load(c *Connection) error {
+	// A known reference handle saves the lookup by name or UUID
+	if this.SRRef != "" {
+		return this.Query(c)
+	}
+
 	var sr xenapi.SRRef
 
 	hasSRName := false
@@ -343,11 +501,19 @@ func (this *SRDescriptor) Load(c *Connection) error {
 
 		hasSRName = true
 		sr = srs[0]
+
+		if len(srs) > 1 {
+			if err := checkDuplicateNames(c, "SR", this.Name, len(srs), func(i int) (string, error) {
+				return c.client.SR.GetUUID(c.session, srs[i])
+			}); err != nil {
+				return err
+			}
+		}
 	}
 
 	if !hasSRName {
 		if this.UUID != "" {
-			_sr, err := c.client.SR.GetByUUID(c.session, this.UUID)
+			_sr, err := c.getSRByUUID(this.UUID)
 			if err != nil {
 				return err
 			}
@@ -366,7 +532,11 @@ func (this *SRDescriptor) Load(c *Connection) error {
 }
 
 func (this *SRDescriptor) Query(c *Connection) error {
-	sr, err := c.client.SR.GetRecord(c.session, this.SRRef)
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+
+	sr, err := c.getSRRecord(this.SRRef)
 	if err != nil {
 		return err
 	}
@@ -375,6 +545,12 @@ func (this *SRDescriptor) Query(c *Connection) error {
 	this.Name = sr.NameLabel
 	this.Description = sr.NameDescription
 	this.Shared = sr.Shared
+
+	this.AllowedOperations = make([]string, 0, len(sr.AllowedOperations))
+	for _, op := range sr.AllowedOperations {
+		this.AllowedOperations = append(this.AllowedOperations, string(op))
+	}
+	sort.Strings(this.AllowedOperations)
 	this.Type = sr.Type
 	this.ContentType = sr.ContentType
 	log.Println("[DEBUG] ", sr.SmConfig)
@@ -383,6 +559,11 @@ func (this *SRDescriptor) Query(c *Connection) error {
 }
 
 func (this *VDIDescriptor) Load(c *Connection) error {
+	// A known reference handle saves the lookup by name or UUID
+	if this.VDIRef != "" {
+		return this.Query(c)
+	}
+
 	var vdi xenapi.VDIRef
 
 	hasVDIName := false
@@ -400,11 +581,19 @@ func (this *VDIDescriptor) Load(c *Connection) error {
 
 		hasVDIName = true
 		vdi = vdis[0]
+
+		if len(vdis) > 1 {
+			if err := checkDuplicateNames(c, "VDI", this.Name, len(vdis), func(i int) (string, error) {
+				return c.client.VDI.GetUUID(c.session, vdis[i])
+			}); err != nil {
+				return err
+			}
+		}
 	}
 
 	if !hasVDIName {
 		if this.UUID != "" {
-			_vdi, err := c.client.VDI.GetByUUID(c.session, this.UUID)
+			_vdi, err := c.getVDIByUUID(this.UUID)
 			if err != nil {
 				return err
 			}
@@ -423,16 +612,30 @@ func (this *VDIDescriptor) Load(c *Connection) error {
 }
 
 func (this *VDIDescriptor) Query(c *Connection) error {
-	vdi, err := c.client.VDI.GetRecord(c.session, this.VDIRef)
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+
+	vdi, err := c.getVDIRecord(this.VDIRef)
 	if err != nil {
 		return err
 	}
 
 	this.UUID = vdi.UUID
 	this.Name = vdi.NameLabel
+	this.Description = vdi.NameDescription
 	this.IsReadOnly = vdi.ReadOnly
 	this.IsShared = vdi.Sharable
 	this.Size = vdi.VirtualSize
+	this.CBTEnabled = vdi.CbtEnabled
+	this.SmConfig = vdi.SmConfig
+	this.OtherConfig = vdi.OtherConfig
+
+	this.AllowedOperations = make([]string, 0, len(vdi.AllowedOperations))
+	for _, op := range vdi.AllowedOperations {
+		this.AllowedOperations = append(this.AllowedOperations, string(op))
+	}
+	sort.Strings(this.AllowedOperations)
 
 	sr := &SRDescriptor{
 		SRRef: vdi.SR,
@@ -451,7 +654,7 @@ func (this *VDIDescriptor) Query(c *Connection) error {
 	var vbd xenapi.VBDRef
 
 	if this.UUID != "" {
-		_vbd, err := c.client.VBD.GetByUUID(c.session, this.UUID)
+		_vbd, err := c.getVBDByUUID(this.UUID)
 		if err != nil {
 			return err
 		}
@@ -466,10 +669,13 @@ func (this *VDIDescriptor) Query(c *Connection) error {
 }*/
 
 func (this *VBDDescriptor) Query(c *Connection) error {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
 
 	log.Println("[DEBUG] Query VBD")
 
-	vbd, err := c.client.VBD.GetRecord(c.session, this.VBDRef)
+	vbd, err := c.getVBDRecord(this.VBDRef)
 	if err != nil {
 		return err
 	}
@@ -481,6 +687,8 @@ func (this *VBDDescriptor) Query(c *Connection) error {
 	this.Bootable = vbd.Bootable
 	this.Mode = vbd.Mode
 	this.OtherConfig = vbd.OtherConfig
+	this.QosAlgorithmType = vbd.QosAlgorithmType
+	this.QosAlgorithmParams = vbd.QosAlgorithmParams
 
 	isTemplateDevice := false
 
@@ -520,6 +728,9 @@ func (this *VBDDescriptor) Query(c *Connection) error {
 }
 
 func (this *VBDDescriptor) Commit(c *Connection) (err error) {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
 
 	if err = c.client.VBD.SetBootable(c.session, this.VBDRef, this.Bootable); err != nil {
 		return err
@@ -535,16 +746,29 @@ func (this *VBDDescriptor) Commit(c *Connection) (err error) {
 		return err
 	}
 
+	if err = c.client.VBD.SetQosAlgorithmType(c.session, this.VBDRef, this.QosAlgorithmType); err != nil {
+		return err
+	}
+
+	if err = c.client.VBD.SetQosAlgorithmParams(c.session, this.VBDRef, this.QosAlgorithmParams); err != nil {
+		return err
+	}
+
 	log.Println("[DEBUG] VBD Commited")
 
 	return nil
 }
 
 func (this *PIFDescriptor) Load(c *Connection) error {
+	// A known reference handle saves the lookup by name or UUID
+	if this.PIFRef != "" {
+		return this.Query(c)
+	}
+
 	var pif xenapi.PIFRef
 
 	if this.UUID != "" {
-		_vbd, err := c.client.PIF.GetByUUID(c.session, this.UUID)
+		_vbd, err := c.getPIFByUUID(this.UUID)
 		if err != nil {
 			return err
 		}
@@ -559,17 +783,90 @@ func (this *PIFDescriptor) Load(c *Connection) error {
 }
 
 func (this *PIFDescriptor) Query(c *Connection) error {
-	pif, err := c.client.PIF.GetRecord(c.session, this.PIFRef)
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+
+	pif, err := c.getPIFRecord(this.PIFRef)
 	if err != nil {
 		return err
 	}
 
 	this.UUID = pif.UUID
+	this.Device = pif.Device
+	this.MAC = pif.MAC
+	this.VLAN = pif.VLAN
+
+	this.Network = NetworkDescriptor{
+		NetworkRef: pif.Network,
+	}
+	if err := this.Network.Query(c); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (this *BondDescriptor) Load(c *Connection) error {
+	// A known reference handle saves the lookup by name or UUID
+	if this.BondRef != "" {
+		return this.Query(c)
+	}
+
+	if this.UUID == "" {
+		return fmt.Errorf("%q should be specified!", bondSchemaMembers)
+	}
+
+	bond, err := c.client.Bond.GetByUUID(c.session, this.UUID)
+	if err != nil {
+		return err
+	}
+
+	this.BondRef = bond
+
+	return this.Query(c)
+}
+
+func (this *BondDescriptor) Query(c *Connection) error {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+
+	bond, err := c.client.Bond.GetRecord(c.session, this.BondRef)
+	if err != nil {
+		return err
+	}
+
+	this.UUID = bond.UUID
+	this.Mode = bond.Mode
+
+	this.Master = PIFDescriptor{
+		PIFRef: bond.Master,
+	}
+	if err := this.Master.Query(c); err != nil {
+		return err
+	}
+
+	this.Members = make([]PIFDescriptor, 0, len(bond.Slaves))
+	for _, slave := range bond.Slaves {
+		member := PIFDescriptor{
+			PIFRef: slave,
+		}
+		if err := member.Query(c); err != nil {
+			return err
+		}
+		this.Members = append(this.Members, member)
+	}
 
 	return nil
 }
 
 func (this *VLANDescriptor) Load(c *Connection) error {
+	// A known reference handle saves the lookup by name or UUID
+	if this.VLANRef != "" {
+		return this.Query(c)
+	}
+
 	var vlan xenapi.VLANRef
 
 	if this.UUID != "" {
@@ -588,6 +885,10 @@ func (this *VLANDescriptor) Load(c *Connection) error {
 }
 
 func (this *VLANDescriptor) Query(c *Connection) error {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+
 	vlan, err := c.client.VLAN.GetRecord(c.session, this.VLANRef)
 	if err != nil {
 		return err
@@ -623,3 +924,67 @@ func (this *VLANDescriptor) Query(c *Connection) error {
 
 	return nil
 }
+
+func (this *HostDescriptor) Load(c *Connection) error {
+	// A known reference handle saves the lookup by name or UUID
+	if this.HostRef != "" {
+		return this.Query(c)
+	}
+
+	var host xenapi.HostRef
+
+	hasHostName := false
+	hasHostUUID := false
+
+	if this.Name != "" {
+		hosts, err := c.client.Host.GetByNameLabel(c.session, this.Name)
+		if err != nil {
+			return err
+		}
+
+		if len(hosts) == 0 {
+			return fmt.Errorf("Host %q not found!", this.Name)
+		}
+
+		hasHostName = true
+		host = hosts[0]
+	}
+
+	if !hasHostName {
+		if this.UUID != "" {
+			_host, err := c.getHostByUUID(this.UUID)
+			if err != nil {
+				return err
+			}
+			hasHostUUID = true
+			host = _host
+		}
+	}
+
+	if !hasHostName && !hasHostUUID {
+		return fmt.Errorf("Either name or UUID should be specified!")
+	}
+
+	this.HostRef = host
+
+	return this.Query(c)
+}
+
+func (this *HostDescriptor) Query(c *Connection) error {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+
+	host, err := c.getHostRecord(this.HostRef)
+	if err != nil {
+		return err
+	}
+
+	this.UUID = host.UUID
+	this.Name = host.NameLabel
+	this.Description = host.NameDescription
+	this.Address = host.Address
+	this.Enabled = host.Enabled
+
+	return nil
+}
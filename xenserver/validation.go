@@ -0,0 +1,49 @@
+package xenserver
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+var (
+	uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+	// XenServer only accepts colon separated MAC addresses
+	macAddressRegexp = regexp.MustCompile(`^[0-9a-fA-F]{2}(:[0-9a-fA-F]{2}){5}$`)
+)
+
+const (
+	minVLANTag = 0
+	maxVLANTag = 4094
+
+	// Smallest MTU of IPv4 and largest MTU of jumbo frames XenServer supports
+	minMTU = 68
+	maxMTU = 9216
+)
+
+// Checks the arguments XenServer would otherwise only reject once the objects
+// are being created, so that typos are reported by terraform plan already
+var (
+	validateVLANTag = validation.IntBetween(minVLANTag, maxVLANTag)
+	validateMTU     = validation.IntBetween(minMTU, maxMTU)
+
+	// For arguments which select a default when empty
+	validateOptionalUUID       = validation.Any(validation.StringIsEmpty, validateUUID)
+	validateOptionalMACAddress = validation.Any(validation.StringIsEmpty, validateMACAddress)
+)
+
+func validateUUID(v interface{}, k string) ([]string, []error) {
+	if !uuidRegexp.MatchString(v.(string)) {
+		return nil, []error{fmt.Errorf("%q must be a UUID like 4cb4c2d7-3b2f-4e3a-9a8c-6e1f0b2d5a10, got %q", k, v.(string))}
+	}
+	return nil, nil
+}
+
+func validateMACAddress(v interface{}, k string) ([]string, []error) {
+	if !macAddressRegexp.MatchString(v.(string)) {
+		return nil, []error{fmt.Errorf("%q must be a MAC address like 02:16:3e:5a:10:2b, got %q", k, v.(string))}
+	}
+	return nil, nil
+}
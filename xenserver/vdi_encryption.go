@@ -0,0 +1,76 @@
+package xenserver
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+const (
+	vdiSchemaEncryptionKey           = "encryption_key"
+	vdiSchemaEncryptionKeySecretUUID = "encryption_key_secret_uuid"
+
+	// Keys in the sm_config of a VDI the encrypting SM drivers take the key
+	// from. Like for the device config of SRs, the _secret variant references
+	// a secret by its UUID instead of holding the key itself.
+	smConfigEncryptionKey       = "encryption_key"
+	smConfigEncryptionKeySecret = "encryption_key_secret"
+
+	// Feature the SM drivers able to encrypt VDIs report
+	smFeatureVDIEncryption = "VDI_ENCRYPTION"
+)
+
+// vdiEncryptionSmConfig adds the encryption key of the VDI to its sm_config,
+// after making sure the driver of the SR is able to encrypt it.
+func vdiEncryptionSmConfig(c *Connection, sr *SRDescriptor, d *schema.ResourceData, smConfig map[string]string) error {
+	key := d.Get(vdiSchemaEncryptionKey).(string)
+	secretUUID := d.Get(vdiSchemaEncryptionKeySecretUUID).(string)
+	if key == "" && secretUUID == "" {
+		return nil
+	}
+
+	supported, err := srSupportsEncryption(c, sr)
+	if err != nil {
+		return err
+	}
+	if !supported {
+		return fmt.Errorf("the %s driver of SR %s does not support encrypting VDIs", sr.Type, sr.UUID)
+	}
+
+	if secretUUID != "" {
+		if _, err := c.client.Secret.GetByUUID(c.session, secretUUID); err != nil {
+			return referenceError(c, "secret", secretUUID, err)
+		}
+		smConfig[smConfigEncryptionKeySecret] = secretUUID
+	} else {
+		smConfig[smConfigEncryptionKey] = key
+	}
+
+	return nil
+}
+
+// srSupportsEncryption tells whether the SM driver of the SR reports the
+// feature to encrypt VDIs.
+func srSupportsEncryption(c *Connection, sr *SRDescriptor) (bool, error) {
+	sms, err := c.client.SM.GetAllRecords(c.session)
+	if err != nil {
+		return false, err
+	}
+
+	for _, sm := range sms {
+		if sm.Type != sr.Type {
+			continue
+		}
+
+		if _, ok := sm.Features[smFeatureVDIEncryption]; ok {
+			return true, nil
+		}
+		for _, capability := range sm.Capabilities {
+			if capability == smFeatureVDIEncryption {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
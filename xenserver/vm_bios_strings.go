@@ -0,0 +1,95 @@
+package xenserver
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+const (
+	vmSchemaBIOSStrings = "bios_strings"
+
+	biosStringsSchemaCopyFromHostUUID   = "copy_from_host_uuid"
+	biosStringsSchemaSystemManufacturer = "system_manufacturer"
+	biosStringsSchemaSystemProductName  = "system_product_name"
+	biosStringsSchemaSystemSerialNumber = "system_serial_number"
+)
+
+// Keys of the BIOS strings of a VM the custom values are set for
+var biosStringsKeys = map[string]string{
+	biosStringsSchemaSystemManufacturer: "system-manufacturer",
+	biosStringsSchemaSystemProductName:  "system-product-name",
+	biosStringsSchemaSystemSerialNumber: "system-serial-number",
+}
+
+func resourceVMBIOSStrings() *schema.Resource {
+	// Copying the strings of a host and custom values are mutually exclusive
+	customValues := make([]string, 0, len(biosStringsKeys))
+	for field := range biosStringsKeys {
+		customValues = append(customValues, vmSchemaBIOSStrings+".0."+field)
+	}
+
+	fields := map[string]*schema.Schema{
+		biosStringsSchemaCopyFromHostUUID: &schema.Schema{
+			Type:          schema.TypeString,
+			Optional:      true,
+			ForceNew:      true,
+			ValidateFunc:  validateUUID,
+			ConflictsWith: customValues,
+		},
+	}
+
+	for field := range biosStringsKeys {
+		fields[field] = &schema.Schema{
+			Type:     schema.TypeString,
+			Optional: true,
+			ForceNew: true,
+		}
+	}
+
+	return &schema.Resource{
+		Schema: fields,
+	}
+}
+
+// applyBIOSStrings sets the BIOS strings of the new VM, which the guest reads as
+// SMBIOS data, either to the ones of a host or to custom values. XenServer
+// only allows this as long as the VM has not been started, a VM is given the
+// default BIOS strings of its host when it boots for the first time.
+func applyBIOSStrings(c *Connection, vm *VMDescriptor, biosStrings map[string]interface{}) error {
+	if hostUUID := biosStrings[biosStringsSchemaCopyFromHostUUID].(string); hostUUID != "" {
+		host := &HostDescriptor{
+			UUID: hostUUID,
+		}
+
+		if err := host.Load(c); err != nil {
+			return referenceError(c, "host", host.UUID, err)
+		}
+
+		log.Printf("[DEBUG] Copying the BIOS strings of host %s to VM %s", host.UUID, vm.UUID)
+		if err := c.client.VM.CopyBiosStrings(c.session, vm.VMRef, host.HostRef); err != nil {
+			return fmt.Errorf("failed to copy the BIOS strings of host %s to VM %s: %s", host.UUID, vm.UUID, err)
+		}
+
+		return nil
+	}
+
+	values := make(map[string]string)
+	for field, key := range biosStringsKeys {
+		if value := biosStrings[field].(string); value != "" {
+			values[key] = value
+		}
+	}
+
+	if len(values) == 0 {
+		return nil
+	}
+
+	log.Printf("[DEBUG] Setting the BIOS strings of VM %s", vm.UUID)
+	if err := c.client.VM.SetBiosStrings(c.session, vm.VMRef, values); err != nil {
+		return fmt.Errorf("failed to set the BIOS strings of VM %s: %s", vm.UUID, err)
+	}
+
+	return nil
+}
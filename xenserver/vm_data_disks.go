@@ -0,0 +1,137 @@
+package xenserver
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+const (
+	vmSchemaPreserveDataDisks = "preserve_data_disks"
+	vmSchemaPreserveID        = "preserve_id"
+
+	// Keys in the other_config of the data disks detached from a destroyed VM,
+	// they tell the preserve_id of the VM and the user device the disk has been
+	// attached as, so that the VM replacing it picks the disk up again.
+	vdiOtherConfigPreservedFor    = "terraform_preserved_for"
+	vdiOtherConfigPreservedDevice = "terraform_preserved_device"
+)
+
+// customizeVMPreserveDataDisksDiff requires a preserve_id along with
+// preserve_data_disks. The name label of a VM is neither unique nor stable, so
+// the preserved disks are tagged with the preserve_id instead, which carries
+// over to the VM replacing this one.
+func customizeVMPreserveDataDisksDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	if !d.Get(vmSchemaPreserveDataDisks).(bool) || !d.NewValueKnown(vmSchemaPreserveID) {
+		return nil
+	}
+
+	if d.Get(vmSchemaPreserveID).(string) == "" {
+		return fmt.Errorf("%s requires %s to be set", vmSchemaPreserveDataDisks, vmSchemaPreserveID)
+	}
+
+	return nil
+}
+
+// preserveDataDisks marks the VDIs of the data disks among vbds, that is the
+// disks which are not bootable, to be reattached to the next VM of the same
+// preserve_id. The VBDs of the other disks are returned.
+func preserveDataDisks(c *Connection, vm *VMDescriptor, preserveID string, vbds []*VBDDescriptor) ([]*VBDDescriptor, error) {
+	destroy := make([]*VBDDescriptor, 0, len(vbds))
+	for _, vbd := range vbds {
+		if vbd.Type != xenapi.VbdTypeDisk || vbd.Bootable || vbd.VDI == nil {
+			destroy = append(destroy, vbd)
+			continue
+		}
+
+		log.Printf("[DEBUG] Preserving VDI %s attached as device %s of VM %s for %q", vbd.VDI.UUID, vbd.UserDevice, vm.UUID, preserveID)
+		if err := c.client.VDI.AddToOtherConfig(c.session, vbd.VDI.VDIRef, vdiOtherConfigPreservedFor, preserveID); err != nil {
+			return nil, err
+		}
+		if err := c.client.VDI.AddToOtherConfig(c.session, vbd.VDI.VDIRef, vdiOtherConfigPreservedDevice, vbd.UserDevice); err != nil {
+			return nil, err
+		}
+	}
+
+	return destroy, nil
+}
+
+// reattachDataDisks attaches the data disks preserved from a former VM of the
+// same preserve_id to the VM, in place of the disks the VM got from its
+// template at the same user devices. The VM has to be halted. Preserved disks
+// the VM has no disk from the template for fail the creation, rather than being
+// left behind unnoticed.
+func reattachDataDisks(c *Connection, vm *VMDescriptor, preserveID string) error {
+	vdis, err := c.client.VDI.GetAllRecords(c.session)
+	if err != nil {
+		return err
+	}
+
+	vmVBDRefs, err := c.client.VM.GetVBDs(c.session, vm.VMRef)
+	if err != nil {
+		return err
+	}
+
+	vmVBDs := make(map[string]xenapi.VBDRef, len(vmVBDRefs))
+	for _, vbdRef := range vmVBDRefs {
+		vbd, err := c.client.VBD.GetRecord(c.session, vbdRef)
+		if err != nil {
+			return err
+		}
+		if vbd.Type == xenapi.VbdTypeDisk {
+			vmVBDs[vbd.Userdevice] = vbdRef
+		}
+	}
+
+	for vdiRef, vdi := range vdis {
+		if vdi.OtherConfig[vdiOtherConfigPreservedFor] != preserveID || len(vdi.VBDs) > 0 {
+			continue
+		}
+		userDevice := vdi.OtherConfig[vdiOtherConfigPreservedDevice]
+
+		// Take the place of the disk from the template, which would have
+		// been a fresh copy of the preserved one
+		vbdRef, ok := vmVBDs[userDevice]
+		if !ok {
+			return fmt.Errorf("VM %s has no disk %s from its template to replace with VDI %s preserved for %q, "+
+				"attach the VDI or remove the %s key from its other-config", vm.UUID, userDevice, vdi.UUID, preserveID, vdiOtherConfigPreservedFor)
+		}
+		delete(vmVBDs, userDevice)
+
+		record, err := c.client.VBD.GetRecord(c.session, vbdRef)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("[DEBUG] Replacing VBD %s of VM %s with preserved VDI %s", record.UUID, vm.UUID, vdi.UUID)
+		if err := c.client.VBD.Destroy(c.session, vbdRef); err != nil {
+			return err
+		}
+		if !record.Empty {
+			if err := c.client.VDI.Destroy(c.session, record.VDI); err != nil {
+				return err
+			}
+		}
+
+		record.VM = vm.VMRef
+		record.VDI = vdiRef
+		record.Empty = false
+
+		log.Printf("[DEBUG] Reattaching preserved VDI %s as device %s of VM %s", vdi.UUID, userDevice, vm.UUID)
+		if _, err := c.client.VBD.Create(c.session, record); err != nil {
+			return err
+		}
+
+		if err := c.client.VDI.RemoveFromOtherConfig(c.session, vdiRef, vdiOtherConfigPreservedFor); err != nil {
+			return err
+		}
+		if err := c.client.VDI.RemoveFromOtherConfig(c.session, vdiRef, vdiOtherConfigPreservedDevice); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package xenserver
+
+import (
+	"log"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+const (
+	vmSchemaInstall = "install"
+
+	installSchemaISOVDIUUID  = "iso_vdi_uuid"
+	installSchemaProvisioned = "provisioned"
+
+	// Boot from the DVD while the OS is installed, the disk takes over once
+	// the installer has finished
+	vmInstallBootOrder = "dc"
+
+	// Key in the other_config of the VBD of the installation media. Like the
+	// generated media, the VBD is not part of the cdrom blocks of the VM, but
+	// the ISO is not destroyed along with the VM.
+	vbdOtherConfigInstallMedia = "terraform_install_media"
+
+	// Key in the other_config of the VBD of the installation media holding the
+	// boot order the VM had before it was made to boot from the media
+	vbdOtherConfigInstallBootOrder = "terraform_install_boot_order"
+)
+
+func resourceVMInstall() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			installSchemaISOVDIUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateUUID,
+			},
+			// Set once the OS has been installed to eject the ISO and to
+			// apply the boot_order of the VM
+			installSchemaProvisioned: &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+		},
+	}
+}
+
+// vmInstallPending tells whether the VM boots from its installation media, as
+// the install block has not been marked as provisioned yet. The boot order is
+// not managed meanwhile.
+func vmInstallPending(d *schema.ResourceData) bool {
+	install := d.Get(vmSchemaInstall).([]interface{})
+	if len(install) == 0 || install[0] == nil {
+		return false
+	}
+
+	return !install[0].(map[string]interface{})[installSchemaProvisioned].(bool)
+}
+
+// attachInstallMedia inserts the ISO to install the OS of the VM from into a
+// CD drive of its own. The boot order the VM is given once the OS has been
+// installed, unless boot_order is declared, is recorded along with the drive.
+func attachInstallMedia(c *Connection, vm *VMDescriptor, d *schema.ResourceData, bootOrder string) error {
+	install := d.Get(vmSchemaInstall).([]interface{})[0].(map[string]interface{})
+
+	vdi := &VDIDescriptor{
+		UUID: install[installSchemaISOVDIUUID].(string),
+	}
+	if err := vdi.Load(c); err != nil {
+		return referenceError(c, "VDI", vdi.UUID, err)
+	}
+
+	log.Printf("[DEBUG] Attaching installation media %s to VM %s", vdi.UUID, vm.UUID)
+	_, err := createVBD(c, &VBDDescriptor{
+		VM:   vm,
+		VDI:  vdi,
+		Type: xenapi.VbdTypeCD,
+		Mode: xenapi.VbdModeRO,
+		OtherConfig: map[string]string{
+			vbdOtherConfigInstallMedia:     "true",
+			vbdOtherConfigInstallBootOrder: bootOrder,
+		},
+	})
+	return err
+}
+
+// installMediaAttached returns whether the CD drive of the installation media
+// is still attached to the VM.
+func installMediaAttached(c *Connection, vm *VMDescriptor) (bool, error) {
+	vbdRefs, err := c.client.VM.GetVBDs(c.session, vm.VMRef)
+	if err != nil {
+		return false, err
+	}
+
+	for _, vbdRef := range vbdRefs {
+		vbd, err := c.client.VBD.GetRecord(c.session, vbdRef)
+		if err != nil {
+			return false, err
+		}
+
+		if _, ok := vbd.OtherConfig[vbdOtherConfigInstallMedia]; ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// finishInstall removes the CD drive of the installation media from the VM and
+// sets the boot order, which takes effect on the next boot of the VM. Without
+// bootOrder, the order the VM had before the install is restored. The CD of a
+// running VM is only ejected, as the drive cannot be unplugged. It is removed
+// once the VM has halted, by the next apply.
+func finishInstall(c *Connection, vm *VMDescriptor, bootOrder string) error {
+	vbdRefs, err := c.client.VM.GetVBDs(c.session, vm.VMRef)
+	if err != nil {
+		return err
+	}
+
+	for _, vbdRef := range vbdRefs {
+		vbd, err := c.client.VBD.GetRecord(c.session, vbdRef)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := vbd.OtherConfig[vbdOtherConfigInstallMedia]; !ok {
+			continue
+		}
+
+		if bootOrder == "" {
+			bootOrder = vbd.OtherConfig[vbdOtherConfigInstallBootOrder]
+		}
+
+		if vm.PowerState == xenapi.VMPowerStateRunning {
+			log.Printf("[DEBUG] Ejecting installation media of running VM %s", vm.UUID)
+			if !vbd.Empty {
+				if err := c.client.VBD.Eject(c.session, vbdRef); err != nil {
+					return err
+				}
+			}
+		} else {
+			log.Printf("[DEBUG] Removing installation media from VM %s", vm.UUID)
+			if err := c.client.VBD.Destroy(c.session, vbdRef); err != nil {
+				return err
+			}
+		}
+	}
+
+	// VMs created before the order was recorded keep the one they have
+	if bootOrder == "" {
+		return nil
+	}
+
+	vm.HVMBootParameters["order"] = bootOrder
+
+	log.Printf("[DEBUG] Setting boot order of VM %s to %q", vm.UUID, bootOrder)
+	return c.client.VM.SetHVMBootParams(c.session, vm.VMRef, vm.HVMBootParameters)
+}
@@ -0,0 +1,77 @@
+package xenserver
+
+import (
+	"fmt"
+	"log"
+)
+
+const (
+	vmSchemaPlacementStrategy     = "placement_strategy"
+	vmSchemaMemoryOvercommitRatio = "memory_overcommit_ratio"
+
+	// Fail the plan or the start of the VM when no host has room for it
+	vmPlacementStrict = "strict"
+	// Only log a warning and leave the placement to XenServer
+	vmPlacementBestEffort = "best_effort"
+)
+
+// checkVMMemoryPlacement makes sure that a host of the pool can start the VM
+// without exceeding the memory overcommit ratio. A host has room for the VM if
+// its free memory covers the dynamic minimum of the VM, and if the dynamic
+// maximums of the VMs resident on it, including the new one, add up to at most
+// ratio times its memory. Only the affinity host is considered if the VM has
+// one. Without placement strategy the check is skipped.
+func checkVMMemoryPlacement(c *Connection, strategy string, ratio float64, affinityHostUUID string, dynamicMin, dynamicMax int) error {
+	if strategy == "" {
+		return nil
+	}
+
+	hosts, err := c.client.Host.GetAllRecords(c.session)
+	if err != nil {
+		return err
+	}
+
+	considered := 0
+	for _, host := range hosts {
+		if !host.Enabled || (affinityHostUUID != "" && host.UUID != affinityHostUUID) {
+			continue
+		}
+		considered++
+
+		metrics, err := c.client.HostMetrics.GetRecord(c.session, host.Metrics)
+		if err != nil {
+			return err
+		}
+
+		committed := 0
+		for _, ref := range host.ResidentVMs {
+			vm, err := c.getVMRecord(ref)
+			if err != nil {
+				return err
+			}
+			committed += vm.MemoryDynamicMax
+		}
+
+		if dynamicMin <= metrics.MemoryFree && float64(committed+dynamicMax) <= ratio*float64(metrics.MemoryTotal) {
+			log.Printf("[DEBUG] Host %s has room for the VM, %d bytes free, %d of %d bytes committed",
+				host.UUID, metrics.MemoryFree, committed, metrics.MemoryTotal)
+			return nil
+		}
+	}
+
+	var problem error
+	if affinityHostUUID != "" {
+		problem = fmt.Errorf("starting the VM would exceed the free memory or a %s of %g on its affinity host %s",
+			vmSchemaMemoryOvercommitRatio, ratio, affinityHostUUID)
+	} else {
+		problem = fmt.Errorf("starting the VM would exceed the free memory or a %s of %g on all %d enabled hosts of pool %s",
+			vmSchemaMemoryOvercommitRatio, ratio, considered, c.poolDescription())
+	}
+
+	if strategy == vmPlacementStrict {
+		return problem
+	}
+
+	log.Printf("[WARN] %s", problem)
+	return nil
+}
@@ -0,0 +1,175 @@
+package xenserver
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+const (
+	vmSchemaAffinityHostUUID = "affinity_host_uuid"
+	vmSchemaPCIDevices       = "pci_devices"
+	vmSchemaSuspendSRUUID    = "suspend_sr_uuid"
+
+	// Devices passed through to the VM on start, as comma separated list of
+	// <slot>/<address> pairs
+	vmOtherConfigPCI = "pci"
+)
+
+// PCI addresses as reported by lspci -D, e.g. 0000:04:00.0
+var pciAddressRegexp = regexp.MustCompile(`^[0-9a-f]{4}:[0-9a-f]{2}:[0-9a-f]{2}\.[0-7]$`)
+
+// setVMPlacement applies the affinity host of the VM and the PCI devices passed
+// through to it, which have to exist on that host. Both take effect on the next
+// start of the VM. It also applies the SR the memory of the VM is saved to when
+// it gets suspended.
+func setVMPlacement(c *Connection, vm *VMDescriptor, d *schema.ResourceData) error {
+	if _, ok := d.Get(vmSchemaOtherConfig).(map[string]interface{})[vmOtherConfigPCI]; ok {
+		return fmt.Errorf("other_config key %q has to be set through the %q argument", vmOtherConfigPCI, vmSchemaPCIDevices)
+	}
+
+	host := &HostDescriptor{
+		UUID: d.Get(vmSchemaAffinityHostUUID).(string),
+	}
+	if host.UUID != "" {
+		if err := host.Load(c); err != nil {
+			return referenceError(c, "host", host.UUID, err)
+		}
+	} else {
+		host.HostRef = "OpaqueRef:NULL"
+	}
+
+	if host.HostRef != vm.Affinity {
+		log.Printf("[DEBUG] Setting affinity of VM %s to host %q", vm.UUID, host.UUID)
+		if err := c.client.VM.SetAffinity(c.session, vm.VMRef, host.HostRef); err != nil {
+			return err
+		}
+	}
+
+	suspendSRUUID := d.Get(vmSchemaSuspendSRUUID).(string)
+	currentSuspendSRUUID, err := srUUIDOf(c, vm.SuspendSR)
+	if err != nil {
+		return err
+	}
+
+	if suspendSRUUID != currentSuspendSRUUID {
+		suspendSR, err := loadSRRef(c, suspendSRUUID)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("[DEBUG] Setting suspend SR of VM %s to %q", vm.UUID, suspendSRUUID)
+		if err := c.client.VM.SetSuspendSR(c.session, vm.VMRef, suspendSR); err != nil {
+			return err
+		}
+	}
+
+	devices := make([]string, 0)
+	for _, address := range d.Get(vmSchemaPCIDevices).([]interface{}) {
+		devices = append(devices, address.(string))
+	}
+
+	if len(devices) > 0 {
+		if host.UUID == "" {
+			return fmt.Errorf("%q requires %q, PCI devices can only be passed through on the host they are installed in",
+				vmSchemaPCIDevices, vmSchemaAffinityHostUUID)
+		}
+
+		if err := checkHostPCIDevices(c, host, devices); err != nil {
+			return err
+		}
+	}
+
+	entries := make([]string, 0, len(devices))
+	for _, address := range devices {
+		entries = append(entries, "0/"+address)
+	}
+	pci := strings.Join(entries, ",")
+
+	if pci == vm.OtherConfig[vmOtherConfigPCI] {
+		return nil
+	}
+
+	log.Printf("[DEBUG] Setting PCI devices of VM %s to %q", vm.UUID, pci)
+	if err := c.client.VM.RemoveFromOtherConfig(c.session, vm.VMRef, vmOtherConfigPCI); err != nil {
+		return err
+	}
+
+	if pci != "" {
+		if err := c.client.VM.AddToOtherConfig(c.session, vm.VMRef, vmOtherConfigPCI, pci); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkHostPCIDevices makes sure that the devices at the PCI addresses are
+// installed in the host.
+func checkHostPCIDevices(c *Connection, host *HostDescriptor, addresses []string) error {
+	pcis, err := c.client.PCI.GetAllRecords(c.session)
+	if err != nil {
+		return err
+	}
+
+	installed := make(map[string]bool)
+	for _, pci := range pcis {
+		if pci.Host == host.HostRef {
+			installed[pci.PciID] = true
+		}
+	}
+
+	for _, address := range addresses {
+		if !installed[address] {
+			return fmt.Errorf("PCI device %s does not exist on host %s", address, host.UUID)
+		}
+	}
+
+	return nil
+}
+
+// readVMPCIDevices returns the addresses of the PCI devices passed through to
+// the VM.
+func readVMPCIDevices(vm *VMDescriptor) []string {
+	devices := make([]string, 0)
+	for _, entry := range strings.Split(vm.OtherConfig[vmOtherConfigPCI], ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+
+		// Strip the slot
+		if i := strings.Index(entry, "/"); i >= 0 {
+			entry = entry[i+1:]
+		}
+		devices = append(devices, entry)
+	}
+
+	return devices
+}
+
+func validatePCIAddress(v interface{}, k string) ([]string, []error) {
+	if !pciAddressRegexp.MatchString(v.(string)) {
+		return nil, []error{fmt.Errorf("%q must be a PCI address like 0000:04:00.0, got %q", k, v.(string))}
+	}
+	return nil, nil
+}
+
+// readVMAffinity returns the UUID of the affinity host of the VM, or an empty
+// string if it has none.
+func readVMAffinity(c *Connection, vm *VMDescriptor) (string, error) {
+	if vm.Affinity == "" || vm.Affinity == "OpaqueRef:NULL" {
+		return "", nil
+	}
+
+	host := &HostDescriptor{
+		HostRef: vm.Affinity,
+	}
+	if err := host.Query(c); err != nil {
+		return "", err
+	}
+
+	return host.UUID, nil
+}
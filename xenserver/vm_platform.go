@@ -0,0 +1,168 @@
+package xenserver
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+const (
+	vmSchemaViridian    = "viridian"
+	vmSchemaNX          = "nx"
+	vmSchemaPAE         = "pae"
+	vmSchemaACPI        = "acpi"
+	vmSchemaAPIC        = "apic"
+	vmSchemaTimeOffset  = "timeoffset"
+	vmSchemaDeviceModel = "device_model"
+	vmSchemaVGA         = "vga"
+	vmSchemaVideoRAM    = "videoram"
+)
+
+// platformFlag maps a typed argument of the VM onto a key of its platform map.
+type platformFlag struct {
+	schemaKey   string
+	platformKey string
+	// Whether the flag is about emulated hardware, which PV VMs do not have
+	hvmOnly bool
+	format  func(interface{}) string
+	parse   func(string) interface{}
+}
+
+func formatPlatformBool(v interface{}) string {
+	return strconv.FormatBool(v.(bool))
+}
+
+// ACPI is enabled by "1" in the templates, unlike the other flags
+func formatPlatformACPI(v interface{}) string {
+	if v.(bool) {
+		return "1"
+	}
+	return "0"
+}
+
+func parsePlatformBool(s string) interface{} {
+	return s == "true" || s == "1"
+}
+
+func formatPlatformInt(v interface{}) string {
+	return strconv.Itoa(v.(int))
+}
+
+func parsePlatformInt(s string) interface{} {
+	i, _ := strconv.Atoi(s)
+	return i
+}
+
+func formatPlatformString(v interface{}) string {
+	return v.(string)
+}
+
+func parsePlatformString(s string) interface{} {
+	return s
+}
+
+var platformFlags = []platformFlag{
+	{vmSchemaViridian, "viridian", true, formatPlatformBool, parsePlatformBool},
+	{vmSchemaNX, "nx", false, formatPlatformBool, parsePlatformBool},
+	{vmSchemaPAE, "pae", false, formatPlatformBool, parsePlatformBool},
+	{vmSchemaACPI, "acpi", true, formatPlatformACPI, parsePlatformBool},
+	{vmSchemaAPIC, "apic", true, formatPlatformBool, parsePlatformBool},
+	{vmSchemaTimeOffset, "timeoffset", true, formatPlatformInt, parsePlatformInt},
+	{vmSchemaDeviceModel, "device-model", true, formatPlatformString, parsePlatformString},
+	{vmSchemaVGA, "vga", true, formatPlatformString, parsePlatformString},
+	{vmSchemaVideoRAM, "videoram", true, formatPlatformInt, parsePlatformInt},
+}
+
+// platformFlagsChanged tells whether any of the typed platform arguments has
+// been changed.
+func platformFlagsChanged(d *schema.ResourceData) bool {
+	for _, flag := range platformFlags {
+		if d.HasChange(flag.schemaKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// customizeVMPlatformFlagsDiff rejects platform map keys which are set through
+// the typed platform arguments, and flags of emulated hardware for PV VMs, so
+// that they fail the plan instead of the apply.
+func customizeVMPlatformFlagsDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	if d.NewValueKnown(vmSchemaPlatform) {
+		declared := d.Get(vmSchemaPlatform).(map[string]interface{})
+		for _, flag := range platformFlags {
+			if _, ok := declared[flag.platformKey]; ok {
+				return fmt.Errorf("platform key %q has to be set through the %q argument", flag.platformKey, flag.schemaKey)
+			}
+		}
+	}
+
+	var hvmFlags []string
+	for _, flag := range platformFlags {
+		if !flag.hvmOnly {
+			continue
+		}
+		if _, ok := d.GetOkExists(flag.schemaKey); ok && (d.Id() == "" || d.HasChange(flag.schemaKey)) {
+			hvmFlags = append(hvmFlags, flag.schemaKey)
+		}
+	}
+	if len(hvmFlags) == 0 {
+		return nil
+	}
+
+	c := m.(*Connection)
+
+	ref, source, err := vmSource(c, d)
+	if err != nil {
+		return err
+	}
+
+	bootloader, err := c.client.VM.GetPVBootloader(c.session, ref)
+	if err != nil {
+		return err
+	}
+
+	if bootloader != "" {
+		return fmt.Errorf("%q is not supported by PV VMs, %s boots PV", hvmFlags[0], source)
+	}
+
+	return nil
+}
+
+// applyPlatformFlags sets the declared typed platform arguments in the platform
+// map of the VM. On updates only the changed arguments are set, the others are
+// left as they are. The platform map argument must not declare the same keys,
+// and PV VMs do not take the flags of emulated hardware, which
+// customizeVMPlatformFlagsDiff makes sure of.
+func applyPlatformFlags(d *schema.ResourceData, vm *VMDescriptor, update bool) {
+	for _, flag := range platformFlags {
+		var value interface{}
+		if update {
+			if !d.HasChange(flag.schemaKey) {
+				continue
+			}
+			value = d.Get(flag.schemaKey)
+		} else {
+			var ok bool
+			if value, ok = d.GetOkExists(flag.schemaKey); !ok {
+				continue
+			}
+		}
+
+		vm.Platform[flag.platformKey] = flag.format(value)
+	}
+}
+
+// readPlatformFlags reports the typed platform arguments from the platform map
+// of the VM, including the defaults of the template.
+func readPlatformFlags(d *schema.ResourceData, vm *VMDescriptor) error {
+	for _, flag := range platformFlags {
+		if err := d.Set(flag.schemaKey, flag.parse(vm.Platform[flag.platformKey])); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,254 @@
+package xenserver
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+// Settings checked against the recommendations of the template and the
+// capacities of the hosts at plan time. vcpus_max is left out as it is not
+// known until the VM has been created when it is not declared.
+var vmSizingKeys = []string{
+	vmSchemaBaseTemplateName,
+	vmSchemaSourceSnapshotUUID,
+	vmSchemaVcpus,
+	vmSchemaStaticMemoryMin,
+	vmSchemaStaticMemoryMax,
+	vmSchemaDynamicMemoryMin,
+	vmSchemaDynamicMemoryMax,
+}
+
+// vmRecommendations are the limits parsed from the recommendations XML of a
+// template, e.g.
+//
+//	<restrictions>
+//	  <restriction field="memory-static-max" max="137438953472" />
+//	  <restriction field="vcpus-max" max="16" />
+//	</restrictions>
+type vmRecommendations struct {
+	Restrictions []struct {
+		Field string `xml:"field,attr"`
+		Min   string `xml:"min,attr"`
+		Max   string `xml:"max,attr"`
+	} `xml:"restriction"`
+}
+
+// limit returns the bound of the field, if the recommendations have one.
+func (r *vmRecommendations) limit(field string, max bool) (int, bool) {
+	for _, restriction := range r.Restrictions {
+		if restriction.Field != field {
+			continue
+		}
+
+		value := restriction.Min
+		if max {
+			value = restriction.Max
+		}
+		if limit, err := strconv.Atoi(value); err == nil {
+			return limit, true
+		}
+	}
+
+	return 0, false
+}
+
+// resourceVMCustomizeDiff rejects VCPU and memory settings the VM could not be
+// created or started with, so that they fail the plan instead of the apply.
+func resourceVMCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	c := m.(*Connection)
+
+	changed := d.Id() == ""
+	for _, key := range vmSizingKeys {
+		if !d.NewValueKnown(key) {
+			return nil
+		}
+		if d.HasChange(key) {
+			changed = true
+		}
+	}
+	if !changed && !d.HasChange(vmSchemaVcpusMax) {
+		return nil
+	}
+
+	vcpus := d.Get(vmSchemaVcpus).(int)
+	vcpusMax := 0
+	if d.NewValueKnown(vmSchemaVcpusMax) {
+		vcpusMax = d.Get(vmSchemaVcpusMax).(int)
+	}
+
+	if err := checkVMVcpusMax(c, d, vcpus, vcpusMax); err != nil {
+		return err
+	}
+
+	if vcpusMax < vcpus {
+		vcpusMax = vcpus
+	}
+
+	staticMin := d.Get(vmSchemaStaticMemoryMin).(int)
+	staticMax := d.Get(vmSchemaStaticMemoryMax).(int)
+	dynamicMin := d.Get(vmSchemaDynamicMemoryMin).(int)
+	dynamicMax := d.Get(vmSchemaDynamicMemoryMax).(int)
+
+	if !(staticMin <= dynamicMin && dynamicMin <= dynamicMax && dynamicMax <= staticMax) {
+		return fmt.Errorf("memory limits have to satisfy %s <= %s <= %s <= %s, got %d, %d, %d and %d",
+			vmSchemaStaticMemoryMin, vmSchemaDynamicMemoryMin, vmSchemaDynamicMemoryMax, vmSchemaStaticMemoryMax,
+			staticMin, dynamicMin, dynamicMax, staticMax)
+	}
+
+	recommendations, source, err := vmSourceRecommendations(c, d)
+	if err != nil {
+		return err
+	}
+
+	if max, ok := recommendations.limit("vcpus-max", true); ok && vcpusMax > max {
+		return fmt.Errorf("%s supports at most %d VCPUs, %d requested", source, max, vcpusMax)
+	}
+
+	if max, ok := recommendations.limit("memory-static-max", true); ok && staticMax > max {
+		return fmt.Errorf("%s supports at most %d bytes of memory, %s is %d", source, max, vmSchemaStaticMemoryMax, staticMax)
+	}
+
+	if min, ok := recommendations.limit("memory-static-min", false); ok && staticMin < min {
+		return fmt.Errorf("%s requires at least %d bytes of memory, %s is %d", source, min, vmSchemaStaticMemoryMin, staticMin)
+	}
+
+	if err := checkHostCapacities(c, vcpusMax, dynamicMin); err != nil {
+		return err
+	}
+
+	// Resident VMs only matter for VMs which are about to be started
+	if d.Id() != "" || d.Get(vmSchemaIsATemplate).(bool) || !d.NewValueKnown(vmSchemaAffinityHostUUID) {
+		return nil
+	}
+
+	return checkVMMemoryPlacement(c, d.Get(vmSchemaPlacementStrategy).(string), d.Get(vmSchemaMemoryOvercommitRatio).(float64),
+		d.Get(vmSchemaAffinityHostUUID).(string), dynamicMin, dynamicMax)
+}
+
+// checkVMVcpusMax makes sure that VCPUs_at_startup does not exceed VCPUs_max.
+// A vcpus_max which is declared along with vcpus has to be at least vcpus.
+// Without a declared change, the maximum of a halted VM is raised to vcpus, but
+// the maximum of a running VM cannot be changed, so VCPUs can only be hot added
+// up to it.
+func checkVMVcpusMax(c *Connection, d *schema.ResourceDiff, vcpus, vcpusMax int) error {
+	if vcpusMax <= 0 || vcpus <= vcpusMax {
+		return nil
+	}
+
+	if d.Id() == "" || d.HasChange(vmSchemaVcpusMax) {
+		return fmt.Errorf("%s (%d) must not exceed %s (%d)", vmSchemaVcpus, vcpus, vmSchemaVcpusMax, vcpusMax)
+	}
+
+	if !d.Get(vmSchemaHotAdd).(bool) {
+		return nil
+	}
+
+	vmRef, err := c.client.VM.GetByUUID(c.session, d.Id())
+	if err != nil {
+		return err
+	}
+
+	powerState, err := c.client.VM.GetPowerState(c.session, vmRef)
+	if err != nil {
+		return err
+	}
+
+	if powerState == xenapi.VMPowerStateRunning {
+		return fmt.Errorf("%s (%d) must not exceed %s (%d) of the running VM %s, raising it requires the VM to be halted",
+			vmSchemaVcpus, vcpus, vmSchemaVcpusMax, vcpusMax, d.Id())
+	}
+
+	return nil
+}
+
+// vmSource returns the VM, or the template or snapshot it is going to be
+// created from, along with a description of it for error messages.
+func vmSource(c *Connection, d *schema.ResourceDiff) (xenapi.VMRef, string, error) {
+	var ref xenapi.VMRef
+	var source string
+	var err error
+
+	switch {
+	case d.Id() != "" && !d.HasChange(vmSchemaSourceSnapshotUUID):
+		source = fmt.Sprintf("VM %s", d.Id())
+		ref, err = c.client.VM.GetByUUID(c.session, d.Id())
+	case d.Get(vmSchemaSourceSnapshotUUID).(string) != "":
+		source = fmt.Sprintf("snapshot %s", d.Get(vmSchemaSourceSnapshotUUID).(string))
+		ref, err = findSourceSnapshot(c, d.Get(vmSchemaSourceSnapshotUUID).(string))
+	default:
+		source = fmt.Sprintf("template %q", d.Get(vmSchemaBaseTemplateName).(string))
+		ref, err = findBaseTemplate(c, d.Get(vmSchemaBaseTemplateName).(string))
+	}
+
+	return ref, source, err
+}
+
+// vmSourceRecommendations returns the recommendations of the VM, or of the
+// template or snapshot it is going to be created from.
+func vmSourceRecommendations(c *Connection, d *schema.ResourceDiff) (*vmRecommendations, string, error) {
+	ref, source, err := vmSource(c, d)
+	if err != nil {
+		return nil, "", err
+	}
+
+	recommendations := &vmRecommendations{}
+
+	raw, err := c.client.VM.GetRecommendations(c.session, ref)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Custom templates often come without recommendations
+	if raw != "" {
+		if err := xml.Unmarshal([]byte(raw), recommendations); err != nil {
+			return nil, "", fmt.Errorf("failed to parse the recommendations of %s: %s", source, err)
+		}
+	}
+
+	return recommendations, source, nil
+}
+
+// checkHostCapacities makes sure that at least one host of the pool has enough
+// physical CPUs and memory to start the VM on.
+func checkHostCapacities(c *Connection, vcpus, memory int) error {
+	hosts, err := c.client.Host.GetAllRecords(c.session)
+	if err != nil {
+		return err
+	}
+
+	maxCPUs, maxMemory := 0, 0
+	for _, host := range hosts {
+		if len(host.HostCPUs) > maxCPUs {
+			maxCPUs = len(host.HostCPUs)
+		}
+
+		total, err := c.client.HostMetrics.GetMemoryTotal(c.session, host.Metrics)
+		if err != nil {
+			return err
+		}
+		if total > maxMemory {
+			maxMemory = total
+		}
+	}
+
+	if len(hosts) == 0 {
+		return nil
+	}
+
+	if vcpus > maxCPUs {
+		return fmt.Errorf("%d VCPUs requested, but the hosts of pool %s have at most %d physical CPUs",
+			vcpus, c.poolDescription(), maxCPUs)
+	}
+
+	if memory > maxMemory {
+		return fmt.Errorf("%s is %d bytes, but the hosts of pool %s have at most %d bytes of memory",
+			vmSchemaDynamicMemoryMin, memory, c.poolDescription(), maxMemory)
+	}
+
+	return nil
+}
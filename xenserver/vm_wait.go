@@ -0,0 +1,187 @@
+package xenserver
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+const (
+	vmSchemaWaitFor = "wait_for"
+
+	waitForSchemaGuestAgent  = "guest_agent"
+	waitForSchemaIPAddress   = "ip_address"
+	waitForSchemaXenstoreKey = "xenstore_key"
+	waitForSchemaTCPPort     = "tcp_port"
+	waitForSchemaTimeout     = "timeout"
+
+	// Longest interval in which the conditions are checked while waiting for a
+	// VM
+	vmWaitPollInterval = 5 * time.Second
+	// Time a connection to the TCP port of the guest may take
+	vmWaitDialTimeout = 5 * time.Second
+)
+
+func resourceVMWaitFor() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			waitForSchemaGuestAgent: &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			waitForSchemaIPAddress: &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			waitForSchemaXenstoreKey: &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			waitForSchemaTCPPort: &schema.Schema{
+				Type:         schema.TypeInt,
+				Optional:     true,
+				ValidateFunc: validation.IsPortNumber,
+			},
+			waitForSchemaTimeout: &schema.Schema{
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      300,
+				ValidateFunc: validation.IntAtLeast(1),
+			},
+		},
+	}
+}
+
+// waitForVM waits until the started VM fulfills the conditions of its wait_for
+// block, so that it is usable once it has been created. It fails once the
+// timeout of the block has passed.
+func waitForVM(c *Connection, vm *VMDescriptor, d *schema.ResourceData) error {
+	waitFor := d.Get(vmSchemaWaitFor).([]interface{})
+	if len(waitFor) == 0 || waitFor[0] == nil {
+		return nil
+	}
+	conditions := waitFor[0].(map[string]interface{})
+
+	timeout := time.Duration(conditions[waitForSchemaTimeout].(int)) * time.Second
+
+	conn, cancel, err := c.WithTimeout(timeout)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	// The conditions are checked again whenever the VM or the metrics reported
+	// by a guest agent change, the port in any case after the poll interval
+	watcher := newEventWatcher(conn, vmWaitPollInterval, "vm/"+string(vm.VMRef), "vm_guest_metrics")
+
+	pending := ""
+	for {
+		condition, err := vmPendingCondition(conn, vm, conditions)
+		if err != nil {
+			// Calls cut short by the timeout are not an error of their own
+			if conn.ctx.Err() == nil {
+				return err
+			}
+		} else if condition == "" {
+			return nil
+		} else {
+			pending = condition
+			log.Printf("[DEBUG] Waiting for VM %s: %s", vm.UUID, pending)
+		}
+
+		if err := watcher.wait(vmWaitPollInterval); err != nil {
+			if c.ctx.Err() != nil {
+				return c.ctx.Err()
+			}
+			if conn.ctx.Err() != nil {
+				return fmt.Errorf("VM %s is not ready after %s: %s", vm.UUID, timeout, pending)
+			}
+			return err
+		}
+	}
+}
+
+// vmPendingCondition returns the first condition the VM does not fulfill yet,
+// or an empty string if it fulfills all of them. The records are fetched
+// without the record cache, as they change while waiting.
+func vmPendingCondition(c *Connection, vm *VMDescriptor, conditions map[string]interface{}) (string, error) {
+	metrics, err := c.client.VM.GetGuestMetrics(c.session, vm.VMRef)
+	if err != nil {
+		return "", err
+	}
+	hasMetrics := metrics != "" && metrics != "OpaqueRef:NULL"
+
+	// The guest agent reports the OS version once it is running
+	if conditions[waitForSchemaGuestAgent].(bool) {
+		if !hasMetrics {
+			return "guest agent is not running", nil
+		}
+
+		osVersion, err := c.client.VMGuestMetrics.GetOSVersion(c.session, metrics)
+		if err != nil {
+			return "", err
+		}
+
+		if len(osVersion) == 0 {
+			return "guest agent is not running", nil
+		}
+	}
+
+	port := conditions[waitForSchemaTCPPort].(int)
+
+	var ips []string
+	if conditions[waitForSchemaIPAddress].(bool) || port > 0 {
+		if ips, err = guestIPAddresses(c, metrics); err != nil {
+			return "", err
+		}
+
+		if len(ips) == 0 {
+			return "no IP address is assigned", nil
+		}
+	}
+
+	// The xenstore_data of the VM is only written to the guest, keys the
+	// guest writes itself are reported back by the guest agent, in the other
+	// map of the guest metrics
+	if key := conditions[waitForSchemaXenstoreKey].(string); key != "" {
+		if !hasMetrics {
+			return fmt.Sprintf("xenstore key %s is not reported", key), nil
+		}
+
+		other, err := c.client.VMGuestMetrics.GetOther(c.session, metrics)
+		if err != nil {
+			return "", err
+		}
+
+		if _, ok := other[key]; !ok {
+			return fmt.Sprintf("xenstore key %s is not reported", key), nil
+		}
+	}
+
+	if port > 0 {
+		reachable := false
+		for _, ip := range ips {
+			conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip, strconv.Itoa(port)), vmWaitDialTimeout)
+			if err != nil {
+				continue
+			}
+			conn.Close()
+
+			reachable = true
+			break
+		}
+
+		if !reachable {
+			return fmt.Sprintf("TCP port %d is not reachable on %v", port, ips), nil
+		}
+	}
+
+	return "", nil
+}
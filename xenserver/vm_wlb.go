@@ -0,0 +1,115 @@
+package xenserver
+
+import (
+	"log"
+	"strconv"
+
+	xenapi "github.com/terra-farm/go-xen-api-client"
+)
+
+const vmSchemaIgnoreWLB = "ignore_wlb"
+
+// Workload Balancing tags the recommendations it makes with this marker, the
+// second element of a recommendation being its star rating
+const wlbRecommendationMarker = "WLB"
+
+// startVM starts the VM on the host Workload Balancing rates best if Workload
+// Balancing is enabled for the pool, and else leaves the placement to
+// XenServer. XenServer prefers the affinity host of a VM over the
+// recommendations of Workload Balancing, so VMs with an affinity host are
+// always placed by XenServer. The VM is started asynchronously, so that waiting
+// for it to boot follows the events of the task.
+//
+// With ignoreWLB, the VM is started on the host with the most free memory
+// instead. VM.start is routed through Workload Balancing as long as it is
+// enabled, so the host is picked here among the ones the VM can be started on.
+func startVM(c *Connection, vm *VMDescriptor, ignoreWLB bool, hasAffinity bool) error {
+	if !hasAffinity {
+		enabled, err := wlbEnabled(c)
+		if err != nil {
+			return err
+		}
+
+		var host xenapi.HostRef
+		if enabled && ignoreWLB {
+			host, err = mostFreeMemoryHost(c, vm)
+		} else if enabled {
+			host, err = wlbRecommendedHost(c, vm)
+		}
+		if err != nil {
+			return err
+		}
+
+		if host != "" {
+			log.Printf("[DEBUG] Starting VM %s on host %s (ignoring WLB: %t)", vm.UUID, host, ignoreWLB)
+			return runPowerTask(c, "VM.start_on", string(vm.VMRef), string(host), false, false)
+		}
+	}
+
+	log.Printf("[DEBUG] Starting VM %s", vm.UUID)
+	return runPowerTask(c, "VM.start", string(vm.VMRef), false, false)
+}
+
+// wlbEnabled returns whether Workload Balancing is enabled for the pool.
+func wlbEnabled(c *Connection) (bool, error) {
+	pool, err := getPool(c)
+	if err != nil {
+		return false, err
+	}
+
+	return c.client.Pool.GetWlbEnabled(c.session, pool)
+}
+
+// mostFreeMemoryHost returns the host with the most free memory among the ones
+// the VM can be started on, or an empty reference if there is none.
+func mostFreeMemoryHost(c *Connection, vm *VMDescriptor) (xenapi.HostRef, error) {
+	hosts, err := c.client.VM.GetPossibleHosts(c.session, vm.VMRef)
+	if err != nil {
+		return "", err
+	}
+
+	var best xenapi.HostRef
+	bestFree := -1
+	for _, host := range hosts {
+		free, err := c.client.Host.ComputeFreeMemory(c.session, host)
+		if err != nil {
+			return "", err
+		}
+
+		if free > bestFree {
+			best, bestFree = host, free
+		}
+	}
+
+	return best, nil
+}
+
+// wlbRecommendedHost returns the host with the best star rating Workload
+// Balancing recommends to start the VM on, or an empty reference if it
+// recommends no host.
+func wlbRecommendedHost(c *Connection, vm *VMDescriptor) (xenapi.HostRef, error) {
+	recommendations, err := c.client.VM.RetrieveWlbRecommendations(c.session, vm.VMRef)
+	if err != nil {
+		// Fall back to the placement of XenServer, e.g. when the WLB server
+		// is unreachable
+		log.Printf("[WARN] Failed to retrieve the WLB recommendations for VM %s: %s", vm.UUID, err)
+		return "", nil
+	}
+
+	var best xenapi.HostRef
+	bestRating := 0.0
+	for host, recommendation := range recommendations {
+		if len(recommendation) < 2 || recommendation[0] != wlbRecommendationMarker {
+			continue
+		}
+
+		rating, err := strconv.ParseFloat(recommendation[1], 64)
+		if err != nil || rating <= bestRating {
+			continue
+		}
+
+		best, bestRating = host, rating
+	}
+
+	return best, nil
+}
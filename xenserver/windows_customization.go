@@ -0,0 +1,237 @@
+package xenserver
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"text/template"
+	"unicode/utf16"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+const (
+	windowsCustomizationSchemaComputerName        = "computer_name"
+	windowsCustomizationSchemaAdminPassword       = "admin_password"
+	windowsCustomizationSchemaTimeZone            = "time_zone"
+	windowsCustomizationSchemaJoinDomain          = "join_domain"
+	windowsCustomizationSchemaDomainAdminUser     = "domain_admin_user"
+	windowsCustomizationSchemaDomainAdminPassword = "domain_admin_password"
+	windowsCustomizationSchemaMachineObjectOU     = "machine_object_ou"
+	windowsCustomizationSchemaUnattendXML         = "unattend_xml"
+	windowsCustomizationSchemaSRUUID              = "sr_uuid"
+
+	windowsCustomizationPurpose = "windows_customization"
+
+	// Windows Setup searches the root of removable media for this file when
+	// a sysprepped installation boots for the first time
+	windowsCustomizationFileName = "unattend.xml"
+)
+
+func resourceWindowsCustomization() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			windowsCustomizationSchemaComputerName: &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+				ForceNew: true,
+			},
+			windowsCustomizationSchemaAdminPassword: &schema.Schema{
+				Type:      schema.TypeString,
+				Optional:  true,
+				ForceNew:  true,
+				Sensitive: true,
+			},
+			windowsCustomizationSchemaTimeZone: &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+				ForceNew: true,
+			},
+			windowsCustomizationSchemaJoinDomain: &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+				ForceNew: true,
+			},
+			windowsCustomizationSchemaDomainAdminUser: &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+				ForceNew: true,
+			},
+			windowsCustomizationSchemaDomainAdminPassword: &schema.Schema{
+				Type:      schema.TypeString,
+				Optional:  true,
+				ForceNew:  true,
+				Sensitive: true,
+			},
+			windowsCustomizationSchemaMachineObjectOU: &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+				ForceNew: true,
+			},
+			windowsCustomizationSchemaUnattendXML: &schema.Schema{
+				Type:      schema.TypeString,
+				Optional:  true,
+				ForceNew:  true,
+				Sensitive: true,
+			},
+			windowsCustomizationSchemaSRUUID: &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				ValidateFunc: validateUUID,
+			},
+		},
+	}
+}
+
+var windowsUnattendTemplate = template.Must(template.New("unattend").Funcs(template.FuncMap{
+	"xml": xmlEscape,
+}).Parse(`<?xml version="1.0" encoding="utf-8"?>
+<unattend xmlns="urn:schemas-microsoft-com:unattend">
+  <settings pass="specialize">
+    <component name="Microsoft-Windows-Shell-Setup" processorArchitecture="amd64" publicKeyToken="31bf3856ad364e35" language="neutral" versionScope="nonSxS">
+      <ComputerName>{{xml .ComputerName}}</ComputerName>
+{{- if .TimeZone}}
+      <TimeZone>{{xml .TimeZone}}</TimeZone>
+{{- end}}
+    </component>
+{{- if .JoinDomain}}
+    <component name="Microsoft-Windows-UnattendedJoin" processorArchitecture="amd64" publicKeyToken="31bf3856ad364e35" language="neutral" versionScope="nonSxS">
+      <Identification>
+        <Credentials>
+          <Domain>{{xml .JoinDomain}}</Domain>
+          <Username>{{xml .DomainAdminUser}}</Username>
+          <Password>{{xml .DomainAdminPassword}}</Password>
+        </Credentials>
+        <JoinDomain>{{xml .JoinDomain}}</JoinDomain>
+{{- if .MachineObjectOU}}
+        <MachineObjectOU>{{xml .MachineObjectOU}}</MachineObjectOU>
+{{- end}}
+      </Identification>
+    </component>
+{{- end}}
+  </settings>
+  <settings pass="oobeSystem">
+    <component name="Microsoft-Windows-Shell-Setup" processorArchitecture="amd64" publicKeyToken="31bf3856ad364e35" language="neutral" versionScope="nonSxS">
+      <OOBE>
+        <HideEULAPage>true</HideEULAPage>
+        <HideOEMRegistrationScreen>true</HideOEMRegistrationScreen>
+        <HideOnlineAccountScreens>true</HideOnlineAccountScreens>
+        <HideWirelessSetupInOOBE>true</HideWirelessSetupInOOBE>
+        <ProtectYourPC>3</ProtectYourPC>
+      </OOBE>
+{{- if .AdminPassword}}
+      <UserAccounts>
+        <AdministratorPassword>
+          <Value>{{.AdminPassword}}</Value>
+          <PlainText>false</PlainText>
+        </AdministratorPassword>
+      </UserAccounts>
+{{- end}}
+    </component>
+  </settings>
+</unattend>
+`))
+
+func xmlEscape(s string) (string, error) {
+	var buf bytes.Buffer
+	if err := xml.EscapeText(&buf, []byte(s)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// encodeUnattendPassword hides a password in an answer file the way Windows
+// System Image Manager does: the password, followed by the name of the
+// setting, encoded as UTF-16LE and then base64.
+func encodeUnattendPassword(password, setting string) string {
+	units := utf16.Encode([]rune(password + setting))
+	buf := make([]byte, 2*len(units))
+	for i, unit := range units {
+		binary.LittleEndian.PutUint16(buf[2*i:], unit)
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+// windowsUnattendXML returns the answer file for the customization, either the
+// one given as is or one generated from the settings.
+func windowsUnattendXML(data map[string]interface{}) ([]byte, error) {
+	if unattendXML := data[windowsCustomizationSchemaUnattendXML].(string); unattendXML != "" {
+		for _, key := range []string{
+			windowsCustomizationSchemaComputerName,
+			windowsCustomizationSchemaAdminPassword,
+			windowsCustomizationSchemaTimeZone,
+			windowsCustomizationSchemaJoinDomain,
+		} {
+			if data[key].(string) != "" {
+				return nil, fmt.Errorf("%q conflicts with %q", windowsCustomizationSchemaUnattendXML, key)
+			}
+		}
+
+		return []byte(unattendXML), nil
+	}
+
+	settings := struct {
+		ComputerName        string
+		AdminPassword       string
+		TimeZone            string
+		JoinDomain          string
+		DomainAdminUser     string
+		DomainAdminPassword string
+		MachineObjectOU     string
+	}{
+		ComputerName:        data[windowsCustomizationSchemaComputerName].(string),
+		TimeZone:            data[windowsCustomizationSchemaTimeZone].(string),
+		JoinDomain:          data[windowsCustomizationSchemaJoinDomain].(string),
+		DomainAdminUser:     data[windowsCustomizationSchemaDomainAdminUser].(string),
+		DomainAdminPassword: data[windowsCustomizationSchemaDomainAdminPassword].(string),
+		MachineObjectOU:     data[windowsCustomizationSchemaMachineObjectOU].(string),
+	}
+
+	if settings.ComputerName == "" {
+		return nil, fmt.Errorf("either %q or %q is required", windowsCustomizationSchemaComputerName, windowsCustomizationSchemaUnattendXML)
+	}
+
+	if settings.JoinDomain != "" && (settings.DomainAdminUser == "" || settings.DomainAdminPassword == "") {
+		return nil, fmt.Errorf("%q requires %q and %q", windowsCustomizationSchemaJoinDomain,
+			windowsCustomizationSchemaDomainAdminUser, windowsCustomizationSchemaDomainAdminPassword)
+	}
+
+	if password := data[windowsCustomizationSchemaAdminPassword].(string); password != "" {
+		settings.AdminPassword = encodeUnattendPassword(password, "AdministratorPassword")
+	}
+
+	var buf bytes.Buffer
+	if err := windowsUnattendTemplate.Execute(&buf, settings); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// applyWindowsCustomization attaches a CD with the answer file to the VM, which
+// Windows Setup picks up on the first boot of the VM.
+func applyWindowsCustomization(c *Connection, vm *VMDescriptor, data map[string]interface{}) error {
+	unattendXML, err := windowsUnattendXML(data)
+	if err != nil {
+		return err
+	}
+
+	image, err := buildISO9660("UNATTEND", map[string][]byte{
+		windowsCustomizationFileName: unattendXML,
+	})
+	if err != nil {
+		return err
+	}
+
+	sr, err := generatedMediaSR(c, data[windowsCustomizationSchemaSRUUID].(string))
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[DEBUG] Attaching Windows customization to VM %s", vm.UUID)
+	return attachGeneratedISO(c, vm, sr, windowsCustomizationPurpose, image)
+}
@@ -0,0 +1,98 @@
+package xenserver
+
+import (
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// XenCenter organizes VMs, networks and SRs in folders and custom fields, which
+// it keeps in their other_config. Like the declared keys of other_config, only
+// the declared folder and custom fields are managed.
+const (
+	xenCenterSchemaFolder       = "folder"
+	xenCenterSchemaCustomFields = "custom_fields"
+
+	// Path of the folder, e.g. /Production/Web
+	otherConfigFolder = "folder"
+	// Each custom field is stored under its name with this prefix
+	otherConfigCustomFieldPrefix = "XenCenter.CustomFields."
+)
+
+func xenCenterFolderSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeString,
+		Optional: true,
+	}
+}
+
+func xenCenterCustomFieldsSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeMap,
+		Optional: true,
+		Elem:     &schema.Schema{Type: schema.TypeString},
+	}
+}
+
+// xenCenterOtherConfig translates the folder and the custom fields into the
+// other_config keys XenCenter stores them in.
+func xenCenterOtherConfig(folder interface{}, customFields interface{}) map[string]interface{} {
+	otherConfig := make(map[string]interface{})
+
+	if folder, ok := folder.(string); ok && folder != "" {
+		otherConfig[otherConfigFolder] = folder
+	}
+
+	if customFields, ok := customFields.(map[string]interface{}); ok {
+		for k, v := range customFields {
+			otherConfig[otherConfigCustomFieldPrefix+k] = v
+		}
+	}
+
+	return otherConfig
+}
+
+// xenCenterMetadataChanged tells whether the folder or the custom fields differ
+// from the state.
+func xenCenterMetadataChanged(d *schema.ResourceData) bool {
+	return d.HasChange(xenCenterSchemaFolder) || d.HasChange(xenCenterSchemaCustomFields)
+}
+
+// mergeXenCenterMetadata applies the change of the folder and the custom fields
+// on top of the other_config current.
+func mergeXenCenterMetadata(current map[string]string, d *schema.ResourceData) map[string]string {
+	oFolder, nFolder := d.GetChange(xenCenterSchemaFolder)
+	oFields, nFields := d.GetChange(xenCenterSchemaCustomFields)
+
+	return mergeDeclaredKeys(current, xenCenterOtherConfig(oFolder, oFields), xenCenterOtherConfig(nFolder, nFields))
+}
+
+// readXenCenterMetadata sets the folder and the custom fields from the
+// other_config, as far as they are declared.
+func readXenCenterMetadata(d *schema.ResourceData, otherConfig map[string]string) error {
+	if d.Get(xenCenterSchemaFolder).(string) != "" {
+		if err := d.Set(xenCenterSchemaFolder, otherConfig[otherConfigFolder]); err != nil {
+			return err
+		}
+	}
+
+	customFields := make(map[string]string)
+	for k := range d.Get(xenCenterSchemaCustomFields).(map[string]interface{}) {
+		if v, ok := otherConfig[otherConfigCustomFieldPrefix+k]; ok {
+			customFields[k] = v
+		}
+	}
+
+	return d.Set(xenCenterSchemaCustomFields, customFields)
+}
+
+// xenCenterCustomFields returns all custom fields stored in the other_config.
+func xenCenterCustomFields(otherConfig map[string]string) map[string]string {
+	customFields := make(map[string]string)
+	for k, v := range otherConfig {
+		if strings.HasPrefix(k, otherConfigCustomFieldPrefix) {
+			customFields[strings.TrimPrefix(k, otherConfigCustomFieldPrefix)] = v
+		}
+	}
+	return customFields
+}